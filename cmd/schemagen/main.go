@@ -0,0 +1,44 @@
+// Command schemagen writes JSON Schemas for every message the agent publishes
+// Run via go generate ./... after changing a telemetry or reply struct
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"win-agent/internal/messages"
+	natsclient "win-agent/internal/nats"
+)
+
+func main() {
+	outDir := flag.String("out", "schemas", "Directory to write schema files to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", *outDir, err)
+	}
+
+	// Payload schemas, one file per schema name
+	for name, sample := range natsclient.MessageTypes() {
+		writeSchema(*outDir, name, messages.GenerateSchema(name, sample))
+	}
+
+	// The wrappers themselves; data is described by the payload schemas
+	writeSchema(*outDir, "envelope", messages.GenerateSchema("envelope", messages.Envelope{}))
+	writeSchema(*outDir, "cloudevent", messages.GenerateSchema("cloudevent", messages.CloudEvent{}))
+}
+
+// writeSchema writes one schema as indented JSON to {dir}/{name}.json
+func writeSchema(dir, name string, schema map[string]interface{}) {
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode schema %s: %v", name, err)
+	}
+	path := filepath.Join(dir, name+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/kardianos/service"
 	"win-agent/internal/agent"
+	"win-agent/internal/config"
 )
 
 var (
@@ -24,11 +28,27 @@ func main() {
 	// Parse command line flags
 	var configPath string
 	var svcFlag string
+	var setSecret string
 
-	flag.StringVar(&configPath, "config", "C:\\ProgramData\\WinAgent\\config.yaml", "Path to configuration file")
+	flag.StringVar(&configPath, "config", config.DefaultConfigFile(), "Path to configuration file")
 	flag.StringVar(&svcFlag, "service", "", "Control the system service: install, uninstall, start, stop, restart")
+	flag.StringVar(&setSecret, "set-secret", "", "Store a secret (value read from stdin) in the encrypted secrets store under this name")
 	flag.Parse()
 
+	// Store a secret and exit - value comes from stdin so it never appears in
+	// the process list or shell history
+	if setSecret != "" {
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value == "" {
+			log.Fatalf("Failed to read secret value from stdin: %v", err)
+		}
+		if err := config.StoreSecret(configPath, setSecret, strings.TrimRight(value, "\r\n")); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Secret %q stored\n", setSecret)
+		return
+	}
+
 	// Service configuration
 	svcConfig := &service.Config{
 		Name:        "win-agent",
@@ -6,7 +6,9 @@ import (
 	"os/signal"
 	"syscall"
 
+	"win-agent/internal/alerts"
 	"win-agent/internal/config"
+	"win-agent/internal/messages"
 	natsclient "win-agent/internal/nats"
 	"win-agent/internal/scheduler"
 	"win-agent/internal/tasks"
@@ -46,31 +48,73 @@ func New(configPath string, version string) (*Agent, error) {
 	// Create task executor with command timeout from config
 	executor := tasks.NewExecutor(logger, cfg.Commands.Timeout)
 
+	// First start with only a bootstrap token: enroll to obtain a device ID
+	// and credentials, then continue with those like any other agent
+	if cfg.NeedsEnrollment() {
+		logger.Info("Agent not enrolled, enrolling with bootstrap token...")
+
+		// Partial facts are still useful to the enrollment service
+		facts, err := executor.CollectInventory(version)
+		if err != nil {
+			logger.Warn("Inventory incomplete for enrollment", zap.Error(err))
+		}
+
+		if err := natsclient.Enroll(cfg, facts, version, logger); err != nil {
+			return nil, fmt.Errorf("failed to enroll: %w", err)
+		}
+	}
+
 	// Connect to NATS
 	logger.Info("Connecting to NATS...")
-	natsClient, err := natsclient.NewClient(&cfg.NATS, logger)
+	// Telemetry and replies are wrapped once the device_id is final (after enrollment)
+	wrapper, err := messages.NewWrapper(messages.Options{
+		Format:       cfg.Messages.Format,
+		Encoding:     cfg.Messages.Encoding,
+		Compression:  cfg.Messages.Compression,
+		DeviceID:     cfg.DeviceID,
+		AgentVersion: version,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure messages: %w", err)
+	}
+	natsClient, err := natsclient.NewClient(&cfg.NATS, wrapper, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 
-	// Create command handlers (now with NATS client for health checks and version)
-	handlers := natsclient.NewCommandHandlers(logger, cfg, executor, natsClient, version)
-
-	// Subscribe to commands
-	logger.Info("Subscribing to commands...")
-	if err := handlers.SubscribeAll(natsClient); err != nil {
+	// Make sure telemetry subjects land in a stream (provisioning it if configured)
+	if err := natsClient.EnsureStreams(cfg.SubjectPrefix, natsclient.TelemetrySubjects(cfg)); err != nil {
 		natsClient.Close()
-		return nil, fmt.Errorf("failed to subscribe to commands: %w", err)
+		return nil, fmt.Errorf("JetStream stream check failed: %w", err)
 	}
 
-	// Create and start scheduler
+	// Alert rules are shared by the scheduler (evaluation) and handlers (health)
+	var alertEvaluator *alerts.Evaluator
+	if cfg.Alerts.Enabled {
+		alertEvaluator = alerts.NewEvaluator(cfg.Alerts.Rules)
+		logger.Info("Alerting enabled", zap.Int("rules", len(cfg.Alerts.Rules)))
+	}
+
+	// Create the scheduler first: its recovery watchdog reports exhausted
+	// services in health
 	logger.Info("Starting scheduler...")
-	sched, err := scheduler.New(logger, natsClient, executor, cfg, version)
+	sched, err := scheduler.New(logger, natsClient, executor, alertEvaluator, cfg, version)
 	if err != nil {
 		natsClient.Close()
 		return nil, fmt.Errorf("failed to create scheduler: %w", err)
 	}
 
+	// Create command handlers (now with NATS client for health checks and version)
+	handlers := natsclient.NewCommandHandlers(logger, cfg, executor, natsClient, alertEvaluator, sched.Watchdog(), version)
+
+	// Register the command service
+	logger.Info("Registering command service...")
+	if err := handlers.RegisterService(natsClient); err != nil {
+		sched.Shutdown()
+		natsClient.Close()
+		return nil, fmt.Errorf("failed to register command service: %w", err)
+	}
+
 	return &Agent{
 		config:    cfg,
 		logger:    logger,
@@ -109,6 +153,11 @@ func (a *Agent) Shutdown() error {
 		a.logger.Error("Error shutting down scheduler", zap.Error(err))
 	}
 
+	// Stop accepting commands
+	if err := a.handlers.Stop(); err != nil {
+		a.logger.Error("Error stopping command service", zap.Error(err))
+	}
+
 	// Drain NATS connection (wait for in-flight messages)
 	if err := a.nats.Drain(a.config.NATS.DrainTimeout); err != nil {
 		a.logger.Error("Error draining NATS", zap.Error(err))
@@ -0,0 +1,311 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"win-agent/internal/config"
+	"win-agent/internal/tasks"
+)
+
+// Alert event types
+const (
+	EventFiring   = "alert_firing"
+	EventResolved = "alert_resolved"
+)
+
+// Alert states
+const (
+	statePending = "pending" // Condition holds, waiting for the rule's "for"
+	stateFiring  = "firing"
+)
+
+// Alert is an active alert as listed in health
+type Alert struct {
+	Rule      string   `json:"rule"`
+	Severity  string   `json:"severity"`
+	Target    string   `json:"target,omitempty"` // Drive or service the alert is about
+	Condition string   `json:"condition"`        // e.g. cpu_usage_percent > 90 for 3m0s
+	Value     *float64 `json:"value,omitempty"`  // Last observed value (metric rules), including 0
+	Status    string   `json:"status,omitempty"` // Last observed status (service rules)
+	Since     string   `json:"since"`            // When the alert started firing
+}
+
+// Event is published to {prefix}.{device_id}.alerts when an alert fires or resolves
+type Event struct {
+	Event string `json:"event"` // alert_firing, alert_resolved
+	Alert
+	Timestamp string `json:"timestamp"`
+}
+
+// instance tracks one rule for one target (e.g. disk_free_percent on C:)
+type instance struct {
+	rule       *config.AlertRule
+	target     string
+	state      string // "" (inactive), pending, firing
+	since      time.Time
+	clearSince time.Time
+	value      float64
+	status     string
+}
+
+// Evaluator evaluates alert rules against collected samples and keeps
+// firing/resolved state between them
+type Evaluator struct {
+	mu        sync.Mutex
+	rules     []config.AlertRule
+	instances map[string]*instance // rule name + target -> state
+}
+
+// NewEvaluator creates an evaluator for the configured rules
+func NewEvaluator(rules []config.AlertRule) *Evaluator {
+	return &Evaluator{
+		rules:     rules,
+		instances: make(map[string]*instance),
+	}
+}
+
+// ObserveMetrics evaluates metric rules against a sample
+// A nil evaluator (alerting disabled) never produces events
+func (e *Evaluator) ObserveMetrics(m *tasks.SystemMetrics, now time.Time) []Event {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []Event
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if rule.Metric == "" {
+			continue
+		}
+
+		if !config.IsDiskMetric(rule.Metric) {
+			value := systemValue(m, rule.Metric)
+			events = e.evaluate(events, rule, "", value, "", now)
+			continue
+		}
+
+		for _, disk := range m.Disks {
+			if rule.Disk != "" && rule.Disk != disk.Drive {
+				continue
+			}
+			events = e.evaluate(events, rule, disk.Drive, diskValue(&disk, rule.Metric), "", now)
+		}
+	}
+	return events
+}
+
+// ObserveServices evaluates service rules against a service check
+func (e *Evaluator) ObserveServices(statuses []tasks.ServiceStatus, now time.Time) []Event {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []Event
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if rule.Service == "" {
+			continue
+		}
+		for _, status := range statuses {
+			// Matched like service_check entries: case-insensitively on Windows
+			if config.ServiceKey(status.Name) == config.ServiceKey(rule.Service) {
+				events = e.evaluate(events, rule, rule.Service, 0, status.Status, now)
+			}
+		}
+	}
+	return events
+}
+
+// Active returns the currently firing alerts
+func (e *Evaluator) Active() []Alert {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var active []Alert
+	for _, inst := range e.instances {
+		if inst.state == stateFiring {
+			active = append(active, inst.alert())
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].Rule != active[j].Rule {
+			return active[i].Rule < active[j].Rule
+		}
+		return active[i].Target < active[j].Target
+	})
+	return active
+}
+
+// evaluate advances one instance's state machine and appends any event
+// Firing needs the condition to hold for rule.For; resolving needs the clear
+// condition (past clear_threshold) to hold for rule.ClearFor
+func (e *Evaluator) evaluate(events []Event, rule *config.AlertRule, target string, value float64, status string, now time.Time) []Event {
+	key := rule.Name + "/" + target
+	inst, ok := e.instances[key]
+	if !ok {
+		inst = &instance{rule: rule, target: target}
+		e.instances[key] = inst
+	}
+	inst.value = value
+	inst.status = status
+
+	firing, clear := conditions(rule, value, status)
+
+	switch inst.state {
+	case "":
+		if !firing {
+			return events
+		}
+		inst.state = statePending
+		inst.since = now
+		fallthrough
+
+	case statePending:
+		if !firing {
+			inst.state = ""
+			return events
+		}
+		if now.Sub(inst.since) < rule.For {
+			return events
+		}
+		inst.state = stateFiring
+		inst.since = now
+		inst.clearSince = time.Time{}
+		return append(events, inst.event(EventFiring, now))
+
+	case stateFiring:
+		if !clear {
+			inst.clearSince = time.Time{}
+			return events
+		}
+		if inst.clearSince.IsZero() {
+			inst.clearSince = now
+		}
+		if now.Sub(inst.clearSince) < rule.ClearFor {
+			return events
+		}
+		event := inst.event(EventResolved, now)
+		inst.state = ""
+		inst.clearSince = time.Time{}
+		return append(events, event)
+	}
+	return events
+}
+
+// conditions returns whether a rule's fire and clear conditions hold
+func conditions(rule *config.AlertRule, value float64, status string) (firing, clear bool) {
+	if rule.Service != "" {
+		firing = status != expectedStatus(rule)
+		return firing, !firing
+	}
+
+	clearThreshold := rule.Threshold
+	if rule.ClearThreshold != nil {
+		clearThreshold = *rule.ClearThreshold
+	}
+	return compare(rule.Op, value, rule.Threshold), !compare(rule.Op, value, clearThreshold)
+}
+
+// compare applies a rule operator
+func compare(op string, value, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// expectedStatus is the status a service rule expects (Running by default)
+func expectedStatus(rule *config.AlertRule) string {
+	if rule.Status == "" {
+		return "Running"
+	}
+	return rule.Status
+}
+
+// alert describes the instance for health and events
+func (inst *instance) alert() Alert {
+	severity := inst.rule.Severity
+	if severity == "" {
+		severity = config.AlertSeverityWarning
+	}
+	alert := Alert{
+		Rule:      inst.rule.Name,
+		Severity:  severity,
+		Target:    inst.target,
+		Condition: describe(inst.rule),
+		Since:     inst.since.UTC().Format(time.RFC3339),
+	}
+	if inst.rule.Service != "" {
+		alert.Status = inst.status
+	} else {
+		value := inst.value
+		alert.Value = &value
+	}
+	return alert
+}
+
+// event builds a firing or resolved event
+func (inst *instance) event(kind string, now time.Time) Event {
+	return Event{
+		Event:     kind,
+		Alert:     inst.alert(),
+		Timestamp: now.UTC().Format(time.RFC3339),
+	}
+}
+
+// describe renders a rule as a readable condition
+func describe(rule *config.AlertRule) string {
+	var condition string
+	if rule.Service != "" {
+		condition = fmt.Sprintf("service %s != %s", rule.Service, expectedStatus(rule))
+	} else {
+		condition = fmt.Sprintf("%s %s %v", rule.Metric, rule.Op, rule.Threshold)
+	}
+	if rule.For > 0 {
+		condition += " for " + rule.For.String()
+	}
+	return condition
+}
+
+// systemValue returns a host-wide metric from a sample
+func systemValue(m *tasks.SystemMetrics, metric string) float64 {
+	switch metric {
+	case "cpu_usage_percent":
+		return m.CPUUsagePercent
+	case "memory_free_gb":
+		return m.MemoryFreeGB
+	}
+	return 0
+}
+
+// diskValue returns a per-drive metric from a sample
+func diskValue(d *tasks.DiskMetrics, metric string) float64 {
+	switch metric {
+	case "disk_free_percent":
+		return d.FreePercent
+	case "disk_free_gb":
+		return d.FreeGB
+	case "disk_read_bytes_per_sec":
+		return d.ReadBytesPerSec
+	case "disk_write_bytes_per_sec":
+		return d.WriteBytesPerSec
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package alerts
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"win-agent/internal/config"
+	"win-agent/internal/tasks"
+)
+
+// TestMetricRuleHysteresis tests for/clear_for timing and the clear threshold
+func TestMetricRuleHysteresis(t *testing.T) {
+	clearAt := 80.0
+	e := NewEvaluator([]config.AlertRule{{
+		Name:           "high_cpu",
+		Metric:         "cpu_usage_percent",
+		Op:             ">",
+		Threshold:      90,
+		ClearThreshold: &clearAt,
+		For:            3 * time.Minute,
+		ClearFor:       time.Minute,
+	}})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cpu := func(v float64) *tasks.SystemMetrics { return &tasks.SystemMetrics{CPUUsagePercent: v} }
+
+	steps := []struct {
+		offset time.Duration
+		value  float64
+		want   string // expected event, "" for none
+		active int
+	}{
+		{0, 95, "", 0},                        // pending
+		{time.Minute, 50, "", 0},              // dropped below - pending resets
+		{2 * time.Minute, 95, "", 0},          // pending again
+		{4 * time.Minute, 96, "", 0},          // only 2m so far
+		{5 * time.Minute, 97, EventFiring, 1}, // held for 3m
+		{6 * time.Minute, 85, "", 1},          // below threshold but above clear threshold
+		{7 * time.Minute, 70, "", 1},          // clear condition starts
+		{7*time.Minute + 30*time.Second, 75, "", 1},
+		{8 * time.Minute, 60, EventResolved, 0}, // clear held for 1m
+	}
+
+	for i, step := range steps {
+		events := e.ObserveMetrics(cpu(step.value), start.Add(step.offset))
+		got := ""
+		if len(events) > 0 {
+			got = events[0].Event
+		}
+		if got != step.want || len(events) > 1 {
+			t.Fatalf("step %d (%v=%v): events = %+v, want %q", i, step.offset, step.value, events, step.want)
+		}
+		if active := len(e.Active()); active != step.active {
+			t.Fatalf("step %d: active = %d, want %d", i, active, step.active)
+		}
+	}
+}
+
+// TestDiskRulePerDrive tests that disk rules track each drive separately
+func TestDiskRulePerDrive(t *testing.T) {
+	e := NewEvaluator([]config.AlertRule{{
+		Name:      "low_disk",
+		Metric:    "disk_free_percent",
+		Op:        "<",
+		Threshold: 10,
+		Severity:  config.AlertSeverityCritical,
+	}})
+	sample := &tasks.SystemMetrics{Disks: []tasks.DiskMetrics{
+		{Drive: "C:", FreePercent: 5},
+		{Drive: "D:", FreePercent: 50},
+	}}
+
+	events := e.ObserveMetrics(sample, time.Now())
+	if len(events) != 1 || events[0].Target != "C:" || events[0].Severity != "critical" {
+		t.Fatalf("events = %+v, want one critical alert for C:", events)
+	}
+	if events[0].Condition != "disk_free_percent < 10" {
+		t.Errorf("condition = %q", events[0].Condition)
+	}
+}
+
+// TestZeroValueReported tests that a last observed value of 0 is kept
+func TestZeroValueReported(t *testing.T) {
+	e := NewEvaluator([]config.AlertRule{{
+		Name:      "disk_full",
+		Metric:    "disk_free_percent",
+		Op:        "<=",
+		Threshold: 0,
+	}})
+	sample := &tasks.SystemMetrics{Disks: []tasks.DiskMetrics{{Drive: "C:", FreePercent: 0}}}
+
+	events := e.ObserveMetrics(sample, time.Now())
+	if len(events) != 1 {
+		t.Fatalf("events = %+v, want one alert", events)
+	}
+	if events[0].Value == nil || *events[0].Value != 0 {
+		t.Errorf("value = %v, want 0", events[0].Value)
+	}
+}
+
+// TestServiceRule tests service state rules
+func TestServiceRule(t *testing.T) {
+	e := NewEvaluator([]config.AlertRule{{Name: "spooler_down", Service: "Spooler"}})
+	now := time.Now()
+
+	events := e.ObserveServices([]tasks.ServiceStatus{{Name: "Spooler", Status: "Stopped"}}, now)
+	if len(events) != 1 || events[0].Event != EventFiring || events[0].Status != "Stopped" {
+		t.Fatalf("events = %+v, want firing with status Stopped", events)
+	}
+	if events[0].Severity != config.AlertSeverityWarning {
+		t.Errorf("severity = %q, want default warning", events[0].Severity)
+	}
+
+	events = e.ObserveServices([]tasks.ServiceStatus{{Name: "Spooler", Status: "Running"}}, now.Add(time.Minute))
+	if len(events) != 1 || events[0].Event != EventResolved {
+		t.Fatalf("events = %+v, want resolved", events)
+	}
+}
+
+// TestServiceRuleCase tests service rules match names like service_check:
+// case-insensitively on Windows, exactly elsewhere
+func TestServiceRuleCase(t *testing.T) {
+	e := NewEvaluator([]config.AlertRule{{Name: "spooler_down", Service: "spooler"}})
+
+	events := e.ObserveServices([]tasks.ServiceStatus{{Name: "Spooler", Status: "Stopped"}}, time.Now())
+	if fired := len(events) == 1; fired != (runtime.GOOS == "windows") {
+		t.Errorf("events = %+v, want firing only on Windows", events)
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// AlertsConfig configures locally evaluated alert rules
+// Alerts are published to {prefix}.{device_id}.alerts and listed in health
+type AlertsConfig struct {
+	Enabled bool        `mapstructure:"enabled"`
+	Rules   []AlertRule `mapstructure:"rules"`
+}
+
+// AlertRule is one threshold or service state rule
+// Metric rules compare a system metric against Threshold; service rules fire
+// while a monitored service is not in Status
+type AlertRule struct {
+	Name     string `mapstructure:"name"`
+	Severity string `mapstructure:"severity"` // info, warning (default), critical
+
+	// Metric rules
+	Metric         string   `mapstructure:"metric"`          // e.g. cpu_usage_percent, disk_free_percent
+	Disk           string   `mapstructure:"disk"`            // Disk metrics: drive (e.g. "C:"), empty for every drive
+	Op             string   `mapstructure:"op"`              // >, >=, <, <=
+	Threshold      float64  `mapstructure:"threshold"`       // Fires when value op threshold
+	ClearThreshold *float64 `mapstructure:"clear_threshold"` // Resolves once past this value (default: threshold)
+
+	// Service rules
+	Service string `mapstructure:"service"`
+	Status  string `mapstructure:"status"` // Expected status (default Running)
+
+	// Hysteresis in time: the condition must hold this long to fire / to resolve
+	For      time.Duration `mapstructure:"for"`
+	ClearFor time.Duration `mapstructure:"clear_for"`
+}
+
+// Alert severities
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+// AlertMetrics are the metric names alert rules can use
+// Disk metrics are evaluated per drive
+var AlertMetrics = map[string]bool{
+	"cpu_usage_percent":        false,
+	"memory_free_gb":           false,
+	"disk_free_percent":        true,
+	"disk_free_gb":             true,
+	"disk_read_bytes_per_sec":  true,
+	"disk_write_bytes_per_sec": true,
+}
+
+// IsDiskMetric reports whether an alert metric is evaluated per drive
+func IsDiskMetric(metric string) bool {
+	return AlertMetrics[metric]
+}
+
+// validateAlerts checks alert rules against the tasks that feed them
+func validateAlerts(cfg *AlertsConfig, tasks *TasksConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("alerts.rules[%d]: name is required", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("alerts.rules[%d]: duplicate rule name %q", i, rule.Name)
+		}
+		names[rule.Name] = true
+
+		if err := validateAlertRule(rule, tasks); err != nil {
+			return fmt.Errorf("alert rule %q: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateAlertRule checks one rule
+func validateAlertRule(rule *AlertRule, tasks *TasksConfig) error {
+	switch rule.Severity {
+	case "", AlertSeverityInfo, AlertSeverityWarning, AlertSeverityCritical:
+	default:
+		return fmt.Errorf("invalid severity: %s (must be info, warning, or critical)", rule.Severity)
+	}
+	if rule.For < 0 || rule.ClearFor < 0 {
+		return fmt.Errorf("for and clear_for cannot be negative")
+	}
+
+	if (rule.Metric == "") == (rule.Service == "") {
+		return fmt.Errorf("exactly one of metric or service is required")
+	}
+
+	if rule.Service != "" {
+		if !tasks.ServiceCheck.Enabled || !isMonitoredService(tasks.ServiceCheck.Services, rule.Service) {
+			return fmt.Errorf("service %s must be listed in tasks.service_check.services", rule.Service)
+		}
+		return nil
+	}
+
+	perDisk, known := AlertMetrics[rule.Metric]
+	if !known {
+		return fmt.Errorf("unknown metric: %s", rule.Metric)
+	}
+	if rule.Disk != "" && !perDisk {
+		return fmt.Errorf("disk can only be set for disk metrics")
+	}
+	if !tasks.SystemMetrics.Enabled {
+		return fmt.Errorf("metric rules require tasks.system_metrics to be enabled")
+	}
+
+	switch rule.Op {
+	case ">", ">=":
+		if rule.ClearThreshold != nil && *rule.ClearThreshold > rule.Threshold {
+			return fmt.Errorf("clear_threshold (%v) must not be above threshold (%v) for %s", *rule.ClearThreshold, rule.Threshold, rule.Op)
+		}
+	case "<", "<=":
+		if rule.ClearThreshold != nil && *rule.ClearThreshold < rule.Threshold {
+			return fmt.Errorf("clear_threshold (%v) must not be below threshold (%v) for %s", *rule.ClearThreshold, rule.Threshold, rule.Op)
+		}
+	default:
+		return fmt.Errorf("invalid op: %q (must be >, >=, <, or <=)", rule.Op)
+	}
+	return nil
+}
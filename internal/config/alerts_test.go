@@ -0,0 +1,100 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// TestValidateAlerts tests alert rule validation
+func TestValidateAlerts(t *testing.T) {
+	tasks := &TasksConfig{
+		SystemMetrics: SystemMetricsConfig{Enabled: true, Interval: time.Minute},
+		ServiceCheck:  ServiceCheckConfig{Enabled: true, Interval: time.Minute, Services: []string{"Spooler"}},
+	}
+	clear := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		rules   []AlertRule
+		errText string
+	}{
+		{
+			name: "valid metric, disk and service rules",
+			rules: []AlertRule{
+				{Name: "cpu", Metric: "cpu_usage_percent", Op: ">", Threshold: 90, ClearThreshold: clear(80), For: 3 * time.Minute},
+				{Name: "disk", Metric: "disk_free_percent", Disk: "C:", Op: "<", Threshold: 10, ClearThreshold: clear(15), Severity: "critical"},
+				{Name: "spooler", Service: "Spooler"},
+			},
+		},
+		{
+			name:    "missing name",
+			rules:   []AlertRule{{Metric: "cpu_usage_percent", Op: ">"}},
+			errText: "name is required",
+		},
+		{
+			name: "duplicate name",
+			rules: []AlertRule{
+				{Name: "cpu", Metric: "cpu_usage_percent", Op: ">"},
+				{Name: "cpu", Metric: "memory_free_gb", Op: "<"},
+			},
+			errText: "duplicate rule name",
+		},
+		{
+			name:    "metric and service",
+			rules:   []AlertRule{{Name: "x", Metric: "cpu_usage_percent", Service: "Spooler", Op: ">"}},
+			errText: "exactly one of metric or service",
+		},
+		{
+			name:    "unknown metric",
+			rules:   []AlertRule{{Name: "x", Metric: "gpu_percent", Op: ">"}},
+			errText: "unknown metric",
+		},
+		{
+			name:    "disk on non-disk metric",
+			rules:   []AlertRule{{Name: "x", Metric: "cpu_usage_percent", Disk: "C:", Op: ">"}},
+			errText: "disk can only be set",
+		},
+		{
+			name:    "invalid op",
+			rules:   []AlertRule{{Name: "x", Metric: "cpu_usage_percent", Op: "=="}},
+			errText: "invalid op",
+		},
+		{
+			name:    "clear threshold on wrong side",
+			rules:   []AlertRule{{Name: "x", Metric: "cpu_usage_percent", Op: ">", Threshold: 90, ClearThreshold: clear(95)}},
+			errText: "must not be above threshold",
+		},
+		{
+			name:    "unmonitored service",
+			rules:   []AlertRule{{Name: "x", Service: "W32Time"}},
+			errText: "must be listed in tasks.service_check.services",
+		},
+		{
+			name:    "invalid severity",
+			rules:   []AlertRule{{Name: "x", Service: "Spooler", Severity: "page"}},
+			errText: "invalid severity",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAlerts(&AlertsConfig{Enabled: true, Rules: tt.rules}, tasks)
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateAlerts() error = %v", err)
+				}
+				return
+			}
+			if err == nil || indexOf(err.Error(), tt.errText) < 0 {
+				t.Errorf("validateAlerts() error = %v, want error containing %q", err, tt.errText)
+			}
+		})
+	}
+
+	// Metric rules need the metrics task
+	noMetrics := &TasksConfig{}
+	err := validateAlerts(&AlertsConfig{Enabled: true, Rules: []AlertRule{{Name: "x", Metric: "cpu_usage_percent", Op: ">"}}}, noMetrics)
+	if err == nil || indexOf(err.Error(), "system_metrics") < 0 {
+		t.Errorf("validateAlerts() without metrics error = %v, want system_metrics error", err)
+	}
+}
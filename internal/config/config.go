@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -11,12 +13,31 @@ import (
 
 // Config represents the complete agent configuration
 type Config struct {
-	DeviceID      string         `mapstructure:"device_id"`
-	SubjectPrefix string         `mapstructure:"subject_prefix"`
-	NATS          NATSConfig     `mapstructure:"nats"`
-	Tasks         TasksConfig    `mapstructure:"tasks"`
-	Commands      CommandsConfig `mapstructure:"commands"`
-	Logging       LoggingConfig  `mapstructure:"logging"`
+	DeviceID      string           `mapstructure:"device_id"`      // Literal ID, "hostname", "machine-id" or a template
+	DeviceIDFile  string           `mapstructure:"device_id_file"` // Where a derived device_id is persisted
+	SubjectPrefix string           `mapstructure:"subject_prefix"`
+	NATS          NATSConfig       `mapstructure:"nats"`
+	Tasks         TasksConfig      `mapstructure:"tasks"`
+	Commands      CommandsConfig   `mapstructure:"commands"`
+	Logging       LoggingConfig    `mapstructure:"logging"`
+	Secrets       SecretsConfig    `mapstructure:"secrets"`
+	Enrollment    EnrollmentConfig `mapstructure:"enrollment"`
+	Messages      MessagesConfig   `mapstructure:"messages"`
+	Alerts        AlertsConfig     `mapstructure:"alerts"`
+
+	// Tags place the agent in command groups, e.g. site: hq, role: kiosk
+	// Each tag subscribes to {prefix}.group.{tag}.{value}.cmd.*
+	Tags map[string]string `mapstructure:"tags"`
+
+	// SecretSources records which fields were resolved from a secret reference
+	// (field name -> "env", "file" or "store"); the values themselves are never kept here
+	SecretSources map[string]string `mapstructure:"-"`
+
+	// DeviceIDSource is the source or template a derived device_id came from
+	DeviceIDSource string `mapstructure:"-"`
+
+	// Enrolled is true once a persisted enrollment has been applied
+	Enrolled bool `mapstructure:"-"`
 }
 
 // NATSConfig holds NATS connection settings
@@ -27,9 +48,19 @@ type NATSConfig struct {
 	MaxReconnects int           `mapstructure:"max_reconnects"`
 	ReconnectWait time.Duration `mapstructure:"reconnect_wait"`
 	DrainTimeout  time.Duration `mapstructure:"drain_timeout"`
+
+	// Stream controls JetStream stream validation/provisioning at startup
+	Stream StreamConfig `mapstructure:"stream"`
+
+	// SequenceFile persists per-subject telemetry sequence numbers across restarts
+	SequenceFile string `mapstructure:"sequence_file"`
+
+	// CertExpiryWarning is how far ahead of expiry creds and certificates are reported
+	CertExpiryWarning time.Duration `mapstructure:"cert_expiry_warning"`
 }
 
 // AuthConfig holds NATS authentication credentials
+// Token, Username and Password accept secret references (env:, file:, secret:)
 type AuthConfig struct {
 	Type      string `mapstructure:"type"`       // creds, token, userpass, none
 	CredsFile string `mapstructure:"creds_file"` // for creds auth
@@ -47,12 +78,35 @@ type TLSConfig struct {
 	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Skip server certificate verification (NOT recommended for production)
 }
 
+// Stream modes
+const (
+	StreamModeOff       = "off"       // No checks
+	StreamModeValidate  = "validate"  // Check a stream captures every telemetry subject
+	StreamModeProvision = "provision" // Create or update the configured stream, then validate
+)
+
+// StreamConfig configures the JetStream stream that stores telemetry
+type StreamConfig struct {
+	Mode      string        `mapstructure:"mode"`       // off, validate, provision
+	OnMissing string        `mapstructure:"on_missing"` // fail or degrade when a subject has no stream
+	Name      string        `mapstructure:"name"`       // Stream name (provision mode)
+	Subjects  []string      `mapstructure:"subjects"`   // Defaults to the agent telemetry subjects under subject_prefix
+	Retention string        `mapstructure:"retention"`  // limits, interest, workqueue
+	Storage   string        `mapstructure:"storage"`    // file, memory
+	MaxAge    time.Duration `mapstructure:"max_age"`    // 0 = unlimited
+	Replicas  int           `mapstructure:"replicas"`
+}
+
 // TasksConfig holds scheduled task configurations
 type TasksConfig struct {
 	Heartbeat     HeartbeatConfig     `mapstructure:"heartbeat"`
 	SystemMetrics SystemMetricsConfig `mapstructure:"system_metrics"`
 	ServiceCheck  ServiceCheckConfig  `mapstructure:"service_check"`
+	ProcessCheck  ProcessCheckConfig  `mapstructure:"process_check"`
 	Inventory     InventoryConfig     `mapstructure:"inventory"`
+
+	// ScrapeTargets are additional exporters published as telemetry.{name}
+	ScrapeTargets []ScrapeTarget `mapstructure:"scrape_targets"`
 }
 
 // HeartbeatConfig configures the heartbeat task
@@ -66,28 +120,68 @@ type SystemMetricsConfig struct {
 	Enabled     bool          `mapstructure:"enabled"`
 	Interval    time.Duration `mapstructure:"interval"`
 	ExporterURL string        `mapstructure:"exporter_url"`
+
+	// Source is where metrics come from: "prometheus" scrapes exporter_url,
+	// "native" reads OS counters directly (no windows_exporter needed)
+	Source string `mapstructure:"source"`
+
+	// SampleInterval enables fast local sampling; each publish then carries
+	// min/max/avg/p95 over the samples taken since the last one (0 = off)
+	SampleInterval time.Duration `mapstructure:"sample_interval"`
+
+	// Custom maps extra exporter families into the custom section
+	Custom []CustomMetric `mapstructure:"custom"`
+
+	// StateFile persists counter baselines so rates survive a restart ("" = off)
+	// StateMaxAge is how old a saved baseline may be and still be restored
+	StateFile   string        `mapstructure:"state_file"`
+	StateMaxAge time.Duration `mapstructure:"state_max_age"`
 }
 
 // ServiceCheckConfig configures service status monitoring
 type ServiceCheckConfig struct {
 	Enabled  bool          `mapstructure:"enabled"`
 	Interval time.Duration `mapstructure:"interval"`
-	Services []string      `mapstructure:"services"`
+
+	// Services are exact names or glob patterns (e.g. "MSSQL$*") that are
+	// expanded again on every check
+	Services []string `mapstructure:"services"`
+
+	// Mode "changes" publishes state transitions as events and the full list
+	// only every KeyframeInterval; "full" (default) publishes the list every check
+	Mode             string        `mapstructure:"mode"`
+	KeyframeInterval time.Duration `mapstructure:"keyframe_interval"`
+
+	// Recovery restarts listed services that stop running
+	Recovery []RecoveryPolicy `mapstructure:"recovery"`
 }
 
 // InventoryConfig configures system inventory reporting
 type InventoryConfig struct {
 	Enabled  bool          `mapstructure:"enabled"`
 	Interval time.Duration `mapstructure:"interval"`
+
+	// Mode "changes" publishes diffs against the last published inventory and a
+	// full inventory only every KeyframeInterval; "full" (default) always sends it all
+	Mode             string        `mapstructure:"mode"`
+	KeyframeInterval time.Duration `mapstructure:"keyframe_interval"`
 }
 
+// Publish modes for service_check and inventory
+const (
+	PublishModeFull    = "full"
+	PublishModeChanges = "changes"
+)
+
 // CommandsConfig holds command execution settings
 type CommandsConfig struct {
 	ScriptsDirectory string        `mapstructure:"scripts_directory"` // Directory containing allowed PowerShell scripts
 	AllowedServices  []string      `mapstructure:"allowed_services"`
 	AllowedCommands  []string      `mapstructure:"allowed_commands"`
 	AllowedLogPaths  []string      `mapstructure:"allowed_log_paths"`
-	Timeout          time.Duration `mapstructure:"timeout"` // Command execution timeout
+	AllowedProcesses []string      `mapstructure:"allowed_processes"` // Executable names cmd.process.kill may terminate
+	Timeout          time.Duration `mapstructure:"timeout"`           // Command execution timeout
+	Broadcast        bool          `mapstructure:"broadcast"`         // Also accept commands on {prefix}.all.cmd.*
 }
 
 // LoggingConfig holds logging settings
@@ -98,6 +192,26 @@ type LoggingConfig struct {
 	MaxBackups int    `mapstructure:"max_backups"`
 }
 
+// MessagesConfig controls how telemetry and command replies are wrapped
+type MessagesConfig struct {
+	// Format is envelope (default), cloudevents, or raw (bare payloads, as before envelopes)
+	Format string `mapstructure:"format"`
+
+	// Encoding is json (default), msgpack, or protobuf; advertised in the Content-Type header
+	Encoding string `mapstructure:"encoding"`
+
+	// Compression is none (default), gzip, or zstd; advertised in the Content-Encoding header
+	Compression string `mapstructure:"compression"`
+}
+
+// SecretsConfig configures the agent-local encrypted secrets store
+// used to resolve "secret:<name>" references
+type SecretsConfig struct {
+	StoreFile      string `mapstructure:"store_file"`      // Encrypted secrets file
+	KeySource      string `mapstructure:"key_source"`      // machine or passphrase_file
+	PassphraseFile string `mapstructure:"passphrase_file"` // Required when key_source is passphrase_file
+}
+
 // Load reads and parses the configuration file
 func Load(configPath string) (*Config, error) {
 	v := viper.New()
@@ -119,6 +233,26 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	// Apply a persisted enrollment first so the bootstrap token is not
+	// resolved (or required) once the agent has its own credentials
+	if err := applyEnrollmentState(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to load enrollment: %w", err)
+	}
+
+	// Derive device_id from the host when it names a source or template
+	// (an agent waiting to enroll is issued its ID instead)
+	if !cfg.NeedsEnrollment() {
+		if err := resolveDeviceID(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Resolve secret references before validation so required-field checks
+	// see the real values
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
 	// Validate configuration
 	if err := validate(&cfg); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
@@ -127,15 +261,57 @@ func Load(configPath string) (*Config, error) {
 	return &cfg, nil
 }
 
+// DefaultConfigFile is where the agent looks for its config without -config
+func DefaultConfigFile() string {
+	if runtime.GOOS == "windows" {
+		return `C:\ProgramData\WinAgent\config.yaml`
+	}
+	return "/etc/win-agent/config.yaml"
+}
+
+// defaultFiles returns the default state and log file locations for an OS:
+// C:\ProgramData\WinAgent on Windows, /var/lib/win-agent and /var/log/win-agent elsewhere
+func defaultFiles(goos string) map[string]string {
+	dataDir, logFile, sep := "/var/lib/win-agent", "/var/log/win-agent/agent.log", "/"
+	if goos == "windows" {
+		dataDir, logFile, sep = `C:\ProgramData\WinAgent`, `C:\ProgramData\WinAgent\agent.log`, `\`
+	}
+	return map[string]string{
+		"device_id_file":                  dataDir + sep + "device_id.json",
+		"nats.sequence_file":              dataDir + sep + "sequences.json",
+		"tasks.system_metrics.state_file": dataDir + sep + "metrics_state.json",
+		"logging.file":                    logFile,
+		"secrets.store_file":              dataDir + sep + "secrets.json",
+		"enrollment.creds_file":           dataDir + sep + "device.creds",
+		"enrollment.state_file":           dataDir + sep + "enrollment.json",
+	}
+}
+
 // setDefaults sets sensible default values
 func setDefaults(v *viper.Viper) {
+	files := defaultFiles(runtime.GOOS)
+
 	// Subject prefix default
 	v.SetDefault("subject_prefix", "agents")
 
+	// Derived device_id persistence
+	v.SetDefault("device_id_file", files["device_id_file"])
+
 	// NATS defaults
 	v.SetDefault("nats.max_reconnects", -1) // infinite
 	v.SetDefault("nats.reconnect_wait", "2s")
 	v.SetDefault("nats.drain_timeout", "30s")
+	v.SetDefault("nats.cert_expiry_warning", "336h") // 14 days
+	v.SetDefault("nats.sequence_file", files["nats.sequence_file"])
+
+	// Stream defaults
+	v.SetDefault("nats.stream.mode", StreamModeValidate)
+	v.SetDefault("nats.stream.on_missing", "degrade")
+	v.SetDefault("nats.stream.name", "AGENTS")
+	v.SetDefault("nats.stream.retention", "limits")
+	v.SetDefault("nats.stream.storage", "file")
+	v.SetDefault("nats.stream.max_age", "168h") // 7 days
+	v.SetDefault("nats.stream.replicas", 1)
 
 	// TLS defaults
 	v.SetDefault("nats.tls.enabled", false)
@@ -147,34 +323,107 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("tasks.system_metrics.enabled", true)
 	v.SetDefault("tasks.system_metrics.interval", "5m")
 	v.SetDefault("tasks.system_metrics.exporter_url", "http://localhost:9182/metrics")
+	v.SetDefault("tasks.system_metrics.source", MetricsSourcePrometheus)
+	v.SetDefault("tasks.system_metrics.state_file", files["tasks.system_metrics.state_file"])
+	v.SetDefault("tasks.system_metrics.state_max_age", "15m")
 	v.SetDefault("tasks.service_check.enabled", true)
 	v.SetDefault("tasks.service_check.interval", "1m")
+	v.SetDefault("tasks.service_check.mode", PublishModeFull)
+	v.SetDefault("tasks.service_check.keyframe_interval", "1h")
+	v.SetDefault("tasks.process_check.enabled", false)
+	v.SetDefault("tasks.process_check.interval", "1m")
 	v.SetDefault("tasks.inventory.enabled", true)
 	v.SetDefault("tasks.inventory.interval", "24h")
+	v.SetDefault("tasks.inventory.mode", PublishModeFull)
+	v.SetDefault("tasks.inventory.keyframe_interval", "168h")
 
 	// Command defaults
 	v.SetDefault("commands.timeout", "30s")
+	v.SetDefault("commands.broadcast", false)
 	v.SetDefault("commands.scripts_directory", "") // Empty by default - feature is optional
 
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
-	v.SetDefault("logging.file", "C:\\ProgramData\\WinAgent\\agent.log")
+	v.SetDefault("logging.file", files["logging.file"])
 	v.SetDefault("logging.max_size_mb", 100)
 	v.SetDefault("logging.max_backups", 3)
+
+	// Alert defaults
+	v.SetDefault("alerts.enabled", false)
+
+	// Message defaults
+	v.SetDefault("messages.format", "envelope")
+	v.SetDefault("messages.encoding", "json")
+	v.SetDefault("messages.compression", "none")
+
+	// Secrets store defaults
+	v.SetDefault("secrets.store_file", files["secrets.store_file"])
+	v.SetDefault("secrets.key_source", KeySourceMachine)
+
+	// Enrollment defaults
+	v.SetDefault("enrollment.enabled", false)
+	v.SetDefault("enrollment.subject", "agents.enroll")
+	v.SetDefault("enrollment.timeout", "30s")
+	v.SetDefault("enrollment.creds_file", files["enrollment.creds_file"])
+	v.SetDefault("enrollment.state_file", files["enrollment.state_file"])
+}
+
+// Subject tokens used for fleet command subjects; device IDs may not use them
+const (
+	BroadcastSubjectToken = "all"
+	GroupSubjectToken     = "group"
+)
+
+// validDeviceID matches device IDs that are safe to use as a NATS subject token
+var validDeviceID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// ValidDeviceID reports whether id contains only alphanumeric characters, dashes and underscores
+func ValidDeviceID(id string) bool {
+	return validDeviceID.MatchString(id)
+}
+
+// ReservedDeviceID reports whether id is a fleet command token, which shares
+// the device position in command subjects
+func ReservedDeviceID(id string) bool {
+	return id == BroadcastSubjectToken || id == GroupSubjectToken
 }
 
 // validate checks that required fields are present and valid
 func validate(cfg *Config) error {
-	// Validate device_id is present
-	if cfg.DeviceID == "" {
-		return fmt.Errorf("device_id is required")
+	// Validate enrollment settings
+	if err := validateEnrollment(&cfg.Enrollment); err != nil {
+		return err
+	}
+
+	// An agent waiting to enroll has no device_id or credentials yet,
+	// only the bootstrap token it will exchange for them
+	if cfg.NeedsEnrollment() {
+		if cfg.Enrollment.BootstrapToken == "" {
+			return fmt.Errorf("enrollment.bootstrap_token is required until the agent has enrolled")
+		}
+	} else {
+		// Validate device_id is present
+		if cfg.DeviceID == "" {
+			return fmt.Errorf("device_id is required")
+		}
+
+		// Validate device_id format (alphanumeric, dash, underscore only)
+		// This ensures compatibility with NATS subject names
+		if !ValidDeviceID(cfg.DeviceID) {
+			return fmt.Errorf("device_id must contain only alphanumeric characters, dashes, and underscores (got: %s)", cfg.DeviceID)
+		}
+
+		// The broadcast and group tokens share the device position in the subject
+		if ReservedDeviceID(cfg.DeviceID) {
+			return fmt.Errorf("device_id %q is reserved for fleet command subjects", cfg.DeviceID)
+		}
 	}
 
-	// Validate device_id format (alphanumeric, dash, underscore only)
-	// This ensures compatibility with NATS subject names
-	validDeviceID := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
-	if !validDeviceID.MatchString(cfg.DeviceID) {
-		return fmt.Errorf("device_id must contain only alphanumeric characters, dashes, and underscores (got: %s)", cfg.DeviceID)
+	// Validate tags - both name and value become subject tokens
+	for name, value := range cfg.Tags {
+		if !ValidDeviceID(name) || !ValidDeviceID(value) {
+			return fmt.Errorf("tag %s=%s must contain only alphanumeric characters, dashes, and underscores", name, value)
+		}
 	}
 
 	// Validate subject_prefix format
@@ -194,28 +443,30 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("at least one NATS URL is required")
 	}
 
-	// Validate NATS auth
-	switch cfg.NATS.Auth.Type {
-	case "creds":
-		if cfg.NATS.Auth.CredsFile == "" {
-			return fmt.Errorf("creds_file is required for creds auth type")
-		}
-		// Verify credentials file exists
-		if _, err := os.Stat(cfg.NATS.Auth.CredsFile); err != nil {
-			return fmt.Errorf("credentials file not found: %s (%w)", cfg.NATS.Auth.CredsFile, err)
-		}
-	case "token":
-		if cfg.NATS.Auth.Token == "" {
-			return fmt.Errorf("token is required for token auth type")
-		}
-	case "userpass":
-		if cfg.NATS.Auth.Username == "" || cfg.NATS.Auth.Password == "" {
-			return fmt.Errorf("username and password are required for userpass auth type")
+	// Validate NATS auth (an agent waiting to enroll authenticates with the bootstrap token)
+	if !cfg.NeedsEnrollment() {
+		if err := validateAuth(&cfg.NATS.Auth); err != nil {
+			return err
 		}
-	case "none":
-		// No validation needed
-	default:
-		return fmt.Errorf("invalid auth type: %s (must be creds, token, userpass, or none)", cfg.NATS.Auth.Type)
+	}
+
+	if cfg.NATS.CertExpiryWarning < 0 {
+		return fmt.Errorf("nats.cert_expiry_warning cannot be negative")
+	}
+
+	// Validate stream settings
+	if err := validateStream(&cfg.NATS.Stream); err != nil {
+		return err
+	}
+
+	// Validate message settings
+	if err := validateMessages(&cfg.Messages); err != nil {
+		return err
+	}
+
+	// Validate secrets store settings
+	if err := validateSecrets(&cfg.Secrets); err != nil {
+		return err
 	}
 
 	// Validate TLS configuration
@@ -264,10 +515,45 @@ func validate(cfg *Config) error {
 		}
 	}
 
+	// Process kill allow list holds bare executable names
+	for _, name := range cfg.Commands.AllowedProcesses {
+		if name == "" || strings.ContainsAny(name, `/\*?`) {
+			return fmt.Errorf("invalid allowed_processes entry %q (must be an executable name such as app.exe)", name)
+		}
+	}
+
 	// Validate service check has services if enabled
 	if cfg.Tasks.ServiceCheck.Enabled && len(cfg.Tasks.ServiceCheck.Services) == 0 {
 		return fmt.Errorf("at least one service must be specified when service_check is enabled")
 	}
+	if err := validateServicePatterns(cfg.Tasks.ServiceCheck.Services); err != nil {
+		return err
+	}
+
+	// Validate alert rules
+	if err := validateAlerts(&cfg.Alerts, &cfg.Tasks); err != nil {
+		return err
+	}
+
+	// Validate service recovery policies
+	if err := validateRecovery(&cfg.Tasks.ServiceCheck, cfg.Commands.ScriptsDirectory); err != nil {
+		return err
+	}
+
+	// Validate process monitoring
+	if err := validateProcessCheck(&cfg.Tasks.ProcessCheck, cfg.Commands.ScriptsDirectory); err != nil {
+		return err
+	}
+
+	// Validate publish modes
+	if err := validatePublishMode("service_check", cfg.Tasks.ServiceCheck.Mode,
+		cfg.Tasks.ServiceCheck.Interval, cfg.Tasks.ServiceCheck.KeyframeInterval); err != nil {
+		return err
+	}
+	if err := validatePublishMode("inventory", cfg.Tasks.Inventory.Mode,
+		cfg.Tasks.Inventory.Interval, cfg.Tasks.Inventory.KeyframeInterval); err != nil {
+		return err
+	}
 
 	// Validate task intervals are sensible
 	if cfg.Tasks.Heartbeat.Enabled && cfg.Tasks.Heartbeat.Interval < 10*time.Second {
@@ -278,6 +564,31 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("system_metrics interval must be at least 30 seconds (got: %v)", cfg.Tasks.SystemMetrics.Interval)
 	}
 
+	if sample := cfg.Tasks.SystemMetrics.SampleInterval; cfg.Tasks.SystemMetrics.Enabled && sample != 0 {
+		if sample < 5*time.Second {
+			return fmt.Errorf("system_metrics sample_interval must be at least 5 seconds (got: %v)", sample)
+		}
+		if sample >= cfg.Tasks.SystemMetrics.Interval {
+			return fmt.Errorf("system_metrics sample_interval (%v) must be shorter than interval (%v)", sample, cfg.Tasks.SystemMetrics.Interval)
+		}
+	}
+
+	if cfg.Tasks.SystemMetrics.Enabled {
+		if err := validateMetricsSource(&cfg.Tasks.SystemMetrics); err != nil {
+			return err
+		}
+		if err := validateCustomMetrics("system_metrics.custom", cfg.Tasks.SystemMetrics.Custom); err != nil {
+			return err
+		}
+		if cfg.Tasks.SystemMetrics.StateFile != "" && cfg.Tasks.SystemMetrics.StateMaxAge <= 0 {
+			return fmt.Errorf("system_metrics state_max_age must be positive when state_file is set")
+		}
+	}
+
+	if err := validateScrapeTargets(cfg.Tasks.ScrapeTargets); err != nil {
+		return err
+	}
+
 	// Validate heartbeat is more frequent than metrics (best practice)
 	// Heartbeat should be MORE frequent, meaning a SMALLER interval duration
 	if cfg.Tasks.Heartbeat.Enabled && cfg.Tasks.SystemMetrics.Enabled {
@@ -328,7 +639,7 @@ func validateSubjectPrefix(prefix string) error {
 
 	// Split into tokens by dots
 	tokens := regexp.MustCompile(`\.`).Split(prefix, -1)
-	
+
 	// Validate each token
 	validToken := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 	for i, token := range tokens {
@@ -342,3 +653,112 @@ func validateSubjectPrefix(prefix string) error {
 
 	return nil
 }
+
+// validateAuth checks the NATS authentication settings
+func validateAuth(auth *AuthConfig) error {
+	switch auth.Type {
+	case "creds":
+		if auth.CredsFile == "" {
+			return fmt.Errorf("creds_file is required for creds auth type")
+		}
+		// Verify credentials file exists
+		if _, err := os.Stat(auth.CredsFile); err != nil {
+			return fmt.Errorf("credentials file not found: %s (%w)", auth.CredsFile, err)
+		}
+	case "token":
+		if auth.Token == "" {
+			return fmt.Errorf("token is required for token auth type")
+		}
+	case "userpass":
+		if auth.Username == "" || auth.Password == "" {
+			return fmt.Errorf("username and password are required for userpass auth type")
+		}
+	case "none":
+		// No validation needed
+	default:
+		return fmt.Errorf("invalid auth type: %s (must be creds, token, userpass, or none)", auth.Type)
+	}
+
+	return nil
+}
+
+// validatePublishMode checks a task's publish mode and keyframe interval
+// An empty mode is treated as full so configs built in code need not set it
+func validatePublishMode(task, mode string, interval, keyframe time.Duration) error {
+	switch mode {
+	case "", PublishModeFull:
+		return nil
+	case PublishModeChanges:
+	default:
+		return fmt.Errorf("invalid tasks.%s.mode: %s (must be full or changes)", task, mode)
+	}
+	if keyframe < interval {
+		return fmt.Errorf("tasks.%s.keyframe_interval (%v) must be at least the task interval (%v)", task, keyframe, interval)
+	}
+	return nil
+}
+
+// validateMessages checks the message format and encoding settings
+// Empty values take the defaults so configs built in code need no messages section
+func validateMessages(cfg *MessagesConfig) error {
+	switch cfg.Format {
+	case "", "envelope", "cloudevents", "raw":
+	default:
+		return fmt.Errorf("invalid messages.format: %s (must be envelope, cloudevents, or raw)", cfg.Format)
+	}
+	switch cfg.Encoding {
+	case "", "json", "msgpack", "protobuf":
+	default:
+		return fmt.Errorf("invalid messages.encoding: %s (must be json, msgpack, or protobuf)", cfg.Encoding)
+	}
+	switch cfg.Compression {
+	case "", "none", "gzip", "zstd":
+	default:
+		return fmt.Errorf("invalid messages.compression: %s (must be none, gzip, or zstd)", cfg.Compression)
+	}
+	if cfg.Format == "cloudevents" && cfg.Encoding == "protobuf" {
+		return fmt.Errorf("messages.format cloudevents supports json and msgpack encodings only")
+	}
+	return nil
+}
+
+// validateStream checks the JetStream stream settings
+// An empty mode is treated as off so configs built in code need no stream section
+func validateStream(cfg *StreamConfig) error {
+	switch cfg.Mode {
+	case "", StreamModeOff:
+		return nil
+	case StreamModeValidate, StreamModeProvision:
+	default:
+		return fmt.Errorf("invalid nats.stream.mode: %s (must be off, validate, or provision)", cfg.Mode)
+	}
+
+	if cfg.OnMissing != "fail" && cfg.OnMissing != "degrade" {
+		return fmt.Errorf("invalid nats.stream.on_missing: %s (must be fail or degrade)", cfg.OnMissing)
+	}
+
+	if cfg.Mode != StreamModeProvision {
+		return nil
+	}
+
+	if cfg.Name == "" || strings.ContainsAny(cfg.Name, " .*>/\\") {
+		return fmt.Errorf("invalid nats.stream.name: %q (must not be empty or contain spaces, dots, wildcards or slashes)", cfg.Name)
+	}
+	switch cfg.Retention {
+	case "limits", "interest", "workqueue":
+	default:
+		return fmt.Errorf("invalid nats.stream.retention: %s (must be limits, interest, or workqueue)", cfg.Retention)
+	}
+	switch cfg.Storage {
+	case "file", "memory":
+	default:
+		return fmt.Errorf("invalid nats.stream.storage: %s (must be file or memory)", cfg.Storage)
+	}
+	if cfg.MaxAge < 0 {
+		return fmt.Errorf("nats.stream.max_age cannot be negative")
+	}
+	if cfg.Replicas < 1 || cfg.Replicas > 5 {
+		return fmt.Errorf("nats.stream.replicas must be between 1 and 5 (got: %d)", cfg.Replicas)
+	}
+	return nil
+}
@@ -3,8 +3,12 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/spf13/viper"
 )
 
 // TestValidateDeviceID tests device ID validation
@@ -73,6 +77,18 @@ func TestValidateDeviceID(t *testing.T) {
 			wantErr:  true,
 			errText:  "must contain only alphanumeric",
 		},
+		{
+			name:     "broadcast token reserved",
+			deviceID: "all",
+			wantErr:  true,
+			errText:  "reserved for fleet command subjects",
+		},
+		{
+			name:     "group token reserved",
+			deviceID: "group",
+			wantErr:  true,
+			errText:  "reserved for fleet command subjects",
+		},
 	}
 
 	for _, tt := range tests {
@@ -115,6 +131,50 @@ func TestValidateDeviceID(t *testing.T) {
 	}
 }
 
+// TestValidateTags tests that tags are usable as subject tokens
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		wantErr bool
+	}{
+		{name: "no tags", tags: nil, wantErr: false},
+		{name: "valid tags", tags: map[string]string{"site": "hq", "role": "kiosk", "env": "prod-1"}, wantErr: false},
+		{name: "value with dot", tags: map[string]string{"site": "hq.east"}, wantErr: true},
+		{name: "value with wildcard", tags: map[string]string{"role": "*"}, wantErr: true},
+		{name: "empty value", tags: map[string]string{"env": ""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				DeviceID:      "device-001",
+				SubjectPrefix: "agents",
+				Tags:          tt.tags,
+				NATS: NATSConfig{
+					URLs: []string{"nats://localhost:4222"},
+					Auth: AuthConfig{Type: "none"},
+				},
+				Tasks: TasksConfig{
+					Heartbeat: HeartbeatConfig{Enabled: true, Interval: 1 * time.Minute},
+				},
+				Commands: CommandsConfig{Timeout: 30 * time.Second},
+				Logging: LoggingConfig{
+					Level:      "info",
+					File:       "test.log",
+					MaxSizeMB:  100,
+					MaxBackups: 3,
+				},
+			}
+
+			err := validate(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 // TestValidateSubjectPrefix tests subject prefix validation
 func TestValidateSubjectPrefix(t *testing.T) {
 	tests := []struct {
@@ -580,6 +640,7 @@ func TestValidateTaskIntervals(t *testing.T) {
 		name              string
 		heartbeatInterval time.Duration
 		metricsInterval   time.Duration
+		sampleInterval    time.Duration
 		wantErr           bool
 		errText           string
 	}{
@@ -619,6 +680,29 @@ func TestValidateTaskIntervals(t *testing.T) {
 			wantErr:           true,
 			errText:           "at least 30 seconds",
 		},
+		{
+			name:              "fast sampling",
+			heartbeatInterval: 1 * time.Minute,
+			metricsInterval:   5 * time.Minute,
+			sampleInterval:    10 * time.Second,
+			wantErr:           false,
+		},
+		{
+			name:              "sample interval too short",
+			heartbeatInterval: 1 * time.Minute,
+			metricsInterval:   5 * time.Minute,
+			sampleInterval:    time.Second,
+			wantErr:           true,
+			errText:           "sample_interval must be at least 5 seconds",
+		},
+		{
+			name:              "sample interval not shorter than interval",
+			heartbeatInterval: 1 * time.Minute,
+			metricsInterval:   5 * time.Minute,
+			sampleInterval:    5 * time.Minute,
+			wantErr:           true,
+			errText:           "must be shorter than interval",
+		},
 	}
 
 	for _, tt := range tests {
@@ -632,7 +716,7 @@ func TestValidateTaskIntervals(t *testing.T) {
 				},
 				Tasks: TasksConfig{
 					Heartbeat:     HeartbeatConfig{Enabled: true, Interval: tt.heartbeatInterval},
-					SystemMetrics: SystemMetricsConfig{Enabled: true, Interval: tt.metricsInterval},
+					SystemMetrics: SystemMetricsConfig{Enabled: true, Interval: tt.metricsInterval, SampleInterval: tt.sampleInterval},
 					ServiceCheck:  ServiceCheckConfig{Enabled: false},
 					Inventory:     InventoryConfig{Enabled: true, Interval: 24 * time.Hour},
 				},
@@ -738,6 +822,53 @@ func TestValidateCommandTimeout(t *testing.T) {
 	}
 }
 
+// TestValidateAllowedProcesses tests the process kill allow list
+func TestValidateAllowedProcesses(t *testing.T) {
+	tests := []struct {
+		name      string
+		processes []string
+		errText   string
+	}{
+		{name: "none"},
+		{name: "names", processes: []string{"notepad.exe", "nginx"}},
+		{name: "path", processes: []string{`C:\Windows\notepad.exe`}, errText: "invalid allowed_processes entry"},
+		{name: "unix path", processes: []string{"/usr/sbin/nginx"}, errText: "invalid allowed_processes entry"},
+		{name: "wildcard", processes: []string{"*.exe"}, errText: "invalid allowed_processes entry"},
+		{name: "empty", processes: []string{""}, errText: "invalid allowed_processes entry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				DeviceID:      "test-device",
+				SubjectPrefix: "agents",
+				NATS: NATSConfig{
+					URLs: []string{"nats://localhost:4222"},
+					Auth: AuthConfig{Type: "none"},
+				},
+				Tasks: TasksConfig{
+					Heartbeat:     HeartbeatConfig{Enabled: true, Interval: 1 * time.Minute},
+					SystemMetrics: SystemMetricsConfig{Enabled: true, Interval: 5 * time.Minute},
+					Inventory:     InventoryConfig{Enabled: true, Interval: 24 * time.Hour},
+				},
+				Commands: CommandsConfig{
+					Timeout:          30 * time.Second,
+					AllowedProcesses: tt.processes,
+				},
+				Logging: LoggingConfig{Level: "info", File: "test.log", MaxSizeMB: 100, MaxBackups: 3},
+			}
+
+			err := validate(cfg)
+			if tt.errText == "" && err != nil {
+				t.Errorf("validate() error = %v", err)
+			}
+			if tt.errText != "" && (err == nil || indexOf(err.Error(), tt.errText) < 0) {
+				t.Errorf("validate() error = %v, want error containing %q", err, tt.errText)
+			}
+		})
+	}
+}
+
 // Helper function
 func indexOf(s, substr string) int {
 	for i := 0; i <= len(s)-len(substr); i++ {
@@ -747,3 +878,185 @@ func indexOf(s, substr string) int {
 	}
 	return -1
 }
+
+// TestValidateStream tests JetStream stream settings validation
+func TestValidateStream(t *testing.T) {
+	provision := func(modify func(*StreamConfig)) StreamConfig {
+		cfg := StreamConfig{
+			Mode:      StreamModeProvision,
+			OnMissing: "degrade",
+			Name:      "AGENTS",
+			Retention: "limits",
+			Storage:   "file",
+			MaxAge:    168 * time.Hour,
+			Replicas:  1,
+		}
+		modify(&cfg)
+		return cfg
+	}
+
+	tests := []struct {
+		name    string
+		cfg     StreamConfig
+		wantErr bool
+		errText string
+	}{
+		{name: "unset mode", cfg: StreamConfig{}, wantErr: false},
+		{name: "off", cfg: StreamConfig{Mode: StreamModeOff}, wantErr: false},
+		{name: "validate", cfg: StreamConfig{Mode: StreamModeValidate, OnMissing: "fail"}, wantErr: false},
+		{name: "provision", cfg: provision(func(c *StreamConfig) {}), wantErr: false},
+		{
+			name:    "invalid mode",
+			cfg:     StreamConfig{Mode: "create"},
+			wantErr: true,
+			errText: "invalid nats.stream.mode",
+		},
+		{
+			name:    "invalid on_missing",
+			cfg:     StreamConfig{Mode: StreamModeValidate, OnMissing: "ignore"},
+			wantErr: true,
+			errText: "invalid nats.stream.on_missing",
+		},
+		{
+			name:    "stream name with dot",
+			cfg:     provision(func(c *StreamConfig) { c.Name = "agents.telemetry" }),
+			wantErr: true,
+			errText: "invalid nats.stream.name",
+		},
+		{
+			name:    "invalid retention",
+			cfg:     provision(func(c *StreamConfig) { c.Retention = "forever" }),
+			wantErr: true,
+			errText: "invalid nats.stream.retention",
+		},
+		{
+			name:    "invalid storage",
+			cfg:     provision(func(c *StreamConfig) { c.Storage = "disk" }),
+			wantErr: true,
+			errText: "invalid nats.stream.storage",
+		},
+		{
+			name:    "too many replicas",
+			cfg:     provision(func(c *StreamConfig) { c.Replicas = 7 }),
+			wantErr: true,
+			errText: "replicas must be between 1 and 5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStream(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateStream() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && indexOf(err.Error(), tt.errText) < 0 {
+				t.Errorf("validateStream() error = %v, want error containing %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// TestValidateMessages tests message format and encoding validation
+func TestValidateMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     MessagesConfig
+		errText string
+	}{
+		{name: "defaults", cfg: MessagesConfig{}},
+		{name: "cloudevents msgpack zstd", cfg: MessagesConfig{Format: "cloudevents", Encoding: "msgpack", Compression: "zstd"}},
+		{name: "raw protobuf gzip", cfg: MessagesConfig{Format: "raw", Encoding: "protobuf", Compression: "gzip"}},
+		{name: "invalid format", cfg: MessagesConfig{Format: "xml"}, errText: "invalid messages.format"},
+		{name: "invalid encoding", cfg: MessagesConfig{Encoding: "cbor"}, errText: "invalid messages.encoding"},
+		{name: "invalid compression", cfg: MessagesConfig{Compression: "brotli"}, errText: "invalid messages.compression"},
+		{name: "cloudevents protobuf", cfg: MessagesConfig{Format: "cloudevents", Encoding: "protobuf"}, errText: "json and msgpack encodings only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMessages(&tt.cfg)
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateMessages() error = %v", err)
+				}
+				return
+			}
+			if err == nil || indexOf(err.Error(), tt.errText) < 0 {
+				t.Errorf("validateMessages() error = %v, want error containing %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// TestValidatePublishMode tests service_check and inventory publish modes
+func TestValidatePublishMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		keyframe time.Duration
+		errText  string
+	}{
+		{name: "unset", mode: ""},
+		{name: "full ignores keyframe", mode: PublishModeFull},
+		{name: "changes", mode: PublishModeChanges, keyframe: time.Hour},
+		{name: "invalid mode", mode: "diff", errText: "invalid tasks.inventory.mode"},
+		{name: "keyframe shorter than interval", mode: PublishModeChanges, keyframe: 30 * time.Second, errText: "keyframe_interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePublishMode("inventory", tt.mode, time.Minute, tt.keyframe)
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validatePublishMode() error = %v", err)
+				}
+				return
+			}
+			if err == nil || indexOf(err.Error(), tt.errText) < 0 {
+				t.Errorf("validatePublishMode() error = %v, want error containing %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// TestBroadcastDefault tests that fleet-wide commands are opt-in
+func TestBroadcastDefault(t *testing.T) {
+	v := viper.New()
+	setDefaults(v)
+	if v.GetBool("commands.broadcast") {
+		t.Error("commands.broadcast defaults to true, want false")
+	}
+}
+
+// TestDefaultFiles tests that default file locations follow the platform
+func TestDefaultFiles(t *testing.T) {
+	windows := defaultFiles("windows")
+	if got := windows["nats.sequence_file"]; got != `C:\ProgramData\WinAgent\sequences.json` {
+		t.Errorf("windows nats.sequence_file = %q", got)
+	}
+	if got := windows["logging.file"]; got != `C:\ProgramData\WinAgent\agent.log` {
+		t.Errorf("windows logging.file = %q", got)
+	}
+
+	linux := defaultFiles("linux")
+	if got := linux["nats.sequence_file"]; got != "/var/lib/win-agent/sequences.json" {
+		t.Errorf("linux nats.sequence_file = %q", got)
+	}
+	if got := linux["logging.file"]; got != "/var/log/win-agent/agent.log" {
+		t.Errorf("linux logging.file = %q", got)
+	}
+	for key, path := range linux {
+		if !filepath.IsAbs(path) || strings.Contains(path, `\`) {
+			t.Errorf("linux %s = %q, want an absolute Unix path", key, path)
+		}
+	}
+
+	v := viper.New()
+	setDefaults(v)
+	for key, path := range defaultFiles(runtime.GOOS) {
+		if got := v.GetString(key); got != path {
+			t.Errorf("default %s = %q, want %q", key, got, path)
+		}
+	}
+}
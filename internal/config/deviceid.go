@@ -0,0 +1,151 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// device_id sources that are derived from the host instead of used literally
+const (
+	DeviceIDSourceHostname  = "hostname"
+	DeviceIDSourceMachineID = "machine-id"
+)
+
+// machineIDShortLength is the length of {machine_id_short}
+const machineIDShortLength = 8
+
+// deviceIDPlaceholder matches {name} placeholders in a device_id template
+var deviceIDPlaceholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// invalidDeviceIDChars matches runs of characters not allowed in a subject token
+var invalidDeviceIDChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// persistedDeviceID is the on-disk record of a derived device_id
+// Source is kept so changing the template in config derives a new ID
+type persistedDeviceID struct {
+	DeviceID string `json:"device_id"`
+	Source   string `json:"source"`
+}
+
+// isDerivedDeviceID returns true if device_id names a host source or template
+func isDerivedDeviceID(spec string) bool {
+	return spec == DeviceIDSourceHostname ||
+		spec == DeviceIDSourceMachineID ||
+		deviceIDPlaceholder.MatchString(spec)
+}
+
+// resolveDeviceID replaces a device_id source or template with the derived value
+// The first derived value is persisted and reused on later starts, so the ID
+// stays stable if the machine is renamed
+func resolveDeviceID(cfg *Config) error {
+	spec := cfg.DeviceID
+	if !isDerivedDeviceID(spec) {
+		return nil
+	}
+
+	persisted, err := loadPersistedDeviceID(cfg.DeviceIDFile)
+	if err != nil {
+		return err
+	}
+	if persisted != nil && persisted.Source == spec && ValidDeviceID(persisted.DeviceID) {
+		cfg.DeviceID = persisted.DeviceID
+		cfg.DeviceIDSource = spec
+		return nil
+	}
+
+	deviceID, err := deriveDeviceID(spec, os.Hostname, MachineID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(persistedDeviceID{DeviceID: deviceID, Source: spec}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode device_id: %w", err)
+	}
+	if err := writeFileAtomic(cfg.DeviceIDFile, data); err != nil {
+		return fmt.Errorf("failed to persist device_id: %w", err)
+	}
+
+	cfg.DeviceID = deviceID
+	cfg.DeviceIDSource = spec
+	return nil
+}
+
+// deriveDeviceID expands a device_id source or template and sanitizes the result
+// Host lookups are passed in so derivation can be tested without a real host
+func deriveDeviceID(spec string, hostname, machineID func() (string, error)) (string, error) {
+	switch spec {
+	case DeviceIDSourceHostname:
+		spec = "{hostname}"
+	case DeviceIDSourceMachineID:
+		spec = "{machine_id}"
+	}
+
+	var expandErr error
+	expanded := deviceIDPlaceholder.ReplaceAllStringFunc(spec, func(placeholder string) string {
+		if expandErr != nil {
+			return ""
+		}
+		var value string
+		var err error
+		switch name := strings.Trim(placeholder, "{}"); name {
+		case "hostname":
+			value, err = hostname()
+			// Drop the domain part of an FQDN
+			if i := strings.IndexByte(value, '.'); i > 0 {
+				value = value[:i]
+			}
+		case "machine_id":
+			value, err = machineID()
+		case "machine_id_short":
+			value, err = machineID()
+			value = strings.ReplaceAll(value, "-", "")
+			if len(value) > machineIDShortLength {
+				value = value[:machineIDShortLength]
+			}
+		default:
+			err = fmt.Errorf("unknown device_id placeholder %s (use {hostname}, {machine_id} or {machine_id_short})", placeholder)
+		}
+		if err != nil {
+			expandErr = err
+		}
+		return value
+	})
+	if expandErr != nil {
+		return "", fmt.Errorf("failed to derive device_id from %q: %w", spec, expandErr)
+	}
+
+	deviceID := sanitizeDeviceID(expanded)
+	if deviceID == "" {
+		return "", fmt.Errorf("device_id derived from %q is empty after sanitizing", spec)
+	}
+	return deviceID, nil
+}
+
+// sanitizeDeviceID lowercases the value and replaces each run of characters
+// outside [a-z0-9_-] with a single dash
+func sanitizeDeviceID(value string) string {
+	value = invalidDeviceIDChars.ReplaceAllString(strings.ToLower(value), "-")
+	return strings.Trim(value, "-")
+}
+
+// loadPersistedDeviceID reads a previously derived device_id
+// Returns nil without error if none has been persisted
+func loadPersistedDeviceID(path string) (*persistedDeviceID, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device_id file: %w", err)
+	}
+
+	var persisted persistedDeviceID
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return nil, fmt.Errorf("failed to parse device_id file %s: %w", path, err)
+	}
+	return &persisted, nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// TestDeriveDeviceID tests device_id sources, templates and sanitizing
+func TestDeriveDeviceID(t *testing.T) {
+	hostname := func() (string, error) { return "WS-Floor2.corp.example.com", nil }
+	machineID := func() (string, error) { return "4c4c4544-0042-3510-8052-b4c04f4e4e32", nil }
+	noMachineID := func() (string, error) { return "", fmt.Errorf("not available") }
+
+	tests := []struct {
+		name      string
+		spec      string
+		machineID func() (string, error)
+		want      string
+		wantErr   bool
+		errText   string
+	}{
+		{
+			name:      "hostname source drops domain and lowercases",
+			spec:      "hostname",
+			machineID: machineID,
+			want:      "ws-floor2",
+		},
+		{
+			name:      "machine-id source",
+			spec:      "machine-id",
+			machineID: machineID,
+			want:      "4c4c4544-0042-3510-8052-b4c04f4e4e32",
+		},
+		{
+			name:      "template with short machine id",
+			spec:      "{hostname}-{machine_id_short}",
+			machineID: machineID,
+			want:      "ws-floor2-4c4c4544",
+		},
+		{
+			name:      "template literal text is sanitized",
+			spec:      "Site A/{hostname}",
+			machineID: machineID,
+			want:      "site-a-ws-floor2",
+		},
+		{
+			name:      "unknown placeholder",
+			spec:      "{serial}",
+			machineID: machineID,
+			wantErr:   true,
+			errText:   "unknown device_id placeholder",
+		},
+		{
+			name:      "machine id unavailable",
+			spec:      "{hostname}-{machine_id}",
+			machineID: noMachineID,
+			wantErr:   true,
+			errText:   "not available",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := deriveDeviceID(tt.spec, hostname, tt.machineID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deriveDeviceID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if indexOf(err.Error(), tt.errText) < 0 {
+					t.Errorf("deriveDeviceID() error = %v, want error containing %q", err, tt.errText)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("deriveDeviceID() = %q, want %q", got, tt.want)
+			}
+			if !ValidDeviceID(got) {
+				t.Errorf("deriveDeviceID() = %q is not a valid device_id", got)
+			}
+		})
+	}
+}
+
+// TestResolveDeviceIDPersistence tests that a derived device_id is reused across starts
+func TestResolveDeviceIDPersistence(t *testing.T) {
+	idFile := filepath.Join(t.TempDir(), "device_id.json")
+
+	// Literal IDs are left alone and nothing is persisted
+	cfg := &Config{DeviceID: "device-001", DeviceIDFile: idFile}
+	if err := resolveDeviceID(cfg); err != nil {
+		t.Fatalf("resolveDeviceID() literal error = %v", err)
+	}
+	if cfg.DeviceID != "device-001" || cfg.DeviceIDSource != "" {
+		t.Errorf("literal device_id changed to %q (source %q)", cfg.DeviceID, cfg.DeviceIDSource)
+	}
+
+	// Pretend the host was derived under an older name
+	if err := writeFileAtomic(idFile, []byte(`{"device_id": "old-name", "source": "hostname"}`)); err != nil {
+		t.Fatalf("failed to write device_id file: %v", err)
+	}
+
+	cfg = &Config{DeviceID: "hostname", DeviceIDFile: idFile}
+	if err := resolveDeviceID(cfg); err != nil {
+		t.Fatalf("resolveDeviceID() error = %v", err)
+	}
+	if cfg.DeviceID != "old-name" {
+		t.Errorf("DeviceID = %q, want persisted old-name", cfg.DeviceID)
+	}
+	if cfg.DeviceIDSource != "hostname" {
+		t.Errorf("DeviceIDSource = %q, want hostname", cfg.DeviceIDSource)
+	}
+
+	// A different source in config derives (and persists) a new ID
+	cfg = &Config{DeviceID: "{hostname}", DeviceIDFile: idFile}
+	if err := resolveDeviceID(cfg); err != nil {
+		t.Fatalf("resolveDeviceID() new source error = %v", err)
+	}
+	if cfg.DeviceID == "old-name" {
+		t.Error("changed source should not reuse the persisted device_id")
+	}
+	persisted, err := loadPersistedDeviceID(idFile)
+	if err != nil || persisted == nil {
+		t.Fatalf("loadPersistedDeviceID() = %v, %v", persisted, err)
+	}
+	if persisted.DeviceID != cfg.DeviceID || persisted.Source != "{hostname}" {
+		t.Errorf("persisted = %+v, want %s from {hostname}", persisted, cfg.DeviceID)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EnrollmentConfig configures zero-touch enrollment
+// An unenrolled agent connects with the bootstrap token, is issued a device ID
+// and user credentials, and uses only those from then on
+type EnrollmentConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	BootstrapToken string        `mapstructure:"bootstrap_token"` // Accepts secret references (env:, file:, secret:)
+	Subject        string        `mapstructure:"subject"`         // Enrollment request subject
+	Timeout        time.Duration `mapstructure:"timeout"`         // How long to wait for the enrollment reply
+	CredsFile      string        `mapstructure:"creds_file"`      // Where issued credentials are written
+	StateFile      string        `mapstructure:"state_file"`      // Where the issued device ID is recorded
+}
+
+// EnrollmentState is persisted after a successful enrollment
+type EnrollmentState struct {
+	DeviceID   string `json:"device_id"`
+	PublicKey  string `json:"public_key"`
+	CredsFile  string `json:"creds_file"`
+	EnrolledAt string `json:"enrolled_at"`
+}
+
+// NeedsEnrollment returns true if enrollment is enabled and has not completed yet
+func (c *Config) NeedsEnrollment() bool {
+	return c.Enrollment.Enabled && !c.Enrolled
+}
+
+// ApplyEnrollment switches the config to the identity issued at enrollment
+// The bootstrap token is dropped so it can never be used again
+func (c *Config) ApplyEnrollment(state *EnrollmentState) {
+	c.DeviceID = state.DeviceID
+	c.NATS.Auth = AuthConfig{
+		Type:      "creds",
+		CredsFile: state.CredsFile,
+	}
+	c.Enrollment.BootstrapToken = ""
+	c.Enrolled = true
+}
+
+// applyEnrollmentState loads a previously persisted enrollment, if any
+// Missing state is not an error - it just means enrollment has to run
+func applyEnrollmentState(cfg *Config) error {
+	if !cfg.Enrollment.Enabled {
+		return nil
+	}
+
+	state, err := LoadEnrollmentState(cfg.Enrollment.StateFile)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+
+	// Enrollment state without its creds is unusable; surface it instead of
+	// silently re-enrolling with a token that may already be spent
+	if _, err := os.Stat(state.CredsFile); err != nil {
+		return fmt.Errorf("enrolled credentials not found: %s (%w)", state.CredsFile, err)
+	}
+
+	cfg.ApplyEnrollment(state)
+	return nil
+}
+
+// LoadEnrollmentState reads the enrollment state file
+// Returns nil without error if the agent has not enrolled yet
+func LoadEnrollmentState(path string) (*EnrollmentState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrollment state: %w", err)
+	}
+
+	var state EnrollmentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse enrollment state %s: %w", path, err)
+	}
+	if state.DeviceID == "" || state.CredsFile == "" {
+		return nil, fmt.Errorf("enrollment state %s is incomplete", path)
+	}
+
+	return &state, nil
+}
+
+// SaveEnrollment persists issued credentials and then the enrollment state
+// The state file is written last so a crash in between leaves the agent unenrolled
+// rather than enrolled without credentials
+func SaveEnrollment(cfg *EnrollmentConfig, deviceID, publicKey string, creds []byte) (*EnrollmentState, error) {
+	if err := writeFileAtomic(cfg.CredsFile, creds); err != nil {
+		return nil, fmt.Errorf("failed to save credentials: %w", err)
+	}
+
+	state := &EnrollmentState{
+		DeviceID:   deviceID,
+		PublicKey:  publicKey,
+		CredsFile:  cfg.CredsFile,
+		EnrolledAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode enrollment state: %w", err)
+	}
+	if err := writeFileAtomic(cfg.StateFile, data); err != nil {
+		return nil, fmt.Errorf("failed to save enrollment state: %w", err)
+	}
+
+	return state, nil
+}
+
+// writeFileAtomic writes a private file via temp file + rename so readers
+// never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// validateEnrollment checks enrollment settings
+func validateEnrollment(cfg *EnrollmentConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Subject == "" {
+		return fmt.Errorf("enrollment.subject is required when enrollment is enabled")
+	}
+	if cfg.CredsFile == "" || cfg.StateFile == "" {
+		return fmt.Errorf("enrollment.creds_file and enrollment.state_file are required when enrollment is enabled")
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("enrollment.timeout must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// enrollmentTestConfig returns a minimal valid config with enrollment enabled
+func enrollmentTestConfig(tmpDir string) *Config {
+	return &Config{
+		SubjectPrefix: "agents",
+		NATS: NATSConfig{
+			URLs: []string{"nats://localhost:4222"},
+		},
+		Tasks: TasksConfig{
+			Heartbeat:     HeartbeatConfig{Enabled: true, Interval: 1 * time.Minute},
+			SystemMetrics: SystemMetricsConfig{Enabled: false},
+			ServiceCheck:  ServiceCheckConfig{Enabled: false},
+			Inventory:     InventoryConfig{Enabled: true, Interval: 24 * time.Hour},
+		},
+		Commands: CommandsConfig{
+			Timeout: 30 * time.Second,
+		},
+		Logging: LoggingConfig{
+			Level:      "info",
+			File:       "test.log",
+			MaxSizeMB:  100,
+			MaxBackups: 3,
+		},
+		Enrollment: EnrollmentConfig{
+			Enabled:        true,
+			BootstrapToken: "bootstrap",
+			Subject:        "agents.enroll",
+			Timeout:        30 * time.Second,
+			CredsFile:      filepath.Join(tmpDir, "device.creds"),
+			StateFile:      filepath.Join(tmpDir, "enrollment.json"),
+		},
+	}
+}
+
+// TestValidateEnrollment tests validation before and after enrollment
+func TestValidateEnrollment(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Unenrolled: no device_id or auth needed, only the bootstrap token
+	cfg := enrollmentTestConfig(tmpDir)
+	if err := validate(cfg); err != nil {
+		t.Errorf("validate() unenrolled error = %v", err)
+	}
+
+	cfg.Enrollment.BootstrapToken = ""
+	if err := validate(cfg); err == nil || indexOf(err.Error(), "bootstrap_token is required") < 0 {
+		t.Errorf("validate() without token error = %v, want bootstrap_token is required", err)
+	}
+
+	cfg = enrollmentTestConfig(tmpDir)
+	cfg.Enrollment.Timeout = 0
+	if err := validate(cfg); err == nil || indexOf(err.Error(), "enrollment.timeout") < 0 {
+		t.Errorf("validate() zero timeout error = %v, want enrollment.timeout error", err)
+	}
+
+	// Enrolled: regular device_id and auth validation applies again
+	cfg = enrollmentTestConfig(tmpDir)
+	cfg.Enrolled = true
+	if err := validate(cfg); err == nil || indexOf(err.Error(), "device_id is required") < 0 {
+		t.Errorf("validate() enrolled without device_id error = %v, want device_id is required", err)
+	}
+}
+
+// TestEnrollmentStatePersistence tests that a saved enrollment is applied on the next load
+func TestEnrollmentStatePersistence(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := enrollmentTestConfig(tmpDir)
+
+	// Nothing persisted yet
+	if err := applyEnrollmentState(cfg); err != nil {
+		t.Fatalf("applyEnrollmentState() error = %v", err)
+	}
+	if !cfg.NeedsEnrollment() {
+		t.Fatal("NeedsEnrollment() = false before enrollment")
+	}
+
+	if _, err := SaveEnrollment(&cfg.Enrollment, "device-001", "UABC", []byte("creds")); err != nil {
+		t.Fatalf("SaveEnrollment() error = %v", err)
+	}
+
+	// Simulate the next start from the same config file
+	next := enrollmentTestConfig(tmpDir)
+	if err := applyEnrollmentState(next); err != nil {
+		t.Fatalf("applyEnrollmentState() error = %v", err)
+	}
+	if next.NeedsEnrollment() {
+		t.Error("NeedsEnrollment() = true after enrollment")
+	}
+	if next.DeviceID != "device-001" {
+		t.Errorf("DeviceID = %q, want device-001", next.DeviceID)
+	}
+	if next.NATS.Auth.Type != "creds" || next.NATS.Auth.CredsFile != cfg.Enrollment.CredsFile {
+		t.Errorf("Auth = %+v, want creds auth with %s", next.NATS.Auth, cfg.Enrollment.CredsFile)
+	}
+	if next.Enrollment.BootstrapToken != "" {
+		t.Error("bootstrap token should be cleared after enrollment")
+	}
+	if err := validate(next); err != nil {
+		t.Errorf("validate() after enrollment error = %v", err)
+	}
+
+	// State without its creds must not silently fall back to the bootstrap token
+	os.Remove(cfg.Enrollment.CredsFile)
+	if err := applyEnrollmentState(enrollmentTestConfig(tmpDir)); err == nil {
+		t.Error("applyEnrollmentState() with missing creds should fail")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// machineIDFiles are checked in order; systemd and dbus both provide one
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// MachineID returns the host machine ID from /etc/machine-id
+func MachineID() (string, error) {
+	for _, path := range machineIDFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if id := strings.ToLower(strings.TrimSpace(string(data))); id != "" {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("machine ID not found (checked %s)", strings.Join(machineIDFiles, ", "))
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// MachineID returns the Windows MachineGuid
+// The value is generated at install time and survives hostname changes
+func MachineID() (string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SOFTWARE\Microsoft\Cryptography`,
+		registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", fmt.Errorf("failed to open registry key: %w", err)
+	}
+	defer k.Close()
+
+	guid, _, err := k.GetStringValue("MachineGuid")
+	if err != nil {
+		return "", fmt.Errorf("failed to read MachineGuid: %w", err)
+	}
+
+	guid = strings.ToLower(strings.TrimSpace(guid))
+	if guid == "" {
+		return "", fmt.Errorf("MachineGuid is empty")
+	}
+	return guid, nil
+}
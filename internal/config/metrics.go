@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CustomMetric maps one Prometheus family from the exporter into the
+// custom section of the system metrics payload
+type CustomMetric struct {
+	Name   string            `mapstructure:"name"`   // Output name in the custom section
+	Family string            `mapstructure:"family"` // Prometheus family, e.g. myapp_requests_total
+	Match  map[string]string `mapstructure:"match"`  // Only series with these label values
+
+	// GroupBy keeps these labels in the output, one value per combination
+	// (empty = a single value across all matching series)
+	GroupBy []string          `mapstructure:"group_by"`
+	Rename  map[string]string `mapstructure:"rename"` // Output label renames (group_by label -> name)
+
+	Aggregate string `mapstructure:"aggregate"` // sum (default), avg, min, max
+	Rate      bool   `mapstructure:"rate"`      // Convert counters to per-second rates before aggregating
+}
+
+// Metrics sources for system_metrics
+const (
+	MetricsSourcePrometheus = "prometheus" // Scrape windows_exporter (default)
+	MetricsSourceNative     = "native"     // Read OS counters directly
+)
+
+// Custom metric aggregations
+const (
+	AggregateSum = "sum"
+	AggregateAvg = "avg"
+	AggregateMin = "min"
+	AggregateMax = "max"
+)
+
+// customMetricName restricts output names to something every consumer can use as a key
+var customMetricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateMetricsSource checks the metrics source and the settings that depend on it
+func validateMetricsSource(cfg *SystemMetricsConfig) error {
+	switch cfg.Source {
+	case "", MetricsSourcePrometheus:
+	case MetricsSourceNative:
+		if len(cfg.Custom) > 0 {
+			return fmt.Errorf("system_metrics custom mappings require the prometheus source")
+		}
+	default:
+		return fmt.Errorf("invalid system_metrics source: %s (must be prometheus or native)", cfg.Source)
+	}
+	return nil
+}
+
+// validateCustomMetrics checks the custom metric mappings under field
+func validateCustomMetrics(field string, metrics []CustomMetric) error {
+	names := make(map[string]bool)
+	for i := range metrics {
+		m := &metrics[i]
+		if !customMetricName.MatchString(m.Name) {
+			return fmt.Errorf("%s[%d]: invalid name %q (letters, digits and underscores)", field, i, m.Name)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("%s[%d]: duplicate name %q", field, i, m.Name)
+		}
+		names[m.Name] = true
+
+		if m.Family == "" {
+			return fmt.Errorf("custom metric %q: family is required", m.Name)
+		}
+
+		switch m.Aggregate {
+		case "", AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+		default:
+			return fmt.Errorf("custom metric %q: invalid aggregate: %s (must be sum, avg, min, or max)", m.Name, m.Aggregate)
+		}
+
+		// Config keys are case-insensitive, so label names are compared lowercased
+		for label := range m.Rename {
+			if !containsFold(m.GroupBy, label) {
+				return fmt.Errorf("custom metric %q: rename of %s requires it in group_by", m.Name, label)
+			}
+		}
+	}
+	return nil
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
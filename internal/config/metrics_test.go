@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestValidateCustomMetrics tests custom metric mapping validation
+func TestValidateCustomMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics []CustomMetric
+		errText string
+	}{
+		{
+			name: "valid mappings",
+			metrics: []CustomMetric{
+				{Name: "requests_per_sec", Family: "myapp_requests_total", Rate: true},
+				{Name: "queue_depth", Family: "myapp_queue_depth", Match: map[string]string{"env": "prod"},
+					GroupBy: []string{"Queue"}, Rename: map[string]string{"queue": "name"}, Aggregate: "max"},
+			},
+		},
+		{
+			name:    "invalid name",
+			metrics: []CustomMetric{{Name: "requests/sec", Family: "myapp_requests_total"}},
+			errText: "invalid name",
+		},
+		{
+			name: "duplicate name",
+			metrics: []CustomMetric{
+				{Name: "depth", Family: "a"},
+				{Name: "depth", Family: "b"},
+			},
+			errText: "duplicate name",
+		},
+		{
+			name:    "missing family",
+			metrics: []CustomMetric{{Name: "depth"}},
+			errText: "family is required",
+		},
+		{
+			name:    "invalid aggregate",
+			metrics: []CustomMetric{{Name: "depth", Family: "a", Aggregate: "median"}},
+			errText: "invalid aggregate",
+		},
+		{
+			name:    "rename outside group_by",
+			metrics: []CustomMetric{{Name: "depth", Family: "a", Rename: map[string]string{"queue": "name"}}},
+			errText: "requires it in group_by",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCustomMetrics("custom", tt.metrics)
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateCustomMetrics() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("validateCustomMetrics() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// TestValidateMetricsSource tests the metrics source and its dependent settings
+func TestValidateMetricsSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SystemMetricsConfig
+		errText string
+	}{
+		{name: "prometheus", cfg: SystemMetricsConfig{Source: "prometheus", ExporterURL: "http://localhost:9182/metrics"}},
+		{name: "default source", cfg: SystemMetricsConfig{ExporterURL: "http://localhost:9182/metrics"}},
+		{name: "native", cfg: SystemMetricsConfig{Source: "native"}},
+		{
+			name:    "native with custom mappings",
+			cfg:     SystemMetricsConfig{Source: "native", Custom: []CustomMetric{{Name: "x", Family: "y"}}},
+			errText: "require the prometheus source",
+		},
+		{name: "unknown", cfg: SystemMetricsConfig{Source: "wmi"}, errText: "invalid system_metrics source"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMetricsSource(&tt.cfg)
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateMetricsSource() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("validateMetricsSource() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"time"
+)
+
+// ProcessCheckConfig configures process presence monitoring, for workloads
+// that run as plain executables or scheduled tasks rather than services
+type ProcessCheckConfig struct {
+	Enabled   bool           `mapstructure:"enabled"`
+	Interval  time.Duration  `mapstructure:"interval"`
+	Processes []ProcessWatch `mapstructure:"processes"`
+}
+
+// ProcessWatch is one monitored process, matched by executable name or full path
+type ProcessWatch struct {
+	Name string `mapstructure:"name"` // Executable name or glob pattern, e.g. "worker.exe"
+	Path string `mapstructure:"path"` // Full executable path, e.g. "C:\Apps\worker.exe"
+
+	// MinInstances is how many must run for the process to count as running
+	// (default 1)
+	MinInstances int `mapstructure:"min_instances"`
+
+	// OnMissing is a .ps1 script from commands.scripts_directory, run once
+	// each time the process goes missing
+	OnMissing string `mapstructure:"on_missing"`
+}
+
+// Label returns the name the process is reported under
+func (w ProcessWatch) Label() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	return w.Path
+}
+
+// validateProcessCheck checks the process_check task
+func validateProcessCheck(check *ProcessCheckConfig, scriptsDir string) error {
+	if !check.Enabled {
+		return nil
+	}
+	if check.Interval < 10*time.Second {
+		return fmt.Errorf("process_check interval must be at least 10 seconds (got: %v)", check.Interval)
+	}
+	if len(check.Processes) == 0 {
+		return fmt.Errorf("at least one process must be specified when process_check is enabled")
+	}
+
+	labels := make(map[string]bool)
+	for i, watch := range check.Processes {
+		if (watch.Name == "") == (watch.Path == "") {
+			return fmt.Errorf("process_check.processes[%d]: exactly one of name or path is required", i)
+		}
+		if _, err := path.Match(watch.Name, ""); err != nil {
+			return fmt.Errorf("process_check.processes[%d]: invalid name pattern %q: %w", i, watch.Name, err)
+		}
+		if labels[watch.Label()] {
+			return fmt.Errorf("process_check.processes[%d]: duplicate process %q", i, watch.Label())
+		}
+		labels[watch.Label()] = true
+
+		if watch.MinInstances < 0 {
+			return fmt.Errorf("process_check.processes[%d]: min_instances cannot be negative", i)
+		}
+		if watch.OnMissing != "" {
+			// Scripts run through PowerShell; other platforms cannot execute them
+			if runtime.GOOS != "windows" {
+				return fmt.Errorf("process_check.processes[%d]: on_missing scripts are only supported on Windows", i)
+			}
+			if err := validateScriptName("process_check", watch.OnMissing, scriptsDir); err != nil {
+				return fmt.Errorf("process_check.processes[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidateProcessCheck tests process_check validation
+func TestValidateProcessCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		check      ProcessCheckConfig
+		scriptsDir string
+		errText    string
+		windows    bool // Only expected on Windows; elsewhere on_missing is rejected
+	}{
+		{name: "disabled", check: ProcessCheckConfig{Interval: time.Second}},
+		{
+			name: "name and path",
+			check: ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{
+				{Name: "worker*.exe", MinInstances: 2},
+				{Path: `C:\Apps\sync.exe`},
+			}},
+		},
+		{
+			name:       "on_missing script",
+			scriptsDir: `C:\Scripts`,
+			check:      ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{Name: "sync.exe", OnMissing: "start-sync.ps1"}}},
+			windows:    true,
+		},
+		{name: "short interval", check: ProcessCheckConfig{Enabled: true, Interval: time.Second, Processes: []ProcessWatch{{Name: "a.exe"}}}, errText: "at least 10 seconds"},
+		{name: "no processes", check: ProcessCheckConfig{Enabled: true, Interval: time.Minute}, errText: "at least one process"},
+		{name: "neither", check: ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{}}}, errText: "exactly one of name or path"},
+		{
+			name:    "both",
+			check:   ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{Name: "a.exe", Path: `C:\a.exe`}}},
+			errText: "exactly one of name or path",
+		},
+		{name: "bad pattern", check: ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{Name: "[a.exe"}}}, errText: "invalid name pattern"},
+		{
+			name:    "duplicate",
+			check:   ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{Name: "a.exe"}, {Name: "a.exe"}}},
+			errText: "duplicate process",
+		},
+		{
+			name:    "negative instances",
+			check:   ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{Name: "a.exe", MinInstances: -1}}},
+			errText: "cannot be negative",
+		},
+		{
+			name:    "script without directory",
+			check:   ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{Name: "a.exe", OnMissing: "start.ps1"}}},
+			errText: "require commands.scripts_directory",
+			windows: true,
+		},
+		{
+			name:       "script path",
+			scriptsDir: `C:\Scripts`,
+			check:      ProcessCheckConfig{Enabled: true, Interval: time.Minute, Processes: []ProcessWatch{{Name: "a.exe", OnMissing: "../start.ps1"}}},
+			errText:    "invalid script",
+			windows:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProcessCheck(&tt.check, tt.scriptsDir)
+			if tt.windows && runtime.GOOS != "windows" {
+				tt.errText = "only supported on Windows"
+			}
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateProcessCheck() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("validateProcessCheck() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// RecoveryPolicy restarts a monitored service that stops running
+// Zero values use the Default* recovery settings
+type RecoveryPolicy struct {
+	Service      string        `mapstructure:"service"`
+	FailedChecks int           `mapstructure:"failed_checks"` // Consecutive checks not Running before recovering
+	Backoff      time.Duration `mapstructure:"backoff"`       // Wait after an attempt before the next, doubled each time
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"`   // Upper limit for the doubled backoff
+	MaxRestarts  int           `mapstructure:"max_restarts"`  // Attempts allowed per Window before giving up
+	Window       time.Duration `mapstructure:"window"`
+
+	// Optional .ps1 scripts from commands.scripts_directory, run before and
+	// after each attempt (the post script runs whatever the outcome)
+	PreScript  string `mapstructure:"pre_script"`
+	PostScript string `mapstructure:"post_script"`
+}
+
+// Recovery defaults for unset policy fields
+const (
+	DefaultRecoveryFailedChecks = 2
+	DefaultRecoveryBackoff      = 30 * time.Second
+	DefaultRecoveryMaxBackoff   = 10 * time.Minute
+	DefaultRecoveryMaxRestarts  = 3
+	DefaultRecoveryWindow       = time.Hour
+)
+
+// validateRecovery checks the service_check recovery policies
+func validateRecovery(check *ServiceCheckConfig, scriptsDir string) error {
+	if len(check.Recovery) == 0 {
+		return nil
+	}
+	if !check.Enabled {
+		return fmt.Errorf("service_check.recovery requires service_check to be enabled")
+	}
+
+	services := make(map[string]bool)
+	for i := range check.Recovery {
+		policy := &check.Recovery[i]
+		if !isMonitoredService(check.Services, policy.Service) {
+			return fmt.Errorf("service_check.recovery[%d]: service %q must be listed in tasks.service_check.services", i, policy.Service)
+		}
+		if services[ServiceKey(policy.Service)] {
+			return fmt.Errorf("service_check.recovery[%d]: duplicate policy for %q", i, policy.Service)
+		}
+		services[ServiceKey(policy.Service)] = true
+
+		if err := validateRecoveryPolicy(policy, scriptsDir); err != nil {
+			return fmt.Errorf("recovery policy for %q: %w", policy.Service, err)
+		}
+	}
+	return nil
+}
+
+// validateRecoveryPolicy checks one policy
+func validateRecoveryPolicy(policy *RecoveryPolicy, scriptsDir string) error {
+	if policy.FailedChecks < 0 || policy.MaxRestarts < 0 {
+		return fmt.Errorf("failed_checks and max_restarts cannot be negative")
+	}
+	if policy.Backoff < 0 || policy.MaxBackoff < 0 || policy.Window < 0 {
+		return fmt.Errorf("backoff, max_backoff and window cannot be negative")
+	}
+	if policy.Backoff > 0 && policy.MaxBackoff > 0 && policy.MaxBackoff < policy.Backoff {
+		return fmt.Errorf("max_backoff (%v) must not be less than backoff (%v)", policy.MaxBackoff, policy.Backoff)
+	}
+
+	for _, script := range []string{policy.PreScript, policy.PostScript} {
+		if script == "" {
+			continue
+		}
+		// Scripts run through PowerShell; other platforms cannot execute them
+		if runtime.GOOS != "windows" {
+			return fmt.Errorf("recovery scripts are only supported on Windows (%s)", script)
+		}
+		if err := validateScriptName("recovery", script, scriptsDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateScriptName checks a script run by a task: a bare .ps1 name that
+// ExecuteCommand resolves in scripts_directory
+func validateScriptName(kind, script, scriptsDir string) error {
+	if scriptsDir == "" {
+		return fmt.Errorf("%s scripts require commands.scripts_directory", kind)
+	}
+	if filepath.Base(script) != script || filepath.Ext(script) != ".ps1" {
+		return fmt.Errorf("invalid script %q (must be a .ps1 file name in scripts_directory)", script)
+	}
+	return nil
+}
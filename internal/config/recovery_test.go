@@ -0,0 +1,96 @@
+package config
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidateRecovery tests service recovery policy validation
+func TestValidateRecovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		policies   []RecoveryPolicy
+		enabled    bool
+		scriptsDir string
+		errText    string
+		windows    bool // Only expected on Windows; elsewhere scripts are rejected
+	}{
+		{name: "none", enabled: false},
+		{name: "defaults", enabled: true, policies: []RecoveryPolicy{{Service: "Spooler"}}},
+		{
+			name:       "full policy",
+			enabled:    true,
+			scriptsDir: `C:\Scripts`,
+			policies: []RecoveryPolicy{{
+				Service: "Spooler", FailedChecks: 3, Backoff: time.Minute, MaxBackoff: 10 * time.Minute,
+				MaxRestarts: 5, Window: time.Hour, PreScript: "pre.ps1", PostScript: "post.ps1",
+			}},
+			windows: true,
+		},
+		{name: "service check disabled", enabled: false, policies: []RecoveryPolicy{{Service: "Spooler"}}, errText: "requires service_check"},
+		{name: "unmonitored service", enabled: true, policies: []RecoveryPolicy{{Service: "W32Time"}}, errText: "must be listed"},
+		{name: "duplicate", enabled: true, policies: []RecoveryPolicy{{Service: "Spooler"}, {Service: "Spooler"}}, errText: "duplicate policy"},
+		{name: "negative restarts", enabled: true, policies: []RecoveryPolicy{{Service: "Spooler", MaxRestarts: -1}}, errText: "cannot be negative"},
+		{
+			name:     "max backoff below backoff",
+			enabled:  true,
+			policies: []RecoveryPolicy{{Service: "Spooler", Backoff: time.Hour, MaxBackoff: time.Minute}},
+			errText:  "must not be less than backoff",
+		},
+		{name: "script without directory", enabled: true, policies: []RecoveryPolicy{{Service: "Spooler", PreScript: "pre.ps1"}}, errText: "require commands.scripts_directory", windows: true},
+		{
+			name:       "script path",
+			enabled:    true,
+			scriptsDir: `C:\Scripts`,
+			policies:   []RecoveryPolicy{{Service: "Spooler", PostScript: "../evil.ps1"}},
+			errText:    "invalid script",
+			windows:    true,
+		},
+		{
+			name:       "not a script",
+			enabled:    true,
+			scriptsDir: `C:\Scripts`,
+			policies:   []RecoveryPolicy{{Service: "Spooler", PostScript: "cleanup.bat"}},
+			errText:    "invalid script",
+			windows:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &ServiceCheckConfig{Enabled: tt.enabled, Services: []string{"Spooler"}, Recovery: tt.policies}
+			err := validateRecovery(check, tt.scriptsDir)
+			if tt.windows && runtime.GOOS != "windows" {
+				tt.errText = "only supported on Windows"
+			}
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateRecovery() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("validateRecovery() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// TestValidateRecoveryCase tests that policies differing only in case are
+// the same service on Windows and a service that is not monitored elsewhere
+func TestValidateRecoveryCase(t *testing.T) {
+	check := &ServiceCheckConfig{
+		Enabled:  true,
+		Services: []string{"Spooler"},
+		Recovery: []RecoveryPolicy{{Service: "Spooler"}, {Service: "spooler"}},
+	}
+	want := "must be listed"
+	if runtime.GOOS == "windows" {
+		want = "duplicate policy"
+	}
+	if err := validateRecovery(check, ""); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("validateRecovery() error = %v, want %q", err, want)
+	}
+}
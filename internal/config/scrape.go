@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"time"
+)
+
+// ScrapeTarget is an additional Prometheus exporter scraped on its own schedule
+// (SQL, IIS, application exporters next to windows_exporter)
+// Each target publishes to {prefix}.{device_id}.telemetry.{name}
+type ScrapeTarget struct {
+	Name     string           `mapstructure:"name"`     // Subject token, e.g. mssql
+	URL      string           `mapstructure:"url"`      // http:// or https:// metrics endpoint
+	Interval time.Duration    `mapstructure:"interval"` // How often to scrape and publish
+	Timeout  time.Duration    `mapstructure:"timeout"`  // Per-scrape timeout (default 10s)
+	Auth     ScrapeAuthConfig `mapstructure:"auth"`
+	TLS      TLSConfig        `mapstructure:"tls"` // https targets; enabled is implied by the URL
+
+	// Metric selection: families are forwarded as-is (globs allowed),
+	// metrics are mapped like system_metrics.custom
+	Families []string       `mapstructure:"families"`
+	Metrics  []CustomMetric `mapstructure:"metrics"`
+}
+
+// ScrapeAuthConfig holds exporter credentials
+// Password and Token accept secret references (env:, file:, secret:)
+type ScrapeAuthConfig struct {
+	Type     string `mapstructure:"type"`     // none (default), basic, bearer
+	Username string `mapstructure:"username"` // for basic auth
+	Password string `mapstructure:"password"` // for basic auth
+	Token    string `mapstructure:"token"`    // for bearer auth
+}
+
+// DefaultScrapeTimeout applies to targets without a timeout
+const DefaultScrapeTimeout = 10 * time.Second
+
+// scrapeTargetName keeps target names usable as a single subject token
+var scrapeTargetName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// reservedScrapeTargets are telemetry subjects the agent already publishes
+var reservedScrapeTargets = map[string]bool{
+	"system":    true,
+	"service":   true,
+	"inventory": true,
+	"process":   true,
+}
+
+// validateScrapeTargets checks the additional scrape targets
+func validateScrapeTargets(targets []ScrapeTarget) error {
+	names := make(map[string]bool)
+	for i := range targets {
+		target := &targets[i]
+		if !scrapeTargetName.MatchString(target.Name) {
+			return fmt.Errorf("scrape_targets[%d]: invalid name %q (lowercase letters, digits, - and _)", i, target.Name)
+		}
+		if reservedScrapeTargets[target.Name] {
+			return fmt.Errorf("scrape_targets[%d]: name %q is reserved", i, target.Name)
+		}
+		if names[target.Name] {
+			return fmt.Errorf("scrape_targets[%d]: duplicate name %q", i, target.Name)
+		}
+		names[target.Name] = true
+
+		if err := validateScrapeTarget(target); err != nil {
+			return fmt.Errorf("scrape target %q: %w", target.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateScrapeTarget checks one target
+func validateScrapeTarget(target *ScrapeTarget) error {
+	u, err := url.Parse(target.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url: %q (must be http:// or https://)", target.URL)
+	}
+	if u.Scheme == "http" && (target.TLS.CertFile != "" || target.TLS.CAFile != "" || target.TLS.InsecureSkipVerify) {
+		return fmt.Errorf("tls settings require an https url")
+	}
+	if (target.TLS.CertFile == "") != (target.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+
+	if target.Interval < 10*time.Second {
+		return fmt.Errorf("interval must be at least 10 seconds (got: %v)", target.Interval)
+	}
+	if target.Timeout < 0 || target.Timeout >= target.Interval {
+		return fmt.Errorf("timeout (%v) must be shorter than interval (%v)", target.Timeout, target.Interval)
+	}
+
+	switch target.Auth.Type {
+	case "", "none":
+	case "basic":
+		if target.Auth.Username == "" {
+			return fmt.Errorf("username is required for basic auth")
+		}
+	case "bearer":
+		if target.Auth.Token == "" {
+			return fmt.Errorf("token is required for bearer auth")
+		}
+	default:
+		return fmt.Errorf("invalid auth type: %s (must be none, basic, or bearer)", target.Auth.Type)
+	}
+
+	if len(target.Families) == 0 && len(target.Metrics) == 0 {
+		return fmt.Errorf("at least one of families or metrics is required")
+	}
+	for _, family := range target.Families {
+		if _, err := path.Match(family, ""); err != nil {
+			return fmt.Errorf("invalid family pattern: %q", family)
+		}
+	}
+	return validateCustomMetrics("metrics", target.Metrics)
+}
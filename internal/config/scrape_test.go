@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidateScrapeTargets tests scrape target validation
+func TestValidateScrapeTargets(t *testing.T) {
+	valid := func() ScrapeTarget {
+		return ScrapeTarget{
+			Name:     "mssql",
+			URL:      "http://localhost:4000/metrics",
+			Interval: time.Minute,
+			Families: []string{"mssql_*"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*ScrapeTarget)
+		errText string
+	}{
+		{name: "valid", modify: func(*ScrapeTarget) {}},
+		{
+			name: "valid https with auth and mapping",
+			modify: func(t *ScrapeTarget) {
+				t.URL = "https://iis.local:9443/metrics"
+				t.TLS = TLSConfig{CAFile: "ca.pem", CertFile: "c.pem", KeyFile: "k.pem"}
+				t.Auth = ScrapeAuthConfig{Type: "basic", Username: "prom", Password: "x"}
+				t.Families = nil
+				t.Metrics = []CustomMetric{{Name: "requests", Family: "iis_requests_total", Rate: true}}
+			},
+		},
+		{name: "invalid name", modify: func(t *ScrapeTarget) { t.Name = "My.SQL" }, errText: "invalid name"},
+		{name: "reserved name", modify: func(t *ScrapeTarget) { t.Name = "system" }, errText: "reserved"},
+		{name: "invalid url", modify: func(t *ScrapeTarget) { t.URL = "localhost:4000" }, errText: "invalid url"},
+		{name: "tls on http", modify: func(t *ScrapeTarget) { t.TLS.InsecureSkipVerify = true }, errText: "require an https url"},
+		{name: "short interval", modify: func(t *ScrapeTarget) { t.Interval = 5 * time.Second }, errText: "at least 10 seconds"},
+		{name: "timeout too long", modify: func(t *ScrapeTarget) { t.Timeout = time.Minute }, errText: "shorter than interval"},
+		{name: "basic without username", modify: func(t *ScrapeTarget) { t.Auth.Type = "basic" }, errText: "username is required"},
+		{name: "bearer without token", modify: func(t *ScrapeTarget) { t.Auth.Type = "bearer" }, errText: "token is required"},
+		{name: "unknown auth", modify: func(t *ScrapeTarget) { t.Auth.Type = "ntlm" }, errText: "invalid auth type"},
+		{name: "nothing selected", modify: func(t *ScrapeTarget) { t.Families = nil }, errText: "families or metrics"},
+		{name: "bad pattern", modify: func(t *ScrapeTarget) { t.Families = []string{"mssql_["} }, errText: "invalid family pattern"},
+		{
+			name:    "invalid mapping",
+			modify:  func(t *ScrapeTarget) { t.Metrics = []CustomMetric{{Name: "x"}} },
+			errText: "family is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := valid()
+			tt.modify(&target)
+			err := validateScrapeTargets([]ScrapeTarget{target})
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateScrapeTargets() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("validateScrapeTargets() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+
+	if err := validateScrapeTargets([]ScrapeTarget{valid(), valid()}); err == nil || !strings.Contains(err.Error(), "duplicate name") {
+		t.Errorf("duplicate targets error = %v, want duplicate name", err)
+	}
+}
@@ -0,0 +1,355 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Secret reference prefixes
+// A config value starting with one of these prefixes is resolved at load time
+// instead of being used literally, so credentials never have to sit in config.yaml
+const (
+	secretPrefixEnv   = "env:"    // env:NATS_TOKEN
+	secretPrefixFile  = "file:"   // file:C:\secrets\token
+	secretPrefixStore = "secret:" // secret:nats_token (agent-local encrypted store)
+)
+
+// Key sources for the encrypted secrets store
+const (
+	KeySourceMachine        = "machine"         // Key derived from the machine ID (MachineGuid / machine-id)
+	KeySourcePassphraseFile = "passphrase_file" // Key derived from the contents of a passphrase file
+)
+
+// pbkdf2Iterations is the PBKDF2-SHA256 work factor used to derive the store key
+const pbkdf2Iterations = 600000
+
+// secretStoreFile is the on-disk format of the encrypted secrets store
+// Each secret is sealed with AES-256-GCM; the secret name is used as
+// additional data so ciphertexts cannot be swapped between names
+type secretStoreFile struct {
+	Version int               `json:"version"`
+	Salt    string            `json:"salt"`    // base64 PBKDF2 salt
+	Secrets map[string]string `json:"secrets"` // name -> base64(nonce || ciphertext)
+}
+
+// secretField is a config value that may hold a secret reference
+type secretField struct {
+	name  string
+	value *string
+}
+
+// secretFields lists every config value that supports secret references
+func secretFields(cfg *Config) []secretField {
+	fields := []secretField{
+		{name: "nats.auth.token", value: &cfg.NATS.Auth.Token},
+		{name: "nats.auth.username", value: &cfg.NATS.Auth.Username},
+		{name: "nats.auth.password", value: &cfg.NATS.Auth.Password},
+	}
+	for i := range cfg.Tasks.ScrapeTargets {
+		auth := &cfg.Tasks.ScrapeTargets[i].Auth
+		fields = append(fields,
+			secretField{name: fmt.Sprintf("tasks.scrape_targets[%d].auth.password", i), value: &auth.Password},
+			secretField{name: fmt.Sprintf("tasks.scrape_targets[%d].auth.token", i), value: &auth.Token})
+	}
+	// The bootstrap token is only resolved while it is still needed
+	if cfg.NeedsEnrollment() {
+		fields = append(fields, secretField{name: "enrollment.bootstrap_token", value: &cfg.Enrollment.BootstrapToken})
+	}
+	return fields
+}
+
+// resolveSecrets replaces secret references in the config with their values
+// The source of each resolved field (env, file, store) is recorded in
+// cfg.SecretSources so it can be reported without echoing the value itself
+func resolveSecrets(cfg *Config) error {
+	resolver := &secretResolver{config: &cfg.Secrets}
+	cfg.SecretSources = make(map[string]string)
+
+	for _, field := range secretFields(cfg) {
+		source, value, err := resolver.resolve(*field.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+		if source != "" {
+			*field.value = value
+			cfg.SecretSources[field.name] = source
+		}
+	}
+
+	return nil
+}
+
+// secretResolver resolves secret references, opening the encrypted store lazily
+// so agents that never use "secret:" references don't need a store or key
+type secretResolver struct {
+	config *SecretsConfig
+	store  map[string]string
+}
+
+// resolve returns the source and value for a reference
+// Values without a known prefix are returned unchanged with an empty source
+func (r *secretResolver) resolve(ref string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretPrefixEnv):
+		name := strings.TrimPrefix(ref, secretPrefixEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return "", "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return "env", value, nil
+
+	case strings.HasPrefix(ref, secretPrefixFile):
+		path := strings.TrimPrefix(ref, secretPrefixFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			return "", "", fmt.Errorf("secret file is empty: %s", path)
+		}
+		return "file", value, nil
+
+	case strings.HasPrefix(ref, secretPrefixStore):
+		name := strings.TrimPrefix(ref, secretPrefixStore)
+		if r.store == nil {
+			store, err := readSecretStore(r.config)
+			if err != nil {
+				return "", "", err
+			}
+			r.store = store
+		}
+		value, ok := r.store[name]
+		if !ok {
+			return "", "", fmt.Errorf("secret %q not found in store %s", name, r.config.StoreFile)
+		}
+		return "store", value, nil
+
+	default:
+		return "", ref, nil
+	}
+}
+
+// readSecretStore decrypts every secret in the configured store
+func readSecretStore(cfg *SecretsConfig) (map[string]string, error) {
+	file, err := loadSecretStoreFile(cfg.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("secrets store not found: %s", cfg.StoreFile)
+	}
+
+	gcm, err := storeCipher(cfg, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]string, len(file.Secrets))
+	for name, sealed := range file.Secrets {
+		raw, err := base64.StdEncoding.DecodeString(sealed)
+		if err != nil || len(raw) < gcm.NonceSize() {
+			return nil, fmt.Errorf("secret %q is corrupt", name)
+		}
+		plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %q (wrong key?): %w", name, err)
+		}
+		secrets[name] = string(plain)
+	}
+
+	return secrets, nil
+}
+
+// StoreSecret encrypts a secret into the store configured in the given config file
+// Only the secrets section is read, so this works before the referencing
+// fields can be resolved (e.g. when provisioning a new machine)
+func StoreSecret(configPath, name, value string) error {
+	if name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	setDefaults(v)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg SecretsConfig
+	if err := v.UnmarshalKey("secrets", &cfg); err != nil {
+		return fmt.Errorf("failed to unmarshal secrets config: %w", err)
+	}
+	if err := validateSecrets(&cfg); err != nil {
+		return err
+	}
+	if cfg.StoreFile == "" {
+		return fmt.Errorf("secrets.store_file is required")
+	}
+
+	return writeSecret(&cfg, name, value)
+}
+
+// writeSecret adds or replaces a secret in the store, creating it if needed
+func writeSecret(cfg *SecretsConfig, name, value string) error {
+	file, err := loadSecretStoreFile(cfg.StoreFile)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+		file = &secretStoreFile{
+			Version: 1,
+			Salt:    base64.StdEncoding.EncodeToString(salt),
+			Secrets: make(map[string]string),
+		}
+	}
+
+	gcm, err := storeCipher(cfg, file.Salt)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to mix keys in one store - existing secrets must decrypt with this key
+	for existing, sealed := range file.Secrets {
+		raw, err := base64.StdEncoding.DecodeString(sealed)
+		if err != nil || len(raw) < gcm.NonceSize() {
+			return fmt.Errorf("secret %q is corrupt", existing)
+		}
+		if _, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(existing)); err != nil {
+			return fmt.Errorf("key does not match existing secrets store %s", cfg.StoreFile)
+		}
+		break
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+	file.Secrets[name] = base64.StdEncoding.EncodeToString(sealed)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets store: %w", err)
+	}
+
+	// Write to a temp file and rename so a crash never leaves a truncated store
+	if err := os.MkdirAll(filepath.Dir(cfg.StoreFile), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	tmp := cfg.StoreFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets store: %w", err)
+	}
+	if err := os.Rename(tmp, cfg.StoreFile); err != nil {
+		return fmt.Errorf("failed to replace secrets store: %w", err)
+	}
+
+	return nil
+}
+
+// loadSecretStoreFile reads the store file, returning nil if it doesn't exist
+func loadSecretStoreFile(path string) (*secretStoreFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets store: %w", err)
+	}
+
+	var file secretStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets store: %w", err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported secrets store version: %d", file.Version)
+	}
+	if file.Secrets == nil {
+		file.Secrets = make(map[string]string)
+	}
+
+	return &file, nil
+}
+
+// storeCipher derives the store key and returns an AES-GCM cipher
+func storeCipher(cfg *SecretsConfig, encodedSalt string) (cipher.AEAD, error) {
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets store salt: %w", err)
+	}
+
+	material, err := keyMaterial(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, material, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive secrets key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyMaterial returns the secret input for key derivation
+func keyMaterial(cfg *SecretsConfig) (string, error) {
+	switch cfg.KeySource {
+	case KeySourcePassphraseFile:
+		data, err := os.ReadFile(cfg.PassphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		passphrase := strings.TrimSpace(string(data))
+		if passphrase == "" {
+			return "", fmt.Errorf("passphrase file is empty: %s", cfg.PassphraseFile)
+		}
+		return passphrase, nil
+
+	case KeySourceMachine, "":
+		id, err := MachineID()
+		if err != nil {
+			return "", fmt.Errorf("failed to read machine ID for secrets key: %w", err)
+		}
+		// Domain-separate the machine ID so the derived key is specific to this use
+		return "win-agent-secrets:" + id, nil
+
+	default:
+		return "", fmt.Errorf("invalid secrets key_source: %s", cfg.KeySource)
+	}
+}
+
+// validateSecrets checks the secrets store settings
+func validateSecrets(cfg *SecretsConfig) error {
+	switch cfg.KeySource {
+	case KeySourceMachine, "":
+		// Machine ID is read lazily when the store is first used
+	case KeySourcePassphraseFile:
+		if cfg.PassphraseFile == "" {
+			return fmt.Errorf("secrets.passphrase_file is required when key_source is %s", KeySourcePassphraseFile)
+		}
+	default:
+		return fmt.Errorf("invalid secrets key_source: %s (must be %s or %s)", cfg.KeySource, KeySourceMachine, KeySourcePassphraseFile)
+	}
+
+	return nil
+}
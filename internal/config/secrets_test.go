@@ -0,0 +1,245 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResolveSecretReferences tests env: and file: reference resolution
+func TestResolveSecretReferences(t *testing.T) {
+	tmpDir := t.TempDir()
+	tokenFile := filepath.Join(tmpDir, "token")
+	os.WriteFile(tokenFile, []byte("file-token\r\n"), 0600)
+	emptyFile := filepath.Join(tmpDir, "empty")
+	os.WriteFile(emptyFile, []byte("  \n"), 0600)
+
+	t.Setenv("WIN_AGENT_TEST_PASSWORD", "env-password")
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantSource string
+		wantValue  string
+		wantErr    bool
+		errText    string
+	}{
+		{
+			name:       "literal value",
+			ref:        "plain-token",
+			wantSource: "",
+			wantValue:  "plain-token",
+		},
+		{
+			name:       "empty value",
+			ref:        "",
+			wantSource: "",
+			wantValue:  "",
+		},
+		{
+			name:       "environment variable",
+			ref:        "env:WIN_AGENT_TEST_PASSWORD",
+			wantSource: "env",
+			wantValue:  "env-password",
+		},
+		{
+			name:       "file trims whitespace",
+			ref:        "file:" + tokenFile,
+			wantSource: "file",
+			wantValue:  "file-token",
+		},
+		{
+			name:    "missing environment variable",
+			ref:     "env:WIN_AGENT_TEST_UNSET",
+			wantErr: true,
+			errText: "is not set",
+		},
+		{
+			name:    "missing file",
+			ref:     "file:" + filepath.Join(tmpDir, "nope"),
+			wantErr: true,
+			errText: "failed to read secret file",
+		},
+		{
+			name:    "empty file",
+			ref:     "file:" + emptyFile,
+			wantErr: true,
+			errText: "secret file is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &secretResolver{config: &SecretsConfig{}}
+			source, value, err := r.resolve(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if indexOf(err.Error(), tt.errText) < 0 {
+					t.Errorf("resolve() error = %v, want error containing %q", err, tt.errText)
+				}
+				return
+			}
+			if source != tt.wantSource {
+				t.Errorf("resolve() source = %q, want %q", source, tt.wantSource)
+			}
+			if value != tt.wantValue {
+				t.Errorf("resolve() value = %q, want %q", value, tt.wantValue)
+			}
+		})
+	}
+}
+
+// TestSecretStoreRoundTrip tests writing and reading the encrypted store
+func TestSecretStoreRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	passphraseFile := filepath.Join(tmpDir, "passphrase")
+	os.WriteFile(passphraseFile, []byte("correct horse battery staple\n"), 0600)
+
+	cfg := &SecretsConfig{
+		StoreFile:      filepath.Join(tmpDir, "store", "secrets.json"),
+		KeySource:      KeySourcePassphraseFile,
+		PassphraseFile: passphraseFile,
+	}
+
+	if err := writeSecret(cfg, "nats_token", "s3cret"); err != nil {
+		t.Fatalf("writeSecret() error = %v", err)
+	}
+	if err := writeSecret(cfg, "nats_password", "hunter2"); err != nil {
+		t.Fatalf("writeSecret() second secret error = %v", err)
+	}
+
+	// The plaintext must not appear in the store file
+	raw, err := os.ReadFile(cfg.StoreFile)
+	if err != nil {
+		t.Fatalf("failed to read store: %v", err)
+	}
+	if indexOf(string(raw), "s3cret") >= 0 || indexOf(string(raw), "hunter2") >= 0 {
+		t.Error("store file contains plaintext secret")
+	}
+
+	secrets, err := readSecretStore(cfg)
+	if err != nil {
+		t.Fatalf("readSecretStore() error = %v", err)
+	}
+	if secrets["nats_token"] != "s3cret" {
+		t.Errorf("nats_token = %q, want %q", secrets["nats_token"], "s3cret")
+	}
+	if secrets["nats_password"] != "hunter2" {
+		t.Errorf("nats_password = %q, want %q", secrets["nats_password"], "hunter2")
+	}
+
+	// A different passphrase must not decrypt or extend the store
+	os.WriteFile(passphraseFile, []byte("wrong passphrase"), 0600)
+	if _, err := readSecretStore(cfg); err == nil {
+		t.Error("readSecretStore() with wrong key should fail")
+	}
+	if err := writeSecret(cfg, "other", "value"); err == nil {
+		t.Error("writeSecret() with wrong key should fail")
+	}
+}
+
+// TestResolveSecretsInConfig tests that resolved fields are replaced and their sources recorded
+func TestResolveSecretsInConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	passphraseFile := filepath.Join(tmpDir, "passphrase")
+	os.WriteFile(passphraseFile, []byte("passphrase"), 0600)
+
+	secrets := SecretsConfig{
+		StoreFile:      filepath.Join(tmpDir, "secrets.json"),
+		KeySource:      KeySourcePassphraseFile,
+		PassphraseFile: passphraseFile,
+	}
+	if err := writeSecret(&secrets, "nats_password", "store-password"); err != nil {
+		t.Fatalf("writeSecret() error = %v", err)
+	}
+	t.Setenv("WIN_AGENT_TEST_USER", "agent-user")
+
+	cfg := &Config{
+		NATS: NATSConfig{
+			Auth: AuthConfig{
+				Type:     "userpass",
+				Username: "env:WIN_AGENT_TEST_USER",
+				Password: "secret:nats_password",
+			},
+		},
+		Secrets: secrets,
+	}
+
+	if err := resolveSecrets(cfg); err != nil {
+		t.Fatalf("resolveSecrets() error = %v", err)
+	}
+	if cfg.NATS.Auth.Username != "agent-user" {
+		t.Errorf("Username = %q, want %q", cfg.NATS.Auth.Username, "agent-user")
+	}
+	if cfg.NATS.Auth.Password != "store-password" {
+		t.Errorf("Password = %q, want %q", cfg.NATS.Auth.Password, "store-password")
+	}
+	if cfg.SecretSources["nats.auth.username"] != "env" {
+		t.Errorf("username source = %q, want env", cfg.SecretSources["nats.auth.username"])
+	}
+	if cfg.SecretSources["nats.auth.password"] != "store" {
+		t.Errorf("password source = %q, want store", cfg.SecretSources["nats.auth.password"])
+	}
+	if _, ok := cfg.SecretSources["nats.auth.token"]; ok {
+		t.Error("empty token should not be recorded as a secret source")
+	}
+
+	// Unknown store entries are an error, not a silent empty value
+	cfg.NATS.Auth.Password = "secret:missing"
+	if err := resolveSecrets(cfg); err == nil || indexOf(err.Error(), "not found in store") < 0 {
+		t.Errorf("resolveSecrets() error = %v, want not found in store", err)
+	}
+}
+
+// TestValidateSecrets tests secrets store settings validation
+func TestValidateSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SecretsConfig
+		wantErr bool
+		errText string
+	}{
+		{
+			name:    "default key source",
+			cfg:     SecretsConfig{},
+			wantErr: false,
+		},
+		{
+			name:    "machine key source",
+			cfg:     SecretsConfig{KeySource: KeySourceMachine},
+			wantErr: false,
+		},
+		{
+			name:    "passphrase file",
+			cfg:     SecretsConfig{KeySource: KeySourcePassphraseFile, PassphraseFile: "pass.txt"},
+			wantErr: false,
+		},
+		{
+			name:    "passphrase file missing",
+			cfg:     SecretsConfig{KeySource: KeySourcePassphraseFile},
+			wantErr: true,
+			errText: "passphrase_file is required",
+		},
+		{
+			name:    "invalid key source",
+			cfg:     SecretsConfig{KeySource: "tpm"},
+			wantErr: true,
+			errText: "invalid secrets key_source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSecrets(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSecrets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && indexOf(err.Error(), tt.errText) < 0 {
+				t.Errorf("validateSecrets() error = %v, want error containing %q", err, tt.errText)
+			}
+		})
+	}
+}
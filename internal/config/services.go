@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// IsServicePattern reports whether a service_check entry is a glob pattern
+// (containing *, ? or [) rather than an exact service name
+func IsServicePattern(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// MatchService reports whether a service name matches a service_check entry
+// Patterns use path.Match syntax; names and patterns compare case-insensitively
+// on Windows, like service names there, and exactly elsewhere (systemd units)
+func MatchService(entry, name string) bool {
+	return matchService(entry, name, runtime.GOOS == "windows")
+}
+
+// matchService matches an entry, folding case when foldCase is set
+func matchService(entry, name string, foldCase bool) bool {
+	if foldCase {
+		entry, name = strings.ToLower(entry), strings.ToLower(name)
+	}
+	if !IsServicePattern(entry) {
+		return entry == name
+	}
+	matched, err := path.Match(entry, name)
+	return err == nil && matched
+}
+
+// ServiceKey identifies a service name for lookups and de-duplication:
+// Windows service names are case-insensitive, systemd unit names are not
+func ServiceKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// isMonitoredService reports whether any service_check entry covers name
+func isMonitoredService(services []string, name string) bool {
+	for _, entry := range services {
+		if MatchService(entry, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateServicePatterns checks the syntax of service_check patterns
+func validateServicePatterns(services []string) error {
+	for _, entry := range services {
+		if !IsServicePattern(entry) {
+			continue
+		}
+		if _, err := path.Match(entry, ""); err != nil {
+			return fmt.Errorf("invalid service pattern %q: %w", entry, err)
+		}
+	}
+	return nil
+}
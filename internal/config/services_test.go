@@ -0,0 +1,67 @@
+package config
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestMatchService tests exact names and glob patterns in service_check.services
+func TestMatchService(t *testing.T) {
+	tests := []struct {
+		entry     string
+		name      string
+		want      bool // Case-insensitive, as on Windows
+		wantExact bool // Case-sensitive, as on Linux
+	}{
+		{"Spooler", "Spooler", true, true},
+		{"Spooler", "spooler", true, false},
+		{"Spooler", "SpoolerX", false, false},
+		{"MSSQL$*", "MSSQL$PROD", true, true},
+		{"MSSQL$*", "mssql$dev", true, false},
+		{"MSSQL$*", "MSSQLSERVER", false, false},
+		{"SQLAgent$?", "SQLAgent$A", true, true},
+		{"W3SVC", "W3SVC*", false, false},
+		{"[ab]*", "bits", true, true},
+		{"nginx*.service", "NGINX.service", true, false},
+	}
+	for _, tt := range tests {
+		if got := matchService(tt.entry, tt.name, true); got != tt.want {
+			t.Errorf("matchService(%q, %q, fold) = %v, want %v", tt.entry, tt.name, got, tt.want)
+		}
+		if got := matchService(tt.entry, tt.name, false); got != tt.wantExact {
+			t.Errorf("matchService(%q, %q, exact) = %v, want %v", tt.entry, tt.name, got, tt.wantExact)
+		}
+		want := tt.wantExact
+		if runtime.GOOS == "windows" {
+			want = tt.want
+		}
+		if got := MatchService(tt.entry, tt.name); got != want {
+			t.Errorf("MatchService(%q, %q) = %v, want %v", tt.entry, tt.name, got, want)
+		}
+	}
+}
+
+// TestValidateServicePatterns tests pattern syntax checks and rules on matched services
+func TestValidateServicePatterns(t *testing.T) {
+	if err := validateServicePatterns([]string{"Spooler", "MSSQL$*"}); err != nil {
+		t.Errorf("validateServicePatterns() error = %v", err)
+	}
+	if err := validateServicePatterns([]string{"MSSQL[*"}); err == nil || !strings.Contains(err.Error(), "invalid service pattern") {
+		t.Errorf("validateServicePatterns() error = %v, want invalid pattern", err)
+	}
+
+	// Recovery policies and alert rules may name services matched by a pattern
+	check := &ServiceCheckConfig{
+		Enabled:  true,
+		Services: []string{"MSSQL$*"},
+		Recovery: []RecoveryPolicy{{Service: "MSSQL$PROD"}},
+	}
+	if err := validateRecovery(check, ""); err != nil {
+		t.Errorf("validateRecovery() error = %v", err)
+	}
+	check.Recovery[0].Service = "W32Time"
+	if err := validateRecovery(check, ""); err == nil {
+		t.Error("validateRecovery() accepted a service no pattern matches")
+	}
+}
@@ -0,0 +1,356 @@
+package messages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Wire encodings
+const (
+	EncodingJSON     = "json"
+	EncodingMsgPack  = "msgpack"
+	EncodingProtobuf = "protobuf"
+)
+
+// Compression algorithms
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Headers advertising how a message body is encoded
+const (
+	HeaderContentType     = "Content-Type"
+	HeaderContentEncoding = "Content-Encoding"
+)
+
+// Content types, one per encoding
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgPack  = "application/msgpack"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// maxDecodedSize caps a decompressed request so a small compressed body
+// cannot expand into an unbounded allocation
+const maxDecodedSize = 16 << 20
+
+// Codec encodes and decodes message bodies in one wire encoding
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// NewCodec returns the codec for an encoding name (json when empty)
+func NewCodec(encoding string) (Codec, error) {
+	switch encoding {
+	case "", EncodingJSON:
+		return jsonCodec{}, nil
+	case EncodingMsgPack:
+		return msgpackCodec{}, nil
+	case EncodingProtobuf:
+		return protobufCodec{}, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+// codecForContentType returns the codec for a Content-Type header value
+// Parameters such as charset are ignored; an empty value means JSON
+func codecForContentType(contentType string) (Codec, error) {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch strings.ToLower(mediaType) {
+	case "", ContentTypeJSON:
+		return jsonCodec{}, nil
+	case ContentTypeMsgPack, "application/x-msgpack", "application/vnd.msgpack":
+		return msgpackCodec{}, nil
+	case ContentTypeProtobuf, "application/x-protobuf":
+		return protobufCodec{}, nil
+	}
+	return nil, fmt.Errorf("unsupported content type: %s", contentType)
+}
+
+// Decode decodes a request body according to its Content-Type and
+// Content-Encoding headers into v (a JSON-tagged struct)
+func Decode(contentType, contentEncoding string, data []byte, v interface{}) error {
+	codec, err := codecForContentType(contentType)
+	if err != nil {
+		return err
+	}
+	data, err = decompress(contentEncoding, data)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, v)
+}
+
+// jsonCodec is the default encoding
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// msgpackCodec encodes the same document as JSON (same field names, same
+// omitted fields) in MessagePack
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return ContentTypeMsgPack }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	doc, err := jsonDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(doc)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := msgpack.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid msgpack: %w", err)
+	}
+	return fromDocument(doc, v)
+}
+
+// protobufCodec encodes an Envelope as winagent.v1.Envelope and raw payloads
+// as google.protobuf.Value; requests are decoded from google.protobuf.Struct
+// (see proto/winagent/v1/envelope.proto)
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	if env, ok := v.(*Envelope); ok {
+		return marshalProtoEnvelope(env)
+	}
+	value, err := protoValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(value)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	var request structpb.Struct
+	if err := proto.Unmarshal(data, &request); err != nil {
+		return fmt.Errorf("invalid protobuf: %w", err)
+	}
+	return fromDocument(request.AsMap(), v)
+}
+
+// Field numbers of winagent.v1.Envelope (proto/winagent/v1/envelope.proto)
+const (
+	protoFieldSchema       = 1
+	protoFieldVersion      = 2
+	protoFieldDeviceID     = 3
+	protoFieldAgentVersion = 4
+	protoFieldSeq          = 5
+	protoFieldTimestamp    = 6
+	protoFieldData         = 7
+)
+
+// marshalProtoEnvelope writes an Envelope in the winagent.v1.Envelope wire format
+// Zero values are left out, as proto3 does
+func marshalProtoEnvelope(env *Envelope) ([]byte, error) {
+	value, err := protoValue(env.Data)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode data: %w", err)
+	}
+
+	var b []byte
+	appendString := func(num protowire.Number, s string) {
+		if s != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	appendVarint := func(num protowire.Number, n uint64) {
+		if n != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, n)
+		}
+	}
+
+	appendString(protoFieldSchema, env.Schema)
+	appendVarint(protoFieldVersion, uint64(env.Version))
+	appendString(protoFieldDeviceID, env.DeviceID)
+	appendString(protoFieldAgentVersion, env.AgentVersion)
+	appendVarint(protoFieldSeq, env.Seq)
+	appendString(protoFieldTimestamp, env.Timestamp)
+	b = protowire.AppendTag(b, protoFieldData, protowire.BytesType)
+	b = protowire.AppendBytes(b, data)
+	return b, nil
+}
+
+// protoValue converts a payload to google.protobuf.Value via its JSON document
+func protoValue(v interface{}) (*structpb.Value, error) {
+	doc, err := jsonDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	// structpb only knows float64 numbers
+	value, err := structpb.NewValue(floatNumbers(doc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to protobuf value: %w", err)
+	}
+	return value, nil
+}
+
+// jsonDocument returns v as the generic value encoding/json would produce
+// (maps, slices, strings, bools, nil and int64/float64 numbers), so binary
+// encodings carry exactly the fields described by the JSON Schemas
+func jsonDocument(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return intNumbers(doc), nil
+}
+
+// intNumbers replaces json.Number with int64 where exact, float64 otherwise
+func intNumbers(doc interface{}) interface{} {
+	switch val := doc.(type) {
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = intNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = intNumbers(item)
+		}
+	}
+	return doc
+}
+
+// floatNumbers replaces int64 with float64 for structpb
+func floatNumbers(doc interface{}) interface{} {
+	switch val := doc.(type) {
+	case int64:
+		return float64(val)
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = floatNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = floatNumbers(item)
+		}
+	}
+	return doc
+}
+
+// fromDocument decodes a generic value into a JSON-tagged struct
+func fromDocument(doc interface{}, v interface{}) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// zstd encoder/decoder are safe for concurrent EncodeAll/DecodeAll and costly to create
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedSize))
+	})
+}
+
+// compress applies a compression algorithm (none when empty)
+func compress(compression string, data []byte) ([]byte, error) {
+	switch compression {
+	case "", CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		initZstd()
+		if zstdErr != nil {
+			return nil, zstdErr
+		}
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", compression)
+}
+
+// decompress reverses a Content-Encoding (identity when empty)
+func decompress(contentEncoding string, data []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity", CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, maxDecodedSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		if len(out) > maxDecodedSize {
+			return nil, fmt.Errorf("decompressed body exceeds %d bytes", maxDecodedSize)
+		}
+		return out, nil
+	case CompressionZstd:
+		initZstd()
+		if zstdErr != nil {
+			return nil, zstdErr
+		}
+		out, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %w", err)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding: %s", contentEncoding)
+}
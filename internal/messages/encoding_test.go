@@ -0,0 +1,173 @@
+package messages
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// encodingTestPayload has the field kinds that differ between encodings
+type encodingTestPayload struct {
+	Name    string          `json:"name"`
+	Count   int             `json:"count"`
+	Ratio   float64         `json:"ratio"`
+	Skipped string          `json:"skipped,omitempty"`
+	Output  json.RawMessage `json:"output"`
+}
+
+// TestWrapperEncodings tests every encoding and compression round trip
+func TestWrapperEncodings(t *testing.T) {
+	payload := encodingTestPayload{Name: "svc", Count: 3, Ratio: 0.5, Output: json.RawMessage(`{"ok":true}`)}
+
+	for _, encoding := range []string{EncodingJSON, EncodingMsgPack, EncodingProtobuf} {
+		for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+			t.Run(encoding+"/"+compression, func(t *testing.T) {
+				w, err := NewWrapper(Options{
+					Encoding:     encoding,
+					Compression:  compression,
+					DeviceID:     "device-001",
+					AgentVersion: "1.2.3",
+				})
+				if err != nil {
+					t.Fatalf("NewWrapper() error = %v", err)
+				}
+				data, err := w.Marshal(SchemaHeartbeat, 5, payload)
+				if err != nil {
+					t.Fatalf("Marshal() error = %v", err)
+				}
+
+				if compression == CompressionNone && w.ContentEncoding() != "" {
+					t.Errorf("ContentEncoding() = %q, want empty", w.ContentEncoding())
+				}
+				raw, err := decompress(w.ContentEncoding(), data)
+				if err != nil {
+					t.Fatalf("decompress() error = %v", err)
+				}
+
+				env := decodeEnvelope(t, w.ContentType(), raw)
+				if env["schema"] != "win-agent.heartbeat" || env["device_id"] != "device-001" {
+					t.Errorf("envelope = %v", env)
+				}
+				body, _ := env["data"].(map[string]interface{})
+				if body["name"] != "svc" {
+					t.Errorf("data.name = %v, want svc", body["name"])
+				}
+				if _, ok := body["skipped"]; ok {
+					t.Error("omitempty field was encoded")
+				}
+				output, _ := body["output"].(map[string]interface{})
+				if output["ok"] != true {
+					t.Errorf("data.output = %v, want embedded object", body["output"])
+				}
+			})
+		}
+	}
+}
+
+// decodeEnvelope decodes an encoded envelope into a generic map
+func decodeEnvelope(t *testing.T, contentType string, data []byte) map[string]interface{} {
+	t.Helper()
+	env := map[string]interface{}{}
+
+	switch contentType {
+	case ContentTypeJSON:
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+	case ContentTypeMsgPack:
+		if err := msgpack.Unmarshal(data, &env); err != nil {
+			t.Fatalf("invalid msgpack: %v", err)
+		}
+	case ContentTypeProtobuf:
+		for len(data) > 0 {
+			num, typ, n := protowire.ConsumeTag(data)
+			if n < 0 {
+				t.Fatalf("invalid protobuf tag")
+			}
+			data = data[n:]
+			switch typ {
+			case protowire.BytesType:
+				value, n := protowire.ConsumeBytes(data)
+				data = data[n:]
+				switch num {
+				case protoFieldSchema:
+					env["schema"] = string(value)
+				case protoFieldDeviceID:
+					env["device_id"] = string(value)
+				case protoFieldData:
+					var v structpb.Value
+					if err := proto.Unmarshal(value, &v); err != nil {
+						t.Fatalf("invalid data value: %v", err)
+					}
+					env["data"] = v.AsInterface()
+				}
+			case protowire.VarintType:
+				_, n := protowire.ConsumeVarint(data)
+				data = data[n:]
+			default:
+				t.Fatalf("unexpected wire type %v", typ)
+			}
+		}
+	default:
+		t.Fatalf("unexpected content type %s", contentType)
+	}
+	return env
+}
+
+// TestDecodeRequest tests request decoding by content type and encoding
+func TestDecodeRequest(t *testing.T) {
+	type request struct {
+		Action      string `json:"action"`
+		ServiceName string `json:"service_name"`
+	}
+	doc := map[string]interface{}{"action": "restart", "service_name": "Spooler"}
+
+	jsonBody, _ := json.Marshal(doc)
+	msgpackBody, _ := msgpack.Marshal(doc)
+	pbStruct, _ := structpb.NewStruct(doc)
+	protoBody, _ := proto.Marshal(pbStruct)
+	gzipBody, _ := compress(CompressionGzip, jsonBody)
+	zstdBody, _ := compress(CompressionZstd, msgpackBody)
+
+	tests := []struct {
+		name            string
+		contentType     string
+		contentEncoding string
+		body            []byte
+		wantErr         bool
+	}{
+		{name: "no headers is JSON", body: jsonBody},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", body: jsonBody},
+		{name: "msgpack", contentType: ContentTypeMsgPack, body: msgpackBody},
+		{name: "protobuf struct", contentType: ContentTypeProtobuf, body: protoBody},
+		{name: "gzip json", contentEncoding: "gzip", body: gzipBody},
+		{name: "zstd msgpack", contentType: ContentTypeMsgPack, contentEncoding: "zstd", body: zstdBody},
+		{name: "unknown content type", contentType: "text/xml", body: jsonBody, wantErr: true},
+		{name: "unknown content encoding", contentEncoding: "br", body: jsonBody, wantErr: true},
+		{name: "body does not match encoding", contentEncoding: "gzip", body: jsonBody, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req request
+			err := Decode(tt.contentType, tt.contentEncoding, tt.body, &req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (req.Action != "restart" || req.ServiceName != "Spooler") {
+				t.Errorf("Decode() = %+v", req)
+			}
+		})
+	}
+}
+
+// TestCloudEventsProtobufRejected tests the unsupported format/encoding combination
+func TestCloudEventsProtobufRejected(t *testing.T) {
+	if _, err := NewWrapper(Options{Format: FormatCloudEvents, Encoding: EncodingProtobuf}); err == nil {
+		t.Error("NewWrapper() cloudevents+protobuf should fail")
+	}
+}
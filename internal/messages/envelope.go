@@ -0,0 +1,170 @@
+package messages
+
+import (
+	"fmt"
+	"time"
+)
+
+// Message formats
+const (
+	FormatEnvelope    = "envelope"    // Standard envelope (default)
+	FormatCloudEvents = "cloudevents" // CloudEvents 1.0 structured JSON
+	FormatRaw         = "raw"         // Payload only, as before the envelope existed
+)
+
+// SchemaPrefix namespaces every schema name
+const SchemaPrefix = "win-agent."
+
+// Envelope is the standard wrapper around every telemetry message and reply
+// Consumers can identify the source and payload type without parsing the subject
+type Envelope struct {
+	Schema       string      `json:"schema"`  // e.g. win-agent.heartbeat
+	Version      int         `json:"version"` // Schema version of data
+	DeviceID     string      `json:"device_id"`
+	AgentVersion string      `json:"agent_version"`
+	Seq          uint64      `json:"seq,omitempty"` // Per-subject sequence (telemetry only)
+	Timestamp    string      `json:"ts"`
+	Data         interface{} `json:"data"`
+}
+
+// CloudEvent is the CloudEvents 1.0 structured form of an Envelope
+// Envelope fields without a CloudEvents attribute become extension attributes
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"` // {schema}.v{version}
+	Time            string      `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	DataSchema      string      `json:"dataschema"`
+	DeviceID        string      `json:"deviceid"`
+	AgentVersion    string      `json:"agentversion"`
+	Seq             uint64      `json:"seq,omitempty"`
+	Data            interface{} `json:"data"`
+}
+
+// Wrapper wraps payloads in the configured message format and encodes them
+type Wrapper struct {
+	format       string
+	codec        Codec
+	compression  string
+	deviceID     string
+	agentVersion string
+}
+
+// Options configures a Wrapper
+type Options struct {
+	Format       string // envelope (default), cloudevents, raw
+	Encoding     string // json (default), msgpack, protobuf
+	Compression  string // none (default), gzip, zstd
+	DeviceID     string
+	AgentVersion string
+}
+
+// NewWrapper creates a wrapper for one agent identity
+func NewWrapper(opts Options) (*Wrapper, error) {
+	if opts.Format == "" {
+		opts.Format = FormatEnvelope
+	}
+	if opts.Compression == "" {
+		opts.Compression = CompressionNone
+	}
+	codec, err := NewCodec(opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Format == FormatCloudEvents && opts.Encoding == EncodingProtobuf {
+		// The CloudEvents protobuf format is not implemented
+		return nil, fmt.Errorf("cloudevents format supports json and msgpack encodings only")
+	}
+	return &Wrapper{
+		format:       opts.Format,
+		codec:        codec,
+		compression:  opts.Compression,
+		deviceID:     opts.DeviceID,
+		agentVersion: opts.AgentVersion,
+	}, nil
+}
+
+// Format returns the configured message format
+func (w *Wrapper) Format() string {
+	return w.format
+}
+
+// Wrap returns the value to encode for a payload of the given schema
+// schema is the short name (e.g. "heartbeat"); seq is 0 for replies
+func (w *Wrapper) Wrap(schema string, seq uint64, data interface{}) interface{} {
+	now := time.Now().UTC()
+	version := SchemaVersion(schema)
+
+	switch w.format {
+	case FormatRaw:
+		return data
+
+	case FormatCloudEvents:
+		id := fmt.Sprintf("%s.%s.%d", w.deviceID, schema, seq)
+		if seq == 0 {
+			// Replies are not sequenced; the timestamp keeps IDs unique per source
+			id = fmt.Sprintf("%s.%s.%d", w.deviceID, schema, now.UnixNano())
+		}
+		return &CloudEvent{
+			SpecVersion:     "1.0",
+			ID:              id,
+			Source:          "/win-agent/" + w.deviceID,
+			Type:            fmt.Sprintf("%s%s.v%d", SchemaPrefix, schema, version),
+			Time:            now.Format(time.RFC3339),
+			DataContentType: w.codec.ContentType(),
+			DataSchema:      SchemaID(schema),
+			DeviceID:        w.deviceID,
+			AgentVersion:    w.agentVersion,
+			Seq:             seq,
+			Data:            data,
+		}
+
+	default:
+		return &Envelope{
+			Schema:       SchemaPrefix + schema,
+			Version:      version,
+			DeviceID:     w.deviceID,
+			AgentVersion: w.agentVersion,
+			Seq:          seq,
+			Timestamp:    now.Format(time.RFC3339),
+			Data:         data,
+		}
+	}
+}
+
+// ContentType returns the Content-Type header value for encoded messages
+func (w *Wrapper) ContentType() string {
+	return w.codec.ContentType()
+}
+
+// ContentEncoding returns the Content-Encoding header value, or "" when uncompressed
+func (w *Wrapper) ContentEncoding() string {
+	if w.compression == CompressionNone {
+		return ""
+	}
+	return w.compression
+}
+
+// Marshal wraps, encodes and compresses a payload
+func (w *Wrapper) Marshal(schema string, seq uint64, data interface{}) ([]byte, error) {
+	encoded, err := w.codec.Marshal(w.Wrap(schema, seq, data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", schema, err)
+	}
+	compressed, err := compress(w.compression, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress %s: %w", schema, err)
+	}
+	return compressed, nil
+}
+
+// ValidFormat reports whether format is a supported message format
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatEnvelope, FormatCloudEvents, FormatRaw:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package messages
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testPayload is a small payload used by the envelope tests
+type testPayload struct {
+	Value string `json:"value"`
+}
+
+// TestWrapFormats tests each message format around the same payload
+func TestWrapFormats(t *testing.T) {
+	payload := testPayload{Value: "ok"}
+
+	tests := []struct {
+		name   string
+		format string
+		check  func(t *testing.T, decoded map[string]interface{})
+	}{
+		{
+			name:   "envelope is the default",
+			format: "",
+			check: func(t *testing.T, decoded map[string]interface{}) {
+				if decoded["schema"] != "win-agent.heartbeat" {
+					t.Errorf("schema = %v, want win-agent.heartbeat", decoded["schema"])
+				}
+				if decoded["version"] != float64(1) {
+					t.Errorf("version = %v, want 1", decoded["version"])
+				}
+				if decoded["device_id"] != "device-001" || decoded["agent_version"] != "1.2.3" {
+					t.Errorf("identity = %v/%v", decoded["device_id"], decoded["agent_version"])
+				}
+				if decoded["seq"] != float64(7) {
+					t.Errorf("seq = %v, want 7", decoded["seq"])
+				}
+				if decoded["ts"] == "" || decoded["ts"] == nil {
+					t.Error("ts is empty")
+				}
+				data, _ := decoded["data"].(map[string]interface{})
+				if data["value"] != "ok" {
+					t.Errorf("data = %v, want payload", decoded["data"])
+				}
+			},
+		},
+		{
+			name:   "cloudevents",
+			format: FormatCloudEvents,
+			check: func(t *testing.T, decoded map[string]interface{}) {
+				if decoded["specversion"] != "1.0" {
+					t.Errorf("specversion = %v, want 1.0", decoded["specversion"])
+				}
+				if decoded["type"] != "win-agent.heartbeat.v1" {
+					t.Errorf("type = %v, want win-agent.heartbeat.v1", decoded["type"])
+				}
+				if decoded["id"] != "device-001.heartbeat.7" {
+					t.Errorf("id = %v, want device-001.heartbeat.7", decoded["id"])
+				}
+				if decoded["source"] != "/win-agent/device-001" {
+					t.Errorf("source = %v", decoded["source"])
+				}
+				if decoded["dataschema"] != SchemaID(SchemaHeartbeat) {
+					t.Errorf("dataschema = %v, want %s", decoded["dataschema"], SchemaID(SchemaHeartbeat))
+				}
+				if _, ok := decoded["data"].(map[string]interface{}); !ok {
+					t.Errorf("data = %v, want object", decoded["data"])
+				}
+			},
+		},
+		{
+			name:   "raw keeps the bare payload",
+			format: FormatRaw,
+			check: func(t *testing.T, decoded map[string]interface{}) {
+				if decoded["value"] != "ok" || len(decoded) != 1 {
+					t.Errorf("raw = %v, want bare payload", decoded)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWrapper(Options{Format: tt.format, DeviceID: "device-001", AgentVersion: "1.2.3"})
+			if err != nil {
+				t.Fatalf("NewWrapper() error = %v", err)
+			}
+			data, err := w.Marshal(SchemaHeartbeat, 7, payload)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Marshal() produced invalid JSON: %v", err)
+			}
+			tt.check(t, decoded)
+		})
+	}
+}
+
+// TestWrapReplyOmitsSeq tests that unsequenced replies carry no seq
+func TestWrapReplyOmitsSeq(t *testing.T) {
+	w, err := NewWrapper(Options{DeviceID: "device-001", AgentVersion: "1.2.3"})
+	if err != nil {
+		t.Fatalf("NewWrapper() error = %v", err)
+	}
+	data, err := w.Marshal(SchemaReplyPing, 0, testPayload{})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if _, ok := decoded["seq"]; ok {
+		t.Errorf("reply envelope has seq = %v", decoded["seq"])
+	}
+}
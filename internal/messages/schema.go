@@ -0,0 +1,185 @@
+package messages
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Schema names of published telemetry and command replies
+// The full name in an envelope is SchemaPrefix + name
+const (
+	SchemaHeartbeat          = "heartbeat"
+	SchemaSystemMetrics      = "telemetry.system"
+	SchemaSystemMetricsError = "telemetry.system.error"
+	SchemaServiceStatus      = "telemetry.service"
+	SchemaProcessStatus      = "telemetry.process"
+	SchemaInventory          = "telemetry.inventory"
+	SchemaInventoryDiff      = "telemetry.inventory.diff"
+	SchemaScrapeTarget       = "telemetry.target" // Published on telemetry.{target name}
+	SchemaScrapeTargetError  = "telemetry.target.error"
+	SchemaCertExpiry         = "events.cert_expiry"
+	SchemaServiceTransition  = "events.service"
+	SchemaServiceRecovery    = "events.recovery"
+	SchemaProcessEvent       = "events.process"
+	SchemaAlert              = "alert"
+
+	SchemaReplyPing         = "reply.ping"
+	SchemaReplyService      = "reply.service"
+	SchemaReplyServiceQuery = "reply.service.query"
+	SchemaReplyProcessList  = "reply.process.list"
+	SchemaReplyProcessKill  = "reply.process.kill"
+	SchemaReplyLogs         = "reply.logs"
+	SchemaReplyExec         = "reply.exec"
+	SchemaReplyHealth       = "reply.health"
+	SchemaReplyError        = "reply.error"
+)
+
+// schemaVersions holds the current data version per schema
+// Bump a version when a field is removed or changes meaning;
+// adding optional fields keeps the version
+var schemaVersions = map[string]int{}
+
+// SchemaVersion returns the current data version of a schema (1 unless bumped)
+func SchemaVersion(name string) int {
+	if v, ok := schemaVersions[name]; ok {
+		return v
+	}
+	return 1
+}
+
+// SchemaID returns the identifier used for $id and CloudEvents dataschema
+func SchemaID(name string) string {
+	return fmt.Sprintf("urn:win-agent:schema:%s:v%d", name, SchemaVersion(name))
+}
+
+// GenerateSchema builds a JSON Schema (draft 2020-12) for the data of a message
+// from the Go value published under that schema
+func GenerateSchema(name string, sample interface{}) map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(sample), map[reflect.Type]bool{})
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = SchemaID(name)
+	schema["title"] = SchemaPrefix + name
+	return schema
+}
+
+// typeSchema maps a Go type to its JSON Schema
+// seen guards against recursive types
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		// Embedded JSON of any shape (e.g. exec output)
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes []byte as base64
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), seen),
+		}
+	case reflect.Struct:
+		if t.PkgPath() == "time" && t.Name() == "Time" {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if seen[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		return structSchema(t, seen)
+	}
+
+	// interface{} and anything else accepts any value
+	return map[string]interface{}{}
+}
+
+// structSchema builds an object schema from exported fields and their json tags
+// Fields without omitempty are required, unless tagged schema:"optional"
+// (for fields a custom MarshalJSON leaves out)
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, omitEmpty, skip := jsonField(field)
+		if skip {
+			continue
+		}
+
+		// Embedded structs without a name are flattened, as encoding/json does
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := structSchema(embedded, seen)
+				for k, v := range inner["properties"].(map[string]interface{}) {
+					properties[k] = v
+				}
+				if req, ok := inner["required"].([]string); ok {
+					required = append(required, req...)
+				}
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type, seen)
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonField parses a field's json tag
+func jsonField(field reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	if field.Tag.Get("schema") == "optional" {
+		omitEmpty = true
+	}
+	return parts[0], omitEmpty, false
+}
@@ -0,0 +1,75 @@
+package messages
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// schemaTestInner is nested inside schemaTestPayload
+type schemaTestInner struct {
+	Name string `json:"name"`
+}
+
+// schemaTestPayload covers the field kinds the generator maps
+type schemaTestPayload struct {
+	Count    int               `json:"count"`
+	Ratio    float64           `json:"ratio,omitempty"`
+	Enabled  bool              `json:"enabled"`
+	Items    []schemaTestInner `json:"items"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Optional *schemaTestInner  `json:"optional,omitempty"`
+	When     time.Time         `json:"when"`
+	Any      interface{}       `json:"any,omitempty"`
+	Custom   interface{}       `json:"custom" schema:"optional"`
+	Ignored  string            `json:"-"`
+	hidden   string
+}
+
+// TestGenerateSchema tests the JSON Schema generated from a struct
+func TestGenerateSchema(t *testing.T) {
+	schema := GenerateSchema("test", schemaTestPayload{hidden: "x"})
+
+	if schema["$id"] != "urn:win-agent:schema:test:v1" {
+		t.Errorf("$id = %v", schema["$id"])
+	}
+	if schema["type"] != "object" {
+		t.Fatalf("type = %v, want object", schema["type"])
+	}
+
+	props := schema["properties"].(map[string]interface{})
+	wantTypes := map[string]string{
+		"count":    "integer",
+		"ratio":    "number",
+		"enabled":  "boolean",
+		"items":    "array",
+		"labels":   "object",
+		"optional": "object",
+		"when":     "string",
+	}
+	for name, want := range wantTypes {
+		prop, ok := props[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("property %s missing", name)
+			continue
+		}
+		if prop["type"] != want {
+			t.Errorf("property %s type = %v, want %s", name, prop["type"], want)
+		}
+	}
+	for _, name := range []string{"Ignored", "hidden"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("property %s should be skipped", name)
+		}
+	}
+
+	items := props["items"].(map[string]interface{})["items"].(map[string]interface{})
+	if items["type"] != "object" {
+		t.Errorf("items type = %v, want object", items["type"])
+	}
+
+	wantRequired := []string{"count", "enabled", "items", "when"}
+	if !reflect.DeepEqual(schema["required"], wantRequired) {
+		t.Errorf("required = %v, want %v", schema["required"], wantRequired)
+	}
+}
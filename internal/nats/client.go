@@ -2,14 +2,16 @@ package nats
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
 	"win-agent/internal/config"
+	"win-agent/internal/messages"
 	"go.uber.org/zap"
 )
 
@@ -19,10 +21,17 @@ type Client struct {
 	js     nats.JetStreamContext
 	logger *zap.Logger
 	config *config.NATSConfig
+	creds  *credentialWatcher
+
+	streamMu sync.RWMutex
+	streams  *StreamHealth // Result of the startup stream check
+
+	sequences *sequencer        // Per-subject telemetry sequence numbers
+	messages  *messages.Wrapper // Envelope for telemetry and replies
 }
 
 // NewClient creates a new NATS client with the specified configuration
-func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
+func NewClient(cfg *config.NATSConfig, wrapper *messages.Wrapper, logger *zap.Logger) (*Client, error) {
 	opts := []nats.Option{
 		nats.Name("win-agent"),
 		nats.MaxReconnects(cfg.MaxReconnects),
@@ -47,14 +56,16 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 		}),
 	}
 
+	// Load credential files into a watcher so rotated creds and certificates
+	// are picked up on the next (re)connect without restarting the agent
+	creds, err := newCredentialWatcher(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	// Configure TLS if enabled
 	if cfg.TLS.Enabled {
-		tlsConfig, err := createTLSConfig(&cfg.TLS, logger)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create TLS config: %w", err)
-		}
-		
-		opts = append(opts, nats.Secure(tlsConfig))
+		opts = append(opts, nats.Secure(createTLSConfig(&cfg.TLS)))
 		logger.Info("TLS enabled for NATS connection",
 			zap.Bool("client_cert", cfg.TLS.CertFile != ""),
 			zap.Bool("ca_cert", cfg.TLS.CAFile != ""),
@@ -70,7 +81,6 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 	switch cfg.Auth.Type {
 	case "creds":
 		logger.Info("Using credentials file authentication", zap.String("file", cfg.Auth.CredsFile))
-		opts = append(opts, nats.UserCredentials(cfg.Auth.CredsFile))
 	case "token":
 		logger.Info("Using token authentication")
 		opts = append(opts, nats.Token(cfg.Auth.Token))
@@ -83,6 +93,9 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 		return nil, fmt.Errorf("invalid auth type: %s", cfg.Auth.Type)
 	}
 
+	// Client certificate, CA pool and creds are served from the watcher
+	opts = append(opts, creds.options()...)
+
 	// Pass all URLs for automatic failover
 	serverURLs := strings.Join(cfg.URLs, ",")
 	logger.Info("Connecting to NATS", zap.Strings("urls", cfg.URLs))
@@ -91,6 +104,19 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 
+	// Reconnect after a rotation so the new material is used right away,
+	// not only when the connection next drops
+	err = creds.start(func(kinds []string) {
+		logger.Info("Reconnecting with rotated credentials", zap.Strings("kinds", kinds))
+		if err := conn.ForceReconnect(); err != nil {
+			logger.Warn("Failed to reconnect with rotated credentials", zap.Error(err))
+		}
+	})
+	if err != nil {
+		// Not fatal - the current material is loaded, only rotation is unavailable
+		logger.Warn("Credential rotation watching unavailable", zap.Error(err))
+	}
+
 	logger.Info("Connected to NATS",
 		zap.String("url", conn.ConnectedUrl()),
 		zap.String("server_id", conn.ConnectedServerId()),
@@ -101,6 +127,7 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 	js, err := conn.JetStream()
 	if err != nil {
 		conn.Close()
+		creds.stop()
 		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
 	}
 
@@ -111,6 +138,7 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 	_, err = js.AccountInfo()
 	if err != nil {
 		conn.Close()
+		creds.stop()
 		return nil, fmt.Errorf("JetStream not available on NATS server (is JetStream enabled?): %w", err)
 	}
 
@@ -121,65 +149,36 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 		js:     js,
 		logger: logger,
 		config: cfg,
+		creds:  creds,
+
+		sequences: newSequencer(cfg.SequenceFile, logger),
+		messages:  wrapper,
 	}, nil
 }
 
-// createTLSConfig creates a TLS configuration based on the provided settings
-func createTLSConfig(cfg *config.TLSConfig, logger *zap.Logger) (*tls.Config, error) {
-	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS12, // Enforce TLS 1.2 minimum for security
-	}
-
-	// Configure certificate verification
-	if cfg.InsecureSkipVerify {
-		tlsConfig.InsecureSkipVerify = true
-	}
-
-	// Load CA certificate if provided
-	// This is used to verify the server's certificate
-	if cfg.CAFile != "" {
-		logger.Info("Loading CA certificate", zap.String("file", cfg.CAFile))
-		
-		caCert, err := os.ReadFile(cfg.CAFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-		}
-
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM(caCert) {
-			return nil, fmt.Errorf("failed to parse CA certificate")
-		}
-
-		tlsConfig.RootCAs = caCertPool
-		logger.Debug("CA certificate loaded successfully")
-	}
-
-	// Load client certificate and key if provided
-	// This is used for mutual TLS authentication
-	if cfg.CertFile != "" && cfg.KeyFile != "" {
-		logger.Info("Loading client certificate",
-			zap.String("cert", cfg.CertFile),
-			zap.String("key", cfg.KeyFile))
-
-		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load client certificate: %w", err)
-		}
-
-		tlsConfig.Certificates = []tls.Certificate{cert}
-		logger.Debug("Client certificate loaded successfully")
+// createTLSConfig creates the base TLS configuration
+// Client certificate and CA pool are supplied per handshake by the credential watcher
+func createTLSConfig(cfg *config.TLSConfig) *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12, // Enforce TLS 1.2 minimum for security
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
 	}
-
-	return tlsConfig, nil
 }
 
 // PublishTelemetry publishes a message to JetStream asynchronously (fire-and-forget)
 // This is used for heartbeats, metrics, service status, and inventory
 // Uses PublishAsync for better performance and built-in retry handling
-func (c *Client) PublishTelemetry(subject string, data []byte) error {
+// payload is wrapped in the configured envelope under the given schema
+func (c *Client) PublishTelemetry(subject, schema string, payload interface{}) error {
+	msg, err := c.telemetryMsg(subject, schema, payload)
+	if err != nil {
+		return err
+	}
+	data := msg.Data
+
 	// PublishAsync returns a PubAckFuture immediately (non-blocking)
 	// The actual publish happens in the background with automatic retries
-	pubAckFuture, err := c.js.PublishAsync(subject, data)
+	pubAckFuture, err := c.js.PublishMsgAsync(msg)
 	if err != nil {
 		// This only fails if we can't queue the message (very rare)
 		c.logger.Error("Failed to queue telemetry publish",
@@ -192,10 +191,12 @@ func (c *Client) PublishTelemetry(subject string, data []byte) error {
 	// This doesn't block the caller - it runs in a goroutine managed by NATS
 	go func() {
 		select {
-		case <-pubAckFuture.Ok():
+		case ack := <-pubAckFuture.Ok():
 			// Message was acknowledged by JetStream
 			c.logger.Debug("Published telemetry",
 				zap.String("subject", subject),
+				zap.String("msg_id", msg.Header.Get(HeaderMsgID)),
+				zap.Bool("duplicate", ack.Duplicate),
 				zap.Int("bytes", len(data)))
 
 		case err := <-pubAckFuture.Err():
@@ -203,6 +204,7 @@ func (c *Client) PublishTelemetry(subject string, data []byte) error {
 			// Log but don't crash - telemetry is fire-and-forget
 			c.logger.Warn("Failed to publish telemetry after retries",
 				zap.String("subject", subject),
+				zap.String("msg_id", msg.Header.Get(HeaderMsgID)),
 				zap.Error(err))
 		}
 	}()
@@ -212,8 +214,14 @@ func (c *Client) PublishTelemetry(subject string, data []byte) error {
 
 // PublishTelemetrySync is a synchronous version for cases where you need to know
 // if the publish succeeded (e.g., during shutdown or critical operations)
-func (c *Client) PublishTelemetrySync(subject string, data []byte, timeout time.Duration) error {
-	pubAckFuture, err := c.js.PublishAsync(subject, data)
+func (c *Client) PublishTelemetrySync(subject, schema string, payload interface{}, timeout time.Duration) error {
+	msg, err := c.telemetryMsg(subject, schema, payload)
+	if err != nil {
+		return err
+	}
+	data := msg.Data
+
+	pubAckFuture, err := c.js.PublishMsgAsync(msg)
 	if err != nil {
 		return fmt.Errorf("failed to queue publish to %s: %w", subject, err)
 	}
@@ -223,6 +231,7 @@ func (c *Client) PublishTelemetrySync(subject string, data []byte, timeout time.
 	case <-pubAckFuture.Ok():
 		c.logger.Debug("Published telemetry (sync)",
 			zap.String("subject", subject),
+			zap.String("msg_id", msg.Header.Get(HeaderMsgID)),
 			zap.Int("bytes", len(data)))
 		return nil
 
@@ -237,6 +246,33 @@ func (c *Client) PublishTelemetrySync(subject string, data []byte, timeout time.
 	}
 }
 
+// telemetryMsg builds a telemetry message with its message ID and sequence headers
+// The ID is fixed before the first attempt, so JetStream drops retried copies
+func (c *Client) telemetryMsg(subject, schema string, payload interface{}) (*nats.Msg, error) {
+	seq := c.sequences.next(subject)
+
+	data, err := c.messages.Marshal(schema, seq, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(HeaderMsgID, messageID(subject, seq))
+	msg.Header.Set(HeaderSequence, strconv.FormatUint(seq, 10))
+	msg.Header.Set(HeaderSchema, messages.SchemaPrefix+schema)
+	c.setContentHeaders(msg.Header)
+	return msg, nil
+}
+
+// setContentHeaders advertises the configured encoding and compression
+func (c *Client) setContentHeaders(header nats.Header) {
+	header.Set(messages.HeaderContentType, c.messages.ContentType())
+	if encoding := c.messages.ContentEncoding(); encoding != "" {
+		header.Set(messages.HeaderContentEncoding, encoding)
+	}
+}
+
 // Subscribe creates a subscription to the specified subject
 // This is used for command handlers with Core NATS request/reply
 func (c *Client) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
@@ -252,10 +288,29 @@ func (c *Client) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subsc
 	return sub, nil
 }
 
+// AddService registers a NATS micro service on this connection
+// This is used to expose the command API with $SRV discovery and stats
+func (c *Client) AddService(cfg micro.Config) (micro.Service, error) {
+	svc, err := micro.AddService(c.conn, cfg)
+	if err != nil {
+		c.logger.Error("Failed to add service",
+			zap.String("service", cfg.Name),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to add service %s: %w", cfg.Name, err)
+	}
+
+	c.logger.Info("Registered service",
+		zap.String("service", cfg.Name),
+		zap.String("version", cfg.Version))
+	return svc, nil
+}
+
 // Drain gracefully closes the connection by draining all subscriptions
 // and waiting for in-flight messages to complete
 func (c *Client) Drain(timeout time.Duration) error {
 	c.logger.Info("Draining NATS connection", zap.Duration("timeout", timeout))
+	defer c.creds.stop()
+	defer c.sequences.stop() // After in-flight publishes have drained
 
 	// Check if connection is already closed
 	if !c.conn.IsConnected() && c.conn.IsClosed() {
@@ -292,6 +347,8 @@ func (c *Client) Drain(timeout time.Duration) error {
 func (c *Client) Close() {
 	c.logger.Info("Closing NATS connection")
 	c.conn.Close()
+	c.creds.stop()
+	c.sequences.stop()
 }
 
 // IsConnected returns true if the NATS connection is currently active
@@ -299,6 +356,11 @@ func (c *Client) IsConnected() bool {
 	return c.conn.IsConnected()
 }
 
+// CredentialStatus returns expiry and reload details for the watched credential files
+func (c *Client) CredentialStatus() []CredentialStatus {
+	return c.creds.status()
+}
+
 // Stats returns connection statistics
 func (c *Client) Stats() nats.Statistics {
 	return c.conn.Stats()
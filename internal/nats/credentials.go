@@ -0,0 +1,502 @@
+package nats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// Credential kinds reported in CredentialStatus
+const (
+	credentialKindCert  = "tls_cert"
+	credentialKindCA    = "tls_ca"
+	credentialKindCreds = "creds"
+)
+
+// reloadDebounce coalesces the burst of events editors and rotation tools
+// produce (truncate + write + chmod, or write temp + rename) into one reload
+const reloadDebounce = 500 * time.Millisecond
+
+// CredentialStatus describes a watched credential file for health reporting
+type CredentialStatus struct {
+	Kind          string `json:"kind"` // tls_cert, tls_ca, creds
+	File          string `json:"file"`
+	Subject       string `json:"subject,omitempty"`
+	NotAfter      string `json:"not_after,omitempty"`      // Omitted for credentials that never expire
+	DaysRemaining *int   `json:"days_remaining,omitempty"` // Negative once expired
+	LastReload    string `json:"last_reload,omitempty"`
+	ReloadError   string `json:"reload_error,omitempty"` // Last failed reload; previous material is still in use
+
+	notAfter time.Time
+}
+
+// CredentialExpiryEvent is published when creds or certificates near expiry
+type CredentialExpiryEvent struct {
+	Event         string `json:"event"` // cert_expiring, cert_expired
+	Kind          string `json:"kind"`
+	File          string `json:"file"`
+	Subject       string `json:"subject,omitempty"`
+	NotAfter      string `json:"not_after"`
+	DaysRemaining int    `json:"days_remaining"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// credentialWatcher keeps the creds file and TLS material in memory and
+// reloads it when the files change on disk
+// nats.go calls the handlers below on every (re)connect, so rotated
+// material is picked up on the next handshake without restarting the agent
+type credentialWatcher struct {
+	logger    *zap.Logger
+	tlsConfig *config.TLSConfig
+	credsFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	rootCAs  *x509.CertPool
+	userJWT  string
+	seed     []byte
+	statuses map[string]*CredentialStatus // keyed by kind
+
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+	reloaded func(kinds []string) // Called once per batch of rotated files loaded
+}
+
+// newCredentialWatcher loads the configured credential files
+// Initial load failures are fatal; later reload failures keep the previous material
+func newCredentialWatcher(cfg *config.NATSConfig, logger *zap.Logger) (*credentialWatcher, error) {
+	w := &credentialWatcher{
+		logger:   logger,
+		statuses: make(map[string]*CredentialStatus),
+		done:     make(chan struct{}),
+	}
+
+	if cfg.Auth.Type == "creds" {
+		w.credsFile = cfg.Auth.CredsFile
+		if err := w.reload(credentialKindCreds); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.TLS.Enabled {
+		w.tlsConfig = &cfg.TLS
+		if cfg.TLS.CAFile != "" {
+			if err := w.reload(credentialKindCA); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.TLS.CertFile != "" && cfg.TLS.KeyFile != "" {
+			if err := w.reload(credentialKindCert); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return w, nil
+}
+
+// files returns the watched files for each credential kind
+func (w *credentialWatcher) files() map[string][]string {
+	files := make(map[string][]string)
+	if w.credsFile != "" {
+		files[credentialKindCreds] = []string{w.credsFile}
+	}
+	if w.tlsConfig != nil {
+		if w.tlsConfig.CAFile != "" {
+			files[credentialKindCA] = []string{w.tlsConfig.CAFile}
+		}
+		if w.tlsConfig.CertFile != "" && w.tlsConfig.KeyFile != "" {
+			files[credentialKindCert] = []string{w.tlsConfig.CertFile, w.tlsConfig.KeyFile}
+		}
+	}
+	return files
+}
+
+// start begins watching the credential files for changes and calls
+// reloaded once with the kinds loaded from each debounced batch, so files
+// rotated together (creds plus certificate) cause a single reconnect
+// Parent directories are watched rather than the files themselves because
+// rotation tools usually replace files (write temp + rename), which drops
+// a watch placed on the old file
+func (w *credentialWatcher) start(reloaded func(kinds []string)) error {
+	w.reloaded = reloaded
+	files := w.files()
+	if len(files) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	// Map each watched file back to its credential kind
+	kinds := make(map[string]string)
+	dirs := make(map[string]bool)
+	for kind, paths := range files {
+		for _, path := range paths {
+			clean := filepath.Clean(path)
+			kinds[clean] = kind
+			dirs[filepath.Dir(clean)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	w.watcher = watcher
+
+	go w.watch(kinds)
+
+	w.logger.Info("Watching credential files for rotation", zap.Int("files", len(kinds)))
+	return nil
+}
+
+// watch processes file events until stop is called
+func (w *credentialWatcher) watch(kinds map[string]string) {
+	pending := make(map[string]bool)
+	timer := time.NewTimer(reloadDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			timer.Stop()
+			return
+
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			kind, tracked := kinds[filepath.Clean(event.Name)]
+			if !tracked {
+				continue
+			}
+			pending[kind] = true
+			timer.Reset(reloadDebounce)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("Credential file watcher error", zap.Error(err))
+
+		case <-timer.C:
+			var loaded []string
+			for kind := range pending {
+				if err := w.reload(kind); err != nil {
+					w.logger.Error("Failed to reload rotated credentials, keeping previous material",
+						zap.String("kind", kind),
+						zap.Error(err))
+					continue
+				}
+				loaded = append(loaded, kind)
+			}
+			pending = make(map[string]bool)
+			if len(loaded) > 0 && w.reloaded != nil {
+				sort.Strings(loaded)
+				w.reloaded(loaded)
+			}
+		}
+	}
+}
+
+// stop ends file watching
+func (w *credentialWatcher) stop() {
+	if w.watcher == nil {
+		return
+	}
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+		w.watcher.Close()
+	}
+}
+
+// reload re-reads one kind of credential material and swaps it in if valid
+func (w *credentialWatcher) reload(kind string) error {
+	status := &CredentialStatus{Kind: kind}
+	var err error
+
+	switch kind {
+	case credentialKindCreds:
+		status.File = w.credsFile
+		var jwt string
+		var seed []byte
+		jwt, seed, err = loadCredsFile(w.credsFile, status)
+		if err == nil {
+			w.mu.Lock()
+			w.userJWT, w.seed = jwt, seed
+			w.mu.Unlock()
+		}
+
+	case credentialKindCA:
+		status.File = w.tlsConfig.CAFile
+		var pool *x509.CertPool
+		pool, err = loadCAFile(w.tlsConfig.CAFile, status)
+		if err == nil {
+			w.mu.Lock()
+			w.rootCAs = pool
+			w.mu.Unlock()
+		}
+
+	case credentialKindCert:
+		status.File = w.tlsConfig.CertFile
+		var cert *tls.Certificate
+		cert, err = loadClientCert(w.tlsConfig.CertFile, w.tlsConfig.KeyFile, status)
+		if err == nil {
+			w.mu.Lock()
+			w.cert = cert
+			w.mu.Unlock()
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err != nil {
+		// Keep reporting the material that is still in use, plus the failure
+		if previous, ok := w.statuses[kind]; ok {
+			previous.ReloadError = err.Error()
+		}
+		return err
+	}
+
+	status.LastReload = time.Now().UTC().Format(time.RFC3339)
+	w.statuses[kind] = status
+
+	w.logger.Info("Loaded credentials",
+		zap.String("kind", kind),
+		zap.String("file", status.File),
+		zap.String("not_after", status.NotAfter))
+	return nil
+}
+
+// options returns the NATS connection options that read from the watcher
+func (w *credentialWatcher) options() []nats.Option {
+	var opts []nats.Option
+
+	if w.credsFile != "" {
+		opts = append(opts, nats.UserJWT(w.userJWTHandler, w.signatureHandler))
+	}
+
+	if w.tlsConfig != nil {
+		var certCB nats.TLSCertHandler
+		var rootCAsCB nats.RootCAsHandler
+		if w.tlsConfig.CertFile != "" && w.tlsConfig.KeyFile != "" {
+			certCB = w.clientCertHandler
+		}
+		if w.tlsConfig.CAFile != "" {
+			rootCAsCB = w.rootCAsHandler
+		}
+		if certCB != nil || rootCAsCB != nil {
+			opts = append(opts, nats.ClientTLSConfig(certCB, rootCAsCB))
+		}
+	}
+
+	return opts
+}
+
+// userJWTHandler returns the current user JWT
+func (w *credentialWatcher) userJWTHandler() (string, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.userJWT, nil
+}
+
+// signatureHandler signs the server nonce with the current user seed
+func (w *credentialWatcher) signatureHandler(nonce []byte) ([]byte, error) {
+	w.mu.RLock()
+	seed := w.seed
+	w.mu.RUnlock()
+
+	kp, err := nkeys.FromSeed(seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user seed: %w", err)
+	}
+	defer kp.Wipe()
+	return kp.Sign(nonce)
+}
+
+// clientCertHandler returns the current client certificate
+func (w *credentialWatcher) clientCertHandler() (tls.Certificate, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return *w.cert, nil
+}
+
+// rootCAsHandler returns the current CA pool
+func (w *credentialWatcher) rootCAsHandler() (*x509.CertPool, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.rootCAs, nil
+}
+
+// status returns the current status of every watched credential
+// DaysRemaining is computed at call time so it stays accurate between reloads
+func (w *credentialWatcher) status() []CredentialStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	now := time.Now()
+	statuses := make([]CredentialStatus, 0, len(w.statuses))
+	for _, kind := range []string{credentialKindCreds, credentialKindCert, credentialKindCA} {
+		s, ok := w.statuses[kind]
+		if !ok {
+			continue
+		}
+		status := *s
+		if !status.notAfter.IsZero() {
+			days := int(status.notAfter.Sub(now).Hours() / 24)
+			status.DaysRemaining = &days
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// ExpiresWithin reports whether the credential expires before now+window
+func (s CredentialStatus) ExpiresWithin(window time.Duration) bool {
+	return !s.notAfter.IsZero() && time.Until(s.notAfter) < window
+}
+
+// Expired reports whether the credential is already past its expiry
+func (s CredentialStatus) Expired() bool {
+	return !s.notAfter.IsZero() && time.Now().After(s.notAfter)
+}
+
+// loadCredsFile parses a NATS creds file into its JWT and seed
+func loadCredsFile(path string, status *CredentialStatus) (string, []byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	jwt, err := nkeys.ParseDecoratedJWT(contents)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse user JWT: %w", err)
+	}
+	kp, err := nkeys.ParseDecoratedNKey(contents)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse user seed: %w", err)
+	}
+	defer kp.Wipe()
+	seed, err := kp.Seed()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read user seed: %w", err)
+	}
+	// Seed returns the key pair's own buffer, which Wipe overwrites
+	seed = append([]byte(nil), seed...)
+
+	claims, err := decodeJWTClaims(jwt)
+	if err != nil {
+		return "", nil, err
+	}
+	status.Subject = claims.Name
+	if claims.Expires > 0 {
+		status.notAfter = time.Unix(claims.Expires, 0)
+		status.NotAfter = status.notAfter.UTC().Format(time.RFC3339)
+	}
+
+	return jwt, seed, nil
+}
+
+// jwtClaims holds the JWT fields we report on and check
+type jwtClaims struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name"`
+	Expires int64  `json:"exp"`
+}
+
+// decodeJWTClaims reads the claims segment of a JWT without verifying it
+// The server verifies the signature; we only need the expiry for reporting
+func decodeJWTClaims(jwt string) (*jwtClaims, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed user JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode user JWT claims: %w", err)
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse user JWT claims: %w", err)
+	}
+	return &claims, nil
+}
+
+// loadCAFile builds a cert pool from a PEM bundle
+// The earliest expiry in the bundle is reported
+func loadCAFile(path string, status *CredentialStatus) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	found := false
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+		}
+		pool.AddCert(cert)
+		found = true
+		if status.notAfter.IsZero() || cert.NotAfter.Before(status.notAfter) {
+			status.notAfter = cert.NotAfter
+			status.Subject = cert.Subject.String()
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("failed to parse CA certificate")
+	}
+
+	status.NotAfter = status.notAfter.UTC().Format(time.RFC3339)
+	return pool, nil
+}
+
+// loadClientCert loads a client certificate/key pair
+func loadClientCert(certFile, keyFile string, status *CredentialStatus) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	status.Subject = leaf.Subject.String()
+	status.notAfter = leaf.NotAfter
+	status.NotAfter = leaf.NotAfter.UTC().Format(time.RFC3339)
+	return &cert, nil
+}
@@ -0,0 +1,215 @@
+package nats
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nkeys"
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// testUserCreds returns a creds file for a new user key with the given JWT name
+// The JWT is not signed; the agent only decodes its claims
+func testUserCreds(t *testing.T, name string) []byte {
+	t.Helper()
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	publicKey, _ := kp.PublicKey()
+	seed, _ := kp.Seed()
+	return formatUserCreds(testJWT(publicKey, name), seed)
+}
+
+// testJWT builds an unsigned JWT with the claims the agent reads
+func testJWT(subject, name string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	claims := fmt.Sprintf(`{"sub":%q,"name":%q,"exp":%d}`, subject, name, time.Now().Add(24*time.Hour).Unix())
+	return encode([]byte(`{"typ":"JWT","alg":"ed25519-nkey"}`)) + "." + encode([]byte(claims)) + ".sig"
+}
+
+// startCredsWatcher loads and watches a creds file; reloads are sent on the returned channel
+func startCredsWatcher(t *testing.T, credsFile string) (*credentialWatcher, chan []string) {
+	t.Helper()
+	return startWatcher(t, &config.NATSConfig{Auth: config.AuthConfig{Type: "creds", CredsFile: credsFile}})
+}
+
+// startWatcher loads and watches the credential files of cfg; each reload
+// batch is sent on the returned channel
+func startWatcher(t *testing.T, cfg *config.NATSConfig) (*credentialWatcher, chan []string) {
+	t.Helper()
+	w, err := newCredentialWatcher(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newCredentialWatcher() error = %v", err)
+	}
+	reloads := make(chan []string, 4)
+	if err := w.start(func(kinds []string) { reloads <- kinds }); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	t.Cleanup(w.stop)
+	return w, reloads
+}
+
+// testCertPEM returns a self-signed client certificate and key with the given common name
+func testCertPEM(t *testing.T, commonName string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTestCert writes a certificate and key pair for commonName
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	certPEM, keyPEM := testCertPEM(t, commonName)
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// jwtName returns the name claim of the JWT the watcher currently serves
+func jwtName(t *testing.T, w *credentialWatcher) string {
+	t.Helper()
+	jwt, _ := w.userJWTHandler()
+	claims, err := decodeJWTClaims(jwt)
+	if err != nil {
+		t.Fatalf("decodeJWTClaims() error = %v", err)
+	}
+	return claims.Name
+}
+
+// TestCredentialRotation tests that a rotated creds file is loaded and
+// triggers the reconnect callback
+func TestCredentialRotation(t *testing.T) {
+	credsFile := filepath.Join(t.TempDir(), "agent.creds")
+	if err := os.WriteFile(credsFile, testUserCreds(t, "old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, reloads := startCredsWatcher(t, credsFile)
+	if got := jwtName(t, w); got != "old" {
+		t.Fatalf("initial JWT name = %q, want old", got)
+	}
+
+	if err := os.WriteFile(credsFile, testUserCreds(t, "new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case kinds := <-reloads:
+		if !reflect.DeepEqual(kinds, []string{credentialKindCreds}) {
+			t.Errorf("reloaded kinds = %v, want [%s]", kinds, credentialKindCreds)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotated creds file did not trigger a reconnect")
+	}
+	if got := jwtName(t, w); got != "new" {
+		t.Errorf("JWT name after rotation = %q, want new", got)
+	}
+	if _, err := w.signatureHandler([]byte("nonce")); err != nil {
+		t.Errorf("signatureHandler() error = %v", err)
+	}
+}
+
+// TestCredentialRotationInvalid tests that a bad creds file keeps the
+// previous material and does not reconnect
+func TestCredentialRotationInvalid(t *testing.T) {
+	credsFile := filepath.Join(t.TempDir(), "agent.creds")
+	if err := os.WriteFile(credsFile, testUserCreds(t, "old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, reloads := startCredsWatcher(t, credsFile)
+
+	if err := os.WriteFile(credsFile, []byte("-----BEGIN NATS USER JWT-----\ntruncated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case kinds := <-reloads:
+		t.Fatalf("invalid creds file triggered a reconnect (%v)", kinds)
+	case <-time.After(2 * reloadDebounce):
+	}
+
+	if got := jwtName(t, w); got != "old" {
+		t.Errorf("JWT name after bad rotation = %q, want old", got)
+	}
+	statuses := w.status()
+	if len(statuses) != 1 || statuses[0].Subject != "old" || !strings.Contains(statuses[0].ReloadError, "failed to parse") {
+		t.Errorf("status = %+v, want the old creds with a reload error", statuses)
+	}
+}
+
+// TestCredentialRotationCombined tests that creds and a client certificate
+// rotated together are reloaded in one batch, with a single reconnect
+func TestCredentialRotationCombined(t *testing.T) {
+	dir := t.TempDir()
+	credsFile := filepath.Join(dir, "agent.creds")
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(credsFile, testUserCreds(t, "old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCert(t, certFile, keyFile, "old-cert")
+	w, reloads := startWatcher(t, &config.NATSConfig{
+		Auth: config.AuthConfig{Type: "creds", CredsFile: credsFile},
+		TLS:  config.TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile},
+	})
+
+	if err := os.WriteFile(credsFile, testUserCreds(t, "new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCert(t, certFile, keyFile, "new-cert")
+
+	select {
+	case kinds := <-reloads:
+		if want := []string{credentialKindCreds, credentialKindCert}; !reflect.DeepEqual(kinds, want) {
+			t.Errorf("reloaded kinds = %v, want %v", kinds, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotation did not trigger a reconnect")
+	}
+	select {
+	case kinds := <-reloads:
+		t.Fatalf("second reconnect for one rotation (%v)", kinds)
+	case <-time.After(2 * reloadDebounce):
+	}
+
+	if got := jwtName(t, w); got != "new" {
+		t.Errorf("JWT name after rotation = %q, want new", got)
+	}
+	cert, err := w.clientCertHandler()
+	if err != nil || cert.Leaf == nil || cert.Leaf.Subject.CommonName != "new-cert" {
+		t.Errorf("client certificate after rotation = %v, %v, want new-cert", cert, err)
+	}
+}
@@ -0,0 +1,176 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+	"win-agent/internal/tasks"
+)
+
+// enrollmentRequest is sent by an unenrolled agent
+// Only the public key leaves the machine; the seed is generated and kept locally
+type enrollmentRequest struct {
+	PublicKey    string           `json:"public_key"`
+	Hostname     string           `json:"hostname"`
+	AgentVersion string           `json:"agent_version"`
+	Facts        *tasks.Inventory `json:"facts,omitempty"`
+	Timestamp    string           `json:"timestamp"`
+}
+
+// enrollmentResponse is returned by the enrollment service
+type enrollmentResponse struct {
+	Status   string `json:"status"` // success, error
+	DeviceID string `json:"device_id"`
+	JWT      string `json:"jwt"` // User JWT issued for PublicKey
+	Error    string `json:"error,omitempty"`
+}
+
+// Enroll exchanges the bootstrap token for a device ID and user credentials
+// A fresh user nkey is generated locally and the issued JWT must be for that key
+// On success the credentials and device ID are persisted and applied to cfg,
+// and the bootstrap token is cleared so it is never used again
+func Enroll(cfg *config.Config, facts *tasks.Inventory, version string, logger *zap.Logger) error {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		return fmt.Errorf("failed to generate user nkey: %w", err)
+	}
+	defer kp.Wipe()
+
+	publicKey, err := kp.PublicKey()
+	if err != nil {
+		return fmt.Errorf("failed to read user public key: %w", err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return fmt.Errorf("failed to read user seed: %w", err)
+	}
+
+	conn, err := connectForEnrollment(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	hostname, _ := os.Hostname()
+	request := enrollmentRequest{
+		PublicKey:    publicKey,
+		Hostname:     hostname,
+		AgentVersion: version,
+		Facts:        facts,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal enrollment request: %w", err)
+	}
+
+	logger.Info("Sending enrollment request",
+		zap.String("subject", cfg.Enrollment.Subject),
+		zap.String("public_key", publicKey))
+
+	msg, err := conn.Request(cfg.Enrollment.Subject, data, cfg.Enrollment.Timeout)
+	if err != nil {
+		return fmt.Errorf("enrollment request failed: %w", err)
+	}
+
+	var response enrollmentResponse
+	if err := json.Unmarshal(msg.Data, &response); err != nil {
+		return fmt.Errorf("invalid enrollment response: %w", err)
+	}
+	if err := validateEnrollmentResponse(&response, publicKey); err != nil {
+		return err
+	}
+
+	state, err := config.SaveEnrollment(&cfg.Enrollment, response.DeviceID, publicKey, formatUserCreds(response.JWT, seed))
+	if err != nil {
+		return err
+	}
+	cfg.ApplyEnrollment(state)
+
+	logger.Info("Enrollment complete",
+		zap.String("device_id", state.DeviceID),
+		zap.String("creds_file", state.CredsFile))
+	return nil
+}
+
+// connectForEnrollment opens a short-lived connection authenticated with the bootstrap token
+// TLS settings are shared with the regular connection
+func connectForEnrollment(cfg *config.Config, logger *zap.Logger) (*nats.Conn, error) {
+	natsCfg := cfg.NATS
+	natsCfg.Auth = config.AuthConfig{Type: "token", Token: cfg.Enrollment.BootstrapToken}
+
+	creds, err := newCredentialWatcher(&natsCfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []nats.Option{
+		nats.Name("win-agent-enroll"),
+		nats.Token(natsCfg.Auth.Token),
+		nats.NoReconnect(),
+	}
+	if natsCfg.TLS.Enabled {
+		opts = append(opts, nats.Secure(createTLSConfig(&natsCfg.TLS)))
+	}
+	opts = append(opts, creds.options()...)
+
+	logger.Info("Connecting to NATS for enrollment", zap.Strings("urls", natsCfg.URLs))
+	conn, err := nats.Connect(strings.Join(natsCfg.URLs, ","), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS for enrollment: %w", err)
+	}
+	return conn, nil
+}
+
+// validateEnrollmentResponse checks the issued identity before anything is persisted
+func validateEnrollmentResponse(response *enrollmentResponse, publicKey string) error {
+	if response.Status != "success" {
+		if response.Error != "" {
+			return fmt.Errorf("enrollment rejected: %s", response.Error)
+		}
+		return fmt.Errorf("enrollment rejected (status %q)", response.Status)
+	}
+	if !config.ValidDeviceID(response.DeviceID) {
+		return fmt.Errorf("enrollment returned invalid device_id %q", response.DeviceID)
+	}
+	// The agent could not start with it, so the creds must not be persisted
+	if config.ReservedDeviceID(response.DeviceID) {
+		return fmt.Errorf("enrollment returned reserved device_id %q", response.DeviceID)
+	}
+
+	// The JWT must be issued for the key we generated, otherwise the seed
+	// we hold could never authenticate with it
+	claims, err := decodeJWTClaims(response.JWT)
+	if err != nil {
+		return fmt.Errorf("enrollment returned invalid JWT: %w", err)
+	}
+	if claims.Subject != publicKey {
+		return fmt.Errorf("enrollment JWT subject %s does not match generated key %s", claims.Subject, publicKey)
+	}
+	return nil
+}
+
+// formatUserCreds renders a JWT and seed in the standard NATS creds file format
+func formatUserCreds(jwt string, seed []byte) []byte {
+	return []byte(fmt.Sprintf(`-----BEGIN NATS USER JWT-----
+%s
+------END NATS USER JWT------
+
+************************* IMPORTANT *************************
+NKEY Seed printed below can be used to sign and prove identity.
+NKEYs are sensitive and should be treated as secrets.
+
+-----BEGIN USER NKEY SEED-----
+%s
+------END USER NKEY SEED------
+
+*************************************************************
+`, jwt, seed))
+}
@@ -0,0 +1,80 @@
+package nats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+)
+
+// TestValidateEnrollmentResponse tests the checks made before enrollment results are persisted
+func TestValidateEnrollmentResponse(t *testing.T) {
+	const publicKey = "UAGENTKEY"
+	tests := []struct {
+		name     string
+		response enrollmentResponse
+		errText  string
+	}{
+		{name: "valid", response: enrollmentResponse{Status: "success", DeviceID: "store-042", JWT: testJWT(publicKey, "store-042")}},
+		{name: "rejected with error", response: enrollmentResponse{Status: "error", Error: "token expired"}, errText: "token expired"},
+		{name: "rejected without error", response: enrollmentResponse{Status: "pending"}, errText: `status "pending"`},
+		{name: "invalid device_id", response: enrollmentResponse{Status: "success", DeviceID: "store.42", JWT: testJWT(publicKey, "x")}, errText: "invalid device_id"},
+		{name: "empty device_id", response: enrollmentResponse{Status: "success", JWT: testJWT(publicKey, "x")}, errText: "invalid device_id"},
+		{name: "broadcast token", response: enrollmentResponse{Status: "success", DeviceID: "all", JWT: testJWT(publicKey, "x")}, errText: "reserved device_id"},
+		{name: "group token", response: enrollmentResponse{Status: "success", DeviceID: "group", JWT: testJWT(publicKey, "x")}, errText: "reserved device_id"},
+		{name: "malformed JWT", response: enrollmentResponse{Status: "success", DeviceID: "store-042", JWT: "not-a-jwt"}, errText: "invalid JWT"},
+		{
+			name:     "JWT for another key",
+			response: enrollmentResponse{Status: "success", DeviceID: "store-042", JWT: testJWT("UOTHERKEY", "x")},
+			errText:  "does not match generated key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnrollmentResponse(&tt.response, publicKey)
+			if tt.errText == "" {
+				if err != nil {
+					t.Errorf("validateEnrollmentResponse() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("validateEnrollmentResponse() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// TestFormatUserCreds tests that formatted creds parse back to the same JWT and seed
+func TestFormatUserCreds(t *testing.T) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	seed, _ := kp.Seed()
+	publicKey, _ := kp.PublicKey()
+
+	tests := map[string]string{
+		"signed":   testJWT(publicKey, "store-042"),
+		"unsigned": "eyJhbGciOiJub25lIn0.e30.",
+	}
+	for name, jwt := range tests {
+		t.Run(name, func(t *testing.T) {
+			creds := formatUserCreds(jwt, seed)
+
+			gotJWT, err := nkeys.ParseDecoratedJWT(creds)
+			if err != nil || gotJWT != jwt {
+				t.Errorf("ParseDecoratedJWT() = %q, %v, want %q", gotJWT, err, jwt)
+			}
+			parsed, err := nkeys.ParseDecoratedNKey(creds)
+			if err != nil {
+				t.Fatalf("ParseDecoratedNKey() error = %v", err)
+			}
+			gotKey, _ := parsed.PublicKey()
+			if gotKey != publicKey {
+				t.Errorf("parsed public key = %s, want %s", gotKey, publicKey)
+			}
+		})
+	}
+}
@@ -4,16 +4,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime"
+	"regexp"
 	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"win-agent/internal/alerts"
 	"win-agent/internal/config"
+	"win-agent/internal/messages"
 	"win-agent/internal/tasks"
+	"win-agent/internal/utils"
+	"win-agent/internal/watchdog"
 	"go.uber.org/zap"
 )
 
+// CommandServiceName is the micro service name every agent registers under
+// Use $SRV.PING.win-agent to discover agents and $SRV.STATS.win-agent for endpoint stats
+const CommandServiceName = "win-agent"
+
 // CommandHandlers manages all command subscriptions and handlers
 type CommandHandlers struct {
 	logger        *zap.Logger
@@ -23,10 +35,19 @@ type CommandHandlers struct {
 	version       string
 	taskExecutor  *tasks.Executor
 	natsClient    *Client
+	alerts        *alerts.Evaluator  // nil when alerting is disabled
+	watchdog      *watchdog.Watchdog // nil without service_check recovery policies
+	service       micro.Service
+	endpoints     map[string]string // Endpoint name to command, e.g. all-ping to ping
+
+	// Last failed command, for the agent section of health
+	errMu         sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
 }
 
 // NewCommandHandlers creates a new command handler manager
-func NewCommandHandlers(logger *zap.Logger, cfg *config.Config, executor *tasks.Executor, natsClient *Client, version string) *CommandHandlers {
+func NewCommandHandlers(logger *zap.Logger, cfg *config.Config, executor *tasks.Executor, natsClient *Client, alertEvaluator *alerts.Evaluator, serviceWatchdog *watchdog.Watchdog, version string) *CommandHandlers {
 	return &CommandHandlers{
 		logger:        logger,
 		config:        cfg,
@@ -35,30 +56,33 @@ func NewCommandHandlers(logger *zap.Logger, cfg *config.Config, executor *tasks.
 		version:       version,
 		taskExecutor:  executor,
 		natsClient:    natsClient,
+		alerts:        alertEvaluator,
+		watchdog:      serviceWatchdog,
+		endpoints:     make(map[string]string),
 	}
 }
 
 // handleWithRecovery wraps a command handler with panic recovery
 // This prevents a panic in one command handler from crashing the entire agent
-func (h *CommandHandlers) handleWithRecovery(name string, handler nats.MsgHandler) nats.MsgHandler {
-	return func(msg *nats.Msg) {
+func (h *CommandHandlers) handleWithRecovery(name string, handler micro.HandlerFunc) micro.HandlerFunc {
+	return func(msg micro.Request) {
 		defer func() {
 			if r := recover(); r != nil {
 				// Log the panic with stack trace
 				h.logger.Error("Panic recovered in command handler",
 					zap.String("handler", name),
-					zap.String("subject", msg.Subject),
+					zap.String("subject", msg.Subject()),
 					zap.Any("panic", r),
 					zap.String("stack", string(debug.Stack())))
 
 				// Send error response to caller
 				response := errorResponse{
 					Status:    "error",
+					DeviceID:  h.deviceID,
 					Error:     fmt.Sprintf("Internal error: handler panicked: %v", r),
 					Timestamp: time.Now().UTC().Format(time.RFC3339),
 				}
-				responseBytes, _ := json.Marshal(response)
-				msg.Respond(responseBytes)
+				h.respondFailure(msg, "500", messages.SchemaReplyError, response.Error, response)
 			}
 		}()
 
@@ -67,70 +91,312 @@ func (h *CommandHandlers) handleWithRecovery(name string, handler nats.MsgHandle
 	}
 }
 
-// SubscribeAll subscribes to all command subjects for this device
-func (h *CommandHandlers) SubscribeAll(client *Client) error {
-	// Subscribe to ping command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.ping", h.subjectPrefix, h.deviceID),
-		h.handleWithRecovery("ping", h.handlePing),
-	); err != nil {
-		return err
+// RegisterService registers the command API as a NATS micro service
+// Each command is an endpoint, so $SRV.PING/INFO/STATS discover agents and report
+// per-endpoint request counts, errors and latency. Every command is available on
+// the device subject and, for fleet-wide scatter-gather requests, on the
+// broadcast and tag group subjects
+func (h *CommandHandlers) RegisterService(client *Client) error {
+	commands := []struct {
+		name    string
+		handler micro.HandlerFunc
+	}{
+		{"ping", h.handlePing},
+		{"service", h.handleServiceControl},
+		{"service.query", h.handleServiceQuery},
+		{"process.list", h.handleProcessList},
+		{"process.kill", h.handleProcessKill},
+		{"logs", h.handleLogFetch},
+		{"exec", h.handleCustomExec},
+		{"health", h.handleHealth},
 	}
 
-	// Subscribe to service control command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.service", h.subjectPrefix, h.deviceID),
-		h.handleWithRecovery("service", h.handleServiceControl),
-	); err != nil {
+	svc, err := client.AddService(micro.Config{
+		Name:        CommandServiceName,
+		Version:     serviceVersion(h.version),
+		Description: "win-agent command API",
+		Metadata:    h.serviceMetadata(),
+		// No queue group: every agent must answer broadcast and group requests
+		QueueGroupDisabled: true,
+	})
+	if err != nil {
 		return err
 	}
 
-	// Subscribe to log fetch command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.logs", h.subjectPrefix, h.deviceID),
-		h.handleWithRecovery("logs", h.handleLogFetch),
-	); err != nil {
-		return err
+	for _, target := range h.commandTargets() {
+		group := svc.AddGroup(target.subject)
+		for _, cmd := range commands {
+			// Endpoint names must be unique per service, so fleet endpoints are
+			// prefixed with their target (e.g. all-ping, group-site-hq-ping)
+			// Names cannot contain dots (service.query becomes service-query)
+			name := strings.ReplaceAll(cmd.name, ".", "-")
+			if target.name != "" {
+				name = target.name + "-" + name
+			}
+
+			h.endpoints[name] = cmd.name
+			if err := group.AddEndpoint(name,
+				h.handleWithRecovery(cmd.name, cmd.handler),
+				micro.WithEndpointSubject("cmd."+cmd.name),
+				micro.WithEndpointMetadata(map[string]string{
+					"command": cmd.name,
+					"scope":   target.scope,
+				}),
+			); err != nil {
+				svc.Stop()
+				return fmt.Errorf("failed to add %s endpoint: %w", name, err)
+			}
+
+			h.logger.Info("Registered command endpoint",
+				zap.String("endpoint", name),
+				zap.String("subject", target.subject+".cmd."+cmd.name))
+		}
 	}
 
-	// Subscribe to custom exec command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.exec", h.subjectPrefix, h.deviceID),
-		h.handleWithRecovery("exec", h.handleCustomExec),
-	); err != nil {
-		return err
+	h.service = svc
+	return nil
+}
+
+// Stop unregisters the command service
+func (h *CommandHandlers) Stop() error {
+	if h.service == nil {
+		return nil
 	}
+	return h.service.Stop()
+}
 
-	// Subscribe to health check command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.health", h.subjectPrefix, h.deviceID),
-		h.handleWithRecovery("health", h.handleHealth),
-	); err != nil {
-		return err
+// commandTarget is a subject root the agent accepts commands on
+type commandTarget struct {
+	subject string // Subject root; commands are {subject}.cmd.{command}
+	name    string // Endpoint name prefix; empty for the device's own subject
+	scope   string // device, broadcast or group
+}
+
+// commandTargets returns the subject roots this agent accepts commands on:
+//   {prefix}.{device_id}              - this device only
+//   {prefix}.all                      - every agent (if commands.broadcast is enabled)
+//   {prefix}.group.{tag}.{value}      - every agent with that tag
+func (h *CommandHandlers) commandTargets() []commandTarget {
+	targets := []commandTarget{{
+		subject: fmt.Sprintf("%s.%s", h.subjectPrefix, h.deviceID),
+		scope:   "device",
+	}}
+
+	if h.config.Commands.Broadcast {
+		targets = append(targets, commandTarget{
+			subject: fmt.Sprintf("%s.%s", h.subjectPrefix, config.BroadcastSubjectToken),
+			name:    config.BroadcastSubjectToken,
+			scope:   "broadcast",
+		})
 	}
 
-	return nil
+	// Sort tag names so endpoints are registered in a stable order
+	for _, name := range h.tagNames() {
+		value := h.config.Tags[name]
+		targets = append(targets, commandTarget{
+			subject: fmt.Sprintf("%s.%s.%s.%s", h.subjectPrefix, config.GroupSubjectToken, name, value),
+			name:    fmt.Sprintf("%s-%s-%s", config.GroupSubjectToken, name, value),
+			scope:   "group",
+		})
+	}
+
+	return targets
+}
+
+// tagNames returns the configured tag names in sorted order
+func (h *CommandHandlers) tagNames() []string {
+	names := make([]string, 0, len(h.config.Tags))
+	for name := range h.config.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serviceMetadata identifies the device in $SRV.PING/INFO/STATS responses
+// (the micro service ID is random per start, the device ID is not)
+func (h *CommandHandlers) serviceMetadata() map[string]string {
+	metadata := map[string]string{
+		"device_id":      h.deviceID,
+		"subject_prefix": h.subjectPrefix,
+		"agent_version":  h.version,
+		"platform":       runtime.GOOS,
+	}
+	for _, name := range h.tagNames() {
+		metadata["tag."+name] = h.config.Tags[name]
+	}
+	return metadata
+}
+
+// serviceSemVer matches versions accepted by the micro framework
+var serviceSemVer = regexp.MustCompile(`^\d+\.\d+\.\d+([-+][0-9A-Za-z.-]+)?$`)
+
+// serviceVersion returns the agent version in SemVer form, as micro requires
+// Development builds without a release version report 0.0.0
+func serviceVersion(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if serviceSemVer.MatchString(version) {
+		return version
+	}
+	return "0.0.0"
+}
+
+// errorDescription makes an error message safe for the service error header
+func errorDescription(message string) string {
+	if message = strings.Join(strings.Fields(message), " "); message == "" {
+		return "error"
+	}
+	return message
+}
+
+// getCommandStats returns per-endpoint statistics from the command service
+func (h *CommandHandlers) getCommandStats() *CommandServiceHealth {
+	if h.service == nil {
+		return nil
+	}
+
+	stats := h.service.Stats()
+	health := &CommandServiceHealth{
+		ServiceID: stats.ID,
+		Started:   stats.Started.Format(time.RFC3339),
+		Endpoints: make([]CommandEndpointStats, 0, len(stats.Endpoints)),
+	}
+	for _, ep := range stats.Endpoints {
+		health.Endpoints = append(health.Endpoints, CommandEndpointStats{
+			command:          h.endpoints[ep.Name],
+			Name:             ep.Name,
+			Subject:          ep.Subject,
+			Requests:         ep.NumRequests,
+			Errors:           ep.NumErrors,
+			LastError:        ep.LastError,
+			AverageLatencyMs: utils.Round(float64(ep.AverageProcessingTime) / float64(time.Millisecond)),
+		})
+	}
+	return health
+}
+
+// uncountedCommands are liveness probes left out of the agent command counts
+var uncountedCommands = map[string]bool{"ping": true, "health": true}
+
+// totals sums requests and errors over the command endpoints
+// A nil health (no command service) has none
+func (c *CommandServiceHealth) totals() (requests, errors int64) {
+	if c == nil {
+		return 0, 0
+	}
+	for _, ep := range c.Endpoints {
+		if uncountedCommands[ep.command] {
+			continue
+		}
+		requests += int64(ep.Requests)
+		errors += int64(ep.Errors)
+	}
+	return requests, errors
+}
+
+// activeAlerts lists firing alert rules and services whose recovery budget
+// is exhausted, ordered by rule then target
+func (h *CommandHandlers) activeAlerts() []alerts.Alert {
+	active := append(h.alerts.Active(), h.watchdog.Active()...)
+	sort.SliceStable(active, func(i, j int) bool {
+		if active[i].Rule != active[j].Rule {
+			return active[i].Rule < active[j].Rule
+		}
+		return active[i].Target < active[j].Target
+	})
+	return active
+}
+
+// recordError keeps the last failed command for health
+func (h *CommandHandlers) recordError(description string) {
+	h.errMu.Lock()
+	defer h.errMu.Unlock()
+	h.lastError = description
+	h.lastErrorTime = time.Now()
+}
+
+// fillCommandMetrics adds the command counts and the last error to the agent metrics
+func (h *CommandHandlers) fillCommandMetrics(metrics *tasks.AgentMetrics, commandStats *CommandServiceHealth) {
+	metrics.CommandsProcessed, metrics.CommandsErrored = commandStats.totals()
+
+	h.errMu.Lock()
+	defer h.errMu.Unlock()
+	if !h.lastErrorTime.IsZero() {
+		metrics.LastError = h.lastError
+		metrics.LastErrorTime = h.lastErrorTime.UTC().Format(time.RFC3339)
+	}
 }
 
 // Response structures
 
 type pingResponse struct {
 	Status    string `json:"status"`
+	DeviceID  string `json:"device_id"`
 	Timestamp string `json:"timestamp"`
 }
 
 type serviceControlRequest struct {
-	Action      string `json:"action"`
-	ServiceName string `json:"service_name"`
+	Action            string `json:"action"`
+	ServiceName       string `json:"service_name"`
+	StartupType       string `json:"startup_type,omitempty"`       // set_startup only
+	IncludeDependents bool   `json:"include_dependents,omitempty"` // stop and restart only
 }
 
 type serviceControlResponse struct {
-	Status      string `json:"status"`
-	ServiceName string `json:"service_name,omitempty"`
-	Action      string `json:"action,omitempty"`
-	Result      string `json:"result,omitempty"`
-	Error       string `json:"error,omitempty"`
-	Timestamp   string `json:"timestamp"`
+	Status            string   `json:"status"`
+	DeviceID          string   `json:"device_id"`
+	ServiceName       string   `json:"service_name,omitempty"`
+	Action            string   `json:"action,omitempty"`
+	Result            string   `json:"result,omitempty"`
+	State             string   `json:"state,omitempty"`              // Service state after the action
+	StartupType       string   `json:"startup_type,omitempty"`       // Startup type after the action
+	Dependents        []string `json:"dependents,omitempty"`         // Dependents stopped and restarted
+	StoppedDependents []string `json:"stopped_dependents,omitempty"` // Dependents a failed stop or restart left stopped
+	Error             string   `json:"error,omitempty"`
+	Timestamp         string   `json:"timestamp"`
+}
+
+type serviceQueryRequest struct {
+	ServiceName string `json:"service_name"`
+}
+
+type serviceQueryResponse struct {
+	Status    string                `json:"status"`
+	DeviceID  string                `json:"device_id"`
+	Service   *tasks.ServiceDetails `json:"service,omitempty"`
+	Error     string                `json:"error,omitempty"`
+	Timestamp string                `json:"timestamp"`
+}
+
+type processListRequest struct {
+	Sort string `json:"sort"` // cpu (default), memory, pid, name, start_time
+	Top  int    `json:"top"`  // 0 returns every match
+	Name string `json:"name"` // Executable name or glob pattern
+	User string `json:"user"`
+}
+
+type processListResponse struct {
+	Status    string              `json:"status"`
+	DeviceID  string              `json:"device_id"`
+	Processes []tasks.ProcessInfo `json:"processes,omitempty"`
+	Matched   *int                `json:"matched,omitempty"` // Set on success, including 0
+	Total     *int                `json:"total,omitempty"`
+	SampleMs  int64               `json:"sample_ms,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Timestamp string              `json:"timestamp"`
+}
+
+type processKillRequest struct {
+	PID  uint32 `json:"pid"`
+	Name string `json:"name"`
+}
+
+type processKillResponse struct {
+	Status    string   `json:"status"`
+	DeviceID  string   `json:"device_id"`
+	Killed    []uint32 `json:"killed,omitempty"` // PIDs terminated, also on partial failure
+	Error     string   `json:"error,omitempty"`
+	Timestamp string   `json:"timestamp"`
 }
 
 type logFetchRequest struct {
@@ -140,6 +406,7 @@ type logFetchRequest struct {
 
 type logFetchResponse struct {
 	Status     string   `json:"status"`
+	DeviceID   string   `json:"device_id"`
 	LogPath    string   `json:"log_path,omitempty"`
 	Lines      []string `json:"lines,omitempty"`
 	TotalLines int      `json:"total_lines,omitempty"`
@@ -153,6 +420,7 @@ type customExecRequest struct {
 
 type customExecResponse struct {
 	Status    string          `json:"status"`
+	DeviceID  string          `json:"device_id"`
 	Command   string          `json:"command,omitempty"`
 	Output    json.RawMessage `json:"output,omitempty"`
 	ExitCode  int             `json:"exit_code,omitempty"`
@@ -163,12 +431,33 @@ type customExecResponse struct {
 // Enhanced health response structures
 type healthResponse struct {
 	Status    string                       `json:"status"` // "healthy", "degraded", "unhealthy"
+	DeviceID  string                       `json:"device_id"`
 	Timestamp string                       `json:"timestamp"`
 	Agent     *tasks.AgentMetrics          `json:"agent"`
 	NATS      *NATSHealth                  `json:"nats"`
 	Tasks     *tasks.TaskHealthMetrics     `json:"tasks"`
 	Config    *ConfigInfo                  `json:"config"`
 	OS        *tasks.OSInfo                `json:"os"` // Operating system information
+	Commands  *CommandServiceHealth        `json:"commands,omitempty"`
+	Alerts    []alerts.Alert               `json:"alerts,omitempty"` // Currently firing alerts
+}
+
+// CommandServiceHealth reports the command service and its per-endpoint stats
+type CommandServiceHealth struct {
+	ServiceID string                 `json:"service_id"`
+	Started   string                 `json:"started"`
+	Endpoints []CommandEndpointStats `json:"endpoints"`
+}
+
+// CommandEndpointStats holds request/error counts and latency for one endpoint
+type CommandEndpointStats struct {
+	command          string  // Command the endpoint serves, e.g. ping for all-ping
+	Name             string  `json:"name"`
+	Subject          string  `json:"subject"`
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	LastError        string  `json:"last_error,omitempty"`
+	AverageLatencyMs float64 `json:"average_latency_ms"`
 }
 
 type NATSHealth struct {
@@ -180,102 +469,242 @@ type NATSHealth struct {
 	OutMsgs    uint64 `json:"out_msgs"`
 	InBytes    uint64 `json:"in_bytes"`
 	OutBytes   uint64 `json:"out_bytes"`
+
+	Credentials []CredentialStatus `json:"credentials,omitempty"` // Watched creds/TLS files with expiry
+	Streams     *StreamHealth      `json:"streams,omitempty"`     // JetStream capture of telemetry subjects
 }
 
 type ConfigInfo struct {
-	DeviceID      string   `json:"device_id"`
-	SubjectPrefix string   `json:"subject_prefix"`
-	Version       string   `json:"version"`
-	EnabledTasks  []string `json:"enabled_tasks"`
+	DeviceID       string            `json:"device_id"`
+	DeviceIDSource string            `json:"device_id_source,omitempty"` // Source/template when derived from the host
+	SubjectPrefix  string            `json:"subject_prefix"`
+	Version        string            `json:"version"`
+	EnabledTasks   []string          `json:"enabled_tasks"`
+	SecretSources  map[string]string `json:"secret_sources,omitempty"` // Field -> source kind only, never the value
+	Tags           map[string]string `json:"tags,omitempty"`
 }
 
 type errorResponse struct {
 	Status    string `json:"status"`
+	DeviceID  string `json:"device_id"`
 	Error     string `json:"error"`
 	Timestamp string `json:"timestamp"`
 }
 
 // handlePing responds to ping commands
-func (h *CommandHandlers) handlePing(msg *nats.Msg) {
+func (h *CommandHandlers) handlePing(msg micro.Request) {
 	h.logger.Debug("Received ping command")
 
 	response := pingResponse{
 		Status:    "pong",
+		DeviceID:  h.deviceID,
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
-	responseBytes, _ := json.Marshal(response)
-	msg.Respond(responseBytes)
+	h.respond(msg, messages.SchemaReplyPing, response)
 
 	h.logger.Debug("Sent pong response")
 }
 
-// handleServiceControl processes service start/stop/restart commands
-func (h *CommandHandlers) handleServiceControl(msg *nats.Msg) {
+// handleServiceControl processes service start/stop/restart/pause/continue
+// and startup type commands
+func (h *CommandHandlers) handleServiceControl(msg micro.Request) {
 	h.logger.Debug("Received service control command")
 
 	// Parse request
 	var req serviceControlRequest
-	if err := json.Unmarshal(msg.Data, &req); err != nil {
+	if err := decodeRequest(msg, &req); err != nil {
 		h.logger.Error("Failed to parse service control request", zap.Error(err))
 		h.respondError(msg, "Invalid request format")
-		h.taskExecutor.RecordCommandError(err)
 		return
 	}
 
 	h.logger.Info("Processing service control",
 		zap.String("action", req.Action),
-		zap.String("service", req.ServiceName))
+		zap.String("service", req.ServiceName),
+		zap.String("startup_type", req.StartupType),
+		zap.Bool("include_dependents", req.IncludeDependents))
 
 	// Execute service control
-	result, err := h.taskExecutor.ControlService(req.ServiceName, req.Action, h.config.Commands.AllowedServices)
+	result, err := h.taskExecutor.ControlServiceWith(tasks.ServiceControl{
+		Name:              req.ServiceName,
+		Action:            req.Action,
+		StartupType:       req.StartupType,
+		IncludeDependents: req.IncludeDependents,
+	}, h.config.Commands.AllowedServices)
 	if err != nil {
 		h.logger.Error("Service control failed",
 			zap.Error(err),
 			zap.String("service", req.ServiceName),
 			zap.String("action", req.Action))
 
-		h.taskExecutor.RecordCommandError(err)
-
 		response := serviceControlResponse{
 			Status:    "error",
+			DeviceID:  h.deviceID,
 			Error:     err.Error(),
 			Timestamp: time.Now().UTC().Format(time.RFC3339),
 		}
-		responseBytes, _ := json.Marshal(response)
-		msg.Respond(responseBytes)
+		if result != nil {
+			response.StoppedDependents = result.StoppedDependents
+		}
+		h.respondFailure(msg, "500", messages.SchemaReplyService, err.Error(), response)
 		return
 	}
 
-	h.taskExecutor.RecordCommandSuccess()
-
 	// Success response
 	response := serviceControlResponse{
 		Status:      "success",
+		DeviceID:    h.deviceID,
 		ServiceName: req.ServiceName,
 		Action:      req.Action,
-		Result:      result,
+		Result:      result.Message,
+		State:       result.State,
+		StartupType: result.StartupType,
+		Dependents:  result.Dependents,
 		Timestamp:   time.Now().UTC().Format(time.RFC3339),
 	}
 
-	responseBytes, _ := json.Marshal(response)
-	msg.Respond(responseBytes)
+	h.respond(msg, messages.SchemaReplyService, response)
 
 	h.logger.Info("Service control succeeded",
 		zap.String("service", req.ServiceName),
-		zap.String("action", req.Action))
+		zap.String("action", req.Action),
+		zap.String("state", result.State))
+}
+
+// handleServiceQuery returns the details of one service
+// Querying is read-only, so it is not limited to allowed_services
+func (h *CommandHandlers) handleServiceQuery(msg micro.Request) {
+	h.logger.Debug("Received service query command")
+
+	// Parse request
+	var req serviceQueryRequest
+	if err := decodeRequest(msg, &req); err != nil {
+		h.logger.Error("Failed to parse service query request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		return
+	}
+
+	details, err := h.taskExecutor.QueryService(req.ServiceName)
+	if err != nil {
+		h.logger.Warn("Service query failed",
+			zap.Error(err),
+			zap.String("service", req.ServiceName))
+
+		response := serviceQueryResponse{
+			Status:    "error",
+			DeviceID:  h.deviceID,
+			Error:     err.Error(),
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		}
+		h.respondFailure(msg, "500", messages.SchemaReplyServiceQuery, err.Error(), response)
+		return
+	}
+
+	response := serviceQueryResponse{
+		Status:    "success",
+		DeviceID:  h.deviceID,
+		Service:   details,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	h.respond(msg, messages.SchemaReplyServiceQuery, response)
+}
+
+// handleProcessList returns running processes with CPU and memory usage
+func (h *CommandHandlers) handleProcessList(msg micro.Request) {
+	h.logger.Debug("Received process list command")
+
+	// Parse request
+	var req processListRequest
+	if err := decodeRequest(msg, &req); err != nil {
+		h.logger.Error("Failed to parse process list request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		return
+	}
+
+	list, err := h.taskExecutor.ListProcesses(tasks.ProcessListOptions{
+		SortBy: req.Sort,
+		Top:    req.Top,
+		Name:   req.Name,
+		User:   req.User,
+	})
+	if err != nil {
+		h.logger.Error("Process list failed", zap.Error(err))
+
+		response := processListResponse{
+			Status:    "error",
+			DeviceID:  h.deviceID,
+			Error:     err.Error(),
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		}
+		h.respondFailure(msg, "500", messages.SchemaReplyProcessList, err.Error(), response)
+		return
+	}
+
+	response := processListResponse{
+		Status:    "success",
+		DeviceID:  h.deviceID,
+		Processes: list.Processes,
+		Matched:   &list.Matched,
+		Total:     &list.Total,
+		SampleMs:  list.SampleMs,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	h.respond(msg, messages.SchemaReplyProcessList, response)
+}
+
+// handleProcessKill terminates processes whose executable is in allowed_processes
+func (h *CommandHandlers) handleProcessKill(msg micro.Request) {
+	h.logger.Debug("Received process kill command")
+
+	// Parse request
+	var req processKillRequest
+	if err := decodeRequest(msg, &req); err != nil {
+		h.logger.Error("Failed to parse process kill request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		return
+	}
+
+	h.logger.Info("Processing process kill",
+		zap.Uint32("pid", req.PID),
+		zap.String("name", req.Name))
+
+	killed, err := h.taskExecutor.KillProcesses(req.PID, req.Name, h.config.Commands.AllowedProcesses)
+	if err != nil {
+		h.logger.Error("Process kill failed",
+			zap.Error(err),
+			zap.Uint32("pid", req.PID),
+			zap.String("name", req.Name))
+
+		response := processKillResponse{
+			Status:    "error",
+			DeviceID:  h.deviceID,
+			Killed:    killed,
+			Error:     err.Error(),
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		}
+		h.respondFailure(msg, "500", messages.SchemaReplyProcessKill, err.Error(), response)
+		return
+	}
+
+	response := processKillResponse{
+		Status:    "success",
+		DeviceID:  h.deviceID,
+		Killed:    killed,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	h.respond(msg, messages.SchemaReplyProcessKill, response)
 }
 
 // handleLogFetch retrieves log file contents
-func (h *CommandHandlers) handleLogFetch(msg *nats.Msg) {
+func (h *CommandHandlers) handleLogFetch(msg micro.Request) {
 	h.logger.Debug("Received log fetch command")
 
 	// Parse request
 	var req logFetchRequest
-	if err := json.Unmarshal(msg.Data, &req); err != nil {
+	if err := decodeRequest(msg, &req); err != nil {
 		h.logger.Error("Failed to parse log fetch request", zap.Error(err))
 		h.respondError(msg, "Invalid request format")
-		h.taskExecutor.RecordCommandError(err)
 		return
 	}
 
@@ -290,31 +719,27 @@ func (h *CommandHandlers) handleLogFetch(msg *nats.Msg) {
 			zap.Error(err),
 			zap.String("path", req.LogPath))
 
-		h.taskExecutor.RecordCommandError(err)
-
 		response := logFetchResponse{
 			Status:    "error",
+			DeviceID:  h.deviceID,
 			Error:     err.Error(),
 			Timestamp: time.Now().UTC().Format(time.RFC3339),
 		}
-		responseBytes, _ := json.Marshal(response)
-		msg.Respond(responseBytes)
+		h.respondFailure(msg, "500", messages.SchemaReplyLogs, err.Error(), response)
 		return
 	}
 
-	h.taskExecutor.RecordCommandSuccess()
-
 	// Success response
 	response := logFetchResponse{
 		Status:     "success",
+		DeviceID:   h.deviceID,
 		LogPath:    req.LogPath,
 		Lines:      lines,
 		TotalLines: len(lines),
 		Timestamp:  time.Now().UTC().Format(time.RFC3339),
 	}
 
-	responseBytes, _ := json.Marshal(response)
-	msg.Respond(responseBytes)
+	h.respond(msg, messages.SchemaReplyLogs, response)
 
 	h.logger.Info("Log fetch succeeded",
 		zap.String("path", req.LogPath),
@@ -322,15 +747,14 @@ func (h *CommandHandlers) handleLogFetch(msg *nats.Msg) {
 }
 
 // handleCustomExec executes whitelisted PowerShell commands or scripts
-func (h *CommandHandlers) handleCustomExec(msg *nats.Msg) {
+func (h *CommandHandlers) handleCustomExec(msg micro.Request) {
 	h.logger.Debug("Received custom exec command")
 
 	// Parse request
 	var req customExecRequest
-	if err := json.Unmarshal(msg.Data, &req); err != nil {
+	if err := decodeRequest(msg, &req); err != nil {
 		h.logger.Error("Failed to parse exec request", zap.Error(err))
 		h.respondError(msg, "Invalid request format")
-		h.taskExecutor.RecordCommandError(err)
 		return
 	}
 
@@ -348,20 +772,16 @@ func (h *CommandHandlers) handleCustomExec(msg *nats.Msg) {
 			zap.Error(err),
 			zap.String("command", req.Command))
 
-		h.taskExecutor.RecordCommandError(err)
-
 		response := customExecResponse{
 			Status:    "error",
+			DeviceID:  h.deviceID,
 			Error:     err.Error(),
 			Timestamp: time.Now().UTC().Format(time.RFC3339),
 		}
-		responseBytes, _ := json.Marshal(response)
-		msg.Respond(responseBytes)
+		h.respondFailure(msg, "500", messages.SchemaReplyExec, err.Error(), response)
 		return
 	}
 
-	h.taskExecutor.RecordCommandSuccess()
-
 	// Prepare output for response
 	// IMPROVED: Always try to parse as JSON first, regardless of first character
 	// This prevents false positives like "[ERROR] message" being treated as JSON
@@ -384,14 +804,14 @@ func (h *CommandHandlers) handleCustomExec(msg *nats.Msg) {
 	// Success response
 	response := customExecResponse{
 		Status:    "success",
+		DeviceID:  h.deviceID,
 		Command:   req.Command,
 		Output:    outputData,
 		ExitCode:  exitCode,
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
-	responseBytes, _ := json.Marshal(response)
-	msg.Respond(responseBytes)
+	h.respond(msg, messages.SchemaReplyExec, response)
 
 	h.logger.Info("Command execution succeeded",
 		zap.String("command", req.Command),
@@ -399,11 +819,13 @@ func (h *CommandHandlers) handleCustomExec(msg *nats.Msg) {
 }
 
 // handleHealth returns enhanced agent health information
-func (h *CommandHandlers) handleHealth(msg *nats.Msg) {
+func (h *CommandHandlers) handleHealth(msg micro.Request) {
 	h.logger.Debug("Received health check command")
 
-	// Get agent metrics
+	// Get agent metrics, with command counts from the command service
 	agentMetrics := h.taskExecutor.GetAgentMetrics()
+	commandStats := h.getCommandStats()
+	h.fillCommandMetrics(agentMetrics, commandStats)
 
 	// Get task metrics
 	taskMetrics := h.taskExecutor.GetTaskMetrics()
@@ -422,16 +844,18 @@ func (h *CommandHandlers) handleHealth(msg *nats.Msg) {
 
 	response := healthResponse{
 		Status:    status,
+		DeviceID:  h.deviceID,
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 		Agent:     agentMetrics,
 		NATS:      natsHealth,
 		Tasks:     taskMetrics,
 		Config:    configInfo,
 		OS:        osInfo,
+		Commands:  commandStats,
+		Alerts:    h.activeAlerts(),
 	}
 
-	responseBytes, _ := json.Marshal(response)
-	msg.Respond(responseBytes)
+	h.respond(msg, messages.SchemaReplyHealth, response)
 
 	h.logger.Debug("Sent health response",
 		zap.String("status", status),
@@ -459,6 +883,9 @@ func (h *CommandHandlers) getNATSHealth() *NATSHealth {
 		health.ServerID = h.natsClient.conn.ConnectedServerId()
 	}
 
+	health.Credentials = h.natsClient.CredentialStatus()
+	health.Streams = h.natsClient.StreamHealth()
+
 	return health
 }
 
@@ -475,15 +902,24 @@ func (h *CommandHandlers) getConfigInfo() *ConfigInfo {
 	if h.config.Tasks.ServiceCheck.Enabled {
 		enabledTasks = append(enabledTasks, "service_check")
 	}
+	if h.config.Tasks.ProcessCheck.Enabled {
+		enabledTasks = append(enabledTasks, "process_check")
+	}
 	if h.config.Tasks.Inventory.Enabled {
 		enabledTasks = append(enabledTasks, "inventory")
 	}
+	for _, target := range h.config.Tasks.ScrapeTargets {
+		enabledTasks = append(enabledTasks, "scrape:"+target.Name)
+	}
 
 	return &ConfigInfo{
-		DeviceID:      h.deviceID,
-		SubjectPrefix: h.subjectPrefix,
-		Version:       h.version,
-		EnabledTasks:  enabledTasks,
+		DeviceID:       h.deviceID,
+		DeviceIDSource: h.config.DeviceIDSource,
+		SubjectPrefix:  h.subjectPrefix,
+		Version:        h.version,
+		EnabledTasks:   enabledTasks,
+		SecretSources:  h.config.SecretSources,
+		Tags:           h.config.Tags,
 	}
 }
 
@@ -516,6 +952,19 @@ func (h *CommandHandlers) determineHealthStatus(natsHealth *NATSHealth, taskMetr
 		return "degraded"
 	}
 
+	// DEGRADED: Telemetry subjects no stream captures (published data is lost)
+	if natsHealth.Streams != nil && (len(natsHealth.Streams.Missing) > 0 || natsHealth.Streams.Error != "") {
+		return "degraded"
+	}
+
+	// DEGRADED: Credentials expiring within the warning window (or expired)
+	// The connection still works until the server rejects them on reconnect
+	for _, cred := range natsHealth.Credentials {
+		if cred.ExpiresWithin(h.config.NATS.CertExpiryWarning) {
+			return "degraded"
+		}
+	}
+
 	// DEGRADED: High metrics failure rate (>50% failures)
 	// Only check if we have enough samples to be meaningful
 	if taskMetrics.MetricsCount > 0 {
@@ -530,12 +979,51 @@ func (h *CommandHandlers) determineHealthStatus(natsHealth *NATSHealth, taskMetr
 }
 
 // respondError sends a generic error response
-func (h *CommandHandlers) respondError(msg *nats.Msg, errorMsg string) {
+func (h *CommandHandlers) respondError(msg micro.Request, errorMsg string) {
 	response := errorResponse{
 		Status:    "error",
+		DeviceID:  h.deviceID,
 		Error:     errorMsg,
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
-	responseBytes, _ := json.Marshal(response)
-	msg.Respond(responseBytes)
+	h.respondFailure(msg, "400", messages.SchemaReplyError, errorMsg, response)
+}
+
+// respond sends a successful reply wrapped in the message envelope
+func (h *CommandHandlers) respond(msg micro.Request, schema string, response interface{}) {
+	responseBytes, err := h.natsClient.messages.Marshal(schema, 0, response)
+	if err != nil {
+		h.logger.Error("Failed to marshal reply", zap.String("schema", schema), zap.Error(err))
+		msg.Error("500", "failed to encode reply", nil)
+		return
+	}
+	msg.Respond(responseBytes, h.contentHeaders())
+}
+
+// respondFailure sends an error reply with the service error headers set,
+// so micro counts it in the endpoint's error stats
+func (h *CommandHandlers) respondFailure(msg micro.Request, code, schema, description string, response interface{}) {
+	h.recordError(description)
+	responseBytes, _ := h.natsClient.messages.Marshal(schema, 0, response)
+	msg.Error(code, errorDescription(description), responseBytes, h.contentHeaders())
+}
+
+// contentHeaders advertises the reply encoding and compression
+func (h *CommandHandlers) contentHeaders() micro.RespondOpt {
+	return func(reply *nats.Msg) {
+		if reply.Header == nil {
+			reply.Header = nats.Header{}
+		}
+		h.natsClient.setContentHeaders(reply.Header)
+	}
+}
+
+// decodeRequest decodes a request body according to its Content-Type and
+// Content-Encoding headers (JSON when absent)
+func decodeRequest(msg micro.Request, v interface{}) error {
+	headers := msg.Headers()
+	return messages.Decode(
+		headers.Get(messages.HeaderContentType),
+		headers.Get(messages.HeaderContentEncoding),
+		msg.Data(), v)
 }
@@ -0,0 +1,166 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/alerts"
+	"win-agent/internal/config"
+	"win-agent/internal/tasks"
+	"win-agent/internal/watchdog"
+)
+
+// TestCommandServiceTotals tests the command counts reported under agent in health
+func TestCommandServiceTotals(t *testing.T) {
+	var none *CommandServiceHealth
+	if requests, errors := none.totals(); requests != 0 || errors != 0 {
+		t.Errorf("nil totals = %d/%d, want 0/0", requests, errors)
+	}
+
+	// Ping and health are liveness probes and not counted
+	health := &CommandServiceHealth{Endpoints: []CommandEndpointStats{
+		{command: "ping", Name: "ping", Requests: 10},
+		{command: "ping", Name: "all-ping", Requests: 5},
+		{command: "health", Name: "health", Requests: 7, Errors: 1},
+		{command: "exec", Name: "exec", Requests: 4, Errors: 3},
+		{command: "exec", Name: "all-exec", Requests: 2, Errors: 1},
+		{command: "service.query", Name: "service-query", Requests: 3},
+	}}
+	if requests, errors := health.totals(); requests != 9 || errors != 4 {
+		t.Errorf("totals = %d/%d, want 9/4", requests, errors)
+	}
+}
+
+// TestRecordCommandSuccess tests successful commands are counted without a last error
+func TestRecordCommandSuccess(t *testing.T) {
+	h := &CommandHandlers{}
+
+	// Initial state
+	metrics := &tasks.AgentMetrics{}
+	h.fillCommandMetrics(metrics, &CommandServiceHealth{})
+	if metrics.CommandsProcessed != 0 {
+		t.Errorf("Initial CommandsProcessed = %d, want 0", metrics.CommandsProcessed)
+	}
+
+	metrics = &tasks.AgentMetrics{}
+	h.fillCommandMetrics(metrics, &CommandServiceHealth{Endpoints: []CommandEndpointStats{
+		{command: "service", Name: "service", Requests: 3},
+	}})
+	if metrics.CommandsProcessed != 3 {
+		t.Errorf("CommandsProcessed = %d, want 3", metrics.CommandsProcessed)
+	}
+	if metrics.CommandsErrored != 0 {
+		t.Errorf("CommandsErrored = %d, want 0", metrics.CommandsErrored)
+	}
+	if metrics.LastError != "" || metrics.LastErrorTime != "" {
+		t.Errorf("LastError = %q at %q, want empty", metrics.LastError, metrics.LastErrorTime)
+	}
+}
+
+// TestRecordCommandError tests the last failed command is reported with its time
+func TestRecordCommandError(t *testing.T) {
+	h := &CommandHandlers{}
+
+	h.recordError("test error")
+	metrics := &tasks.AgentMetrics{}
+	h.fillCommandMetrics(metrics, &CommandServiceHealth{Endpoints: []CommandEndpointStats{
+		{command: "exec", Name: "exec", Requests: 1, Errors: 1},
+	}})
+	if metrics.CommandsErrored != 1 {
+		t.Errorf("CommandsErrored = %d, want 1", metrics.CommandsErrored)
+	}
+	if metrics.CommandsProcessed != 1 {
+		t.Errorf("CommandsProcessed = %d, want 1 (errors count as processed)", metrics.CommandsProcessed)
+	}
+	if metrics.LastError != "test error" {
+		t.Errorf("LastError = %q, want %q", metrics.LastError, "test error")
+	}
+	if _, err := time.Parse(time.RFC3339, metrics.LastErrorTime); err != nil {
+		t.Errorf("LastErrorTime parse error: %v", err)
+	}
+
+	// The newest error wins
+	h.recordError("second error")
+	metrics = &tasks.AgentMetrics{}
+	h.fillCommandMetrics(metrics, nil)
+	if metrics.LastError != "second error" {
+		t.Errorf("LastError = %q, want %q", metrics.LastError, "second error")
+	}
+}
+
+// TestConcurrentCommandRecording tests thread-safety of error recording against health
+func TestConcurrentCommandRecording(t *testing.T) {
+	h := &CommandHandlers{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if j%2 == 0 {
+					h.recordError(fmt.Sprintf("error %d", i))
+				} else {
+					h.fillCommandMetrics(&tasks.AgentMetrics{}, nil)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	metrics := &tasks.AgentMetrics{}
+	h.fillCommandMetrics(metrics, nil)
+	if metrics.LastError == "" || metrics.LastErrorTime == "" {
+		t.Errorf("LastError = %q at %q, want set", metrics.LastError, metrics.LastErrorTime)
+	}
+}
+
+// failingRecoverer is a watchdog.Recoverer whose restarts never work
+type failingRecoverer struct{}
+
+func (failingRecoverer) RecoverService(name string) error {
+	return errors.New("service did not start")
+}
+
+func (failingRecoverer) ExecuteCommand(command string, allowedCommands []string, scriptsDir string, timeout time.Duration) (string, int, error) {
+	return "", 0, nil
+}
+
+// TestActiveAlertsRecovery tests that a service whose recovery budget is
+// exhausted is listed with the firing alert rules in health
+func TestActiveAlertsRecovery(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tasks.ServiceCheck.Recovery = []config.RecoveryPolicy{{Service: "Spooler", FailedChecks: 1, MaxRestarts: 1}}
+	var published []alerts.Event
+	w := watchdog.New(zap.NewNop(), failingRecoverer{}, cfg, func(watchdog.Event) {}, func(event alerts.Event) {
+		published = append(published, event)
+	})
+
+	evaluator := alerts.NewEvaluator([]config.AlertRule{{
+		Name: "spooler_down", Service: "Spooler", Status: "Running", Severity: config.AlertSeverityWarning,
+	}})
+	h := &CommandHandlers{alerts: evaluator, watchdog: w}
+	if active := h.activeAlerts(); len(active) != 0 {
+		t.Fatalf("activeAlerts() = %+v before any check, want none", active)
+	}
+
+	// One failed attempt uses up the budget; the next check exhausts it
+	stopped := []tasks.ServiceStatus{{Name: "Spooler", Status: "Stopped"}}
+	start := time.Now()
+	w.Observe(stopped, start)
+	w.Wait()
+	w.Observe(stopped, start.Add(time.Minute))
+	evaluator.ObserveServices(stopped, start.Add(time.Minute))
+
+	active := h.activeAlerts()
+	if len(active) != 2 || active[0].Rule != watchdog.AlertRule || active[1].Rule != "spooler_down" {
+		t.Fatalf("activeAlerts() = %+v, want service_recovery then spooler_down", active)
+	}
+	if len(published) != 1 || active[0] != published[0].Alert {
+		t.Errorf("health alert = %+v, want the published alert %+v", active[0], published)
+	}
+}
@@ -0,0 +1,42 @@
+package nats
+
+import (
+	"win-agent/internal/alerts"
+	"win-agent/internal/messages"
+	"win-agent/internal/tasks"
+	"win-agent/internal/watchdog"
+)
+
+//go:generate go run ../../cmd/schemagen -out ../../schemas
+
+// MessageTypes returns the Go value published under each schema name
+// Used to generate the JSON Schemas in schemas/; add new telemetry and
+// reply types here when they are introduced
+func MessageTypes() map[string]interface{} {
+	return map[string]interface{}{
+		messages.SchemaHeartbeat:          tasks.Heartbeat{},
+		messages.SchemaSystemMetrics:      tasks.SystemMetrics{},
+		messages.SchemaSystemMetricsError: tasks.MetricsError{},
+		messages.SchemaServiceStatus:      tasks.ServiceReport{},
+		messages.SchemaProcessStatus:      tasks.ProcessReport{},
+		messages.SchemaInventory:          tasks.Inventory{},
+		messages.SchemaInventoryDiff:      tasks.InventoryDiff{},
+		messages.SchemaScrapeTarget:       tasks.TargetMetrics{},
+		messages.SchemaScrapeTargetError:  tasks.MetricsError{},
+		messages.SchemaCertExpiry:         CredentialExpiryEvent{},
+		messages.SchemaServiceTransition:  tasks.ServiceTransition{},
+		messages.SchemaServiceRecovery:    watchdog.Event{},
+		messages.SchemaProcessEvent:       tasks.ProcessEvent{},
+		messages.SchemaAlert:              alerts.Event{},
+
+		messages.SchemaReplyPing:         pingResponse{},
+		messages.SchemaReplyService:      serviceControlResponse{},
+		messages.SchemaReplyServiceQuery: serviceQueryResponse{},
+		messages.SchemaReplyProcessList:  processListResponse{},
+		messages.SchemaReplyProcessKill:  processKillResponse{},
+		messages.SchemaReplyLogs:         logFetchResponse{},
+		messages.SchemaReplyExec:         customExecResponse{},
+		messages.SchemaReplyHealth:       healthResponse{},
+		messages.SchemaReplyError:        errorResponse{},
+	}
+}
@@ -0,0 +1,229 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Telemetry headers
+const (
+	// HeaderMsgID lets JetStream drop duplicates from PublishAsync retries
+	HeaderMsgID = "Nats-Msg-Id"
+
+	// HeaderSequence carries the per-subject sequence so consumers can spot gaps
+	HeaderSequence = "Agent-Seq"
+
+	// HeaderSchema names the payload schema so consumers can route without decoding
+	HeaderSchema = "Agent-Schema"
+)
+
+// sequencePersistInterval is how often changed counters are written to disk
+const sequencePersistInterval = 5 * time.Second
+
+// sequenceCrashMargin is added to every counter when the file was not saved
+// on a clean shutdown, since up to sequencePersistInterval of numbers may
+// have been used without being persisted
+// Skipping numbers after a crash is safe; reusing them is not
+const sequenceCrashMargin = 1000
+
+// sequenceFile is the on-disk form of the per-subject counters
+type sequenceFile struct {
+	Sequences map[string]uint64 `json:"sequences"`
+	Base      uint64            `json:"base,omitempty"`  // Start of subjects not listed, raised after each crash
+	Clean     bool              `json:"clean,omitempty"` // Written on shutdown; counters are exact
+}
+
+// sequencer hands out monotonic per-subject sequence numbers and persists
+// them so numbering continues across restarts instead of starting over
+// (which would look like duplicates to JetStream and resets to consumers)
+// Counters are kept in memory and written periodically and on stop, so
+// publishing never waits on disk I/O
+type sequencer struct {
+	mu     sync.Mutex
+	path   string
+	seqs   map[string]uint64
+	base   uint64 // Start of subjects not yet numbered, kept across restarts
+	dirty  bool
+	logger *zap.Logger
+
+	saveMu sync.Mutex // Serializes file writes, outside mu
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newSequencer loads persisted sequences from path and starts persisting
+// them in the background
+// An empty path keeps sequences in memory only
+func newSequencer(path string, logger *zap.Logger) *sequencer {
+	s := &sequencer{
+		path:   path,
+		seqs:   make(map[string]uint64),
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	if path == "" {
+		return s
+	}
+	s.load()
+
+	// Mark the file as in use right away, so a crash before the first
+	// periodic save is detected on the next start
+	s.dirty = true
+	if err := s.save(false); err != nil {
+		s.logger.Warn("Failed to persist telemetry sequences", zap.Error(err))
+	}
+
+	s.wg.Add(1)
+	go s.persist()
+	return s
+}
+
+// load reads the sequence file, skipping ahead if it was not saved cleanly
+func (s *sequencer) load() {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		s.logger.Warn("Failed to read sequence file, numbering restarts at 1",
+			zap.String("file", s.path), zap.Error(err))
+		return
+	}
+
+	var file sequenceFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		s.logger.Warn("Failed to parse sequence file, numbering restarts at 1",
+			zap.String("file", s.path), zap.Error(err))
+		return
+	}
+
+	// Subjects first numbered in the crashed run may not be in the file,
+	// so the base moves past them too
+	var margin uint64
+	if !file.Clean {
+		margin = sequenceCrashMargin
+		s.logger.Info("Agent did not shut down cleanly, skipping telemetry sequences ahead",
+			zap.Uint64("margin", margin))
+	}
+	s.base = file.Base + margin
+	for subject, seq := range file.Sequences {
+		s.seqs[subject] = seq + margin
+	}
+
+	s.logger.Debug("Loaded telemetry sequences", zap.Int("subjects", len(s.seqs)))
+}
+
+// next returns the next sequence number for subject
+func (s *sequencer) next(subject string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq, ok := s.seqs[subject]
+	if !ok {
+		seq = s.base
+	}
+	seq++
+	s.seqs[subject] = seq
+	s.dirty = true
+	return seq
+}
+
+// persist saves changed counters every sequencePersistInterval until stop
+func (s *sequencer) persist() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(sequencePersistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.save(false); err != nil {
+				// Keep publishing; numbering is still monotonic for this run
+				s.logger.Warn("Failed to persist telemetry sequences", zap.Error(err))
+			}
+		}
+	}
+}
+
+// stop ends background persistence and saves the exact counters, marked
+// clean so the next start continues without skipping
+func (s *sequencer) stop() {
+	if s.path == "" {
+		return
+	}
+	select {
+	case <-s.done:
+		return
+	default:
+		close(s.done)
+	}
+	s.wg.Wait()
+
+	s.mu.Lock()
+	s.dirty = true // Always rewrite to record the clean shutdown
+	s.mu.Unlock()
+	if err := s.save(true); err != nil {
+		s.logger.Warn("Failed to persist telemetry sequences", zap.Error(err))
+	}
+}
+
+// save writes the counters to disk if they changed since the last save
+// Only the snapshot is taken under the lock; the write happens outside it
+func (s *sequencer) save(clean bool) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	file := sequenceFile{Sequences: make(map[string]uint64, len(s.seqs)), Base: s.base, Clean: clean}
+	for subject, seq := range s.seqs {
+		file.Sequences[subject] = seq
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err := s.write(file); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write replaces the sequence file atomically
+func (s *sequencer) write(file sequenceFile) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode sequences: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create sequence directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write sequence file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace sequence file: %w", err)
+	}
+	return nil
+}
+
+// messageID builds the deterministic JetStream message ID for a publish
+// The subject identifies device and task; the sequence makes it unique
+func messageID(subject string, seq uint64) string {
+	return fmt.Sprintf("%s.%d", subject, seq)
+}
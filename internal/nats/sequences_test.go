@@ -0,0 +1,121 @@
+package nats
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// readSequenceFile decodes a sequence file written by the sequencer
+func readSequenceFile(t *testing.T, path string) sequenceFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var file sequenceFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("sequence file is not valid JSON: %v", err)
+	}
+	return file
+}
+
+// TestSequencerIncrement tests per-subject numbering in memory
+func TestSequencerIncrement(t *testing.T) {
+	s := newSequencer("", zap.NewNop())
+	defer s.stop()
+
+	for want := uint64(1); want <= 3; want++ {
+		if got := s.next("agents.a.heartbeat"); got != want {
+			t.Errorf("next(heartbeat) = %d, want %d", got, want)
+		}
+	}
+	if got := s.next("agents.a.telemetry.system"); got != 1 {
+		t.Errorf("next(system) = %d, want 1 (subjects are numbered independently)", got)
+	}
+	if got := messageID("agents.a.heartbeat", 3); got != "agents.a.heartbeat.3" {
+		t.Errorf("messageID() = %q", got)
+	}
+}
+
+// TestSequencerCleanRestart tests that a clean shutdown persists the exact counters
+func TestSequencerCleanRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "sequences.json")
+
+	s := newSequencer(path, zap.NewNop())
+	if file := readSequenceFile(t, path); file.Clean {
+		t.Error("sequence file is marked clean while the sequencer runs")
+	}
+	s.next("heartbeat")
+	s.next("heartbeat")
+	s.stop()
+
+	file := readSequenceFile(t, path)
+	if !file.Clean || file.Sequences["heartbeat"] != 2 {
+		t.Errorf("file after stop = %+v, want clean with heartbeat 2", file)
+	}
+
+	s = newSequencer(path, zap.NewNop())
+	defer s.stop()
+	if got := s.next("heartbeat"); got != 3 {
+		t.Errorf("next() after clean restart = %d, want 3", got)
+	}
+	if got := s.next("events.service"); got != 1 {
+		t.Errorf("next(new subject) after clean restart = %d, want 1", got)
+	}
+}
+
+// TestSequencerCrashRestart tests that numbering skips ahead when the
+// last run did not stop cleanly, including for subjects not yet saved
+func TestSequencerCrashRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sequences.json")
+
+	// A crashed run: numbers were used after the last periodic save
+	crashed := newSequencer(path, zap.NewNop())
+	crashed.next("heartbeat")
+	if err := crashed.save(false); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	crashed.next("heartbeat")
+	crashed.next("telemetry.system")
+	close(crashed.done)
+	crashed.wg.Wait()
+
+	s := newSequencer(path, zap.NewNop())
+	if got, want := s.next("heartbeat"), uint64(1+sequenceCrashMargin+1); got != want {
+		t.Errorf("next(heartbeat) after crash = %d, want %d", got, want)
+	}
+	if got, want := s.next("telemetry.system"), uint64(sequenceCrashMargin+1); got != want {
+		t.Errorf("next(unsaved subject) after crash = %d, want %d", got, want)
+	}
+	s.stop()
+
+	// The raised base survives a later clean restart
+	s = newSequencer(path, zap.NewNop())
+	defer s.stop()
+	if got, want := s.next("events.process"), uint64(sequenceCrashMargin+1); got != want {
+		t.Errorf("next(new subject) after clean restart = %d, want %d", got, want)
+	}
+}
+
+// TestSequencerCorruptFile tests that an unreadable file restarts numbering
+// and is replaced with a valid one
+func TestSequencerCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sequences.json")
+	if err := os.WriteFile(path, []byte(`{"sequences":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSequencer(path, zap.NewNop())
+	if got := s.next("heartbeat"); got != 1 {
+		t.Errorf("next() with corrupt file = %d, want 1", got)
+	}
+	s.stop()
+
+	if file := readSequenceFile(t, path); !file.Clean || file.Sequences["heartbeat"] != 1 {
+		t.Errorf("file after stop = %+v, want clean with heartbeat 1", file)
+	}
+}
@@ -0,0 +1,241 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// StreamHealth reports which JetStream streams capture the agent's telemetry
+type StreamHealth struct {
+	Mode        string            `json:"mode"`
+	Provisioned string            `json:"provisioned,omitempty"` // Stream created/updated at startup
+	Streams     map[string]string `json:"streams,omitempty"`     // Subject -> stream name
+	Missing     []string          `json:"missing,omitempty"`     // Subjects no stream captures
+	Error       string            `json:"error,omitempty"`
+}
+
+// TelemetrySubjects returns the subjects the agent publishes to JetStream
+// with this config, so stream checks only ask for what is actually sent
+// Keep this in sync with the scheduler
+func TelemetrySubjects(cfg *config.Config) []string {
+	base := fmt.Sprintf("%s.%s", cfg.SubjectPrefix, cfg.DeviceID)
+	taskCfg := &cfg.Tasks
+
+	var subjects []string
+	add := func(enabled bool, suffixes ...string) {
+		if enabled {
+			for _, suffix := range suffixes {
+				subjects = append(subjects, base+"."+suffix)
+			}
+		}
+	}
+
+	// The watchdog raises an alert when a recovery budget runs out
+	recovery := taskCfg.ServiceCheck.Enabled && len(taskCfg.ServiceCheck.Recovery) > 0
+
+	add(taskCfg.Heartbeat.Enabled, "heartbeat")
+	add(taskCfg.SystemMetrics.Enabled, "telemetry.system")
+	add(taskCfg.ServiceCheck.Enabled, "telemetry.service")
+	add(taskCfg.ServiceCheck.Enabled && serviceEvents(&taskCfg.ServiceCheck), "events.service")
+	add(recovery, "events.recovery")
+	add(taskCfg.ProcessCheck.Enabled, "telemetry.process", "events.process")
+	add(taskCfg.Inventory.Enabled, "telemetry.inventory")
+	add(taskCfg.Inventory.Enabled && taskCfg.Inventory.Mode == config.PublishModeChanges, "telemetry.inventory.diff")
+	add(cfg.NATS.CertExpiryWarning > 0 && watchesCredentials(&cfg.NATS), "events.cert_expiry")
+	add(recovery || (cfg.Alerts.Enabled && len(cfg.Alerts.Rules) > 0), "alerts")
+	for _, target := range taskCfg.ScrapeTargets {
+		add(true, "telemetry."+target.Name)
+	}
+	return subjects
+}
+
+// serviceEvents reports whether service_check publishes events.service:
+// state changes in changes mode, and services that start or stop matching
+// a pattern in either mode
+func serviceEvents(cfg *config.ServiceCheckConfig) bool {
+	if cfg.Mode == config.PublishModeChanges {
+		return true
+	}
+	for _, entry := range cfg.Services {
+		if config.IsServicePattern(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchesCredentials reports whether any creds or certificate files are
+// watched for expiry (see newCredentialWatcher)
+func watchesCredentials(cfg *config.NATSConfig) bool {
+	return cfg.Auth.Type == "creds" ||
+		(cfg.TLS.Enabled && (cfg.TLS.CAFile != "" || (cfg.TLS.CertFile != "" && cfg.TLS.KeyFile != "")))
+}
+
+// defaultStreamSubjects are captured by a provisioned stream when none are configured
+// Commands ({prefix}.*.cmd.*) are deliberately left out - they are request/reply
+func defaultStreamSubjects(prefix string) []string {
+	return []string{
+		prefix + ".*.heartbeat",
+		prefix + ".*.telemetry.>",
+		prefix + ".*.events.>",
+		prefix + ".*.alerts",
+	}
+}
+
+// EnsureStreams provisions and/or validates the telemetry stream per nats.stream
+// With on_missing: fail a subject without a stream is returned as an error;
+// with degrade it is only reported in health
+// subjects are the agent's TelemetrySubjects
+func (c *Client) EnsureStreams(prefix string, subjects []string) error {
+	cfg := c.config.Stream
+	if cfg.Mode == "" || cfg.Mode == config.StreamModeOff {
+		return nil
+	}
+
+	health := &StreamHealth{Mode: cfg.Mode}
+	defer func() {
+		c.streamMu.Lock()
+		c.streams = health
+		c.streamMu.Unlock()
+	}()
+
+	if cfg.Mode == config.StreamModeProvision {
+		if err := c.provisionStream(&cfg, prefix); err != nil {
+			health.Error = err.Error()
+			if cfg.OnMissing == "fail" {
+				return err
+			}
+			c.logger.Error("Failed to provision telemetry stream", zap.Error(err))
+		} else {
+			health.Provisioned = cfg.Name
+		}
+	}
+
+	health.Streams = make(map[string]string)
+	for _, subject := range subjects {
+		stream, err := c.js.StreamNameBySubject(subject)
+		if errors.Is(err, nats.ErrNoMatchingStream) {
+			health.Missing = append(health.Missing, subject)
+			continue
+		}
+		if err != nil {
+			// Lookup itself failed (e.g. no permission on $JS.API.STREAM.NAMES)
+			health.Error = fmt.Sprintf("stream lookup for %s failed: %v", subject, err)
+			c.logger.Warn("Stream lookup failed", zap.String("subject", subject), zap.Error(err))
+			continue
+		}
+		health.Streams[subject] = stream
+	}
+
+	if len(health.Missing) == 0 {
+		c.logger.Info("Telemetry subjects are captured by JetStream",
+			zap.Any("streams", health.Streams))
+		return nil
+	}
+
+	sort.Strings(health.Missing)
+	if cfg.OnMissing == "fail" {
+		return fmt.Errorf("no JetStream stream captures %v - create a stream for these subjects or set nats.stream.mode: provision", health.Missing)
+	}
+	c.logger.Error("No JetStream stream captures telemetry subjects - telemetry for them will be lost",
+		zap.Strings("subjects", health.Missing))
+	return nil
+}
+
+// StreamHealth returns the result of the last stream check, or nil if checks are off
+func (c *Client) StreamHealth() *StreamHealth {
+	c.streamMu.RLock()
+	defer c.streamMu.RUnlock()
+	return c.streams
+}
+
+// provisionStream creates the stream or updates it if its settings differ
+func (c *Client) provisionStream(cfg *config.StreamConfig, prefix string) error {
+	want := &nats.StreamConfig{
+		Name:        cfg.Name,
+		Description: "win-agent telemetry",
+		Subjects:    cfg.Subjects,
+		MaxAge:      cfg.MaxAge,
+		Replicas:    cfg.Replicas,
+	}
+	if len(want.Subjects) == 0 {
+		want.Subjects = defaultStreamSubjects(prefix)
+	}
+	switch cfg.Retention {
+	case "interest":
+		want.Retention = nats.InterestPolicy
+	case "workqueue":
+		want.Retention = nats.WorkQueuePolicy
+	default:
+		want.Retention = nats.LimitsPolicy
+	}
+	if cfg.Storage == "memory" {
+		want.Storage = nats.MemoryStorage
+	} else {
+		want.Storage = nats.FileStorage
+	}
+
+	info, err := c.js.StreamInfo(cfg.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if _, err := c.js.AddStream(want); err != nil {
+			return fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+		}
+		c.logger.Info("Created telemetry stream",
+			zap.String("stream", cfg.Name),
+			zap.Strings("subjects", want.Subjects))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up stream %s: %w", cfg.Name, err)
+	}
+
+	// Storage and retention cannot be changed on an existing stream, so a
+	// mismatch is reported and left for an operator
+	current, changed, drift := streamUpdate(info.Config, *want)
+	if len(drift) > 0 {
+		c.logger.Error("Telemetry stream settings differ from config and cannot be changed in place - recreate the stream to apply them",
+			zap.String("stream", cfg.Name),
+			zap.Strings("settings", drift))
+	}
+
+	// Every agent in the fleet runs this, so only update when something differs
+	if !changed {
+		c.logger.Debug("Telemetry stream up to date", zap.String("stream", cfg.Name))
+		return nil
+	}
+	if _, err := c.js.UpdateStream(&current); err != nil {
+		return fmt.Errorf("failed to update stream %s: %w", cfg.Name, err)
+	}
+	c.logger.Info("Updated telemetry stream",
+		zap.String("stream", cfg.Name),
+		zap.Strings("subjects", want.Subjects))
+	return nil
+}
+
+// streamUpdate applies the managed settings that JetStream can change in
+// place (subjects, max age, replicas) to the current stream config and
+// keeps everything else, including settings we don't manage (limits,
+// discard policy, etc.)
+// drift lists the immutable settings (storage, retention) that differ
+func streamUpdate(current, want nats.StreamConfig) (updated nats.StreamConfig, changed bool, drift []string) {
+	if current.Storage != want.Storage {
+		drift = append(drift, fmt.Sprintf("storage: %s (config: %s)", current.Storage, want.Storage))
+	}
+	if current.Retention != want.Retention {
+		drift = append(drift, fmt.Sprintf("retention: %s (config: %s)", current.Retention, want.Retention))
+	}
+
+	changed = !reflect.DeepEqual(current.Subjects, want.Subjects) ||
+		current.MaxAge != want.MaxAge ||
+		current.Replicas != want.Replicas
+	current.Subjects = want.Subjects
+	current.MaxAge = want.MaxAge
+	current.Replicas = want.Replicas
+	return current, changed, drift
+}
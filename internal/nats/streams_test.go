@@ -0,0 +1,180 @@
+package nats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"win-agent/internal/config"
+)
+
+// TestTelemetrySubjects tests that stream checks only cover the subjects
+// the configured tasks publish
+func TestTelemetrySubjects(t *testing.T) {
+	minimal := func() *config.Config {
+		cfg := &config.Config{SubjectPrefix: "agents", DeviceID: "dev1"}
+		cfg.Tasks.Heartbeat.Enabled = true
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+		want   []string
+	}{
+		{
+			name:   "heartbeat only",
+			modify: func(*config.Config) {},
+			want:   []string{"agents.dev1.heartbeat"},
+		},
+		{
+			name: "service check with exact names",
+			modify: func(c *config.Config) {
+				c.Tasks.ServiceCheck.Enabled = true
+				c.Tasks.ServiceCheck.Services = []string{"Spooler"}
+			},
+			want: []string{"agents.dev1.heartbeat", "agents.dev1.telemetry.service"},
+		},
+		{
+			name: "service check with a pattern",
+			modify: func(c *config.Config) {
+				c.Tasks.ServiceCheck.Enabled = true
+				c.Tasks.ServiceCheck.Services = []string{"SQL*"}
+			},
+			want: []string{"agents.dev1.heartbeat", "agents.dev1.telemetry.service", "agents.dev1.events.service"},
+		},
+		{
+			name: "service changes and recovery",
+			modify: func(c *config.Config) {
+				c.Tasks.ServiceCheck.Enabled = true
+				c.Tasks.ServiceCheck.Mode = config.PublishModeChanges
+				c.Tasks.ServiceCheck.Recovery = []config.RecoveryPolicy{{Service: "Spooler"}}
+			},
+			want: []string{
+				"agents.dev1.heartbeat", "agents.dev1.telemetry.service", "agents.dev1.events.service",
+				"agents.dev1.events.recovery", "agents.dev1.alerts",
+			},
+		},
+		{
+			name: "alerting enabled without rules",
+			modify: func(c *config.Config) {
+				c.Alerts.Enabled = true
+			},
+			want: []string{"agents.dev1.heartbeat"},
+		},
+		{
+			name: "alert rules",
+			modify: func(c *config.Config) {
+				c.Alerts.Enabled = true
+				c.Alerts.Rules = []config.AlertRule{{Name: "cpu"}}
+			},
+			want: []string{"agents.dev1.heartbeat", "agents.dev1.alerts"},
+		},
+		{
+			name: "process check",
+			modify: func(c *config.Config) {
+				c.Tasks.ProcessCheck.Enabled = true
+			},
+			want: []string{"agents.dev1.heartbeat", "agents.dev1.telemetry.process", "agents.dev1.events.process"},
+		},
+		{
+			name: "inventory changes",
+			modify: func(c *config.Config) {
+				c.Tasks.Inventory.Enabled = true
+				c.Tasks.Inventory.Mode = config.PublishModeChanges
+			},
+			want: []string{"agents.dev1.heartbeat", "agents.dev1.telemetry.inventory", "agents.dev1.telemetry.inventory.diff"},
+		},
+		{
+			name: "creds expiry",
+			modify: func(c *config.Config) {
+				c.NATS.Auth.Type = "creds"
+				c.NATS.CertExpiryWarning = time.Hour
+			},
+			want: []string{"agents.dev1.heartbeat", "agents.dev1.events.cert_expiry"},
+		},
+		{
+			name: "expiry warning without watched files",
+			modify: func(c *config.Config) {
+				c.NATS.Auth.Type = "token"
+				c.NATS.CertExpiryWarning = time.Hour
+			},
+			want: []string{"agents.dev1.heartbeat"},
+		},
+		{
+			name: "scrape target",
+			modify: func(c *config.Config) {
+				c.Tasks.Heartbeat.Enabled = false
+				c.Tasks.ScrapeTargets = []config.ScrapeTarget{{Name: "iis"}}
+			},
+			want: []string{"agents.dev1.telemetry.iis"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := minimal()
+			tt.modify(cfg)
+			if got := TelemetrySubjects(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TelemetrySubjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStreamUpdate tests which stream settings are updated in place and
+// which are reported as drift
+func TestStreamUpdate(t *testing.T) {
+	current := nats.StreamConfig{
+		Name:      "AGENTS",
+		Subjects:  []string{"agents.*.heartbeat"},
+		Retention: nats.LimitsPolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    time.Hour,
+		Replicas:  1,
+		MaxBytes:  1 << 30, // Not managed, must be kept
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(*nats.StreamConfig)
+		changed   bool
+		driftSize int
+	}{
+		{name: "up to date", modify: func(*nats.StreamConfig) {}},
+		{name: "subjects", modify: func(c *nats.StreamConfig) { c.Subjects = []string{"agents.>"} }, changed: true},
+		{name: "max age", modify: func(c *nats.StreamConfig) { c.MaxAge = 24 * time.Hour }, changed: true},
+		{name: "replicas", modify: func(c *nats.StreamConfig) { c.Replicas = 3 }, changed: true},
+		{name: "storage", modify: func(c *nats.StreamConfig) { c.Storage = nats.MemoryStorage }, driftSize: 1},
+		{name: "retention", modify: func(c *nats.StreamConfig) { c.Retention = nats.InterestPolicy }, driftSize: 1},
+		{
+			name: "drift and update",
+			modify: func(c *nats.StreamConfig) {
+				c.Storage, c.Retention, c.MaxAge = nats.MemoryStorage, nats.WorkQueuePolicy, time.Minute
+			},
+			changed:   true,
+			driftSize: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := current
+			want.MaxBytes = 0
+			tt.modify(&want)
+
+			updated, changed, drift := streamUpdate(current, want)
+			if changed != tt.changed || len(drift) != tt.driftSize {
+				t.Errorf("streamUpdate() changed = %v, drift = %v, want %v and %d", changed, drift, tt.changed, tt.driftSize)
+			}
+			// Immutable settings and unmanaged limits are never sent to UpdateStream
+			if updated.Storage != current.Storage || updated.Retention != current.Retention || updated.MaxBytes != current.MaxBytes {
+				t.Errorf("updated = %+v, want storage, retention and limits unchanged", updated)
+			}
+			if !reflect.DeepEqual(updated.Subjects, want.Subjects) || updated.MaxAge != want.MaxAge || updated.Replicas != want.Replicas {
+				t.Errorf("updated = %+v, want managed settings from %+v", updated, want)
+			}
+		})
+	}
+}
@@ -1,17 +1,20 @@
 package scheduler
 
 import (
-	"encoding/json"
 	"fmt"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
 	"go.uber.org/zap"
+	"win-agent/internal/alerts"
 	"win-agent/internal/config"
+	"win-agent/internal/messages"
 	natsclient "win-agent/internal/nats"
 	"win-agent/internal/tasks"
+	"win-agent/internal/watchdog"
 )
 
 // Scheduler manages periodic task execution
@@ -20,16 +23,44 @@ type Scheduler struct {
 	logger        *zap.Logger
 	nats          *natsclient.Client
 	executor      *tasks.Executor
+	alerts        *alerts.Evaluator        // nil when alerting is disabled
+	metrics       tasks.MetricsSource      // nil unless system_metrics is enabled
+	samples       *tasks.MetricsAggregator // nil unless fast sampling is enabled
+	scrapers      []*tasks.Scraper         // One per scrape_targets entry
+	watchdog      *watchdog.Watchdog       // nil without service_check recovery policies
+	processes     *tasks.ProcessMonitor    // nil unless process_check is enabled
+	scripts       sync.WaitGroup           // Running on_missing scripts
 	config        *config.Config
 	version       string
 	subjectPrefix string
+
+	// expiryWarned tracks the last expiry warning per credential file
+	// so a file nearing expiry is reported once a day, not every check
+	expiryWarned map[string]time.Time
+
+	// Change detection state for service_check and inventory in changes mode
+	changeMu            sync.Mutex
+	serviceStates       map[string]string // Last observed state per service
+	serviceKeyframe     time.Time         // Last full service list
+	serviceNames        []string          // Last expansion of service_check.services
+	monitoredServices   map[string]string // Services of the last check and their state (nil before the first)
+	inventory           *tasks.Inventory  // Last published inventory
+	inventoryKeyframe   time.Time         // Last full inventory
+	inventoryKeyframeTS string            // Its timestamp, referenced by diffs
 }
 
+// credentialExpiryCheckInterval is how often watched creds/certificates are checked for expiry
+const credentialExpiryCheckInterval = time.Hour
+
+// credentialExpiryRepeat is how often a still-expiring credential is re-announced
+const credentialExpiryRepeat = 24 * time.Hour
+
 // New creates a new scheduler with configured tasks
 func New(
 	logger *zap.Logger,
 	natsClient *natsclient.Client,
 	executor *tasks.Executor,
+	alertEvaluator *alerts.Evaluator,
 	cfg *config.Config,
 	version string,
 ) (*Scheduler, error) {
@@ -44,9 +75,37 @@ func New(
 		logger:        logger,
 		nats:          natsClient,
 		executor:      executor,
+		alerts:        alertEvaluator,
 		config:        cfg,
 		version:       version,
 		subjectPrefix: cfg.SubjectPrefix,
+		expiryWarned:  make(map[string]time.Time),
+		serviceStates: make(map[string]string),
+	}
+	if cfg.Tasks.SystemMetrics.Enabled {
+		source, err := executor.NewMetricsSource(&cfg.Tasks.SystemMetrics)
+		if err != nil {
+			return nil, err
+		}
+		scheduler.metrics = source
+	}
+	if cfg.Tasks.SystemMetrics.SampleInterval > 0 {
+		scheduler.samples = tasks.NewMetricsAggregator()
+	}
+	if cfg.Tasks.ServiceCheck.Enabled && len(cfg.Tasks.ServiceCheck.Recovery) > 0 {
+		scheduler.watchdog = watchdog.New(logger, executor, cfg, scheduler.publishRecovery, func(event alerts.Event) {
+			scheduler.publishAlerts(cfg.DeviceID, []alerts.Event{event})
+		})
+	}
+	if cfg.Tasks.ProcessCheck.Enabled {
+		scheduler.processes = tasks.NewProcessMonitor(cfg.Tasks.ProcessCheck.Processes)
+	}
+	for _, target := range cfg.Tasks.ScrapeTargets {
+		scraper, err := tasks.NewScraper(logger, target)
+		if err != nil {
+			return nil, err
+		}
+		scheduler.scrapers = append(scheduler.scrapers, scraper)
 	}
 
 	// Schedule tasks based on configuration
@@ -82,15 +141,18 @@ func (s *Scheduler) scheduleTasks() error {
 
 	// If metrics are enabled, establish baseline with retries
 	// This is critical for counter-based metrics (CPU, disk I/O)
-	if s.config.Tasks.SystemMetrics.Enabled {
-		s.logger.Info("Establishing metrics baseline")
+	// A baseline restored from the state file makes this unnecessary
+	if s.config.Tasks.SystemMetrics.Enabled && s.executor.HasMetricsBaseline() {
+		s.logger.Info("Using restored metrics baseline", zap.String("source", s.metrics.Name()))
+	} else if s.config.Tasks.SystemMetrics.Enabled {
+		s.logger.Info("Establishing metrics baseline", zap.String("source", s.metrics.Name()))
 
 		const maxRetries = 3
 		const retryDelay = 2 * time.Second
 
 		var baselineErr error
 		for attempt := 1; attempt <= maxRetries; attempt++ {
-			_, err := s.executor.ScrapeMetrics(s.config.Tasks.SystemMetrics.ExporterURL)
+			_, err := s.metrics.Collect()
 			if err == nil {
 				s.logger.Info("Metrics baseline established successfully")
 				baselineErr = nil
@@ -151,6 +213,21 @@ func (s *Scheduler) scheduleTasks() error {
 			zap.Duration("interval", s.config.Tasks.SystemMetrics.Interval))
 	}
 
+	// Schedule fast local sampling; publishMetrics then sends the aggregate
+	if s.config.Tasks.SystemMetrics.Enabled && s.samples != nil {
+		_, err := s.scheduler.NewJob(
+			gocron.DurationJob(s.config.Tasks.SystemMetrics.SampleInterval),
+			gocron.NewTask(s.wrapTaskWithRecovery("metrics_sample", func() {
+				s.sampleMetrics(deviceID)
+			})),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule metrics sampling: %w", err)
+		}
+		s.logger.Info("Scheduled metrics sampling",
+			zap.Duration("sample_interval", s.config.Tasks.SystemMetrics.SampleInterval))
+	}
+
 	// Schedule service check task WITH PANIC RECOVERY
 	if s.config.Tasks.ServiceCheck.Enabled {
 		_, err := s.scheduler.NewJob(
@@ -166,6 +243,22 @@ func (s *Scheduler) scheduleTasks() error {
 			zap.Duration("interval", s.config.Tasks.ServiceCheck.Interval))
 	}
 
+	// Schedule process check task WITH PANIC RECOVERY
+	if s.config.Tasks.ProcessCheck.Enabled {
+		_, err := s.scheduler.NewJob(
+			gocron.DurationJob(s.config.Tasks.ProcessCheck.Interval),
+			gocron.NewTask(s.wrapTaskWithRecovery("process_check", func() {
+				s.publishProcessStatus(deviceID)
+			})),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule process check: %w", err)
+		}
+		s.logger.Info("Scheduled process check task",
+			zap.Duration("interval", s.config.Tasks.ProcessCheck.Interval),
+			zap.Int("processes", len(s.config.Tasks.ProcessCheck.Processes)))
+	}
+
 	// Schedule inventory task WITH PANIC RECOVERY (but run it once immediately first)
 	if s.config.Tasks.Inventory.Enabled {
 		// Run immediately on startup (wrapped with panic recovery)
@@ -187,19 +280,62 @@ func (s *Scheduler) scheduleTasks() error {
 			zap.Duration("interval", s.config.Tasks.Inventory.Interval))
 	}
 
+	// Schedule each additional scrape target on its own interval
+	for i, scraper := range s.scrapers {
+		interval := s.config.Tasks.ScrapeTargets[i].Interval
+		_, err := s.scheduler.NewJob(
+			gocron.DurationJob(interval),
+			gocron.NewTask(s.wrapTaskWithRecovery("scrape_"+scraper.Name(), func() {
+				s.publishScrapeTarget(deviceID, scraper)
+			})),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule scrape target %s: %w", scraper.Name(), err)
+		}
+		s.logger.Info("Scheduled scrape target",
+			zap.String("target", scraper.Name()),
+			zap.Duration("interval", interval))
+	}
+
+	// Schedule credential expiry check when there are creds/certificates to watch
+	if s.config.NATS.CertExpiryWarning > 0 && len(s.nats.CredentialStatus()) > 0 {
+		_, err := s.scheduler.NewJob(
+			gocron.DurationJob(credentialExpiryCheckInterval),
+			gocron.NewTask(s.wrapTaskWithRecovery("cert_expiry", func() {
+				s.checkCredentialExpiry(deviceID)
+			})),
+			gocron.WithStartAt(gocron.WithStartImmediately()),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule credential expiry check: %w", err)
+		}
+		s.logger.Info("Scheduled credential expiry check",
+			zap.Duration("warning_window", s.config.NATS.CertExpiryWarning))
+	}
+
 	return nil
 }
 
+// Watchdog returns the service recovery watchdog, or nil without recovery policies
+func (s *Scheduler) Watchdog() *watchdog.Watchdog {
+	return s.watchdog
+}
+
 // Start begins executing scheduled tasks
 func (s *Scheduler) Start() {
 	s.scheduler.Start()
 	s.logger.Info("Scheduler started")
 }
 
-// Shutdown gracefully stops the scheduler
+// Shutdown gracefully stops the scheduler, then waits for running service
+// recoveries and on_missing scripts so their events are published before
+// the connection is drained
 func (s *Scheduler) Shutdown() error {
 	s.logger.Info("Shutting down scheduler")
-	return s.scheduler.Shutdown()
+	err := s.scheduler.Shutdown()
+	s.watchdog.Wait()
+	s.scripts.Wait()
+	return err
 }
 
 // publishHeartbeat publishes a heartbeat message
@@ -208,15 +344,10 @@ func (s *Scheduler) publishHeartbeat(deviceID string) {
 	subject := fmt.Sprintf("%s.%s.heartbeat", s.subjectPrefix, deviceID)
 
 	heartbeat := s.executor.CreateHeartbeat(s.version)
-	data, err := json.Marshal(heartbeat)
-	if err != nil {
-		s.logger.Error("Failed to marshal heartbeat", zap.Error(err))
-		return
-	}
 
 	// PublishAsync is fire-and-forget with built-in retries
 	// Errors are logged automatically in the async callback
-	if err := s.nats.PublishTelemetry(subject, data); err != nil {
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaHeartbeat, heartbeat); err != nil {
 		// This only fails if we can't queue (extremely rare)
 		s.logger.Error("Failed to queue heartbeat publish", zap.Error(err))
 		return
@@ -232,7 +363,14 @@ func (s *Scheduler) publishHeartbeat(deviceID string) {
 func (s *Scheduler) publishMetrics(deviceID string) {
 	subject := fmt.Sprintf("%s.%s.telemetry.system", s.subjectPrefix, deviceID)
 
-	metrics, err := s.executor.ScrapeMetrics(s.config.Tasks.SystemMetrics.ExporterURL)
+	// With fast sampling the samples are already scraped (and alerts evaluated)
+	var metrics *tasks.SystemMetrics
+	var err error
+	if s.samples != nil {
+		metrics, err = s.samples.Flush()
+	} else {
+		metrics, err = s.metrics.Collect()
+	}
 	if err != nil {
 		s.logger.Error("Failed to scrape metrics", zap.Error(err))
 
@@ -241,23 +379,21 @@ func (s *Scheduler) publishMetrics(deviceID string) {
 
 		// Publish error message so control plane knows scraping failed
 		errorMsg := tasks.CreateMetricsError(err)
-		data, _ := json.Marshal(errorMsg)
-		
+
 		// Even errors are published async - fire and forget
-		if err := s.nats.PublishTelemetry(subject, data); err != nil {
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaSystemMetricsError, errorMsg); err != nil {
 			s.logger.Error("Failed to queue metrics error publish", zap.Error(err))
 		}
 		return
 	}
 
-	data, err := json.Marshal(metrics)
-	if err != nil {
-		s.logger.Error("Failed to marshal metrics", zap.Error(err))
-		return
+	// Alert rules are evaluated locally, even if the publish below fails
+	if s.samples == nil {
+		s.publishAlerts(deviceID, s.alerts.ObserveMetrics(metrics, time.Now()))
 	}
 
 	// Fire and forget with async retries
-	if err := s.nats.PublishTelemetry(subject, data); err != nil {
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaSystemMetrics, metrics); err != nil {
 		s.logger.Error("Failed to queue metrics publish", zap.Error(err))
 		return
 	}
@@ -280,53 +416,265 @@ func (s *Scheduler) publishMetrics(deviceID string) {
 		zap.String("disks", strings.Join(diskSummary, ", ")))
 }
 
+// publishScrapeTarget scrapes one additional exporter and publishes it
+// to telemetry.{target}; failures are published there as errors
+func (s *Scheduler) publishScrapeTarget(deviceID string, scraper *tasks.Scraper) {
+	subject := fmt.Sprintf("%s.%s.telemetry.%s", s.subjectPrefix, deviceID, scraper.Name())
+
+	metrics, err := scraper.Scrape()
+	if err != nil {
+		s.logger.Error("Failed to scrape target",
+			zap.String("target", scraper.Name()),
+			zap.Error(err))
+		s.executor.RecordScrapeFailure(scraper.Name(), err)
+
+		errorMsg := tasks.CreateMetricsError(err)
+		errorMsg.Target = scraper.Name()
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaScrapeTargetError, errorMsg); err != nil {
+			s.logger.Error("Failed to queue scrape error publish", zap.Error(err))
+		}
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaScrapeTarget, metrics); err != nil {
+		s.logger.Error("Failed to queue scrape target publish",
+			zap.String("target", scraper.Name()),
+			zap.Error(err))
+		return
+	}
+	s.executor.RecordScrapeSuccess(scraper.Name())
+
+	s.logger.Debug("Queued scrape target publish",
+		zap.String("subject", subject),
+		zap.Int("metrics", len(metrics.Metrics)),
+		zap.Int64("duration_ms", metrics.ScrapeDurationMs))
+}
+
+// sampleMetrics scrapes one fast sample for the next aggregate and
+// evaluates alert rules against it
+func (s *Scheduler) sampleMetrics(deviceID string) {
+	sample, err := s.metrics.Collect()
+	if err != nil {
+		s.logger.Debug("Failed to sample metrics", zap.Error(err))
+		s.samples.AddError(err)
+		return
+	}
+	s.samples.Add(sample)
+	s.publishAlerts(deviceID, s.alerts.ObserveMetrics(sample, time.Now()))
+}
+
 // publishServiceStatus checks and publishes service status
 func (s *Scheduler) publishServiceStatus(deviceID string) {
 	subject := fmt.Sprintf("%s.%s.telemetry.service", s.subjectPrefix, deviceID)
 
-	statuses, err := s.executor.GetServiceStatuses(s.config.Tasks.ServiceCheck.Services)
+	services, err := s.expandServices()
+	var statuses []tasks.ServiceStatus
+	if err == nil {
+		statuses, err = s.executor.GetServiceStatuses(services)
+	}
 	if err != nil {
 		s.logger.Error("Failed to get service statuses", zap.Error(err))
 
 		// Publish error message
-		errorMsg := map[string]interface{}{
-			"status":    "error",
-			"error":     err.Error(),
-			"timestamp": s.executor.CreateHeartbeat(s.version).Timestamp,
-		}
-		data, _ := json.Marshal(errorMsg)
-		
-		if err := s.nats.PublishTelemetry(subject, data); err != nil {
+		errorMsg := tasks.CreateServiceError(err)
+
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaServiceStatus, errorMsg); err != nil {
 			s.logger.Error("Failed to queue service status error publish", zap.Error(err))
 		}
 		return
 	}
 
-	// Create message with all services
-	message := map[string]interface{}{
-		"services":  statuses,
-		"timestamp": s.executor.CreateHeartbeat(s.version).Timestamp,
-	}
+	s.publishServiceMembership(deviceID, statuses)
+	s.publishAlerts(deviceID, s.alerts.ObserveServices(statuses, time.Now()))
+	s.watchdog.Observe(statuses, time.Now())
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		s.logger.Error("Failed to marshal service statuses", zap.Error(err))
-		return
+	// In changes mode transitions go out as events and the full list only on keyframes
+	if s.config.Tasks.ServiceCheck.Mode == config.PublishModeChanges {
+		s.publishServiceTransitions(deviceID, statuses)
+		if !s.serviceKeyframeDue() {
+			s.executor.RecordServiceCheck()
+			return
+		}
 	}
 
-	if err := s.nats.PublishTelemetry(subject, data); err != nil {
+	// Create message with all services
+	report := tasks.CreateServiceReport(statuses)
+
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaServiceStatus, report); err != nil {
 		s.logger.Error("Failed to queue service status publish", zap.Error(err))
 		return
 	}
 
 	// Record successful execution
 	s.executor.RecordServiceCheck()
+	s.markServiceKeyframe()
 
 	s.logger.Debug("Queued service status publish",
 		zap.String("subject", subject),
 		zap.Int("count", len(statuses)))
 }
 
+// publishProcessStatus checks the process_check processes, publishes their
+// status and transitions, and starts any on_missing scripts that are due
+func (s *Scheduler) publishProcessStatus(deviceID string) {
+	subject := fmt.Sprintf("%s.%s.telemetry.process", s.subjectPrefix, deviceID)
+
+	report, events, due, err := s.processes.Check(time.Now())
+	if err != nil {
+		s.logger.Error("Failed to check processes", zap.Error(err))
+
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaProcessStatus, tasks.CreateProcessError(err)); err != nil {
+			s.logger.Error("Failed to queue process status error publish", zap.Error(err))
+		}
+		return
+	}
+
+	for _, event := range events {
+		s.logger.Info("Process changed",
+			zap.String("event", event.Event),
+			zap.String("process", event.Name),
+			zap.Int("instances", event.Instances))
+		s.publishProcessEvent(deviceID, event)
+	}
+
+	// Scripts run in the background so a slow one does not hold up the next check
+	for _, watch := range due {
+		s.scripts.Add(1)
+		go s.wrapTaskWithRecovery("process_script", func() {
+			defer s.scripts.Done()
+			s.runProcessScript(deviceID, watch)
+		})()
+	}
+
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaProcessStatus, report); err != nil {
+		s.logger.Error("Failed to queue process status publish", zap.Error(err))
+		return
+	}
+	s.executor.RecordProcessCheck()
+
+	s.logger.Debug("Queued process status publish",
+		zap.String("subject", subject),
+		zap.Int("count", len(report.Processes)))
+}
+
+// runProcessScript runs the on_missing script of a missing process and
+// publishes the outcome
+func (s *Scheduler) runProcessScript(deviceID string, watch config.ProcessWatch) {
+	s.logger.Warn("Process missing, running on_missing script",
+		zap.String("process", watch.Label()),
+		zap.String("script", watch.OnMissing))
+
+	_, exitCode, err := s.executor.ExecuteCommand(watch.OnMissing, nil, s.config.Commands.ScriptsDirectory, s.config.Commands.Timeout)
+	result := &tasks.ProcessScriptResult{Script: watch.OnMissing, ExitCode: exitCode}
+	if err != nil {
+		result.Error = err.Error()
+		s.logger.Warn("on_missing script failed", zap.String("script", watch.OnMissing), zap.Error(err))
+	}
+
+	s.publishProcessEvent(deviceID, tasks.ProcessEvent{
+		Event:     tasks.ProcessEventScript,
+		Name:      watch.Label(),
+		Script:    result,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// publishProcessEvent publishes a process_check event
+func (s *Scheduler) publishProcessEvent(deviceID string, event tasks.ProcessEvent) {
+	subject := fmt.Sprintf("%s.%s.events.process", s.subjectPrefix, deviceID)
+
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaProcessEvent, event); err != nil {
+		s.logger.Error("Failed to queue process event", zap.Error(err))
+	}
+}
+
+// publishServiceTransitions publishes an event for each service whose state
+// changed since the previous check
+func (s *Scheduler) publishServiceTransitions(deviceID string, statuses []tasks.ServiceStatus) {
+	subject := fmt.Sprintf("%s.%s.events.service", s.subjectPrefix, deviceID)
+
+	s.changeMu.Lock()
+	transitions := tasks.ServiceTransitions(s.serviceStates, statuses)
+	// Rebuilt rather than updated, so a service that disappears and comes back
+	// is reported as appeared, not as a stale state change
+	s.serviceStates = make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		s.serviceStates[status.Name] = status.Status
+	}
+	s.changeMu.Unlock()
+
+	for _, transition := range transitions {
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaServiceTransition, transition); err != nil {
+			s.logger.Error("Failed to queue service transition", zap.Error(err))
+			continue
+		}
+		s.logger.Info("Service state changed",
+			zap.String("service", transition.Name),
+			zap.String("from", transition.From),
+			zap.String("to", transition.To))
+	}
+}
+
+// expandServices resolves service_check patterns to the installed services
+// If services cannot be listed, the previous expansion is used
+func (s *Scheduler) expandServices() ([]string, error) {
+	names, err := s.executor.ExpandServices(s.config.Tasks.ServiceCheck.Services)
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	if err != nil {
+		if s.serviceNames == nil {
+			return nil, err
+		}
+		s.logger.Warn("Failed to expand service patterns, using the previous list", zap.Error(err))
+		return s.serviceNames, nil
+	}
+	s.serviceNames = names
+	return names, nil
+}
+
+// publishServiceMembership publishes an event for each service that started
+// or stopped matching a service_check pattern since the previous check
+func (s *Scheduler) publishServiceMembership(deviceID string, statuses []tasks.ServiceStatus) {
+	subject := fmt.Sprintf("%s.%s.events.service", s.subjectPrefix, deviceID)
+
+	s.changeMu.Lock()
+	var events []tasks.ServiceTransition
+	if s.monitoredServices != nil {
+		events = tasks.ServiceMembershipChanges(s.monitoredServices, statuses)
+	}
+	s.monitoredServices = make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		s.monitoredServices[status.Name] = status.Status
+	}
+	s.changeMu.Unlock()
+
+	for _, event := range events {
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaServiceTransition, event); err != nil {
+			s.logger.Error("Failed to queue service membership event", zap.Error(err))
+			continue
+		}
+		s.logger.Info("Monitored service list changed",
+			zap.String("event", event.Event),
+			zap.String("service", event.Name))
+	}
+}
+
+// serviceKeyframeDue reports whether the full service list should be published
+func (s *Scheduler) serviceKeyframeDue() bool {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	return s.serviceKeyframe.IsZero() ||
+		time.Since(s.serviceKeyframe) >= s.config.Tasks.ServiceCheck.KeyframeInterval
+}
+
+// markServiceKeyframe records that the full service list was published
+func (s *Scheduler) markServiceKeyframe() {
+	s.changeMu.Lock()
+	s.serviceKeyframe = time.Now()
+	s.changeMu.Unlock()
+}
+
 // publishInventory collects and publishes system inventory
 func (s *Scheduler) publishInventory(deviceID string) {
 	subject := fmt.Sprintf("%s.%s.telemetry.inventory", s.subjectPrefix, deviceID)
@@ -337,13 +685,14 @@ func (s *Scheduler) publishInventory(deviceID string) {
 		return
 	}
 
-	data, err := json.Marshal(inventory)
-	if err != nil {
-		s.logger.Error("Failed to marshal inventory", zap.Error(err))
-		return
+	// In changes mode only a diff is sent between keyframes
+	if s.config.Tasks.Inventory.Mode == config.PublishModeChanges {
+		if published := s.publishInventoryDiff(deviceID, inventory); published {
+			return
+		}
 	}
 
-	if err := s.nats.PublishTelemetry(subject, data); err != nil {
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaInventory, inventory); err != nil {
 		s.logger.Error("Failed to queue inventory publish", zap.Error(err))
 		return
 	}
@@ -351,7 +700,126 @@ func (s *Scheduler) publishInventory(deviceID string) {
 	// Record successful execution
 	s.executor.RecordInventory()
 
+	s.changeMu.Lock()
+	s.inventory = inventory
+	s.inventoryKeyframe = time.Now()
+	s.inventoryKeyframeTS = inventory.Timestamp
+	s.changeMu.Unlock()
+
 	s.logger.Info("Queued inventory publish",
 		zap.String("subject", subject),
 		zap.String("os", inventory.OS.Name))
 }
+
+// publishRecovery publishes a service watchdog event
+func (s *Scheduler) publishRecovery(event watchdog.Event) {
+	subject := fmt.Sprintf("%s.%s.events.recovery", s.subjectPrefix, s.config.DeviceID)
+
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaServiceRecovery, event); err != nil {
+		s.logger.Error("Failed to queue recovery event", zap.Error(err))
+	}
+}
+
+// publishAlerts publishes alert firing/resolved events
+func (s *Scheduler) publishAlerts(deviceID string, events []alerts.Event) {
+	subject := fmt.Sprintf("%s.%s.alerts", s.subjectPrefix, deviceID)
+
+	for _, event := range events {
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaAlert, event); err != nil {
+			s.logger.Error("Failed to queue alert event", zap.Error(err))
+			continue
+		}
+		s.logger.Warn("Alert "+strings.TrimPrefix(event.Event, "alert_"),
+			zap.String("rule", event.Rule),
+			zap.String("target", event.Target),
+			zap.String("condition", event.Condition),
+			zap.String("severity", event.Severity))
+	}
+}
+
+// publishInventoryDiff publishes the changes since the last published inventory
+// Returns false when a full inventory (keyframe) should be sent instead
+func (s *Scheduler) publishInventoryDiff(deviceID string, inventory *tasks.Inventory) bool {
+	subject := fmt.Sprintf("%s.%s.telemetry.inventory.diff", s.subjectPrefix, deviceID)
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	if s.inventory == nil || time.Since(s.inventoryKeyframe) >= s.config.Tasks.Inventory.KeyframeInterval {
+		return false
+	}
+
+	changes, err := tasks.DiffInventory(s.inventory, inventory)
+	if err != nil {
+		s.logger.Warn("Failed to diff inventory, sending full inventory", zap.Error(err))
+		return false
+	}
+
+	// Nothing changed - the last published inventory is still current
+	if len(changes) == 0 {
+		s.executor.RecordInventory()
+		s.logger.Debug("Inventory unchanged")
+		return true
+	}
+
+	diff := &tasks.InventoryDiff{
+		Keyframe:  s.inventoryKeyframeTS,
+		Changes:   changes,
+		Timestamp: inventory.Timestamp,
+	}
+	if err := s.nats.PublishTelemetry(subject, messages.SchemaInventoryDiff, diff); err != nil {
+		// Fall back to a full inventory so consumers are not left behind
+		s.logger.Error("Failed to queue inventory diff publish", zap.Error(err))
+		return false
+	}
+
+	s.executor.RecordInventory()
+	s.inventory = inventory
+
+	s.logger.Info("Queued inventory diff publish",
+		zap.String("subject", subject),
+		zap.Int("changes", len(changes)))
+	return true
+}
+
+// checkCredentialExpiry publishes a warning event for creds or certificates
+// that expire within the configured warning window
+func (s *Scheduler) checkCredentialExpiry(deviceID string) {
+	subject := fmt.Sprintf("%s.%s.events.cert_expiry", s.subjectPrefix, deviceID)
+	now := time.Now()
+
+	for _, cred := range s.nats.CredentialStatus() {
+		if !cred.ExpiresWithin(s.config.NATS.CertExpiryWarning) {
+			// Renewed (or never close) - allow a fresh warning next time
+			delete(s.expiryWarned, cred.File)
+			continue
+		}
+		if last, ok := s.expiryWarned[cred.File]; ok && now.Sub(last) < credentialExpiryRepeat {
+			continue
+		}
+
+		event := natsclient.CredentialExpiryEvent{
+			Event:         "cert_expiring",
+			Kind:          cred.Kind,
+			File:          cred.File,
+			Subject:       cred.Subject,
+			NotAfter:      cred.NotAfter,
+			DaysRemaining: *cred.DaysRemaining,
+			Timestamp:     now.UTC().Format(time.RFC3339),
+		}
+		if cred.Expired() {
+			event.Event = "cert_expired"
+		}
+
+		if err := s.nats.PublishTelemetry(subject, messages.SchemaCertExpiry, event); err != nil {
+			s.logger.Error("Failed to queue credential expiry event", zap.Error(err))
+			continue
+		}
+		s.expiryWarned[cred.File] = now
+
+		s.logger.Warn("Credentials nearing expiry",
+			zap.String("kind", cred.Kind),
+			zap.String("file", cred.File),
+			zap.String("not_after", cred.NotAfter))
+	}
+}
@@ -0,0 +1,232 @@
+package tasks
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"win-agent/internal/utils"
+)
+
+// MetricStats summarizes one metric over a publish interval
+type MetricStats struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+	P95 float64 `json:"p95"`
+}
+
+// DiskStats summarizes one drive over a publish interval
+type DiskStats struct {
+	Drive            string      `json:"drive"`
+	FreePercent      MetricStats `json:"free_percent"`
+	FreeGB           MetricStats `json:"free_gb"`
+	ReadBytesPerSec  MetricStats `json:"read_bytes_per_sec"`
+	WriteBytesPerSec MetricStats `json:"write_bytes_per_sec"`
+}
+
+// CPUCoreStats summarizes one core's usage over a publish interval
+type CPUCoreStats struct {
+	Core         string      `json:"core"`
+	UsagePercent MetricStats `json:"usage_percent"`
+}
+
+// NetworkStats summarizes one NIC's throughput over a publish interval
+type NetworkStats struct {
+	NIC                 string      `json:"nic"`
+	BytesReceivedPerSec MetricStats `json:"bytes_received_per_sec"`
+	BytesSentPerSec     MetricStats `json:"bytes_sent_per_sec"`
+}
+
+// CustomStats summarizes one custom metric series over a publish interval
+type CustomStats struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	MetricStats
+}
+
+// MetricsWindow is the aggregate of the samples taken in one publish interval
+type MetricsWindow struct {
+	Start           string         `json:"start"`
+	End             string         `json:"end"`
+	Samples         int            `json:"samples"`
+	FailedSamples   int            `json:"failed_samples,omitempty"`
+	CPUUsagePercent MetricStats    `json:"cpu_usage_percent"`
+	MemoryFreeGB    MetricStats    `json:"memory_free_gb"`
+	Disks           []DiskStats    `json:"disks"`
+	CPUCores        []CPUCoreStats `json:"cpu_cores,omitempty"`
+	Network         []NetworkStats `json:"network,omitempty"`
+	Custom          []CustomStats  `json:"custom,omitempty"`
+}
+
+// MetricsAggregator collects fast local samples between publishes
+type MetricsAggregator struct {
+	mu      sync.Mutex
+	samples []*SystemMetrics
+	failed  int
+	lastErr error
+	start   time.Time
+}
+
+// NewMetricsAggregator creates an empty aggregator
+func NewMetricsAggregator() *MetricsAggregator {
+	return &MetricsAggregator{start: time.Now()}
+}
+
+// Add records a successful sample
+func (a *MetricsAggregator) Add(sample *SystemMetrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.samples = append(a.samples, sample)
+}
+
+// AddError records a failed sample
+func (a *MetricsAggregator) AddError(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failed++
+	a.lastErr = err
+}
+
+// Flush returns the latest sample with the window aggregate attached and
+// starts a new window. Fails with the last sample error if every sample failed
+func (a *MetricsAggregator) Flush() (*SystemMetrics, error) {
+	a.mu.Lock()
+	samples, failed, lastErr, start := a.samples, a.failed, a.lastErr, a.start
+	a.samples, a.failed, a.lastErr, a.start = nil, 0, nil, time.Now()
+	a.mu.Unlock()
+
+	if len(samples) == 0 {
+		if lastErr != nil {
+			return nil, fmt.Errorf("all %d samples failed, last error: %w", failed, lastErr)
+		}
+		return nil, fmt.Errorf("no samples collected")
+	}
+
+	// Top-level fields keep the latest sample so existing consumers see no change
+	latest := *samples[len(samples)-1]
+	window := AggregateSamples(samples)
+	window.Start = start.UTC().Format(time.RFC3339)
+	window.End = time.Now().UTC().Format(time.RFC3339)
+	window.FailedSamples = failed
+	latest.Window = window
+	return &latest, nil
+}
+
+// AggregateSamples computes min/max/avg/p95 per metric across samples
+// Drives, cores and NICs are aggregated over the samples they appear in
+func AggregateSamples(samples []*SystemMetrics) *MetricsWindow {
+	var cpu, memory []float64
+	type diskSeries struct{ freePercent, freeGB, read, write []float64 }
+	disks := make(map[string]*diskSeries)
+	cores := make(map[string][]float64)
+	var coreOrder []string
+	type nicSeries struct{ received, sent []float64 }
+	nics := make(map[string]*nicSeries)
+	var nicOrder []string
+	custom := make(map[string][]float64)
+	var customOrder []CustomMetric
+
+	for _, sample := range samples {
+		cpu = append(cpu, sample.CPUUsagePercent)
+		memory = append(memory, sample.MemoryFreeGB)
+		for _, disk := range sample.Disks {
+			series, ok := disks[disk.Drive]
+			if !ok {
+				series = &diskSeries{}
+				disks[disk.Drive] = series
+			}
+			series.freePercent = append(series.freePercent, disk.FreePercent)
+			series.freeGB = append(series.freeGB, disk.FreeGB)
+			series.read = append(series.read, disk.ReadBytesPerSec)
+			series.write = append(series.write, disk.WriteBytesPerSec)
+		}
+		for _, core := range sample.CPUCores {
+			if _, ok := cores[core.Core]; !ok {
+				coreOrder = append(coreOrder, core.Core)
+			}
+			cores[core.Core] = append(cores[core.Core], core.UsagePercent)
+		}
+		for _, nic := range sample.Network {
+			series, ok := nics[nic.NIC]
+			if !ok {
+				series = &nicSeries{}
+				nics[nic.NIC] = series
+				nicOrder = append(nicOrder, nic.NIC)
+			}
+			series.received = append(series.received, nic.BytesReceivedPerSec)
+			series.sent = append(series.sent, nic.BytesSentPerSec)
+		}
+		for _, metric := range sample.Custom {
+			key := metric.Name + "|" + seriesKeyFromMap(metric.Labels)
+			if _, ok := custom[key]; !ok {
+				customOrder = append(customOrder, metric)
+			}
+			custom[key] = append(custom[key], metric.Value)
+		}
+	}
+
+	window := &MetricsWindow{
+		Samples:         len(samples),
+		CPUUsagePercent: summarize(cpu),
+		MemoryFreeGB:    summarize(memory),
+		Disks:           make([]DiskStats, 0, len(disks)),
+	}
+	for drive, series := range disks {
+		window.Disks = append(window.Disks, DiskStats{
+			Drive:            drive,
+			FreePercent:      summarize(series.freePercent),
+			FreeGB:           summarize(series.freeGB),
+			ReadBytesPerSec:  summarize(series.read),
+			WriteBytesPerSec: summarize(series.write),
+		})
+	}
+	sort.Slice(window.Disks, func(i, j int) bool { return window.Disks[i].Drive < window.Disks[j].Drive })
+
+	// Cores, NICs and custom series keep the order they first appeared in
+	for _, core := range coreOrder {
+		window.CPUCores = append(window.CPUCores, CPUCoreStats{
+			Core:         core,
+			UsagePercent: summarize(cores[core]),
+		})
+	}
+	for _, nic := range nicOrder {
+		window.Network = append(window.Network, NetworkStats{
+			NIC:                 nic,
+			BytesReceivedPerSec: summarize(nics[nic].received),
+			BytesSentPerSec:     summarize(nics[nic].sent),
+		})
+	}
+	for _, metric := range customOrder {
+		window.Custom = append(window.Custom, CustomStats{
+			Name:        metric.Name,
+			Labels:      metric.Labels,
+			MetricStats: summarize(custom[metric.Name+"|"+seriesKeyFromMap(metric.Labels)]),
+		})
+	}
+	return window
+}
+
+// summarize computes stats for one series; p95 uses the nearest-rank method
+func summarize(values []float64) MetricStats {
+	if len(values) == 0 {
+		return MetricStats{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+
+	return MetricStats{
+		Min: sorted[0],
+		Max: sorted[len(sorted)-1],
+		Avg: utils.Round(sum / float64(len(sorted))),
+		P95: sorted[rank],
+	}
+}
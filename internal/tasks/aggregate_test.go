@@ -0,0 +1,124 @@
+package tasks
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestSummarize tests min/max/avg/p95 for a series
+func TestSummarize(t *testing.T) {
+	values := make([]float64, 0, 20)
+	for i := 20; i >= 1; i-- {
+		values = append(values, float64(i))
+	}
+
+	got := summarize(values)
+	want := MetricStats{Min: 1, Max: 20, Avg: 10.5, P95: 19}
+	if got != want {
+		t.Errorf("summarize() = %+v, want %+v", got, want)
+	}
+
+	if got := summarize([]float64{42}); got != (MetricStats{Min: 42, Max: 42, Avg: 42, P95: 42}) {
+		t.Errorf("summarize(single) = %+v", got)
+	}
+	if got := summarize(nil); got != (MetricStats{}) {
+		t.Errorf("summarize(nil) = %+v, want zero", got)
+	}
+}
+
+// TestMetricsAggregatorFlush tests windows, latest sample and drive handling
+func TestMetricsAggregatorFlush(t *testing.T) {
+	a := NewMetricsAggregator()
+	a.Add(&SystemMetrics{CPUUsagePercent: 10, MemoryFreeGB: 4, Disks: []DiskMetrics{{Drive: "C:", FreePercent: 50}}})
+	a.AddError(errors.New("scrape timeout"))
+	a.Add(&SystemMetrics{CPUUsagePercent: 90, MemoryFreeGB: 2, Disks: []DiskMetrics{{Drive: "C:", FreePercent: 40}, {Drive: "D:", FreePercent: 80}}})
+
+	metrics, err := a.Flush()
+	if err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if metrics.CPUUsagePercent != 90 {
+		t.Errorf("CPUUsagePercent = %v, want latest sample 90", metrics.CPUUsagePercent)
+	}
+	w := metrics.Window
+	if w == nil || w.Samples != 2 || w.FailedSamples != 1 {
+		t.Fatalf("Window = %+v, want 2 samples and 1 failure", w)
+	}
+	if w.CPUUsagePercent.Min != 10 || w.CPUUsagePercent.Max != 90 || w.CPUUsagePercent.Avg != 50 {
+		t.Errorf("cpu stats = %+v", w.CPUUsagePercent)
+	}
+	if len(w.Disks) != 2 || w.Disks[0].Drive != "C:" || w.Disks[0].FreePercent.Min != 40 {
+		t.Errorf("disk stats = %+v", w.Disks)
+	}
+
+	// The next window starts empty; only failures means an error
+	a.AddError(errors.New("connection refused"))
+	if _, err := a.Flush(); err == nil {
+		t.Error("Flush() with only failed samples should return an error")
+	}
+	if _, err := a.Flush(); err == nil {
+		t.Error("Flush() with no samples should return an error")
+	}
+}
+
+// TestAggregateSamplesCustom tests custom series aggregation by name and labels
+func TestAggregateSamplesCustom(t *testing.T) {
+	orders := map[string]string{"queue": "orders"}
+	window := AggregateSamples([]*SystemMetrics{
+		{Custom: []CustomMetric{{Name: "depth", Labels: orders, Value: 2}, {Name: "rps", Value: 10}}},
+		{Custom: []CustomMetric{{Name: "depth", Labels: orders, Value: 4}}},
+	})
+
+	if len(window.Custom) != 2 {
+		t.Fatalf("len(Custom) = %d, want 2", len(window.Custom))
+	}
+	if got := window.Custom[0]; got.Name != "depth" || got.Labels["queue"] != "orders" || got.MetricStats != (MetricStats{Min: 2, Max: 4, Avg: 3, P95: 4}) {
+		t.Errorf("Custom[0] = %+v", got)
+	}
+	if got := window.Custom[1]; got.Name != "rps" || got.MetricStats != (MetricStats{Min: 10, Max: 10, Avg: 10, P95: 10}) {
+		t.Errorf("Custom[1] = %+v", got)
+	}
+}
+
+// TestAggregateSamplesCoresAndNetwork tests per-core CPU and NIC throughput
+// are aggregated over the samples each core or NIC appears in
+func TestAggregateSamplesCoresAndNetwork(t *testing.T) {
+	window := AggregateSamples([]*SystemMetrics{
+		{
+			CPUCores: []CPUCoreMetrics{{Core: "0,0", UsagePercent: 10}, {Core: "0,1", UsagePercent: 50}},
+			Network:  []NetworkMetrics{{NIC: "Ethernet", BytesReceivedPerSec: 100, BytesSentPerSec: 40}},
+		},
+		{
+			CPUCores: []CPUCoreMetrics{{Core: "0,0", UsagePercent: 30}, {Core: "0,1", UsagePercent: 70}},
+			Network: []NetworkMetrics{
+				{NIC: "Ethernet", BytesReceivedPerSec: 300, BytesSentPerSec: 20},
+				{NIC: "Wi-Fi", BytesReceivedPerSec: 5, BytesSentPerSec: 1},
+			},
+		},
+	})
+
+	wantCores := []CPUCoreStats{
+		{Core: "0,0", UsagePercent: MetricStats{Min: 10, Max: 30, Avg: 20, P95: 30}},
+		{Core: "0,1", UsagePercent: MetricStats{Min: 50, Max: 70, Avg: 60, P95: 70}},
+	}
+	if !reflect.DeepEqual(window.CPUCores, wantCores) {
+		t.Errorf("CPUCores = %+v, want %+v", window.CPUCores, wantCores)
+	}
+
+	wantNetwork := []NetworkStats{
+		{
+			NIC:                 "Ethernet",
+			BytesReceivedPerSec: MetricStats{Min: 100, Max: 300, Avg: 200, P95: 300},
+			BytesSentPerSec:     MetricStats{Min: 20, Max: 40, Avg: 30, P95: 40},
+		},
+		{
+			NIC:                 "Wi-Fi",
+			BytesReceivedPerSec: MetricStats{Min: 5, Max: 5, Avg: 5, P95: 5},
+			BytesSentPerSec:     MetricStats{Min: 1, Max: 1, Avg: 1, P95: 1},
+		},
+	}
+	if !reflect.DeepEqual(window.Network, wantNetwork) {
+		t.Errorf("Network = %+v, want %+v", window.Network, wantNetwork)
+	}
+}
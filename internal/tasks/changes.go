@@ -0,0 +1,253 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Service event types published on events.service
+const (
+	ServiceEventStateChanged = "service_state_changed"
+	ServiceEventAppeared     = "service_appeared"    // Newly matched by a service_check pattern (From is empty)
+	ServiceEventDisappeared  = "service_disappeared" // No longer matched, e.g. uninstalled (To is empty)
+)
+
+// ServiceTransition is published when a monitored service changes state,
+// or starts or stops matching a service_check pattern
+type ServiceTransition struct {
+	Event     string `json:"event"` // ServiceEvent* constants
+	Name      string `json:"name"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ServiceTransitions compares statuses with the previously observed states
+// and returns one transition per service whose state changed
+// Services seen for the first time produce no transition; the snapshot covers them
+func ServiceTransitions(previous map[string]string, statuses []ServiceStatus) []ServiceTransition {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var transitions []ServiceTransition
+	for _, status := range statuses {
+		from, seen := previous[status.Name]
+		if !seen || from == status.Status {
+			continue
+		}
+		transitions = append(transitions, ServiceTransition{
+			Event:     ServiceEventStateChanged,
+			Name:      status.Name,
+			From:      from,
+			To:        status.Status,
+			Timestamp: now,
+		})
+	}
+	return transitions
+}
+
+// ServiceMembershipChanges compares the services of this check with the
+// previous check (service name to state) and returns an event for each
+// service that appeared or disappeared
+func ServiceMembershipChanges(previous map[string]string, statuses []ServiceStatus) []ServiceTransition {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var events []ServiceTransition
+	current := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		current[status.Name] = true
+		if _, seen := previous[status.Name]; !seen {
+			events = append(events, ServiceTransition{
+				Event:     ServiceEventAppeared,
+				Name:      status.Name,
+				To:        status.Status,
+				Timestamp: now,
+			})
+		}
+	}
+
+	names := make([]string, 0, len(previous))
+	for name := range previous {
+		if !current[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		events = append(events, ServiceTransition{
+			Event:     ServiceEventDisappeared,
+			Name:      name,
+			From:      previous[name],
+			Timestamp: now,
+		})
+	}
+	return events
+}
+
+// PatchOperation is one RFC 6902 JSON Patch operation
+type PatchOperation struct {
+	Op    string      `json:"op"` // add, remove, replace
+	Path  string      `json:"path"`
+	Value interface{} `json:"value" schema:"optional"` // Left out for remove only
+}
+
+// MarshalJSON leaves out value for remove; add and replace keep it even when
+// it is null, zero or empty, since that is the new value
+func (p PatchOperation) MarshalJSON() ([]byte, error) {
+	if p.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{p.Op, p.Path})
+	}
+	type operation PatchOperation
+	return json.Marshal(operation(p))
+}
+
+// InventoryDiff is published instead of a full inventory when only part changed
+// Applying Changes to the last published inventory (the keyframe plus earlier
+// diffs) yields the current one, apart from volatile fields
+type InventoryDiff struct {
+	Keyframe  string           `json:"keyframe"` // Timestamp of the full inventory this builds on
+	Changes   []PatchOperation `json:"changes"`
+	Timestamp string           `json:"timestamp"`
+}
+
+// inventoryVolatileFields change on almost every collection; they are left
+// out of diffs and only refreshed by keyframes ("*" matches any array index)
+var inventoryVolatileFields = []string{
+	"/timestamp",
+	"/memory/available_gb",
+	"/disks/*/free_gb",
+}
+
+// DiffInventory returns the JSON Patch from previous to current inventory,
+// ignoring volatile fields. An empty result means nothing worth publishing changed
+func DiffInventory(previous, current *Inventory) ([]PatchOperation, error) {
+	prevDoc, err := toDocument(previous)
+	if err != nil {
+		return nil, err
+	}
+	curDoc, err := toDocument(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []PatchOperation
+	diffValues("", prevDoc, curDoc, &ops)
+	return ops, nil
+}
+
+// toDocument converts a value to its generic JSON form
+func toDocument(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode for diff: %w", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode for diff: %w", err)
+	}
+	return doc, nil
+}
+
+// diffValues appends the operations turning prev into cur at path
+func diffValues(path string, prev, cur interface{}, ops *[]PatchOperation) {
+	if isVolatile(path) {
+		return
+	}
+
+	switch p := prev.(type) {
+	case map[string]interface{}:
+		c, ok := cur.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(p) {
+			child := path + "/" + escapePointer(key)
+			if cv, ok := c[key]; ok {
+				diffValues(child, p[key], cv, ops)
+			} else if !isVolatile(child) {
+				*ops = append(*ops, PatchOperation{Op: "remove", Path: child})
+			}
+		}
+		for _, key := range sortedKeys(c) {
+			child := path + "/" + escapePointer(key)
+			if _, ok := p[key]; !ok && !isVolatile(child) {
+				*ops = append(*ops, PatchOperation{Op: "add", Path: child, Value: c[key]})
+			}
+		}
+		return
+
+	case []interface{}:
+		c, ok := cur.([]interface{})
+		if !ok {
+			break
+		}
+		common := len(p)
+		if len(c) < common {
+			common = len(c)
+		}
+		for i := 0; i < common; i++ {
+			diffValues(path+"/"+strconv.Itoa(i), p[i], c[i], ops)
+		}
+		// Removals run from the end so earlier indexes stay valid
+		for i := len(p) - 1; i >= len(c); i-- {
+			*ops = append(*ops, PatchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := len(p); i < len(c); i++ {
+			*ops = append(*ops, PatchOperation{Op: "add", Path: path + "/" + strconv.Itoa(i), Value: c[i]})
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(prev, cur) {
+		*ops = append(*ops, PatchOperation{Op: "replace", Path: path, Value: cur})
+	}
+}
+
+// isVolatile reports whether a JSON Pointer matches a volatile field
+func isVolatile(path string) bool {
+	segments := strings.Split(path, "/")
+	for _, field := range inventoryVolatileFields {
+		pattern := strings.Split(field, "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		match := true
+		for i := range pattern {
+			if pattern[i] == "*" {
+				if _, err := strconv.Atoi(segments[i]); err == nil {
+					continue
+				}
+			}
+			if pattern[i] != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901)
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// sortedKeys returns map keys in order so diffs are deterministic
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
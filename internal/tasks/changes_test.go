@@ -0,0 +1,166 @@
+package tasks
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestServiceTransitions tests state change detection between checks
+func TestServiceTransitions(t *testing.T) {
+	previous := map[string]string{
+		"Spooler": "Running",
+		"W32Time": "Running",
+	}
+	statuses := []ServiceStatus{
+		{Name: "Spooler", Status: "Stopped"},
+		{Name: "W32Time", Status: "Running"},
+		{Name: "NewSvc", Status: "Running"},
+	}
+
+	transitions := ServiceTransitions(previous, statuses)
+	if len(transitions) != 1 {
+		t.Fatalf("ServiceTransitions() = %+v, want 1 transition", transitions)
+	}
+	got := transitions[0]
+	if got.Name != "Spooler" || got.From != "Running" || got.To != "Stopped" {
+		t.Errorf("transition = %+v, want Spooler Running -> Stopped", got)
+	}
+	if got.Event != "service_state_changed" || got.Timestamp == "" {
+		t.Errorf("transition = %+v, want event and timestamp set", got)
+	}
+
+	if transitions := ServiceTransitions(nil, statuses); len(transitions) != 0 {
+		t.Errorf("first observation produced transitions: %+v", transitions)
+	}
+}
+
+// TestServiceMembershipChanges tests appeared and disappeared services
+func TestServiceMembershipChanges(t *testing.T) {
+	previous := map[string]string{
+		"MSSQL$PROD": "Running",
+		"MSSQL$OLD":  "Stopped",
+	}
+	statuses := []ServiceStatus{
+		{Name: "MSSQL$PROD", Status: "Stopped"},
+		{Name: "MSSQL$NEW", Status: "StartPending"},
+	}
+
+	events := ServiceMembershipChanges(previous, statuses)
+	if len(events) != 2 {
+		t.Fatalf("ServiceMembershipChanges() = %+v, want 2 events", events)
+	}
+	if got := events[0]; got.Event != ServiceEventAppeared || got.Name != "MSSQL$NEW" || got.From != "" || got.To != "StartPending" {
+		t.Errorf("appeared = %+v", got)
+	}
+	if got := events[1]; got.Event != ServiceEventDisappeared || got.Name != "MSSQL$OLD" || got.From != "Stopped" || got.To != "" {
+		t.Errorf("disappeared = %+v", got)
+	}
+
+	if events := ServiceMembershipChanges(previous, []ServiceStatus{{Name: "MSSQL$PROD"}, {Name: "MSSQL$OLD"}}); len(events) != 0 {
+		t.Errorf("unchanged list produced events: %+v", events)
+	}
+}
+
+// TestDiffInventory tests inventory diffs and volatile field handling
+func TestDiffInventory(t *testing.T) {
+	base := func() *Inventory {
+		return &Inventory{
+			OS:     OSInfo{Name: "Windows 11", Version: "23H2", Build: "22631"},
+			CPU:    CPUInfo{Cores: 8, Model: "x"},
+			Memory: MemoryInfo{TotalGB: 16, AvailableGB: 8},
+			Disks: []DiskInfo{
+				{Drive: "C:", TotalGB: 500, FreeGB: 100},
+				{Drive: "D:", TotalGB: 1000, FreeGB: 900},
+			},
+			Network:   NetworkInfo{PrimaryIP: "10.0.0.5"},
+			Agent:     AgentInfo{Version: "1.0.0"},
+			Timestamp: "2025-01-01T00:00:00Z",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Inventory)
+		want   []PatchOperation
+	}{
+		{
+			name: "only volatile fields changed",
+			modify: func(inv *Inventory) {
+				inv.Timestamp = "2025-01-02T00:00:00Z"
+				inv.Memory.AvailableGB = 4
+				inv.Disks[1].FreeGB = 10
+			},
+			want: nil,
+		},
+		{
+			name: "scalar replaced",
+			modify: func(inv *Inventory) {
+				inv.OS.Build = "22635"
+				inv.Network.PrimaryIP = "10.0.0.9"
+			},
+			want: []PatchOperation{
+				{Op: "replace", Path: "/network/primary_ip", Value: "10.0.0.9"},
+				{Op: "replace", Path: "/os/build", Value: "22635"},
+			},
+		},
+		{
+			name: "disk added",
+			modify: func(inv *Inventory) {
+				inv.Disks = append(inv.Disks, DiskInfo{Drive: "E:", TotalGB: 64, FreeGB: 64})
+			},
+			want: []PatchOperation{
+				{Op: "add", Path: "/disks/2", Value: map[string]interface{}{"drive": "E:", "total_gb": float64(64), "free_gb": float64(64)}},
+			},
+		},
+		{
+			name: "disk removed",
+			modify: func(inv *Inventory) {
+				inv.Disks = inv.Disks[:1]
+			},
+			want: []PatchOperation{
+				{Op: "remove", Path: "/disks/1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := base()
+			tt.modify(current)
+
+			got, err := DiffInventory(base(), current)
+			if err != nil {
+				t.Fatalf("DiffInventory() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffInventory() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPatchOperationJSON tests that value is kept for zero values and left out for remove
+func TestPatchOperationJSON(t *testing.T) {
+	tests := []struct {
+		op   PatchOperation
+		want string
+	}{
+		{PatchOperation{Op: "replace", Path: "/os/build", Value: "22635"}, `{"op":"replace","path":"/os/build","value":"22635"}`},
+		{PatchOperation{Op: "replace", Path: "/memory/used_gb", Value: float64(0)}, `{"op":"replace","path":"/memory/used_gb","value":0}`},
+		{PatchOperation{Op: "replace", Path: "/network/primary_ip", Value: ""}, `{"op":"replace","path":"/network/primary_ip","value":""}`},
+		{PatchOperation{Op: "replace", Path: "/hardware/virtual", Value: false}, `{"op":"replace","path":"/hardware/virtual","value":false}`},
+		{PatchOperation{Op: "add", Path: "/network/gateway", Value: nil}, `{"op":"add","path":"/network/gateway","value":null}`},
+		{PatchOperation{Op: "remove", Path: "/disks/1"}, `{"op":"remove","path":"/disks/1"}`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.op)
+		if err != nil {
+			t.Fatalf("Marshal(%+v) error = %v", tt.op, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", tt.op, data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package tasks
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+	"win-agent/internal/utils"
+)
+
+// CustomMetric is one value mapped from an exporter family by system_metrics.custom
+type CustomMetric struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"` // group_by labels (after renames)
+	Value  float64           `json:"value"`
+}
+
+// customCounter is the previous reading of one counter series for rate calculation
+type customCounter struct {
+	value float64
+	at    time.Time
+}
+
+// mapCustomMetrics applies the configured mappings to the scraped families
+// Rates need a previous reading per series, so they appear from the second scrape
+func (c *metricsCache) mapCustomMetrics(logger *zap.Logger, families map[string]*dto.MetricFamily, mappings []config.CustomMetric, now time.Time) []CustomMetric {
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Only series seen this scrape are kept, so vanished series don't pile up
+	seen := make(map[string]customCounter)
+	var result []CustomMetric
+
+	for i := range mappings {
+		mapping := &mappings[i]
+		family, ok := families[mapping.Family]
+		if !ok {
+			logger.Debug("Custom metric family not found",
+				zap.String("name", mapping.Name),
+				zap.String("family", mapping.Family))
+			continue
+		}
+
+		groups := make(map[string][]float64)
+		groupLabels := make(map[string]map[string]string)
+
+		for _, m := range family.Metric {
+			value, ok := seriesValue(m)
+			if !ok || !matchLabels(m.Label, mapping.Match) {
+				continue
+			}
+
+			if mapping.Rate {
+				key := mapping.Name + "|" + seriesKey(m.Label)
+				seen[key] = customCounter{value: value, at: now}
+
+				// Skip the first reading and counter resets (exporter restarted)
+				prev, exists := c.lastCustom[key]
+				if !exists || value < prev.value || !now.After(prev.at) {
+					continue
+				}
+				value = (value - prev.value) / now.Sub(prev.at).Seconds()
+			}
+
+			labels := outputLabels(m.Label, mapping)
+			key := seriesKeyFromMap(labels)
+			groups[key] = append(groups[key], value)
+			groupLabels[key] = labels
+		}
+
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			result = append(result, CustomMetric{
+				Name:   mapping.Name,
+				Labels: groupLabels[key],
+				Value:  utils.Round(aggregateValues(mapping.Aggregate, groups[key])),
+			})
+		}
+	}
+
+	c.lastCustom = seen
+	return result
+}
+
+// seriesValue returns the value of a counter, gauge or untyped series
+// Summaries and histograms have no single value and are skipped
+func seriesValue(m *dto.Metric) (float64, bool) {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue(), true
+	case m.Gauge != nil:
+		return m.Gauge.GetValue(), true
+	case m.Untyped != nil:
+		return m.Untyped.GetValue(), true
+	}
+	return 0, false
+}
+
+// matchLabels reports whether a series has every wanted label value
+// Label names are compared case-insensitively because config keys are lowercased
+func matchLabels(labels []*dto.LabelPair, match map[string]string) bool {
+	for name, want := range match {
+		if getLabelValueFold(labels, name) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// outputLabels keeps the group_by labels of a series, renamed for output
+func outputLabels(labels []*dto.LabelPair, mapping *config.CustomMetric) map[string]string {
+	if len(mapping.GroupBy) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(mapping.GroupBy))
+	for _, name := range mapping.GroupBy {
+		value := getLabelValueFold(labels, name)
+		if value == "" {
+			continue
+		}
+		if renamed, ok := mapping.Rename[strings.ToLower(name)]; ok {
+			name = renamed
+		}
+		out[name] = value
+	}
+	return out
+}
+
+// aggregateValues combines the series of one output group
+func aggregateValues(aggregate string, values []float64) float64 {
+	result := values[0]
+	switch aggregate {
+	case config.AggregateMin:
+		for _, v := range values[1:] {
+			if v < result {
+				result = v
+			}
+		}
+	case config.AggregateMax:
+		for _, v := range values[1:] {
+			if v > result {
+				result = v
+			}
+		}
+	default:
+		for _, v := range values[1:] {
+			result += v
+		}
+		if aggregate == config.AggregateAvg {
+			result /= float64(len(values))
+		}
+	}
+	return result
+}
+
+// getLabelValueFold is getLabelValue with a case-insensitive name
+func getLabelValueFold(labels []*dto.LabelPair, name string) string {
+	for _, label := range labels {
+		if strings.EqualFold(label.GetName(), name) {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// seriesKey identifies a series by its full label set
+func seriesKey(labels []*dto.LabelPair) string {
+	pairs := make(map[string]string, len(labels))
+	for _, label := range labels {
+		pairs[label.GetName()] = label.GetValue()
+	}
+	return seriesKeyFromMap(pairs)
+}
+
+// seriesKeyFromMap builds a stable key from a label map
+func seriesKeyFromMap(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+labels[name])
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// parseFamilies decodes Prometheus text for mapping tests
+func parseFamilies(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+	decoder := expfmt.NewDecoder(strings.NewReader(text), expfmt.FmtText)
+	families := make(map[string]*dto.MetricFamily)
+	for {
+		mf := &dto.MetricFamily{}
+		if err := decoder.Decode(mf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		families[mf.GetName()] = mf
+	}
+	return families
+}
+
+const customExposition = `# TYPE myapp_queue_depth gauge
+myapp_queue_depth{queue="orders",instance="a"} 4
+myapp_queue_depth{queue="orders",instance="b"} 6
+myapp_queue_depth{queue="emails",instance="a"} 1
+# TYPE myapp_requests_total counter
+myapp_requests_total{code="200",handler="/api"} %d
+myapp_requests_total{code="500",handler="/api"} %d
+`
+
+// TestMapCustomMetricsAggregation tests label filters, grouping, renames and aggregation
+func TestMapCustomMetricsAggregation(t *testing.T) {
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	families := parseFamilies(t, strings.NewReplacer("%d", "0").Replace(customExposition))
+
+	mappings := []config.CustomMetric{
+		{Name: "queue_total", Family: "myapp_queue_depth"},
+		{Name: "orders_max", Family: "myapp_queue_depth", Match: map[string]string{"queue": "orders"}, Aggregate: "max"},
+		{Name: "queue_avg", Family: "myapp_queue_depth", GroupBy: []string{"queue"}, Rename: map[string]string{"queue": "name"}, Aggregate: "avg"},
+		{Name: "missing", Family: "myapp_not_exported"},
+	}
+
+	got := e.metricsCache.mapCustomMetrics(e.logger, families, mappings, time.Now())
+	want := []CustomMetric{
+		{Name: "queue_total", Value: 11},
+		{Name: "orders_max", Value: 6},
+		{Name: "queue_avg", Labels: map[string]string{"name": "emails"}, Value: 1},
+		{Name: "queue_avg", Labels: map[string]string{"name": "orders"}, Value: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mapCustomMetrics() = %+v, want %+v", got, want)
+	}
+}
+
+// TestMapCustomMetricsRate tests counter-to-rate conversion across scrapes
+func TestMapCustomMetricsRate(t *testing.T) {
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	mappings := []config.CustomMetric{
+		{Name: "requests_per_sec", Family: "myapp_requests_total", Rate: true},
+		{Name: "errors_per_sec", Family: "myapp_requests_total", Match: map[string]string{"code": "500"}, Rate: true},
+	}
+	exposition := func(ok, failed string) map[string]*dto.MetricFamily {
+		text := strings.Replace(customExposition, "%d", ok, 1)
+		return parseFamilies(t, strings.Replace(text, "%d", failed, 1))
+	}
+
+	start := time.Now()
+	if got := e.metricsCache.mapCustomMetrics(e.logger, exposition("100", "10"), mappings, start); len(got) != 0 {
+		t.Errorf("first scrape = %+v, want no rates (baseline only)", got)
+	}
+
+	got := e.metricsCache.mapCustomMetrics(e.logger, exposition("700", "30"), mappings, start.Add(10*time.Second))
+	want := []CustomMetric{
+		{Name: "requests_per_sec", Value: 62},
+		{Name: "errors_per_sec", Value: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second scrape = %+v, want %+v", got, want)
+	}
+
+	// A counter reset (exporter restart) skips the series until the next reading
+	got = e.metricsCache.mapCustomMetrics(e.logger, exposition("5", "40"), mappings, start.Add(20*time.Second))
+	want = []CustomMetric{
+		{Name: "requests_per_sec", Value: 1},
+		{Name: "errors_per_sec", Value: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after reset = %+v, want %+v", got, want)
+	}
+}
@@ -15,19 +15,10 @@ type Executor struct {
 	logger         *zap.Logger
 	commandTimeout time.Duration
 	httpClient     *http.Client  // Cached HTTP client for metrics scraping (created once, reused)
-	stats          *ExecutorStats
+	startTime      time.Time
 	metricsCache   *metricsCache // Moved from global variable in metrics.go
 	taskStats      *TaskStats
-}
-
-// ExecutorStats tracks executor statistics for self-monitoring
-type ExecutorStats struct {
-	mu                sync.RWMutex
-	startTime         time.Time
-	commandsProcessed int64
-	commandsErrored   int64
-	lastError         string
-	lastErrorTime     time.Time
+	services       ServiceManager // OS service backend for service commands and checks
 }
 
 // TaskStats tracks scheduled task execution for monitoring
@@ -38,6 +29,7 @@ type TaskStats struct {
 	lastHeartbeat    time.Time
 	lastMetrics      time.Time
 	lastServiceCheck time.Time
+	lastProcessCheck time.Time
 	lastInventory    time.Time
 	
 	// Execution counters
@@ -45,7 +37,11 @@ type TaskStats struct {
 	metricsCount      int64
 	metricsFailures   int64
 	serviceCheckCount int64
+	processCheckCount int64
 	inventoryCount    int64
+
+	// Per scrape target (scrape_targets), keyed by target name
+	scrapes map[string]*scrapeStats
 }
 
 // metricsCache stores previous counter values for rate calculation
@@ -55,6 +51,8 @@ type metricsCache struct {
 	lastCPUTotal    float64
 	lastCPUIdle     float64
 	lastDiskMetrics map[string]DiskCounters  // Per-drive counters for I/O rate calculation
+	lastCustom      map[string]customCounter // Per-series counters for custom metric rates
+	lastCounters    map[string]float64       // Other counters (per core, per NIC), keyed family|label
 	lastTimestamp   time.Time
 }
 
@@ -69,7 +67,7 @@ type AgentMetrics struct {
 	MemoryUsageMB     float64 `json:"memory_usage_mb"`
 	Goroutines        int     `json:"goroutines"`
 	UptimeSeconds     int64   `json:"uptime_seconds"`
-	CommandsProcessed int64   `json:"commands_processed"`
+	CommandsProcessed int64   `json:"commands_processed"` // Command requests, not counting ping and health
 	CommandsErrored   int64   `json:"commands_errored"`
 	LastError         string  `json:"last_error,omitempty"`
 	LastErrorTime     string  `json:"last_error_time,omitempty"`
@@ -80,53 +78,54 @@ type TaskHealthMetrics struct {
 	LastHeartbeat    string `json:"last_heartbeat,omitempty"`
 	LastMetrics      string `json:"last_metrics,omitempty"`
 	LastServiceCheck string `json:"last_service_check,omitempty"`
+	LastProcessCheck string `json:"last_process_check,omitempty"`
 	LastInventory    string `json:"last_inventory,omitempty"`
 	
 	HeartbeatCount    int64 `json:"heartbeat_count"`
 	MetricsCount      int64 `json:"metrics_count"`
 	MetricsFailures   int64 `json:"metrics_failures"`
 	ServiceCheckCount int64 `json:"service_check_count"`
+	ProcessCheckCount int64 `json:"process_check_count"`
 	InventoryCount    int64 `json:"inventory_count"`
+
+	ScrapeTargets map[string]ScrapeTargetHealth `json:"scrape_targets,omitempty"`
 }
 
-// NewExecutor creates a new task executor
+// NewExecutor creates a new task executor using the platform service backend
 func NewExecutor(logger *zap.Logger, commandTimeout time.Duration) *Executor {
+	return NewExecutorWithServices(logger, commandTimeout, newServiceManager())
+}
+
+// NewExecutorWithServices creates a task executor with the given service backend
+func NewExecutorWithServices(logger *zap.Logger, commandTimeout time.Duration, services ServiceManager) *Executor {
 	return &Executor{
 		logger:         logger,
 		commandTimeout: commandTimeout,
 		httpClient:     createHTTPClient(), // Create HTTP client ONCE and reuse for all scrapes
-		stats: &ExecutorStats{
-			startTime: time.Now(),
-		},
+		startTime:      time.Now(),
 		metricsCache: &metricsCache{
 			lastDiskMetrics: make(map[string]DiskCounters), // Initialize per-drive counters map
+			lastCustom:      make(map[string]customCounter),
+			lastCounters:    make(map[string]float64),
 		},
 		taskStats: &TaskStats{},
+		services:  services,
 	}
 }
 
 // GetAgentMetrics returns current agent performance metrics
+// Command counts come from the command service and are filled in by the caller
 func (e *Executor) GetAgentMetrics() *AgentMetrics {
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
 
-	e.stats.mu.RLock()
-	defer e.stats.mu.RUnlock()
-
 	metrics := &AgentMetrics{
 		// Use mem.Sys for total OS memory (matches Task Manager)
 		// This includes heap, stack, runtime overhead - the full process footprint
 		// Rounded to 2 decimal places for consistency with other metrics
-		MemoryUsageMB:     utils.Round(float64(mem.Sys) / 1024 / 1024),
-		Goroutines:        runtime.NumGoroutine(),
-		UptimeSeconds:     int64(time.Since(e.stats.startTime).Seconds()),
-		CommandsProcessed: e.stats.commandsProcessed,
-		CommandsErrored:   e.stats.commandsErrored,
-	}
-
-	if !e.stats.lastErrorTime.IsZero() {
-		metrics.LastError = e.stats.lastError
-		metrics.LastErrorTime = e.stats.lastErrorTime.Format(time.RFC3339)
+		MemoryUsageMB: utils.Round(float64(mem.Sys) / 1024 / 1024),
+		Goroutines:    runtime.NumGoroutine(),
+		UptimeSeconds: int64(time.Since(e.startTime).Seconds()),
 	}
 
 	return metrics
@@ -142,7 +141,9 @@ func (e *Executor) GetTaskMetrics() *TaskHealthMetrics {
 		MetricsCount:      e.taskStats.metricsCount,
 		MetricsFailures:   e.taskStats.metricsFailures,
 		ServiceCheckCount: e.taskStats.serviceCheckCount,
+		ProcessCheckCount: e.taskStats.processCheckCount,
 		InventoryCount:    e.taskStats.inventoryCount,
+		ScrapeTargets:     e.taskStats.scrapeHealth(),
 	}
 
 	// Only include timestamps if tasks have executed
@@ -155,6 +156,9 @@ func (e *Executor) GetTaskMetrics() *TaskHealthMetrics {
 	if !e.taskStats.lastServiceCheck.IsZero() {
 		metrics.LastServiceCheck = e.taskStats.lastServiceCheck.Format(time.RFC3339)
 	}
+	if !e.taskStats.lastProcessCheck.IsZero() {
+		metrics.LastProcessCheck = e.taskStats.lastProcessCheck.Format(time.RFC3339)
+	}
 	if !e.taskStats.lastInventory.IsZero() {
 		metrics.LastInventory = e.taskStats.lastInventory.Format(time.RFC3339)
 	}
@@ -193,6 +197,14 @@ func (e *Executor) RecordServiceCheck() {
 	e.taskStats.serviceCheckCount++
 }
 
+// RecordProcessCheck records a process check execution
+func (e *Executor) RecordProcessCheck() {
+	e.taskStats.mu.Lock()
+	defer e.taskStats.mu.Unlock()
+	e.taskStats.lastProcessCheck = time.Now()
+	e.taskStats.processCheckCount++
+}
+
 // RecordInventory records an inventory collection
 func (e *Executor) RecordInventory() {
 	e.taskStats.mu.Lock()
@@ -200,21 +212,3 @@ func (e *Executor) RecordInventory() {
 	e.taskStats.lastInventory = time.Now()
 	e.taskStats.inventoryCount++
 }
-
-// RecordCommandSuccess increments success counter
-func (e *Executor) RecordCommandSuccess() {
-	e.stats.mu.Lock()
-	defer e.stats.mu.Unlock()
-	e.stats.commandsProcessed++
-}
-
-// RecordCommandError increments error counter and stores last error
-func (e *Executor) RecordCommandError(err error) {
-	e.stats.mu.Lock()
-	defer e.stats.mu.Unlock()
-	
-	e.stats.commandsErrored++
-	e.stats.commandsProcessed++ // Still counts as processed
-	e.stats.lastError = err.Error()
-	e.stats.lastErrorTime = time.Now()
-}
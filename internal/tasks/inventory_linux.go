@@ -0,0 +1,279 @@
+//go:build linux
+
+package tasks
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/utils"
+)
+
+// Inventory represents complete system inventory information
+type Inventory struct {
+	OS        OSInfo      `json:"os"`
+	CPU       CPUInfo     `json:"cpu"`
+	Memory    MemoryInfo  `json:"memory"`
+	Disks     []DiskInfo  `json:"disks"`
+	Network   NetworkInfo `json:"network"`
+	Agent     AgentInfo   `json:"agent"`
+	Timestamp string      `json:"timestamp"`
+}
+
+// OSInfo contains operating system information
+type OSInfo struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Build    string `json:"build"`
+	Platform string `json:"platform"` // runtime.GOOS value: "windows", "linux", "freebsd"
+}
+
+// CPUInfo contains CPU information
+type CPUInfo struct {
+	Cores int    `json:"cores"`
+	Model string `json:"model"`
+}
+
+// MemoryInfo contains memory information
+type MemoryInfo struct {
+	TotalGB     float64 `json:"total_gb"`
+	AvailableGB float64 `json:"available_gb"`
+}
+
+// DiskInfo contains disk information
+type DiskInfo struct {
+	Drive   string  `json:"drive"` // Mount point on Linux
+	TotalGB float64 `json:"total_gb"`
+	FreeGB  float64 `json:"free_gb"`
+}
+
+// NetworkInfo contains network information
+type NetworkInfo struct {
+	PrimaryIP string `json:"primary_ip"`
+}
+
+// AgentInfo contains agent version information
+type AgentInfo struct {
+	Version string `json:"version"`
+}
+
+// osReleaseFiles are checked in order, as specified by os-release(5)
+var osReleaseFiles = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// CollectInventory gathers system inventory from procfs, statfs and os-release
+func (e *Executor) CollectInventory(version string) (*Inventory, error) {
+	inv := &Inventory{
+		Agent:     AgentInfo{Version: version},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// Collect OS information from os-release
+	osInfo, err := GetOSInfo()
+	if err != nil {
+		e.logger.Warn("Failed to collect OS info", zap.Error(err))
+	} else {
+		inv.OS = *osInfo
+	}
+
+	// Collect CPU information
+	inv.CPU = getCPUInfo("/proc/cpuinfo")
+
+	// Collect memory information
+	memInfo, err := getMemoryInfo("/proc/meminfo")
+	if err != nil {
+		e.logger.Warn("Failed to collect memory info", zap.Error(err))
+	} else {
+		inv.Memory = memInfo
+	}
+
+	// Collect disk information
+	diskInfo, err := getDiskInfo("/proc")
+	if err != nil {
+		e.logger.Warn("Failed to collect disk info", zap.Error(err))
+	} else {
+		inv.Disks = diskInfo
+	}
+
+	// Collect network information
+	netInfo, err := getNetworkInfo()
+	if err != nil {
+		e.logger.Warn("Failed to collect network info", zap.Error(err))
+	} else {
+		inv.Network = netInfo
+	}
+
+	return inv, nil
+}
+
+// GetOSInfo retrieves OS information from os-release and the kernel release
+// This is public so it can be used by both inventory collection and health checks
+func GetOSInfo() (*OSInfo, error) {
+	return readOSInfo(osReleaseFiles, "/proc/sys/kernel/osrelease")
+}
+
+// readOSInfo builds OSInfo from the first readable os-release file
+// Build holds the kernel release, the closest match to a Windows build number
+func readOSInfo(releaseFiles []string, kernelFile string) (*OSInfo, error) {
+	var release map[string]string
+	var lastErr error
+	for _, path := range releaseFiles {
+		values, err := parseOSRelease(path)
+		if err == nil {
+			release = values
+			break
+		}
+		lastErr = err
+	}
+	if release == nil {
+		return nil, fmt.Errorf("failed to read os-release: %w", lastErr)
+	}
+
+	info := &OSInfo{
+		Name:     "Unknown",
+		Version:  "Unknown",
+		Build:    "Unknown",
+		Platform: runtime.GOOS, // "linux"
+	}
+	if name := release["PRETTY_NAME"]; name != "" {
+		info.Name = name
+	} else if name := release["NAME"]; name != "" {
+		info.Name = name
+	}
+	if version := release["VERSION_ID"]; version != "" {
+		info.Version = version
+	}
+	if kernel, err := os.ReadFile(kernelFile); err == nil {
+		info.Build = strings.TrimSpace(string(kernel))
+	}
+	return info, nil
+}
+
+// parseOSRelease reads KEY=value lines, removing shell quoting from values
+func parseOSRelease(path string) (map[string]string, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = strings.NewReplacer(`\"`, `"`, `\\`, `\`, "\\$", "$", "\\`", "`").Replace(value)
+	}
+	return values, nil
+}
+
+// getCPUInfo retrieves CPU information
+func getCPUInfo(path string) CPUInfo {
+	info := CPUInfo{
+		Cores: runtime.NumCPU(),
+		Model: "Unknown",
+	}
+
+	// x86 reports "model name"; many ARM kernels only "Model" or "Hardware"
+	lines, err := readLines(path)
+	if err != nil {
+		return info
+	}
+	fallback := ""
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if key == "model name" {
+			info.Model = value
+			return info
+		}
+		if (key == "Model" || key == "Hardware") && fallback == "" {
+			fallback = value
+		}
+	}
+	if fallback != "" {
+		info.Model = fallback
+	}
+	return info
+}
+
+// getMemoryInfo retrieves memory information from /proc/meminfo
+func getMemoryInfo(path string) (MemoryInfo, error) {
+	info, err := readMeminfo(path)
+	if err != nil {
+		return MemoryInfo{}, fmt.Errorf("failed to read meminfo: %w", err)
+	}
+	if info["MemTotal"] <= 0 {
+		return MemoryInfo{}, fmt.Errorf("MemTotal missing from meminfo")
+	}
+
+	return MemoryInfo{
+		TotalGB:     utils.Round(info["MemTotal"] / 1024 / 1024 / 1024),
+		AvailableGB: utils.Round(info["MemAvailable"] / 1024 / 1024 / 1024),
+	}, nil
+}
+
+// getDiskInfo retrieves disk information for all mounted block devices
+func getDiskInfo(procRoot string) ([]DiskInfo, error) {
+	mounts, err := blockMounts(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mounts: %w", err)
+	}
+
+	var disks []DiskInfo
+	for _, mount := range mounts {
+		total, free, err := diskSpace(mount.mountPoint)
+		if err != nil {
+			continue
+		}
+		disks = append(disks, DiskInfo{
+			Drive:   mount.mountPoint,
+			TotalGB: utils.Round(total / 1024 / 1024 / 1024),
+			FreeGB:  utils.Round(free / 1024 / 1024 / 1024),
+		})
+	}
+
+	if len(disks) == 0 {
+		return nil, fmt.Errorf("no disks found")
+	}
+
+	return disks, nil
+}
+
+// getNetworkInfo retrieves primary network interface IP
+func getNetworkInfo() (NetworkInfo, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return NetworkInfo{}, fmt.Errorf("failed to get network interfaces: %w", err)
+	}
+
+	// Find first non-loopback IPv4 address
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			if !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+				return NetworkInfo{
+					PrimaryIP: ipnet.IP.String(),
+				}, nil
+			}
+		}
+	}
+
+	return NetworkInfo{PrimaryIP: "Unknown"}, nil
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestReadOSInfo tests os-release parsing and fallbacks
+func TestReadOSInfo(t *testing.T) {
+	dir := t.TempDir()
+	release := filepath.Join(dir, "os-release")
+	kernel := filepath.Join(dir, "osrelease")
+	writeFixture(t, release, "NAME=\"Ubuntu\"\nVERSION_ID=\"22.04\"\nPRETTY_NAME=\"Ubuntu 22.04.4 LTS\"\n# comment\nID=ubuntu\n")
+	writeFixture(t, kernel, "5.15.0-105-generic\n")
+
+	info, err := readOSInfo([]string{filepath.Join(dir, "missing"), release}, kernel)
+	if err != nil {
+		t.Fatalf("readOSInfo() error = %v", err)
+	}
+	want := OSInfo{Name: "Ubuntu 22.04.4 LTS", Version: "22.04", Build: "5.15.0-105-generic", Platform: "linux"}
+	if *info != want {
+		t.Errorf("readOSInfo() = %+v, want %+v", *info, want)
+	}
+
+	if _, err := readOSInfo([]string{filepath.Join(dir, "missing")}, kernel); err == nil {
+		t.Error("readOSInfo() without os-release error = nil")
+	}
+}
+
+// TestGetCPUInfoLinux tests the model name on x86 and ARM cpuinfo
+func TestGetCPUInfoLinux(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		cpuinfo string
+		want    string
+	}{
+		{name: "x86", cpuinfo: "processor\t: 0\nmodel name\t: Intel(R) Xeon(R) CPU\n", want: "Intel(R) Xeon(R) CPU"},
+		{name: "arm", cpuinfo: "processor\t: 0\nBogoMIPS\t: 108.00\n\nModel\t\t: Raspberry Pi 4 Model B\n", want: "Raspberry Pi 4 Model B"},
+		{name: "none", cpuinfo: "processor\t: 0\n", want: "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			writeFixture(t, path, tt.cpuinfo)
+			if got := getCPUInfo(path); got.Model != tt.want || got.Cores < 1 {
+				t.Errorf("getCPUInfo() = %+v, want model %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCollectInventoryLinux tests that the real system produces a full inventory
+func TestCollectInventoryLinux(t *testing.T) {
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	inv, err := e.CollectInventory("1.2.3")
+	if err != nil {
+		t.Fatalf("CollectInventory() error = %v", err)
+	}
+	if inv.OS.Platform != "linux" || inv.Memory.TotalGB <= 0 || inv.Agent.Version != "1.2.3" {
+		t.Errorf("CollectInventory() = %+v", inv)
+	}
+}
+
+// writeFixture writes a test input file
+func writeFixture(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
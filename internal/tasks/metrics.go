@@ -11,6 +11,7 @@ import (
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"go.uber.org/zap"
+	"win-agent/internal/config"
 	"win-agent/internal/utils"
 )
 
@@ -20,6 +21,23 @@ type SystemMetrics struct {
 	MemoryFreeGB    float64       `json:"memory_free_gb"`
 	Disks           []DiskMetrics `json:"disks"` // All drives detected on system
 	Timestamp       string        `json:"timestamp"`
+
+	// Extended system metrics; each is omitted when the exporter lacks its collector
+	CPUCores       []CPUCoreMetrics `json:"cpu_cores,omitempty"` // From the second scrape
+	Memory         *MemoryMetrics   `json:"memory,omitempty"`
+	PageFile       *PageFileMetrics `json:"page_file,omitempty"`
+	Network        []NetworkMetrics `json:"network,omitempty"`
+	UptimeSeconds  int64            `json:"uptime_seconds,omitempty"`
+	Processes      int              `json:"processes,omitempty"`
+	Threads        int              `json:"threads,omitempty"`
+	TCPConnections map[string]int   `json:"tcp_connections,omitempty"` // Connection count per TCP state
+
+	// Custom holds the families mapped by system_metrics.custom
+	Custom []CustomMetric `json:"custom,omitempty"`
+
+	// Window aggregates the fast samples taken since the last publish
+	// (only with system_metrics.sample_interval; top-level fields are the latest sample)
+	Window *MetricsWindow `json:"window,omitempty"`
 }
 
 // DiskMetrics represents metrics for a single disk drive
@@ -64,7 +82,8 @@ func createHTTPClient() *http.Client {
 }
 
 // ScrapeMetrics fetches and parses metrics from windows_exporter
-func (e *Executor) ScrapeMetrics(exporterURL string) (*SystemMetrics, error) {
+// custom maps additional exporter families into the custom section
+func (e *Executor) ScrapeMetrics(exporterURL string, custom []config.CustomMetric) (*SystemMetrics, error) {
 	e.logger.Debug("Starting metrics scrape", zap.String("url", exporterURL))
 
 	// Create context with timeout for additional safety
@@ -106,7 +125,7 @@ func (e *Executor) ScrapeMetrics(exporterURL string) (*SystemMetrics, error) {
 
 	// Parse metrics using expfmt
 	e.logger.Debug("Parsing Prometheus metrics")
-	metrics, err := e.parsePrometheusMetrics(limitedReader)
+	metrics, err := e.parsePrometheusMetrics(limitedReader, custom)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse metrics: %w", err)
 	}
@@ -121,30 +140,17 @@ func (e *Executor) ScrapeMetrics(exporterURL string) (*SystemMetrics, error) {
 	e.logger.Debug("Metrics scrape completed successfully",
 		zap.Float64("cpu_percent", metrics.CPUUsagePercent),
 		zap.Float64("memory_free_gb", metrics.MemoryFreeGB),
-		zap.Int("disk_count", len(metrics.Disks)))
+		zap.Int("disk_count", len(metrics.Disks)),
+		zap.Int("custom_count", len(metrics.Custom)))
 
 	return metrics, nil
 }
 
 // parsePrometheusMetrics parses Prometheus format metrics using expfmt
-func (e *Executor) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, error) {
-	// Use NewDecoder with FmtText format for proper initialization
-	// This ensures validation scheme is properly set
-	decoder := expfmt.NewDecoder(reader, expfmt.FmtText)
-
-	metricFamilies := make(map[string]*dto.MetricFamily)
-
-	// Parse all metric families
-	for {
-		mf := &dto.MetricFamily{}
-		err := decoder.Decode(mf)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode metric family: %w", err)
-		}
-		metricFamilies[mf.GetName()] = mf
+func (e *Executor) parsePrometheusMetrics(reader io.Reader, custom []config.CustomMetric) (*SystemMetrics, error) {
+	metricFamilies, err := decodeMetricFamilies(reader)
+	if err != nil {
+		return nil, err
 	}
 
 	e.logger.Debug("Parsed metric families", zap.Int("count", len(metricFamilies)))
@@ -289,6 +295,9 @@ func (e *Executor) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, err
 	// Same concept as CPU - counters need two measurements to calculate rate
 	now := time.Now()
 
+	// Map configured custom families (counters become rates the same way)
+	metrics.Custom = e.metricsCache.mapCustomMetrics(e.logger, metricFamilies, custom, now)
+
 	// Lock for disk I/O cache operations
 	e.metricsCache.mu.Lock()
 	
@@ -303,8 +312,8 @@ func (e *Executor) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, err
 					if volume != "" && m.Counter != nil {
 						currentRead := m.Counter.GetValue()
 						
-						// Check if we have previous measurement for this drive
-						if prevCounters, exists := e.metricsCache.lastDiskMetrics[volume]; exists && prevCounters.ReadBytes > 0 {
+						// Check if we have previous measurement for this drive (and no counter reset)
+						if prevCounters, exists := e.metricsCache.lastDiskMetrics[volume]; exists && prevCounters.ReadBytes > 0 && currentRead >= prevCounters.ReadBytes {
 							delta := currentRead - prevCounters.ReadBytes
 							if diskData[volume] == nil {
 								diskData[volume] = &DiskMetrics{Drive: volume}
@@ -330,8 +339,8 @@ func (e *Executor) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, err
 					if volume != "" && m.Counter != nil {
 						currentWrite := m.Counter.GetValue()
 						
-						// Check if we have previous measurement for this drive
-						if prevCounters, exists := e.metricsCache.lastDiskMetrics[volume]; exists && prevCounters.WriteBytes > 0 {
+						// Check if we have previous measurement for this drive (and no counter reset)
+						if prevCounters, exists := e.metricsCache.lastDiskMetrics[volume]; exists && prevCounters.WriteBytes > 0 && currentWrite >= prevCounters.WriteBytes {
 							delta := currentWrite - prevCounters.WriteBytes
 							if diskData[volume] == nil {
 								diskData[volume] = &DiskMetrics{Drive: volume}
@@ -374,6 +383,9 @@ func (e *Executor) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, err
 		e.logger.Debug("Disk I/O baseline stored for all drives, will calculate on next scrape")
 	}
 
+	// Network, per-core CPU, memory, paging, uptime, processes and TCP states
+	e.extractSystemMetrics(metricFamilies, metrics, now)
+
 	e.metricsCache.lastTimestamp = now
 	e.metricsCache.mu.Unlock()
 
@@ -406,6 +418,29 @@ func (e *Executor) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, err
 	return metrics, nil
 }
 
+// decodeMetricFamilies parses Prometheus text format into families by name
+func decodeMetricFamilies(reader io.Reader) (map[string]*dto.MetricFamily, error) {
+	// Use NewDecoder with FmtText format for proper initialization
+	// This ensures validation scheme is properly set
+	decoder := expfmt.NewDecoder(reader, expfmt.FmtText)
+
+	metricFamilies := make(map[string]*dto.MetricFamily)
+
+	// Parse all metric families
+	for {
+		mf := &dto.MetricFamily{}
+		err := decoder.Decode(mf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metric family: %w", err)
+		}
+		metricFamilies[mf.GetName()] = mf
+	}
+	return metricFamilies, nil
+}
+
 // validateMetrics performs sanity checks on metrics values
 // FIXED: Now validates gauge metrics (memory, disk) even on first scrape
 // Only counter-based metrics (CPU, disk I/O) are skipped on first scrape
@@ -427,6 +462,14 @@ func (e *Executor) validateMetrics(m *SystemMetrics) error {
 		return fmt.Errorf("invalid memory free: %.2f GB (cannot be negative)", m.MemoryFreeGB)
 	}
 
+	// Extended memory and page file percentages are gauges too
+	if m.Memory != nil && (m.Memory.UsedPercent < 0 || m.Memory.UsedPercent > 100) {
+		return fmt.Errorf("invalid memory used percent: %.2f%% (must be 0-100)", m.Memory.UsedPercent)
+	}
+	if m.PageFile != nil && (m.PageFile.UsedPercent < 0 || m.PageFile.UsedPercent > 100) {
+		return fmt.Errorf("invalid page file used percent: %.2f%% (must be 0-100)", m.PageFile.UsedPercent)
+	}
+
 	// ALWAYS validate all disk metrics (gauge metrics for space, counters for I/O)
 	for _, disk := range m.Disks {
 		// Validate space metrics (always available)
@@ -466,6 +509,7 @@ func getLabelValue(labels []*dto.LabelPair, name string) string {
 
 // MetricsError represents an error that occurred during metrics collection
 type MetricsError struct {
+	Target    string `json:"target,omitempty"` // Scrape target name (scrape_targets only)
 	Status    string `json:"status"`
 	Error     string `json:"error"`
 	Timestamp string `json:"timestamp"`
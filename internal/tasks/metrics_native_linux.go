@@ -0,0 +1,416 @@
+//go:build linux
+
+package tasks
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"win-agent/internal/utils"
+)
+
+// linuxTCPStates maps /proc/net/tcp st values to the windows_exporter state names
+var linuxTCPStates = map[int64]string{
+	0x01: tcpStates[5],  // ESTABLISHED
+	0x02: tcpStates[3],  // SYN_SENT
+	0x03: tcpStates[4],  // SYN_RECEIVED
+	0x04: tcpStates[6],  // FIN_WAIT1
+	0x05: tcpStates[7],  // FIN_WAIT2
+	0x06: tcpStates[11], // TIME_WAIT
+	0x07: tcpStates[1],  // CLOSED
+	0x08: tcpStates[8],  // CLOSE_WAIT
+	0x09: tcpStates[10], // LAST_ACK
+	0x0A: tcpStates[2],  // LISTENING
+	0x0B: tcpStates[9],  // CLOSING
+}
+
+// nativeCollector reads metrics from procfs and sysfs
+// The roots are fields so tests can point them at fixtures
+type nativeCollector struct {
+	procRoot string
+	sysRoot  string
+}
+
+// newNativeCollector checks that procfs is readable
+func newNativeCollector() (*nativeCollector, error) {
+	c := &nativeCollector{procRoot: "/proc", sysRoot: "/sys"}
+	if _, err := os.Stat(filepath.Join(c.procRoot, "stat")); err != nil {
+		return nil, fmt.Errorf("procfs not available: %w", err)
+	}
+	return c, nil
+}
+
+// collect reads one measurement; counters are rated through cache
+// Callers must hold cache.mu; cache.lastTimestamp is still the previous Collect
+func (c *nativeCollector) collect(cache *metricsCache, now time.Time) (*SystemMetrics, error) {
+	var seconds float64
+	if !cache.lastTimestamp.IsZero() {
+		seconds = now.Sub(cache.lastTimestamp).Seconds()
+	}
+
+	metrics := &SystemMetrics{Disks: []DiskMetrics{}}
+
+	if err := c.readCPU(cache, metrics); err != nil {
+		return nil, err
+	}
+	if err := c.readMemory(metrics); err != nil {
+		return nil, err
+	}
+
+	// The rest is best effort, like missing windows_exporter collectors
+	c.readDisks(cache, metrics, seconds)
+	c.readNetwork(cache, metrics, seconds)
+	c.readSystem(metrics)
+	c.readTCP(metrics)
+
+	return metrics, nil
+}
+
+// readCPU calculates overall and per-core usage from /proc/stat
+func (c *nativeCollector) readCPU(cache *metricsCache, metrics *SystemMetrics) error {
+	lines, err := readLines(filepath.Join(c.procRoot, "stat"))
+	if err != nil {
+		return fmt.Errorf("failed to read cpu times: %w", err)
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		// user nice system idle iowait irq softirq steal; guest time is already in user
+		var total float64
+		values := make([]float64, 8)
+		for i := range values {
+			values[i], _ = strconv.ParseFloat(fields[i+1], 64)
+			total += values[i]
+		}
+		idle := values[3] + values[4]
+
+		core := strings.TrimPrefix(fields[0], "cpu")
+		if core == "" {
+			core = "all"
+		}
+		totalDelta, ok := cache.counterDelta("cpu_total|"+core, total)
+		idleDelta, idleOK := cache.counterDelta("cpu_idle|"+core, idle)
+		if !ok || !idleOK || totalDelta <= 0 {
+			continue
+		}
+
+		usage := utils.Round(100 - idleDelta/totalDelta*100)
+		if core == "all" {
+			metrics.CPUUsagePercent = usage
+		} else {
+			metrics.CPUCores = append(metrics.CPUCores, CPUCoreMetrics{Core: core, UsagePercent: usage})
+		}
+	}
+
+	sort.Slice(metrics.CPUCores, func(i, j int) bool { return coreLess(metrics.CPUCores[i].Core, metrics.CPUCores[j].Core) })
+	return nil
+}
+
+// readMemory fills memory and swap (as page file) from /proc/meminfo
+func (c *nativeCollector) readMemory(metrics *SystemMetrics) error {
+	info, err := readMeminfo(filepath.Join(c.procRoot, "meminfo"))
+	if err != nil {
+		return fmt.Errorf("failed to read memory info: %w", err)
+	}
+
+	total, available := info["MemTotal"], info["MemAvailable"]
+	if total <= 0 {
+		return fmt.Errorf("MemTotal missing from meminfo")
+	}
+	metrics.MemoryFreeGB = utils.Round(available / 1024 / 1024 / 1024)
+	metrics.Memory = &MemoryMetrics{
+		TotalGB:     utils.Round(total / 1024 / 1024 / 1024),
+		UsedGB:      utils.Round((total - available) / 1024 / 1024 / 1024),
+		UsedPercent: utils.Round((total - available) / total * 100),
+	}
+
+	if swap := info["SwapTotal"]; swap > 0 {
+		used := swap - info["SwapFree"]
+		metrics.PageFile = &PageFileMetrics{
+			TotalGB:     utils.Round(swap / 1024 / 1024 / 1024),
+			UsedGB:      utils.Round(used / 1024 / 1024 / 1024),
+			UsedPercent: utils.Round(used / swap * 100),
+		}
+	}
+	return nil
+}
+
+// readDisks fills space per mounted block device and I/O rates from /proc/diskstats
+// Drives are named by mount point; bind mounts of the same device are skipped
+func (c *nativeCollector) readDisks(cache *metricsCache, metrics *SystemMetrics, seconds float64) {
+	mounts, err := blockMounts(c.procRoot)
+	if err != nil {
+		return
+	}
+
+	// Sectors read/written per block device (always 512 bytes in diskstats)
+	ioBytes := make(map[string][2]float64)
+	if lines, err := readLines(filepath.Join(c.procRoot, "diskstats")); err == nil {
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) < 10 {
+				continue
+			}
+			read, _ := strconv.ParseFloat(fields[5], 64)
+			written, _ := strconv.ParseFloat(fields[9], 64)
+			ioBytes[fields[2]] = [2]float64{read * 512, written * 512}
+		}
+	}
+
+	for _, mount := range mounts {
+		mountPoint := mount.mountPoint
+		totalBytes, freeBytes, err := diskSpace(mountPoint)
+		if err != nil {
+			continue
+		}
+
+		disk := DiskMetrics{
+			Drive:       mountPoint,
+			FreeGB:      utils.Round(freeBytes / 1024 / 1024 / 1024),
+			TotalGB:     utils.Round(totalBytes / 1024 / 1024 / 1024),
+			FreePercent: utils.Round(freeBytes / totalBytes * 100),
+		}
+
+		// /dev/mapper and /dev/disk/by-* names are symlinks to the kernel name
+		device := mount.device
+		if resolved, err := filepath.EvalSymlinks(device); err == nil {
+			device = resolved
+		}
+		if counters, ok := ioBytes[filepath.Base(device)]; ok {
+			read, readOK := cache.counterDelta("disk_read|"+mountPoint, counters[0])
+			written, writeOK := cache.counterDelta("disk_write|"+mountPoint, counters[1])
+			disk.ReadBytesPerSec = utils.Round(rate(read, readOK, seconds))
+			disk.WriteBytesPerSec = utils.Round(rate(written, writeOK, seconds))
+		}
+
+		metrics.Disks = append(metrics.Disks, disk)
+	}
+	sort.Slice(metrics.Disks, func(i, j int) bool { return metrics.Disks[i].Drive < metrics.Disks[j].Drive })
+}
+
+// readNetwork fills per-interface rates from /proc/net/dev (loopback excluded)
+func (c *nativeCollector) readNetwork(cache *metricsCache, metrics *SystemMetrics, seconds float64) {
+	lines, err := readLines(filepath.Join(c.procRoot, "net", "dev"))
+	if err != nil {
+		return
+	}
+
+	for _, line := range lines {
+		name, data, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(data)
+		if !ok || name == "lo" || len(fields) < 12 {
+			continue
+		}
+
+		nic := NetworkMetrics{NIC: name}
+		// rx: bytes packets errs drop ... tx (from field 8): bytes packets errs drop
+		for _, counter := range []struct {
+			field int
+			value *float64
+		}{
+			{0, &nic.BytesReceivedPerSec},
+			{2, &nic.ErrorsReceivedPerSec},
+			{3, &nic.DiscardsReceivedPerSec},
+			{8, &nic.BytesSentPerSec},
+			{10, &nic.ErrorsSentPerSec},
+			{11, &nic.DiscardsSentPerSec},
+		} {
+			value, _ := strconv.ParseFloat(fields[counter.field], 64)
+			delta, ok := cache.counterDelta(fmt.Sprintf("net%d|%s", counter.field, name), value)
+			*counter.value = utils.Round(rate(delta, ok, seconds))
+		}
+
+		// Link speed in Mbit/s; virtual interfaces report -1 or fail
+		if speed, err := readInt(filepath.Join(c.sysRoot, "class", "net", name, "speed")); err == nil && speed > 0 {
+			nic.BandwidthBytesPerSec = float64(speed) * 1000 * 1000 / 8
+		}
+
+		metrics.Network = append(metrics.Network, nic)
+	}
+	sort.Slice(metrics.Network, func(i, j int) bool { return metrics.Network[i].NIC < metrics.Network[j].NIC })
+}
+
+// readSystem fills uptime, process and thread counts
+func (c *nativeCollector) readSystem(metrics *SystemMetrics) {
+	if lines, err := readLines(filepath.Join(c.procRoot, "uptime")); err == nil && len(lines) > 0 {
+		if fields := strings.Fields(lines[0]); len(fields) > 0 {
+			uptime, _ := strconv.ParseFloat(fields[0], 64)
+			metrics.UptimeSeconds = int64(uptime)
+		}
+	}
+
+	// loadavg: "0.00 0.01 0.05 1/312 4242" - the total is every thread
+	if lines, err := readLines(filepath.Join(c.procRoot, "loadavg")); err == nil && len(lines) > 0 {
+		if fields := strings.Fields(lines[0]); len(fields) > 3 {
+			if _, total, ok := strings.Cut(fields[3], "/"); ok {
+				metrics.Threads, _ = strconv.Atoi(total)
+			}
+		}
+	}
+
+	if entries, err := os.ReadDir(c.procRoot); err == nil {
+		for _, entry := range entries {
+			if _, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+				metrics.Processes++
+			}
+		}
+	}
+}
+
+// readTCP counts IPv4 and IPv6 connections per state
+func (c *nativeCollector) readTCP(metrics *SystemMetrics) {
+	for _, file := range []string{"tcp", "tcp6"} {
+		lines, err := readLines(filepath.Join(c.procRoot, "net", file))
+		if err != nil {
+			continue
+		}
+		for _, line := range lines[min(1, len(lines)):] { // Skip the header
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				continue
+			}
+			state, err := strconv.ParseInt(fields[3], 16, 32)
+			if name, ok := linuxTCPStates[state]; err == nil && ok {
+				if metrics.TCPConnections == nil {
+					metrics.TCPConnections = make(map[string]int)
+				}
+				metrics.TCPConnections[name]++
+			}
+		}
+	}
+}
+
+// readLines reads a small text file into lines
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// blockMount is a mounted block device
+type blockMount struct {
+	device     string
+	mountPoint string
+}
+
+// blockMounts lists block devices in the mount table, first mount point only
+// so bind mounts of the same device are not counted twice
+func blockMounts(procRoot string) ([]blockMount, error) {
+	lines, err := readLines(filepath.Join(procRoot, "mounts"))
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []blockMount
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		mounts = append(mounts, blockMount{device: fields[0], mountPoint: unescapeMount(fields[1])})
+	}
+	return mounts, nil
+}
+
+// diskSpace returns the total and available bytes of a mounted filesystem
+func diskSpace(mountPoint string) (total, free float64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountPoint, &stat); err != nil {
+		return 0, 0, err
+	}
+	if stat.Blocks == 0 {
+		return 0, 0, fmt.Errorf("%s has no blocks", mountPoint)
+	}
+	return float64(stat.Blocks) * float64(stat.Bsize), float64(stat.Bavail) * float64(stat.Bsize), nil
+}
+
+// readMeminfo parses /proc/meminfo into bytes per field
+func readMeminfo(path string) (map[string]float64, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]float64)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		info[strings.TrimSuffix(fields[0], ":")] = value * 1024 // kB
+	}
+	return info, nil
+}
+
+// readInt reads a file holding a single integer
+func readInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// unescapeMount decodes the octal escapes (\040 for space) used in /proc/mounts
+func unescapeMount(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// systemBootTime reads the boot time ("btime") from /proc/stat
+func systemBootTime() (time.Time, error) {
+	lines, err := readLines("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range lines {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid btime: %w", err)
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("btime not found in /proc/stat")
+}
@@ -0,0 +1,135 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// writeProcFixture writes a minimal procfs/sysfs tree with counters scaled by step
+func writeProcFixture(t *testing.T, proc, sys, mountPoint string, step int) {
+	t.Helper()
+	files := map[string]string{
+		"stat": fmt.Sprintf("cpu  %d 0 %d %d 0 0 0 0 0 0\ncpu0 %d 0 0 %d 0 0 0 0 0 0\ncpu1 %d 0 0 %d 0 0 0 0 0 0\nintr 0\n",
+			60*step, 20*step, 120*step, // all: 40% busy
+			50*step, 50*step, // cpu0: 50% busy
+			30*step, 70*step), // cpu1: 30% busy
+		"meminfo":   "MemTotal:       16777216 kB\nMemFree:         1048576 kB\nMemAvailable:    4194304 kB\nSwapTotal:       2097152 kB\nSwapFree:        1572864 kB\n",
+		"mounts":    fmt.Sprintf("proc /proc proc rw 0 0\n/dev/fake1 %s ext4 rw 0 0\n/dev/fake1 /bind ext4 rw 0 0\n", mountPoint),
+		"diskstats": fmt.Sprintf("   8       1 fake1 100 0 %d 0 50 0 %d 0 0 0 0\n", 1000*step, 2000*step),
+		"net/dev": fmt.Sprintf("Inter-|   Receive |  Transmit\n face |bytes packets errs drop fifo frame compressed multicast|bytes packets errs drop fifo colls carrier compressed\n"+
+			"    lo: 999 1 0 0 0 0 0 0 999 1 0 0 0 0 0 0\n  eth0: %d 10 %d 0 0 0 0 0 %d 5 0 %d 0 0 0 0\n",
+			10000*step, step, 5000*step, 2*step),
+		"uptime":   "3600.42 7000.00\n",
+		"loadavg":  "0.10 0.20 0.30 2/345 4242\n",
+		"net/tcp":  "  sl  local_address rem_address   st\n   0: 0100007F:1F90 00000000:0000 0A 0\n   1: 0100007F:1F90 0100007F:C350 01 0\n",
+		"net/tcp6": "  sl  local_address rem_address   st\n   0: 00000000000000000000000001000000:1F90 00000000000000000000000000000000:0000 01 0\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(proc, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"1", "42", "self"} {
+		os.MkdirAll(filepath.Join(proc, dir), 0755)
+	}
+	os.MkdirAll(filepath.Join(sys, "class", "net", "eth0"), 0755)
+	os.WriteFile(filepath.Join(sys, "class", "net", "eth0", "speed"), []byte("1000\n"), 0644)
+}
+
+// TestNativeCollectorLinux tests procfs parsing and counter rates
+func TestNativeCollectorLinux(t *testing.T) {
+	proc, sys, mountPoint := t.TempDir(), t.TempDir(), t.TempDir()
+	c := &nativeCollector{procRoot: proc, sysRoot: sys}
+	cache := &metricsCache{lastCounters: make(map[string]float64)}
+	start := time.Now()
+
+	writeProcFixture(t, proc, sys, mountPoint, 1)
+	first, err := c.collect(cache, start)
+	if err != nil {
+		t.Fatalf("first collect error = %v", err)
+	}
+	cache.lastTimestamp = start
+
+	if first.CPUUsagePercent != 0 || first.CPUCores != nil {
+		t.Errorf("first collect CPU = %v / %+v, want no usage before a baseline", first.CPUUsagePercent, first.CPUCores)
+	}
+	if want := (MemoryMetrics{TotalGB: 16, UsedGB: 12, UsedPercent: 75}); first.Memory == nil || *first.Memory != want {
+		t.Errorf("Memory = %+v, want %+v", first.Memory, want)
+	}
+	if first.MemoryFreeGB != 4 {
+		t.Errorf("MemoryFreeGB = %v, want 4", first.MemoryFreeGB)
+	}
+	if want := (PageFileMetrics{TotalGB: 2, UsedGB: 0.5, UsedPercent: 25}); first.PageFile == nil || *first.PageFile != want {
+		t.Errorf("PageFile = %+v, want %+v", first.PageFile, want)
+	}
+	if first.UptimeSeconds != 3600 || first.Threads != 345 || first.Processes != 2 {
+		t.Errorf("uptime/threads/processes = %d/%d/%d, want 3600/345/2", first.UptimeSeconds, first.Threads, first.Processes)
+	}
+	if want := map[string]int{"LISTENING": 1, "ESTABLISHED": 2}; !reflect.DeepEqual(first.TCPConnections, want) {
+		t.Errorf("TCPConnections = %v, want %v", first.TCPConnections, want)
+	}
+	if len(first.Disks) != 1 || first.Disks[0].Drive != mountPoint || first.Disks[0].TotalGB <= 0 {
+		t.Errorf("Disks = %+v, want the fixture mount once", first.Disks)
+	}
+
+	writeProcFixture(t, proc, sys, mountPoint, 2)
+	second, err := c.collect(cache, start.Add(10*time.Second))
+	if err != nil {
+		t.Fatalf("second collect error = %v", err)
+	}
+
+	if second.CPUUsagePercent != 40 {
+		t.Errorf("CPUUsagePercent = %v, want 40", second.CPUUsagePercent)
+	}
+	if want := []CPUCoreMetrics{{Core: "0", UsagePercent: 50}, {Core: "1", UsagePercent: 30}}; !reflect.DeepEqual(second.CPUCores, want) {
+		t.Errorf("CPUCores = %+v, want %+v", second.CPUCores, want)
+	}
+	wantNIC := NetworkMetrics{NIC: "eth0", BytesReceivedPerSec: 1000, BytesSentPerSec: 500, ErrorsReceivedPerSec: 0.1,
+		DiscardsSentPerSec: 0.2, BandwidthBytesPerSec: 125000000}
+	if len(second.Network) != 1 || second.Network[0] != wantNIC {
+		t.Errorf("Network = %+v, want [%+v]", second.Network, wantNIC)
+	}
+	if disk := second.Disks[0]; disk.ReadBytesPerSec != 51200 || disk.WriteBytesPerSec != 102400 {
+		t.Errorf("disk I/O = %v/%v, want 51200/102400", disk.ReadBytesPerSec, disk.WriteBytesPerSec)
+	}
+}
+
+// TestUnescapeMount tests octal escapes in mount points
+func TestUnescapeMount(t *testing.T) {
+	if got := unescapeMount(`/mnt/my\040disk`); got != "/mnt/my disk" {
+		t.Errorf("unescapeMount() = %q", got)
+	}
+}
+
+// TestNativeSourceCollect tests the native source against the real procfs
+func TestNativeSourceCollect(t *testing.T) {
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	source, err := e.NewMetricsSource(&config.SystemMetricsConfig{Source: config.MetricsSourceNative})
+	if err != nil {
+		t.Fatalf("NewMetricsSource(native) error = %v", err)
+	}
+	if source.Name() != "native" {
+		t.Errorf("Name() = %q, want native", source.Name())
+	}
+
+	for i := 0; i < 2; i++ {
+		metrics, err := source.Collect()
+		if err != nil {
+			t.Fatalf("Collect() #%d error = %v", i+1, err)
+		}
+		if metrics.Memory == nil || metrics.Memory.TotalGB <= 0 || metrics.Timestamp == "" {
+			t.Errorf("Collect() #%d = %+v, want memory and timestamp", i+1, metrics)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows && !linux
+
+package tasks
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// nativeCollector is unavailable on this platform
+type nativeCollector struct{}
+
+// newNativeCollector reports that native metrics are not supported here
+func newNativeCollector() (*nativeCollector, error) {
+	return nil, fmt.Errorf("native metrics are not supported on %s", runtime.GOOS)
+}
+
+// collect is never called; newNativeCollector always fails
+func (c *nativeCollector) collect(cache *metricsCache, now time.Time) (*SystemMetrics, error) {
+	return nil, fmt.Errorf("native metrics are not supported on %s", runtime.GOOS)
+}
+
+// systemBootTime is unknown on this platform
+func systemBootTime() (time.Time, error) {
+	return time.Time{}, fmt.Errorf("boot time is not available on %s", runtime.GOOS)
+}
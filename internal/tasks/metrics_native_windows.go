@@ -0,0 +1,378 @@
+//go:build windows
+
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"win-agent/internal/utils"
+)
+
+var (
+	modPdh                          = windows.NewLazySystemDLL("pdh.dll")
+	procPdhOpenQuery                = modPdh.NewProc("PdhOpenQueryW")
+	procPdhAddEnglishCounter        = modPdh.NewProc("PdhAddEnglishCounterW")
+	procPdhCollectQueryData         = modPdh.NewProc("PdhCollectQueryData")
+	procPdhGetFormattedCounterArray = modPdh.NewProc("PdhGetFormattedCounterArrayW")
+
+	modKernel32              = windows.NewLazySystemDLL("kernel32.dll")
+	procGetSystemTimes       = modKernel32.NewProc("GetSystemTimes")
+	procGlobalMemoryStatusEx = modKernel32.NewProc("GlobalMemoryStatusEx")
+	procGetTickCount64       = modKernel32.NewProc("GetTickCount64")
+
+	modIphlpapi      = windows.NewLazySystemDLL("iphlpapi.dll")
+	procGetTcpTable  = modIphlpapi.NewProc("GetTcpTable")
+	procGetTcp6Table = modIphlpapi.NewProc("GetTcp6Table")
+)
+
+// PDH constants (pdh.h, pdhmsg.h)
+const (
+	pdhFmtDouble          = 0x00000200
+	pdhFmtNoCap100        = 0x00008000
+	pdhMoreData           = 0x800007D2
+	pdhCStatusValidData   = 0x00000000
+	pdhCStatusNewData     = 0x00000001
+	driveFixed            = 3   // DRIVE_FIXED
+	errInsufficientBuffer = 122 // ERROR_INSUFFICIENT_BUFFER
+)
+
+// pdhCounterPaths are the PDH counters read on every collect, by key
+// Rates (/sec, % Processor Time) are calculated by PDH between collects;
+// the packet error and discard counts are raw and rated through metricsCache
+var pdhCounterPaths = map[string]string{
+	"core":            `\Processor Information(*)\% Processor Time`,
+	"disk_read":       `\LogicalDisk(*)\Disk Read Bytes/sec`,
+	"disk_write":      `\LogicalDisk(*)\Disk Write Bytes/sec`,
+	"net_rx":          `\Network Interface(*)\Bytes Received/sec`,
+	"net_tx":          `\Network Interface(*)\Bytes Sent/sec`,
+	"net_rx_errors":   `\Network Interface(*)\Packets Received Errors`,
+	"net_tx_errors":   `\Network Interface(*)\Packets Outbound Errors`,
+	"net_rx_discards": `\Network Interface(*)\Packets Received Discarded`,
+	"net_tx_discards": `\Network Interface(*)\Packets Outbound Discarded`,
+	"net_bandwidth":   `\Network Interface(*)\Current Bandwidth`,
+	"processes":       `\System\Processes`,
+	"threads":         `\System\Threads`,
+	"pagefile":        `\Paging File(_Total)\% Usage`,
+}
+
+// driveInstance matches LogicalDisk instances that are drive letters
+var driveInstance = regexp.MustCompile(`^[A-Z]:$`)
+
+// pdhCounterValueItem is PDH_FMT_COUNTERVALUE_ITEM_W with PDH_FMT_DOUBLE
+// The value union is 8-byte aligned on every architecture
+type pdhCounterValueItem struct {
+	name   *uint16
+	_      [8 - unsafe.Sizeof(uintptr(0))]byte
+	status uint32
+	_      uint32
+	value  float64
+}
+
+// nativeCollector reads metrics through PDH and Win32 APIs
+type nativeCollector struct {
+	query    uintptr
+	counters map[string]uintptr
+}
+
+// newNativeCollector opens a PDH query with every available counter
+// Counters missing on this system are left out (their fields stay empty)
+func newNativeCollector() (*nativeCollector, error) {
+	c := &nativeCollector{counters: make(map[string]uintptr)}
+
+	if ret, _, _ := procPdhOpenQuery.Call(0, 0, uintptr(unsafe.Pointer(&c.query))); ret != 0 {
+		return nil, fmt.Errorf("PdhOpenQuery failed: 0x%x", uint32(ret))
+	}
+
+	for key, path := range pdhCounterPaths {
+		pathPtr, err := windows.UTF16PtrFromString(path)
+		if err != nil {
+			continue
+		}
+		var counter uintptr
+		ret, _, _ := procPdhAddEnglishCounter.Call(c.query, uintptr(unsafe.Pointer(pathPtr)), 0, uintptr(unsafe.Pointer(&counter)))
+		if ret == 0 {
+			c.counters[key] = counter
+		}
+	}
+
+	// Rate counters need a first sample to calculate against
+	procPdhCollectQueryData.Call(c.query)
+	return c, nil
+}
+
+// collect reads one measurement; raw counters are rated through cache
+// Callers must hold cache.mu; cache.lastTimestamp is still the previous Collect
+func (c *nativeCollector) collect(cache *metricsCache, now time.Time) (*SystemMetrics, error) {
+	var seconds float64
+	if !cache.lastTimestamp.IsZero() {
+		seconds = now.Sub(cache.lastTimestamp).Seconds()
+	}
+
+	metrics := &SystemMetrics{Disks: []DiskMetrics{}}
+
+	if err := c.readCPU(cache, metrics); err != nil {
+		return nil, err
+	}
+	if err := c.readMemory(metrics); err != nil {
+		return nil, err
+	}
+
+	if ret, _, _ := procPdhCollectQueryData.Call(c.query); ret != 0 {
+		return nil, fmt.Errorf("PdhCollectQueryData failed: 0x%x", uint32(ret))
+	}
+	c.readCores(metrics)
+	c.readDisks(metrics)
+	c.readNetwork(cache, metrics, seconds)
+	c.readSystem(metrics)
+	readTCPStates(metrics)
+
+	return metrics, nil
+}
+
+// readCPU calculates overall usage from GetSystemTimes (kernel time includes idle)
+func (c *nativeCollector) readCPU(cache *metricsCache, metrics *SystemMetrics) error {
+	var idle, kernel, user windows.Filetime
+	ret, _, err := procGetSystemTimes.Call(
+		uintptr(unsafe.Pointer(&idle)),
+		uintptr(unsafe.Pointer(&kernel)),
+		uintptr(unsafe.Pointer(&user)),
+	)
+	if ret == 0 {
+		return fmt.Errorf("GetSystemTimes failed: %w", err)
+	}
+
+	totalDelta, ok := cache.counterDelta("cpu_total|all", float64(filetimeTicks(kernel)+filetimeTicks(user)))
+	idleDelta, idleOK := cache.counterDelta("cpu_idle|all", float64(filetimeTicks(idle)))
+	if ok && idleOK && totalDelta > 0 {
+		metrics.CPUUsagePercent = utils.Round(100 - idleDelta/totalDelta*100)
+	}
+	return nil
+}
+
+// readMemory fills physical memory and the page file size from GlobalMemoryStatusEx
+func (c *nativeCollector) readMemory(metrics *SystemMetrics) error {
+	var status struct {
+		length               uint32
+		memoryLoad           uint32
+		totalPhys            uint64
+		availPhys            uint64
+		totalPageFile        uint64
+		availPageFile        uint64
+		totalVirtual         uint64
+		availVirtual         uint64
+		availExtendedVirtual uint64
+	}
+	status.length = uint32(unsafe.Sizeof(status))
+
+	if ret, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ret == 0 {
+		return fmt.Errorf("GlobalMemoryStatusEx failed: %w", err)
+	}
+
+	total, available := float64(status.totalPhys), float64(status.availPhys)
+	metrics.MemoryFreeGB = utils.Round(available / 1024 / 1024 / 1024)
+	metrics.Memory = &MemoryMetrics{
+		TotalGB:     utils.Round(total / 1024 / 1024 / 1024),
+		UsedGB:      utils.Round((total - available) / 1024 / 1024 / 1024),
+		UsedPercent: utils.Round((total - available) / total * 100),
+	}
+
+	// The commit limit is physical memory plus all page files
+	if status.totalPageFile > status.totalPhys {
+		metrics.PageFile = &PageFileMetrics{
+			TotalGB: utils.Round(float64(status.totalPageFile-status.totalPhys) / 1024 / 1024 / 1024),
+		}
+	}
+	return nil
+}
+
+// readCores fills per-core usage from Processor Information ("group,number")
+func (c *nativeCollector) readCores(metrics *SystemMetrics) {
+	for core, usage := range c.values("core") {
+		if strings.Contains(core, "_Total") {
+			continue
+		}
+		metrics.CPUCores = append(metrics.CPUCores, CPUCoreMetrics{Core: core, UsagePercent: utils.Round(usage)})
+	}
+	sort.Slice(metrics.CPUCores, func(i, j int) bool { return coreLess(metrics.CPUCores[i].Core, metrics.CPUCores[j].Core) })
+}
+
+// readDisks fills space for fixed drives and I/O rates from PDH
+func (c *nativeCollector) readDisks(metrics *SystemMetrics) {
+	reads, writes := c.values("disk_read"), c.values("disk_write")
+
+	for drive := 'C'; drive <= 'Z'; drive++ {
+		name := fmt.Sprintf("%c:", drive)
+		root, _ := windows.UTF16PtrFromString(name + `\`)
+		if windows.GetDriveType(root) != driveFixed {
+			continue
+		}
+
+		var freeAvailable, totalBytes, totalFree uint64
+		if err := windows.GetDiskFreeSpaceEx(root, &freeAvailable, &totalBytes, &totalFree); err != nil || totalBytes == 0 {
+			continue
+		}
+
+		metrics.Disks = append(metrics.Disks, DiskMetrics{
+			Drive:            name,
+			FreeGB:           utils.Round(float64(freeAvailable) / 1024 / 1024 / 1024),
+			TotalGB:          utils.Round(float64(totalBytes) / 1024 / 1024 / 1024),
+			FreePercent:      utils.Round(float64(freeAvailable) / float64(totalBytes) * 100),
+			ReadBytesPerSec:  utils.Round(reads[name]),
+			WriteBytesPerSec: utils.Round(writes[name]),
+		})
+	}
+}
+
+// readNetwork fills per-interface rates from PDH
+func (c *nativeCollector) readNetwork(cache *metricsCache, metrics *SystemMetrics, seconds float64) {
+	nics := make(map[string]*NetworkMetrics)
+	nic := func(name string) *NetworkMetrics {
+		if nics[name] == nil {
+			nics[name] = &NetworkMetrics{NIC: name}
+		}
+		return nics[name]
+	}
+
+	for name, value := range c.values("net_rx") {
+		nic(name).BytesReceivedPerSec = utils.Round(value)
+	}
+	for name, value := range c.values("net_tx") {
+		nic(name).BytesSentPerSec = utils.Round(value)
+	}
+	for name, value := range c.values("net_bandwidth") {
+		nic(name).BandwidthBytesPerSec = value / 8 // bits per second
+	}
+
+	// Error and discard counts are raw totals
+	for _, counter := range []struct {
+		key   string
+		field func(*NetworkMetrics) *float64
+	}{
+		{"net_rx_errors", func(n *NetworkMetrics) *float64 { return &n.ErrorsReceivedPerSec }},
+		{"net_tx_errors", func(n *NetworkMetrics) *float64 { return &n.ErrorsSentPerSec }},
+		{"net_rx_discards", func(n *NetworkMetrics) *float64 { return &n.DiscardsReceivedPerSec }},
+		{"net_tx_discards", func(n *NetworkMetrics) *float64 { return &n.DiscardsSentPerSec }},
+	} {
+		for name, value := range c.values(counter.key) {
+			delta, ok := cache.counterDelta(counter.key+"|"+name, value)
+			*counter.field(nic(name)) = utils.Round(rate(delta, ok, seconds))
+		}
+	}
+
+	for _, n := range nics {
+		metrics.Network = append(metrics.Network, *n)
+	}
+	sort.Slice(metrics.Network, func(i, j int) bool { return metrics.Network[i].NIC < metrics.Network[j].NIC })
+}
+
+// readSystem fills uptime, processes, threads and page file usage
+func (c *nativeCollector) readSystem(metrics *SystemMetrics) {
+	ms, _, _ := procGetTickCount64.Call()
+	metrics.UptimeSeconds = int64(ms / 1000)
+
+	for _, v := range c.values("processes") {
+		metrics.Processes += int(v)
+	}
+	for _, v := range c.values("threads") {
+		metrics.Threads += int(v)
+	}
+
+	if metrics.PageFile != nil {
+		for _, usage := range c.values("pagefile") {
+			metrics.PageFile.UsedPercent = utils.Round(usage)
+			metrics.PageFile.UsedGB = utils.Round(metrics.PageFile.TotalGB * usage / 100)
+		}
+	}
+}
+
+// values returns the current formatted value per instance of a counter
+// Unavailable counters and instances without valid data are left out
+func (c *nativeCollector) values(key string) map[string]float64 {
+	counter, ok := c.counters[key]
+	if !ok {
+		return nil
+	}
+
+	var size, count uint32
+	ret, _, _ := procPdhGetFormattedCounterArray.Call(counter, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), 0)
+	if uint32(ret) != pdhMoreData || size == 0 {
+		return nil
+	}
+
+	// The buffer holds the items followed by their names; uint64 keeps it aligned
+	buf := make([]uint64, (size+7)/8)
+	ret, _, _ = procPdhGetFormattedCounterArray.Call(counter, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&buf[0])))
+	if ret != 0 {
+		return nil
+	}
+
+	result := make(map[string]float64, count)
+	for _, item := range unsafe.Slice((*pdhCounterValueItem)(unsafe.Pointer(&buf[0])), count) {
+		if item.status != pdhCStatusValidData && item.status != pdhCStatusNewData {
+			continue
+		}
+		name := windows.UTF16PtrToString(item.name)
+		if key == "disk_read" || key == "disk_write" {
+			if !driveInstance.MatchString(name) {
+				continue
+			}
+		}
+		result[name] = item.value
+	}
+	return result
+}
+
+// readTCPStates counts IPv4 and IPv6 connections per state
+func readTCPStates(metrics *SystemMetrics) {
+	counts := make(map[string]int)
+	countTCPStates(procGetTcpTable, 20, counts)  // MIB_TCPROW
+	countTCPStates(procGetTcp6Table, 52, counts) // MIB_TCP6ROW
+	if len(counts) > 0 {
+		metrics.TCPConnections = counts
+	}
+}
+
+// countTCPStates reads a MIB_TCPTABLE/MIB_TCP6TABLE; each row starts with its state
+func countTCPStates(proc *windows.LazyProc, rowSize uint32, counts map[string]int) {
+	var size uint32
+	if ret, _, _ := proc.Call(0, uintptr(unsafe.Pointer(&size)), 0); ret != errInsufficientBuffer || size < 4 {
+		return
+	}
+
+	// Connections opened between the calls make the buffer too small; skip this sample
+	buf := make([]uint32, (size+3)/4)
+	if ret, _, _ := proc.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0); ret != 0 {
+		return
+	}
+
+	entries := buf[0]
+	stride := rowSize / 4
+	for i := uint32(0); i < entries; i++ {
+		index := 1 + i*stride
+		if index >= uint32(len(buf)) {
+			break
+		}
+		if name, ok := tcpStates[int(buf[index])]; ok {
+			counts[name]++
+		}
+	}
+}
+
+// filetimeTicks converts a FILETIME to 100ns ticks
+func filetimeTicks(ft windows.Filetime) uint64 {
+	return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)
+}
+
+// systemBootTime derives the boot time from the tick count, to the second
+func systemBootTime() (time.Time, error) {
+	ms, _, _ := procGetTickCount64.Call()
+	return time.Now().Add(-time.Duration(ms) * time.Millisecond).Truncate(time.Second), nil
+}
@@ -0,0 +1,138 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// MetricsSource produces the SystemMetrics published by the system_metrics task
+// Counter-based values are rates against the previous Collect
+type MetricsSource interface {
+	// Name identifies the source in logs ("prometheus" or "native")
+	Name() string
+
+	// Collect takes one measurement
+	Collect() (*SystemMetrics, error)
+}
+
+// NewMetricsSource creates the source selected by system_metrics.source
+// With a state_file, counter baselines saved by a previous run are restored
+// and the source saves them after every Collect
+func (e *Executor) NewMetricsSource(cfg *config.SystemMetricsConfig) (MetricsSource, error) {
+	var source MetricsSource
+	switch cfg.Source {
+	case "", config.MetricsSourcePrometheus:
+		source = &prometheusSource{executor: e, url: cfg.ExporterURL, custom: cfg.Custom}
+	case config.MetricsSourceNative:
+		collector, err := newNativeCollector()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize native metrics: %w", err)
+		}
+		source = &nativeSource{executor: e, collector: collector}
+	default:
+		return nil, fmt.Errorf("unknown metrics source: %s", cfg.Source)
+	}
+
+	if cfg.StateFile == "" {
+		return source, nil
+	}
+
+	if err := e.restoreMetricsState(cfg.StateFile, source.Name(), cfg.StateMaxAge, time.Now()); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			e.logger.Info("Metrics state not restored, a new baseline is needed",
+				zap.String("file", cfg.StateFile), zap.String("reason", err.Error()))
+		}
+	} else {
+		e.logger.Info("Metrics baseline restored from state file", zap.String("file", cfg.StateFile))
+	}
+	return &persistedSource{MetricsSource: source, executor: e, path: cfg.StateFile}, nil
+}
+
+// prometheusSource scrapes windows_exporter
+type prometheusSource struct {
+	executor *Executor
+	url      string
+	custom   []config.CustomMetric
+}
+
+// Name returns the source name
+func (p *prometheusSource) Name() string {
+	return config.MetricsSourcePrometheus
+}
+
+// Collect scrapes the exporter
+func (p *prometheusSource) Collect() (*SystemMetrics, error) {
+	return p.executor.ScrapeMetrics(p.url, p.custom)
+}
+
+// nativeSource reads OS counters directly through a platform collector
+// It keeps its counters in the executor's metricsCache like a scrape would
+type nativeSource struct {
+	executor  *Executor
+	collector *nativeCollector
+}
+
+// Name returns the source name
+func (n *nativeSource) Name() string {
+	return config.MetricsSourceNative
+}
+
+// Collect reads the OS counters and rates them against the previous Collect
+func (n *nativeSource) Collect() (*SystemMetrics, error) {
+	e := n.executor
+	now := time.Now()
+
+	e.metricsCache.mu.Lock()
+	metrics, err := n.collector.collect(e.metricsCache, now)
+	if err == nil {
+		e.metricsCache.lastTimestamp = now
+	}
+	e.metricsCache.mu.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read native metrics: %w", err)
+	}
+
+	if err := e.validateMetrics(metrics); err != nil {
+		return nil, fmt.Errorf("invalid metrics: %w", err)
+	}
+	metrics.Timestamp = now.UTC().Format(time.RFC3339)
+
+	e.logger.Debug("Native metrics collected",
+		zap.Float64("cpu_percent", metrics.CPUUsagePercent),
+		zap.Float64("memory_free_gb", metrics.MemoryFreeGB),
+		zap.Int("disk_count", len(metrics.Disks)))
+
+	return metrics, nil
+}
+
+// rate converts a counter delta into a per-second rate
+// Returns 0 without a previous reading
+func rate(delta float64, ok bool, seconds float64) float64 {
+	if !ok || seconds <= 0 {
+		return 0
+	}
+	return delta / seconds
+}
+
+// tcpStates are the MIB_TCP_STATE names windows_exporter uses, indexed by state
+// Native collectors report tcp_connections under the same names on every platform
+var tcpStates = map[int]string{
+	1:  "CLOSED",
+	2:  "LISTENING",
+	3:  "SYN_SENT",
+	4:  "SYN_RECEIVED",
+	5:  "ESTABLISHED",
+	6:  "FIN_WAIT1",
+	7:  "FIN_WAIT2",
+	8:  "CLOSE_WAIT",
+	9:  "CLOSING",
+	10: "LAST_ACK",
+	11: "TIME_WAIT",
+	12: "DELETE_TCB",
+}
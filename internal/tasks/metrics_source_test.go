@@ -0,0 +1,28 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// TestNewMetricsSource tests source selection by config
+func TestNewMetricsSource(t *testing.T) {
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+
+	for _, source := range []string{"", config.MetricsSourcePrometheus} {
+		got, err := e.NewMetricsSource(&config.SystemMetricsConfig{Source: source, ExporterURL: "http://localhost:9182/metrics"})
+		if err != nil {
+			t.Fatalf("NewMetricsSource(%q) error = %v", source, err)
+		}
+		if got.Name() != config.MetricsSourcePrometheus {
+			t.Errorf("NewMetricsSource(%q).Name() = %q, want prometheus", source, got.Name())
+		}
+	}
+
+	if _, err := e.NewMetricsSource(&config.SystemMetricsConfig{Source: "wmi"}); err == nil {
+		t.Error("NewMetricsSource(wmi) error = nil, want unknown source")
+	}
+}
@@ -0,0 +1,155 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// bootTimeTolerance absorbs clock adjustments when comparing boot times;
+// a reboot that fast would also be caught by the counters going backwards
+const bootTimeTolerance = time.Minute
+
+// metricsState is the on-disk form of the metricsCache counter baselines
+type metricsState struct {
+	Source    string                  `json:"source"`
+	Timestamp time.Time               `json:"timestamp"`
+	BootTime  int64                   `json:"boot_time,omitempty"` // Unix seconds; 0 if unknown
+	CPUTotal  float64                 `json:"cpu_total"`
+	CPUIdle   float64                 `json:"cpu_idle"`
+	Disks     map[string]DiskCounters `json:"disks,omitempty"`
+	Counters  map[string]float64      `json:"counters,omitempty"`
+	Custom    map[string]savedCounter `json:"custom,omitempty"`
+}
+
+// savedCounter is the on-disk form of a customCounter
+type savedCounter struct {
+	Value float64   `json:"value"`
+	At    time.Time `json:"at"`
+}
+
+// persistedSource saves the counter baselines after every successful Collect
+// so the first publish after a restart already has rates
+type persistedSource struct {
+	MetricsSource
+	executor *Executor
+	path     string
+	mu       sync.Mutex // Serializes writes from the sampling and publish jobs
+}
+
+// Collect collects from the wrapped source and saves the new baselines
+func (p *persistedSource) Collect() (*SystemMetrics, error) {
+	metrics, err := p.MetricsSource.Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.executor.saveMetricsState(p.path, p.Name()); err != nil {
+		// Keep publishing; only the next restart loses its baseline
+		p.executor.logger.Warn("Failed to save metrics state", zap.Error(err))
+	}
+	return metrics, nil
+}
+
+// HasMetricsBaseline reports whether the next Collect can calculate rates,
+// either from an earlier Collect or from restored state
+func (e *Executor) HasMetricsBaseline() bool {
+	e.metricsCache.mu.RLock()
+	defer e.metricsCache.mu.RUnlock()
+	return !e.metricsCache.lastTimestamp.IsZero()
+}
+
+// saveMetricsState writes the current counter baselines to path
+func (e *Executor) saveMetricsState(path, source string) error {
+	state := metricsState{Source: source}
+	if boot, err := systemBootTime(); err == nil {
+		state.BootTime = boot.Unix()
+	}
+
+	cache := e.metricsCache
+	cache.mu.RLock()
+	state.Timestamp = cache.lastTimestamp
+	state.CPUTotal = cache.lastCPUTotal
+	state.CPUIdle = cache.lastCPUIdle
+	state.Disks = cache.lastDiskMetrics
+	state.Counters = cache.lastCounters
+	state.Custom = make(map[string]savedCounter, len(cache.lastCustom))
+	for key, counter := range cache.lastCustom {
+		state.Custom[key] = savedCounter{Value: counter.value, At: counter.at}
+	}
+	data, err := json.Marshal(state)
+	cache.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create metrics state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write metrics state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace metrics state: %w", err)
+	}
+	return nil
+}
+
+// restoreMetricsState loads the counter baselines saved by source at path
+// State older than maxAge, from another source or from before the last
+// boot is rejected, since rates against it would be wrong
+func (e *Executor) restoreMetricsState(path, source string, maxAge time.Duration, now time.Time) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read metrics state: %w", err)
+	}
+
+	var state metricsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse metrics state: %w", err)
+	}
+
+	if state.Source != source {
+		return fmt.Errorf("state is from the %s source", state.Source)
+	}
+	if state.Timestamp.IsZero() {
+		return fmt.Errorf("state has no baseline")
+	}
+	age := now.Sub(state.Timestamp)
+	if age < 0 || age > maxAge {
+		return fmt.Errorf("state is %v old (max %v)", age.Round(time.Second), maxAge)
+	}
+	if state.BootTime != 0 {
+		if boot, err := systemBootTime(); err == nil {
+			if diff := boot.Sub(time.Unix(state.BootTime, 0)); diff > bootTimeTolerance || diff < -bootTimeTolerance {
+				return fmt.Errorf("system restarted since state was saved")
+			}
+		}
+	}
+
+	cache := e.metricsCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.lastTimestamp = state.Timestamp
+	cache.lastCPUTotal = state.CPUTotal
+	cache.lastCPUIdle = state.CPUIdle
+	for drive, counters := range state.Disks {
+		cache.lastDiskMetrics[drive] = counters
+	}
+	for key, value := range state.Counters {
+		cache.lastCounters[key] = value
+	}
+	for key, counter := range state.Custom {
+		cache.lastCustom[key] = customCounter{value: counter.Value, at: counter.At}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestMetricsStateRoundTrip tests that saved baselines restore into a new executor
+func TestMetricsStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "metrics_state.json")
+	saved := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	e.metricsCache.lastTimestamp = saved
+	e.metricsCache.lastCPUTotal = 1000
+	e.metricsCache.lastCPUIdle = 800
+	e.metricsCache.lastDiskMetrics["C:"] = DiskCounters{ReadBytes: 10, WriteBytes: 20}
+	e.metricsCache.lastCounters["cpu_total|0,0"] = 500
+	e.metricsCache.lastCustom["requests|"] = customCounter{value: 42, at: saved}
+
+	if err := e.saveMetricsState(path, "prometheus"); err != nil {
+		t.Fatalf("saveMetricsState() error = %v", err)
+	}
+
+	restored := NewExecutor(zap.NewNop(), 30*time.Second)
+	if restored.HasMetricsBaseline() {
+		t.Fatal("HasMetricsBaseline() = true before restore")
+	}
+	if err := restored.restoreMetricsState(path, "prometheus", 15*time.Minute, time.Now()); err != nil {
+		t.Fatalf("restoreMetricsState() error = %v", err)
+	}
+	if !restored.HasMetricsBaseline() {
+		t.Error("HasMetricsBaseline() = false after restore")
+	}
+
+	cache := restored.metricsCache
+	if !cache.lastTimestamp.Equal(saved) || cache.lastCPUTotal != 1000 || cache.lastCPUIdle != 800 {
+		t.Errorf("restored CPU baseline = %v %v %v", cache.lastTimestamp, cache.lastCPUTotal, cache.lastCPUIdle)
+	}
+	if cache.lastDiskMetrics["C:"] != (DiskCounters{ReadBytes: 10, WriteBytes: 20}) {
+		t.Errorf("restored disk counters = %+v", cache.lastDiskMetrics["C:"])
+	}
+	if cache.lastCounters["cpu_total|0,0"] != 500 {
+		t.Errorf("restored counters = %v", cache.lastCounters)
+	}
+	if c := cache.lastCustom["requests|"]; c.value != 42 || !c.at.Equal(saved) {
+		t.Errorf("restored custom counter = %+v", c)
+	}
+}
+
+// TestMetricsStateRejected tests that unusable state leaves the cache empty
+func TestMetricsStateRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics_state.json")
+
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	e.metricsCache.lastTimestamp = time.Now().Add(-time.Hour)
+	e.metricsCache.lastCPUTotal = 1000
+	if err := e.saveMetricsState(path, "prometheus"); err != nil {
+		t.Fatalf("saveMetricsState() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		source string
+		maxAge time.Duration
+		now    time.Time
+	}{
+		{name: "missing file", path: path + ".missing", source: "prometheus", maxAge: 2 * time.Hour, now: time.Now()},
+		{name: "other source", path: path, source: "native", maxAge: 2 * time.Hour, now: time.Now()},
+		{name: "too old", path: path, source: "prometheus", maxAge: 15 * time.Minute, now: time.Now()},
+		{name: "from the future", path: path, source: "prometheus", maxAge: 2 * time.Hour, now: time.Now().Add(-2 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := NewExecutor(zap.NewNop(), 30*time.Second)
+			if err := restored.restoreMetricsState(tt.path, tt.source, tt.maxAge, tt.now); err == nil {
+				t.Fatal("restoreMetricsState() error = nil, want rejection")
+			}
+			if restored.HasMetricsBaseline() {
+				t.Error("HasMetricsBaseline() = true after rejected restore")
+			}
+		})
+	}
+
+	restored := NewExecutor(zap.NewNop(), 30*time.Second)
+	if err := restored.restoreMetricsState(path+".missing", "prometheus", time.Hour, time.Now()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("restoreMetricsState(missing) error = %v, want ErrNotExist", err)
+	}
+}
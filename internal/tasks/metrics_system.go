@@ -0,0 +1,258 @@
+package tasks
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"win-agent/internal/utils"
+)
+
+// CPUCoreMetrics is the usage of one logical processor
+type CPUCoreMetrics struct {
+	Core         string  `json:"core"` // windows_exporter core label, e.g. "0,3" (group,number)
+	UsagePercent float64 `json:"usage_percent"`
+}
+
+// MemoryMetrics describes physical memory
+type MemoryMetrics struct {
+	TotalGB     float64 `json:"total_gb"`
+	UsedGB      float64 `json:"used_gb"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// PageFileMetrics describes page file usage across all page files
+type PageFileMetrics struct {
+	TotalGB     float64 `json:"total_gb"`
+	UsedGB      float64 `json:"used_gb"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// NetworkMetrics represents throughput and errors of one network interface
+// Rates require a previous measurement, like disk I/O
+type NetworkMetrics struct {
+	NIC                    string  `json:"nic"`
+	BytesReceivedPerSec    float64 `json:"bytes_received_per_sec"`
+	BytesSentPerSec        float64 `json:"bytes_sent_per_sec"`
+	ErrorsReceivedPerSec   float64 `json:"errors_received_per_sec"`
+	ErrorsSentPerSec       float64 `json:"errors_sent_per_sec"`
+	DiscardsReceivedPerSec float64 `json:"discards_received_per_sec"`
+	DiscardsSentPerSec     float64 `json:"discards_sent_per_sec"`
+	BandwidthBytesPerSec   float64 `json:"bandwidth_bytes_per_sec,omitempty"` // Current link speed
+}
+
+// networkCounters maps windows_net counter families to the field they feed
+var networkCounters = []struct {
+	family string
+	field  func(*NetworkMetrics) *float64
+}{
+	{"windows_net_bytes_received_total", func(n *NetworkMetrics) *float64 { return &n.BytesReceivedPerSec }},
+	{"windows_net_bytes_sent_total", func(n *NetworkMetrics) *float64 { return &n.BytesSentPerSec }},
+	{"windows_net_packets_received_errors_total", func(n *NetworkMetrics) *float64 { return &n.ErrorsReceivedPerSec }},
+	{"windows_net_packets_outbound_errors_total", func(n *NetworkMetrics) *float64 { return &n.ErrorsSentPerSec }},
+	{"windows_net_packets_received_discarded_total", func(n *NetworkMetrics) *float64 { return &n.DiscardsReceivedPerSec }},
+	{"windows_net_packets_outbound_discarded_total", func(n *NetworkMetrics) *float64 { return &n.DiscardsSentPerSec }},
+}
+
+// extractSystemMetrics fills the network, per-core CPU, memory, page file,
+// uptime, process and TCP fields. Counters are rated against the previous
+// scrape through metricsCache.lastCounters
+// Callers must hold e.metricsCache.mu; lastTimestamp is still the previous scrape
+func (e *Executor) extractSystemMetrics(families map[string]*dto.MetricFamily, metrics *SystemMetrics, now time.Time) {
+	cache := e.metricsCache
+
+	var seconds float64
+	if !cache.lastTimestamp.IsZero() {
+		seconds = now.Sub(cache.lastTimestamp).Seconds()
+	}
+
+	metrics.CPUCores = cpuCoreUsage(cache, families["windows_cpu_time_total"])
+	metrics.Network = networkUsage(cache, families, seconds)
+
+	// Physical memory: newer windows_exporter has memory_physical_total_bytes,
+	// older ones only cs_physical_memory_bytes
+	if total, ok := familySum(families, "windows_memory_physical_total_bytes", "windows_cs_physical_memory_bytes"); ok && total > 0 {
+		if available, ok := familySum(families, "windows_memory_available_bytes", "windows_memory_physical_free_bytes"); ok {
+			metrics.Memory = &MemoryMetrics{
+				TotalGB:     utils.Round(total / 1024 / 1024 / 1024),
+				UsedGB:      utils.Round((total - available) / 1024 / 1024 / 1024),
+				UsedPercent: utils.Round((total - available) / total * 100),
+			}
+		}
+	}
+
+	// Page file: pagefile collector (per file) or the older os collector totals
+	if limit, ok := familySum(families, "windows_pagefile_limit_bytes", "windows_os_paging_limit_bytes"); ok && limit > 0 {
+		if free, ok := familySum(families, "windows_pagefile_free_bytes", "windows_os_paging_free_bytes"); ok {
+			metrics.PageFile = &PageFileMetrics{
+				TotalGB:     utils.Round(limit / 1024 / 1024 / 1024),
+				UsedGB:      utils.Round((limit - free) / 1024 / 1024 / 1024),
+				UsedPercent: utils.Round((limit - free) / limit * 100),
+			}
+		}
+	}
+
+	// Both families hold the boot time as a Unix timestamp
+	if boot, ok := familySum(families, "windows_system_boot_time_timestamp_seconds", "windows_system_system_up_time"); ok && boot > 0 {
+		metrics.UptimeSeconds = int64(float64(now.Unix()) - boot)
+	}
+
+	if processes, ok := familySum(families, "windows_system_processes", "windows_os_processes"); ok {
+		metrics.Processes = int(processes)
+	}
+	if threads, ok := familySum(families, "windows_system_threads"); ok {
+		metrics.Threads = int(threads)
+	}
+
+	// TCP connection states, summed over IPv4 and IPv6
+	if family, ok := families["windows_tcp_connections_state_count"]; ok {
+		metrics.TCPConnections = make(map[string]int)
+		for _, m := range family.Metric {
+			if value, ok := seriesValue(m); ok {
+				if state := getLabelValue(m.Label, "state"); state != "" {
+					metrics.TCPConnections[state] += int(value)
+				}
+			}
+		}
+	}
+}
+
+// cpuCoreUsage calculates usage per logical processor from windows_cpu_time_total
+// Same method as the overall CPU usage, per core label
+func cpuCoreUsage(cache *metricsCache, family *dto.MetricFamily) []CPUCoreMetrics {
+	if family == nil {
+		return nil
+	}
+
+	type coreTimes struct{ total, idle float64 }
+	cores := make(map[string]*coreTimes)
+	for _, m := range family.Metric {
+		core := getLabelValue(m.Label, "core")
+		if core == "" || m.Counter == nil {
+			continue
+		}
+		times, ok := cores[core]
+		if !ok {
+			times = &coreTimes{}
+			cores[core] = times
+		}
+		times.total += m.Counter.GetValue()
+		if getLabelValue(m.Label, "mode") == "idle" {
+			times.idle += m.Counter.GetValue()
+		}
+	}
+
+	var result []CPUCoreMetrics
+	for core, times := range cores {
+		totalDelta, ok := cache.counterDelta("cpu_total|"+core, times.total)
+		idleDelta, idleOK := cache.counterDelta("cpu_idle|"+core, times.idle)
+		if !ok || !idleOK || totalDelta <= 0 {
+			continue
+		}
+		result = append(result, CPUCoreMetrics{
+			Core:         core,
+			UsagePercent: utils.Round(100 - idleDelta/totalDelta*100),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return coreLess(result[i].Core, result[j].Core) })
+	return result
+}
+
+// networkUsage calculates per-NIC rates from the windows_net counters
+func networkUsage(cache *metricsCache, families map[string]*dto.MetricFamily, seconds float64) []NetworkMetrics {
+	nics := make(map[string]*NetworkMetrics)
+	nic := func(name string) *NetworkMetrics {
+		if nics[name] == nil {
+			nics[name] = &NetworkMetrics{NIC: name}
+		}
+		return nics[name]
+	}
+
+	for _, counter := range networkCounters {
+		family, ok := families[counter.family]
+		if !ok {
+			continue
+		}
+		for _, m := range family.Metric {
+			name := getLabelValue(m.Label, "nic")
+			if name == "" || m.Counter == nil {
+				continue
+			}
+			n := nic(name)
+			delta, ok := cache.counterDelta(counter.family+"|"+name, m.Counter.GetValue())
+			if ok && seconds > 0 {
+				*counter.field(n) = utils.Round(delta / seconds)
+			}
+		}
+	}
+
+	if family, ok := families["windows_net_current_bandwidth_bytes"]; ok {
+		for _, m := range family.Metric {
+			if name := getLabelValue(m.Label, "nic"); name != "" && m.Gauge != nil {
+				nic(name).BandwidthBytesPerSec = m.Gauge.GetValue()
+			}
+		}
+	}
+
+	if len(nics) == 0 {
+		return nil
+	}
+	result := make([]NetworkMetrics, 0, len(nics))
+	for _, n := range nics {
+		result = append(result, *n)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].NIC < result[j].NIC })
+	return result
+}
+
+// counterDelta returns how much a counter grew since its previous reading
+// and stores the new one; ok is false on the first reading and after a reset
+// Callers must hold c.mu
+func (c *metricsCache) counterDelta(key string, value float64) (float64, bool) {
+	prev, exists := c.lastCounters[key]
+	c.lastCounters[key] = value
+	if !exists || value < prev {
+		return 0, false
+	}
+	return value - prev, true
+}
+
+// familySum returns the sum of all series of the first family present
+func familySum(families map[string]*dto.MetricFamily, names ...string) (float64, bool) {
+	for _, name := range names {
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+		var sum float64
+		found := false
+		for _, m := range family.Metric {
+			if value, ok := seriesValue(m); ok {
+				sum += value
+				found = true
+			}
+		}
+		if found {
+			return sum, true
+		}
+	}
+	return 0, false
+}
+
+// coreLess orders core labels ("group,number") numerically
+func coreLess(a, b string) bool {
+	pa, pb := strings.Split(a, ","), strings.Split(b, ",")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		if errA != nil || errB != nil {
+			return a < b
+		}
+		if na != nb {
+			return na < nb
+		}
+	}
+	return len(pa) < len(pb)
+}
@@ -0,0 +1,127 @@
+package tasks
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// systemExposition renders windows_exporter output with counters scaled by step
+func systemExposition(step int, boot int64) string {
+	return fmt.Sprintf(`# TYPE windows_cpu_time_total counter
+windows_cpu_time_total{core="0,0",mode="idle"} %d
+windows_cpu_time_total{core="0,0",mode="user"} %d
+windows_cpu_time_total{core="0,10",mode="idle"} %d
+windows_cpu_time_total{core="0,10",mode="user"} %d
+windows_cpu_time_total{core="0,2",mode="idle"} %d
+windows_cpu_time_total{core="0,2",mode="user"} %d
+# TYPE windows_memory_available_bytes gauge
+windows_memory_available_bytes 4.294967296e+09
+# TYPE windows_memory_physical_total_bytes gauge
+windows_memory_physical_total_bytes 1.7179869184e+10
+# TYPE windows_pagefile_limit_bytes gauge
+windows_pagefile_limit_bytes{file="C:\\pagefile.sys"} 4.294967296e+09
+# TYPE windows_pagefile_free_bytes gauge
+windows_pagefile_free_bytes{file="C:\\pagefile.sys"} 3.221225472e+09
+# TYPE windows_system_boot_time_timestamp_seconds gauge
+windows_system_boot_time_timestamp_seconds %d
+# TYPE windows_system_processes gauge
+windows_system_processes 142
+# TYPE windows_system_threads gauge
+windows_system_threads 1830
+# TYPE windows_net_bytes_received_total counter
+windows_net_bytes_received_total{nic="Ethernet"} %d
+# TYPE windows_net_bytes_sent_total counter
+windows_net_bytes_sent_total{nic="Ethernet"} %d
+# TYPE windows_net_packets_received_errors_total counter
+windows_net_packets_received_errors_total{nic="Ethernet"} %d
+# TYPE windows_net_current_bandwidth_bytes gauge
+windows_net_current_bandwidth_bytes{nic="Ethernet"} 1.25e+08
+# TYPE windows_tcp_connections_state_count gauge
+windows_tcp_connections_state_count{af="ipv4",state="ESTABLISHED"} 40
+windows_tcp_connections_state_count{af="ipv6",state="ESTABLISHED"} 2
+windows_tcp_connections_state_count{af="ipv4",state="TIME_WAIT"} 7
+`,
+		100*step, 100*step, // core 0,0: 50% busy
+		190*step, 10*step, // core 0,10: 5% busy
+		25*step, 75*step, // core 0,2: 75% busy
+		boot,
+		1000000*step, 200000*step, 3*step)
+}
+
+// TestExtendedSystemMetrics tests network, per-core CPU, memory, paging, uptime and TCP parsing
+func TestExtendedSystemMetrics(t *testing.T) {
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	boot := time.Now().Add(-2 * time.Hour).Unix()
+
+	first, err := e.parsePrometheusMetrics(strings.NewReader(systemExposition(1, boot)), nil)
+	if err != nil {
+		t.Fatalf("first parse error = %v", err)
+	}
+	if first.CPUCores != nil {
+		t.Errorf("CPUCores on first scrape = %+v, want none (baseline only)", first.CPUCores)
+	}
+	if len(first.Network) != 1 || first.Network[0].BytesReceivedPerSec != 0 {
+		t.Errorf("Network on first scrape = %+v, want Ethernet without rates", first.Network)
+	}
+
+	wantMemory := MemoryMetrics{TotalGB: 16, UsedGB: 12, UsedPercent: 75}
+	if first.Memory == nil || *first.Memory != wantMemory {
+		t.Errorf("Memory = %+v, want %+v", first.Memory, wantMemory)
+	}
+	wantPageFile := PageFileMetrics{TotalGB: 4, UsedGB: 1, UsedPercent: 25}
+	if first.PageFile == nil || *first.PageFile != wantPageFile {
+		t.Errorf("PageFile = %+v, want %+v", first.PageFile, wantPageFile)
+	}
+	if first.UptimeSeconds < 7199 || first.UptimeSeconds > 7260 {
+		t.Errorf("UptimeSeconds = %d, want about 7200", first.UptimeSeconds)
+	}
+	if first.Processes != 142 || first.Threads != 1830 {
+		t.Errorf("Processes/Threads = %d/%d, want 142/1830", first.Processes, first.Threads)
+	}
+	if want := map[string]int{"ESTABLISHED": 42, "TIME_WAIT": 7}; !reflect.DeepEqual(first.TCPConnections, want) {
+		t.Errorf("TCPConnections = %v, want %v", first.TCPConnections, want)
+	}
+
+	// Pretend the first scrape happened 10 seconds ago
+	e.metricsCache.lastTimestamp = time.Now().Add(-10 * time.Second)
+	second, err := e.parsePrometheusMetrics(strings.NewReader(systemExposition(2, boot)), nil)
+	if err != nil {
+		t.Fatalf("second parse error = %v", err)
+	}
+
+	wantCores := []CPUCoreMetrics{
+		{Core: "0,0", UsagePercent: 50},
+		{Core: "0,2", UsagePercent: 75},
+		{Core: "0,10", UsagePercent: 5},
+	}
+	if !reflect.DeepEqual(second.CPUCores, wantCores) {
+		t.Errorf("CPUCores = %+v, want %+v", second.CPUCores, wantCores)
+	}
+
+	if len(second.Network) != 1 {
+		t.Fatalf("Network = %+v, want one NIC", second.Network)
+	}
+	nic := second.Network[0]
+	if nic.NIC != "Ethernet" || nic.BandwidthBytesPerSec != 1.25e8 {
+		t.Errorf("NIC = %+v", nic)
+	}
+	// ~10s between scrapes; allow for test timing
+	if nic.BytesReceivedPerSec < 99000 || nic.BytesReceivedPerSec > 100100 {
+		t.Errorf("BytesReceivedPerSec = %v, want about 100000", nic.BytesReceivedPerSec)
+	}
+	if nic.BytesSentPerSec < 19800 || nic.BytesSentPerSec > 20020 {
+		t.Errorf("BytesSentPerSec = %v, want about 20000", nic.BytesSentPerSec)
+	}
+}
+
+// TestCoreLess tests numeric ordering of core labels
+func TestCoreLess(t *testing.T) {
+	if !coreLess("0,2", "0,10") || coreLess("0,10", "0,2") || !coreLess("0,63", "1,0") {
+		t.Error("coreLess does not order cores numerically")
+	}
+}
@@ -0,0 +1,254 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Process list sort orders
+const (
+	ProcessSortCPU       = "cpu"
+	ProcessSortMemory    = "memory"
+	ProcessSortPID       = "pid"
+	ProcessSortName      = "name"
+	ProcessSortStartTime = "start_time"
+)
+
+// processCPUSample is how long CPU time is measured for cpu_percent;
+// a variable so tests can shorten it
+var processCPUSample = time.Second
+
+// ProcessInfo is one process in a cmd.process.list reply
+type ProcessInfo struct {
+	PID         uint32  `json:"pid"`
+	Name        string  `json:"name"`                   // Executable name, e.g. "sqlservr.exe"
+	User        string  `json:"user,omitempty"`         // Empty when it cannot be read
+	CPUPercent  float64 `json:"cpu_percent"`            // Share of all cores over the sample, 0-100
+	RSSBytes    uint64  `json:"rss_bytes"`              // Working set on Windows
+	StartTime   string  `json:"start_time,omitempty"`   // RFC3339
+	CommandLine string  `json:"command_line,omitempty"` // Empty when it cannot be read
+}
+
+// ProcessListOptions selects and orders processes for ListProcesses
+type ProcessListOptions struct {
+	SortBy string // ProcessSort* constants; cpu when empty
+	Top    int    // Keep only the first Top processes after sorting; 0 keeps all
+	Name   string // Executable name or glob pattern (case-insensitive)
+	User   string // Exact user name (case-insensitive)
+}
+
+// ProcessList is the result of ListProcesses
+type ProcessList struct {
+	Processes []ProcessInfo `json:"processes"`
+	Matched   int           `json:"matched"` // Processes that passed the filters, before top
+	Total     int           `json:"total"`   // All processes on the system
+	SampleMs  int64         `json:"sample_ms"`
+}
+
+// processSample is one process from a platform snapshot
+// User and command line are read separately, only for processes that are returned
+type processSample struct {
+	PID     uint32
+	Name    string
+	Path    string        // Full executable path; empty when it cannot be read
+	CPUTime time.Duration // User plus kernel time since the process started
+	RSS     uint64
+	Start   time.Time // Zero when it cannot be read
+}
+
+// ListProcesses samples the running processes twice, processCPUSample apart,
+// to calculate CPU usage, then filters, sorts and trims them
+func (e *Executor) ListProcesses(opts ProcessListOptions) (*ProcessList, error) {
+	switch opts.SortBy {
+	case "":
+		opts.SortBy = ProcessSortCPU
+	case ProcessSortCPU, ProcessSortMemory, ProcessSortPID, ProcessSortName, ProcessSortStartTime:
+	default:
+		return nil, fmt.Errorf("invalid sort: %s (must be cpu, memory, pid, name, or start_time)", opts.SortBy)
+	}
+	if opts.Top < 0 {
+		return nil, fmt.Errorf("top cannot be negative")
+	}
+	if opts.Name != "" {
+		if _, err := path.Match(opts.Name, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", opts.Name, err)
+		}
+	}
+
+	before, err := listProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	start := time.Now()
+	time.Sleep(processCPUSample)
+	after, err := listProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	elapsed := time.Since(start)
+
+	cpuTimes := make(map[uint32]processSample, len(before))
+	for _, p := range before {
+		cpuTimes[p.PID] = p
+	}
+
+	var processes []ProcessInfo
+	for _, p := range after {
+		if opts.Name != "" && !matchProcessName(opts.Name, p.Name) {
+			continue
+		}
+		info := ProcessInfo{PID: p.PID, Name: p.Name, RSSBytes: p.RSS}
+		// A PID seen in both snapshots with the same start is the same process
+		if prev, ok := cpuTimes[p.PID]; ok && prev.Start.Equal(p.Start) && p.CPUTime >= prev.CPUTime {
+			info.CPUPercent = cpuPercent(p.CPUTime-prev.CPUTime, elapsed)
+		}
+		if !p.Start.IsZero() {
+			info.StartTime = p.Start.UTC().Format(time.RFC3339)
+		}
+		if opts.User != "" {
+			e.fillProcessDetails(&info)
+			if !strings.EqualFold(info.User, opts.User) {
+				continue
+			}
+		}
+		processes = append(processes, info)
+	}
+
+	sortProcesses(processes, opts.SortBy)
+	matched := len(processes)
+	if opts.Top > 0 && len(processes) > opts.Top {
+		processes = processes[:opts.Top]
+	}
+	if opts.User == "" {
+		for i := range processes {
+			e.fillProcessDetails(&processes[i])
+		}
+	}
+	if processes == nil {
+		processes = []ProcessInfo{}
+	}
+
+	return &ProcessList{
+		Processes: processes,
+		Matched:   matched,
+		Total:     len(after),
+		SampleMs:  elapsed.Milliseconds(),
+	}, nil
+}
+
+// KillProcesses terminates a process by PID, or every process with an
+// executable name, if the name is in allowedProcesses
+// Exactly one of pid and name must be set; the agent never kills itself
+func (e *Executor) KillProcesses(pid uint32, name string, allowedProcesses []string) ([]uint32, error) {
+	if (pid == 0) == (name == "") {
+		return nil, fmt.Errorf("exactly one of pid or name is required")
+	}
+	if name != "" && !isProcessAllowed(name, allowedProcesses) {
+		return nil, fmt.Errorf("process not in allowed list: %s", name)
+	}
+
+	processes, err := listProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var targets []processSample
+	for _, p := range processes {
+		if (pid != 0 && p.PID == pid) || (name != "" && strings.EqualFold(p.Name, name)) {
+			targets = append(targets, p)
+		}
+	}
+	if len(targets) == 0 {
+		if pid != 0 {
+			return nil, fmt.Errorf("process %d not found", pid)
+		}
+		return nil, fmt.Errorf("no running process named %s", name)
+	}
+
+	var killed []uint32
+	for _, p := range targets {
+		// A PID must name an allowed executable too
+		if !isProcessAllowed(p.Name, allowedProcesses) {
+			return killed, fmt.Errorf("process not in allowed list: %s (pid %d)", p.Name, p.PID)
+		}
+		if int(p.PID) == os.Getpid() {
+			return killed, fmt.Errorf("refusing to kill the agent itself (pid %d)", p.PID)
+		}
+		if err := killProcess(p); err != nil {
+			return killed, fmt.Errorf("failed to kill %s (pid %d): %w", p.Name, p.PID, err)
+		}
+		killed = append(killed, p.PID)
+		e.logger.Info("Killed process", zap.String("name", p.Name), zap.Uint32("pid", p.PID))
+	}
+	return killed, nil
+}
+
+// fillProcessDetails adds the user and command line; processes that cannot
+// be opened keep them empty
+func (e *Executor) fillProcessDetails(info *ProcessInfo) {
+	user, commandLine, err := processDetails(info.PID)
+	if err != nil {
+		e.logger.Debug("Failed to read process details", zap.Uint32("pid", info.PID), zap.Error(err))
+	}
+	info.User, info.CommandLine = user, commandLine
+}
+
+// cpuPercent converts CPU time used over elapsed to a share of all cores
+func cpuPercent(used, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	percent := float64(used) / float64(elapsed) / float64(runtime.NumCPU()) * 100
+	return float64(int64(percent*100+0.5)) / 100 // Two decimals
+}
+
+// sortProcesses orders processes; cpu, memory and start_time put the largest
+// or newest first, pid and name sort ascending
+func sortProcesses(processes []ProcessInfo, sortBy string) {
+	sort.SliceStable(processes, func(i, j int) bool {
+		a, b := processes[i], processes[j]
+		switch sortBy {
+		case ProcessSortCPU:
+			if a.CPUPercent != b.CPUPercent {
+				return a.CPUPercent > b.CPUPercent
+			}
+		case ProcessSortMemory:
+			if a.RSSBytes != b.RSSBytes {
+				return a.RSSBytes > b.RSSBytes
+			}
+		case ProcessSortName:
+			if !strings.EqualFold(a.Name, b.Name) {
+				return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+			}
+		case ProcessSortStartTime:
+			if a.StartTime != b.StartTime {
+				return a.StartTime > b.StartTime
+			}
+		}
+		return a.PID < b.PID
+	})
+}
+
+// matchProcessName matches an executable name against a name or glob pattern
+func matchProcessName(pattern, name string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return err == nil && matched
+}
+
+// isProcessAllowed checks if an executable name is in the allowed list
+// Names compare case-insensitively, as on Windows
+func isProcessAllowed(name string, allowedProcesses []string) bool {
+	for _, allowed := range allowedProcesses {
+		if strings.EqualFold(name, allowed) {
+			return true
+		}
+	}
+	return false
+}
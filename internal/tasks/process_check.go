@@ -0,0 +1,214 @@
+package tasks
+
+import (
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"win-agent/internal/config"
+)
+
+// Process check statuses
+const (
+	ProcessStatusRunning  = "running"
+	ProcessStatusDegraded = "degraded" // Running, but fewer than min_instances
+	ProcessStatusMissing  = "missing"
+)
+
+// Process event types published on events.process
+const (
+	ProcessEventAppeared    = "process_appeared"    // No instances before, at least one now
+	ProcessEventDisappeared = "process_disappeared" // Instances before, none now
+	ProcessEventRestarted   = "process_restarted"   // Still running, but an instance was replaced by a new PID
+	ProcessEventScript      = "process_script"      // The on_missing script ran
+)
+
+// ProcessCheckStatus is one monitored process in a process_check report
+type ProcessCheckStatus struct {
+	Name          string   `json:"name"`   // Configured name or path
+	Status        string   `json:"status"` // ProcessStatus* constants
+	Instances     int      `json:"instances"`
+	MinInstances  int      `json:"min_instances"`
+	PIDs          []uint32 `json:"pids,omitempty"`
+	UptimeSeconds int64    `json:"uptime_seconds,omitempty"` // Of the oldest instance
+	CPUPercent    float64  `json:"cpu_percent"`              // All instances, averaged since the previous check
+	RSSBytes      uint64   `json:"rss_bytes"`                // All instances
+}
+
+// ProcessReport is the process_check telemetry payload
+// On failure Processes is empty and Status/Error describe what went wrong
+type ProcessReport struct {
+	Processes []ProcessCheckStatus `json:"processes,omitempty"`
+	Status    string               `json:"status,omitempty"` // "error" when processes could not be listed
+	Error     string               `json:"error,omitempty"`
+	Timestamp string               `json:"timestamp"`
+}
+
+// ProcessScriptResult is the outcome of an on_missing script
+type ProcessScriptResult struct {
+	Script   string `json:"script"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ProcessEvent is published to {prefix}.{device_id}.events.process
+type ProcessEvent struct {
+	Event        string               `json:"event"` // ProcessEvent* constants
+	Name         string               `json:"name"`
+	PIDs         []uint32             `json:"pids,omitempty"`
+	PreviousPIDs []uint32             `json:"previous_pids,omitempty"`
+	Instances    int                  `json:"instances"`
+	Script       *ProcessScriptResult `json:"script,omitempty"` // process_script only
+	Timestamp    string               `json:"timestamp"`
+}
+
+// CreateProcessError creates a report for a failed process check
+func CreateProcessError(err error) *ProcessReport {
+	return &ProcessReport{
+		Status:    "error",
+		Error:     err.Error(),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// ProcessMonitor tracks the process_check processes between checks, to
+// report CPU usage and publish transitions
+type ProcessMonitor struct {
+	mu        sync.Mutex
+	watches   []config.ProcessWatch
+	samples   map[uint32]processSample // Matched processes of the last check
+	lastCheck time.Time
+	pids      map[string][]uint32 // PIDs per process of the last check (nil before the first)
+	scriptRan map[string]bool     // on_missing already run for the current absence
+}
+
+// NewProcessMonitor creates a monitor for the process_check processes
+func NewProcessMonitor(watches []config.ProcessWatch) *ProcessMonitor {
+	return &ProcessMonitor{
+		watches:   watches,
+		scriptRan: make(map[string]bool),
+	}
+}
+
+// Check lists the running processes and returns the report, the transitions
+// since the previous check, and the processes whose on_missing script is due
+func (m *ProcessMonitor) Check(now time.Time) (*ProcessReport, []ProcessEvent, []config.ProcessWatch, error) {
+	samples, err := listProcesses()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	report, events, due := m.observe(samples, now)
+	return report, events, due, nil
+}
+
+// observe matches a process snapshot against the watches
+// The first check produces no events; the report covers it
+func (m *ProcessMonitor) observe(samples []processSample, now time.Time) (*ProcessReport, []ProcessEvent, []config.ProcessWatch) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	timestamp := now.UTC().Format(time.RFC3339)
+	elapsed := now.Sub(m.lastCheck)
+	matchedSamples := make(map[uint32]processSample)
+	pids := make(map[string][]uint32, len(m.watches))
+
+	report := &ProcessReport{Processes: make([]ProcessCheckStatus, 0, len(m.watches)), Timestamp: timestamp}
+	var events []ProcessEvent
+	var due []config.ProcessWatch
+
+	for _, watch := range m.watches {
+		label := watch.Label()
+		status := ProcessCheckStatus{Name: label, MinInstances: max(watch.MinInstances, 1)}
+
+		var oldest time.Time
+		for _, p := range samples {
+			if !watchMatches(watch, p) {
+				continue
+			}
+			matchedSamples[p.PID] = p
+			status.PIDs = append(status.PIDs, p.PID)
+			status.RSSBytes += p.RSS
+			// A PID seen in the last check with the same start is the same process
+			if prev, ok := m.samples[p.PID]; ok && prev.Start.Equal(p.Start) && p.CPUTime >= prev.CPUTime {
+				status.CPUPercent += cpuPercent(p.CPUTime-prev.CPUTime, elapsed)
+			}
+			if !p.Start.IsZero() && (oldest.IsZero() || p.Start.Before(oldest)) {
+				oldest = p.Start
+			}
+		}
+		slices.Sort(status.PIDs)
+		status.Instances = len(status.PIDs)
+		status.CPUPercent = float64(int64(status.CPUPercent*100+0.5)) / 100
+		if !oldest.IsZero() && now.After(oldest) {
+			status.UptimeSeconds = int64(now.Sub(oldest).Seconds())
+		}
+
+		switch {
+		case status.Instances == 0:
+			status.Status = ProcessStatusMissing
+			if watch.OnMissing != "" && !m.scriptRan[label] {
+				m.scriptRan[label] = true
+				due = append(due, watch)
+			}
+		case status.Instances < status.MinInstances:
+			status.Status = ProcessStatusDegraded
+			delete(m.scriptRan, label)
+		default:
+			status.Status = ProcessStatusRunning
+			delete(m.scriptRan, label)
+		}
+
+		if m.pids != nil {
+			if event, ok := processTransition(label, m.pids[label], status.PIDs); ok {
+				event.Timestamp = timestamp
+				events = append(events, event)
+			}
+		}
+		pids[label] = status.PIDs
+		report.Processes = append(report.Processes, status)
+	}
+
+	m.samples = matchedSamples
+	m.pids = pids
+	m.lastCheck = now
+	return report, events, due
+}
+
+// processTransition compares the PIDs of one process across two checks
+func processTransition(name string, previous, current []uint32) (ProcessEvent, bool) {
+	event := ProcessEvent{Name: name, PIDs: current, PreviousPIDs: previous, Instances: len(current)}
+	switch {
+	case len(previous) == 0 && len(current) > 0:
+		event.Event = ProcessEventAppeared
+	case len(previous) > 0 && len(current) == 0:
+		event.Event = ProcessEventDisappeared
+	case len(previous) > 0 && slices.ContainsFunc(previous, func(pid uint32) bool {
+		return !slices.Contains(current, pid)
+	}) && slices.ContainsFunc(current, func(pid uint32) bool {
+		return !slices.Contains(previous, pid)
+	}):
+		// An instance exited and a new one started; a plain scale up or down is not a restart
+		event.Event = ProcessEventRestarted
+	default:
+		return ProcessEvent{}, false
+	}
+	return event, true
+}
+
+// watchMatches checks a process against a name pattern or full path
+// Paths compare case-insensitively on Windows
+func watchMatches(watch config.ProcessWatch, p processSample) bool {
+	if watch.Name != "" {
+		return matchProcessName(watch.Name, p.Name)
+	}
+	if p.Path == "" {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Clean(watch.Path), filepath.Clean(p.Path))
+	}
+	return filepath.Clean(watch.Path) == p.Path
+}
@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"win-agent/internal/config"
+)
+
+// TestProcessMonitorObserve tests status, CPU and uptime reporting, transitions
+// and on_missing scheduling across checks
+func TestProcessMonitorObserve(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	monitor := NewProcessMonitor([]config.ProcessWatch{
+		{Name: "worker*.exe", MinInstances: 2},
+		{Path: "/opt/sync/sync.exe", OnMissing: "start-sync.ps1"},
+	})
+
+	// First check: one worker, sync missing; no events, script due
+	now := start.Add(time.Hour)
+	report, events, due := monitor.observe([]processSample{
+		{PID: 10, Name: "Worker1.exe", CPUTime: time.Second, RSS: 100, Start: start},
+		{PID: 11, Name: "other.exe", Path: "/opt/other.exe"},
+	}, now)
+	if len(events) != 0 {
+		t.Errorf("first check events = %+v, want none", events)
+	}
+	if len(due) != 1 || due[0].OnMissing != "start-sync.ps1" {
+		t.Errorf("first check due = %+v, want start-sync.ps1", due)
+	}
+	worker, sync := report.Processes[0], report.Processes[1]
+	if worker.Status != ProcessStatusDegraded || worker.Instances != 1 || worker.UptimeSeconds != 3600 || worker.RSSBytes != 100 {
+		t.Errorf("worker = %+v", worker)
+	}
+	if sync.Name != "/opt/sync/sync.exe" || sync.Status != ProcessStatusMissing || sync.MinInstances != 1 {
+		t.Errorf("sync = %+v", sync)
+	}
+
+	// Second check: worker 10 replaced by 12 and 13, sync appears
+	now = now.Add(time.Minute)
+	report, events, due = monitor.observe([]processSample{
+		{PID: 12, Name: "worker1.exe", RSS: 100, Start: now},
+		{PID: 13, Name: "worker2.exe", RSS: 50, Start: now},
+		{PID: 20, Name: "sync.exe", Path: "/opt/sync/sync.exe", CPUTime: time.Second, Start: start},
+	}, now)
+	if len(due) != 0 {
+		t.Errorf("second check due = %+v, want none", due)
+	}
+	if report.Processes[0].Status != ProcessStatusRunning || report.Processes[0].RSSBytes != 150 {
+		t.Errorf("worker = %+v", report.Processes[0])
+	}
+	wantEvents := []ProcessEvent{
+		{Event: ProcessEventRestarted, Name: "worker*.exe", PIDs: []uint32{12, 13}, PreviousPIDs: []uint32{10}, Instances: 2},
+		{Event: ProcessEventAppeared, Name: "/opt/sync/sync.exe", PIDs: []uint32{20}, Instances: 1},
+	}
+	for i := range events {
+		events[i].Timestamp = ""
+	}
+	if !reflect.DeepEqual(events, wantEvents) {
+		t.Errorf("second check events = %+v, want %+v", events, wantEvents)
+	}
+
+	// Third check: sync used 6s of CPU in a minute, one worker exits
+	now = now.Add(time.Minute)
+	report, events, _ = monitor.observe([]processSample{
+		{PID: 12, Name: "worker1.exe", Start: start.Add(time.Hour + time.Minute)},
+		{PID: 20, Name: "sync.exe", Path: "/opt/sync/sync.exe", CPUTime: 7 * time.Second, Start: start},
+	}, now)
+	if len(events) != 0 {
+		t.Errorf("scale down events = %+v, want none", events)
+	}
+	if want := cpuPercent(6*time.Second, time.Minute); report.Processes[1].CPUPercent != want {
+		t.Errorf("sync cpu = %v, want %v", report.Processes[1].CPUPercent, want)
+	}
+
+	// Fourth and fifth checks: sync disappears; the script runs once per absence
+	for i, wantDue := range []int{1, 0} {
+		now = now.Add(time.Minute)
+		_, events, due = monitor.observe([]processSample{{PID: 12, Name: "worker1.exe"}}, now)
+		if len(due) != wantDue {
+			t.Errorf("missing check %d due = %+v, want %d", i, due, wantDue)
+		}
+		if wantEvents := 1 - i; len(events) != wantEvents || (wantEvents == 1 && events[0].Event != ProcessEventDisappeared) {
+			t.Errorf("missing check %d events = %+v", i, events)
+		}
+	}
+}
+
+// TestWatchMatches tests name patterns and path matching
+func TestWatchMatches(t *testing.T) {
+	sample := processSample{Name: "Sync.exe", Path: "/opt/Sync.exe"}
+	tests := []struct {
+		watch config.ProcessWatch
+		want  bool
+	}{
+		{config.ProcessWatch{Name: "sync.exe"}, true},
+		{config.ProcessWatch{Name: "s*.exe"}, true},
+		{config.ProcessWatch{Name: "other.exe"}, false},
+		{config.ProcessWatch{Path: "/opt/Sync.exe"}, true},
+		{config.ProcessWatch{Path: "/opt/./Sync.exe"}, true},
+		{config.ProcessWatch{Path: "/opt/sync.exe"}, runtime.GOOS == "windows"},
+		{config.ProcessWatch{Path: "/usr/Sync.exe"}, false},
+	}
+	for _, tt := range tests {
+		if got := watchMatches(tt.watch, sample); got != tt.want {
+			t.Errorf("watchMatches(%+v) = %v, want %v", tt.watch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+//go:build linux
+
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc/[pid]/stat
+// It is 100 on every mainstream architecture
+const clockTicks = 100
+
+// procRoot is the procfs mount read for processes
+const procRoot = "/proc"
+
+// userNames caches uid to user name lookups
+var userNames sync.Map
+
+// listProcesses reads every process from /proc
+// Processes that exit while being read are skipped
+func listProcesses() ([]processSample, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	bootTime, err := systemBootTime()
+	if err != nil {
+		return nil, err
+	}
+	pageSize := uint64(os.Getpagesize())
+
+	var processes []processSample
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(procRoot, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			continue
+		}
+		stat, err := parseProcStat(string(data))
+		if err != nil {
+			continue
+		}
+
+		// comm is truncated to 15 characters; the executable is exact
+		name, exePath := stat.comm, ""
+		if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+			exePath = strings.TrimSuffix(exe, " (deleted)")
+			name = filepath.Base(exePath)
+		}
+
+		processes = append(processes, processSample{
+			PID:     uint32(pid),
+			Name:    name,
+			Path:    exePath,
+			CPUTime: time.Duration(stat.utime+stat.stime) * time.Second / clockTicks,
+			RSS:     stat.rssPages * pageSize,
+			Start:   bootTime.Add(time.Duration(stat.startTime) * time.Second / clockTicks),
+		})
+	}
+	return processes, nil
+}
+
+// procStat holds the /proc/[pid]/stat fields the agent uses
+type procStat struct {
+	comm      string
+	utime     uint64
+	stime     uint64
+	startTime uint64
+	rssPages  uint64
+}
+
+// parseProcStat parses /proc/[pid]/stat
+// comm may contain spaces and parentheses, so fields are counted from the last ')'
+func parseProcStat(data string) (procStat, error) {
+	open, end := strings.IndexByte(data, '('), strings.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procStat{}, fmt.Errorf("malformed stat")
+	}
+	// Fields after comm, starting with state (field 3)
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("stat has %d fields after comm", len(fields))
+	}
+
+	stat := procStat{comm: data[open+1 : end]}
+	values := []*uint64{&stat.utime, &stat.stime, &stat.startTime, &stat.rssPages}
+	for i, field := range []int{14, 15, 22, 24} {
+		v, err := strconv.ParseInt(fields[field-3], 10, 64)
+		if err != nil {
+			return procStat{}, fmt.Errorf("stat field %d: %w", field, err)
+		}
+		*values[i] = uint64(max(v, 0))
+	}
+	return stat, nil
+}
+
+// processDetails returns the owner and command line of a process
+func processDetails(pid uint32) (string, string, error) {
+	dir := filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10))
+
+	status, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return "", "", err
+	}
+	var owner string
+	for _, line := range strings.Split(string(status), "\n") {
+		if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				owner = userName(fields[0])
+			}
+			break
+		}
+	}
+
+	// Arguments are NUL separated; kernel threads have none
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return owner, "", err
+	}
+	return owner, strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " ")), nil
+}
+
+// userName resolves a uid, falling back to the number
+func userName(uid string) string {
+	if name, ok := userNames.Load(uid); ok {
+		return name.(string)
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	userNames.Store(uid, name)
+	return name
+}
+
+// killProcess sends SIGKILL, matching TerminateProcess on Windows
+// The process is pinned with a pidfd before its start time is checked, so a
+// PID reused since the listing is never signalled; kernels without pidfds
+// (before 5.3) check and then kill by PID
+func killProcess(p processSample) error {
+	pidfd, err := unix.PidfdOpen(int(p.PID), 0)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+		if err := checkProcessStart(p); err != nil {
+			return err
+		}
+		return syscall.Kill(int(p.PID), syscall.SIGKILL)
+	}
+	if err != nil {
+		return err
+	}
+	defer unix.Close(pidfd)
+
+	if err := checkProcessStart(p); err != nil {
+		return err
+	}
+	return unix.PidfdSendSignal(pidfd, unix.SIGKILL, nil, 0)
+}
+
+// checkProcessStart verifies that a PID still belongs to the process that was
+// listed, by its start time in /proc/[pid]/stat
+func checkProcessStart(p processSample) error {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.FormatUint(uint64(p.PID), 10), "stat"))
+	if err != nil {
+		return err
+	}
+	stat, err := parseProcStat(string(data))
+	if err != nil {
+		return err
+	}
+	bootTime, err := systemBootTime()
+	if err != nil {
+		return err
+	}
+	if start := bootTime.Add(time.Duration(stat.startTime) * time.Second / clockTicks); !start.Equal(p.Start) {
+		return fmt.Errorf("pid %d now belongs to another process", p.PID)
+	}
+	return nil
+}
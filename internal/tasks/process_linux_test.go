@@ -0,0 +1,170 @@
+//go:build linux
+
+package tasks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestParseProcStat tests stat parsing with a comm containing spaces and parentheses
+func TestParseProcStat(t *testing.T) {
+	data := "1234 (my (odd) proc) S 1 1234 1234 0 -1 4194560 500 0 0 0 250 50 0 0 20 0 4 0 9000 123456789 2048 18446744073709551615 0 0 0 0 0 0 0 4096 0 0 0 0 17 3 0 0 0 0 0"
+	stat, err := parseProcStat(data)
+	if err != nil {
+		t.Fatalf("parseProcStat() error = %v", err)
+	}
+	want := procStat{comm: "my (odd) proc", utime: 250, stime: 50, startTime: 9000, rssPages: 2048}
+	if stat != want {
+		t.Errorf("parseProcStat() = %+v, want %+v", stat, want)
+	}
+
+	if _, err := parseProcStat("1234 (short) S 1 2"); err == nil {
+		t.Error("parseProcStat() accepted a truncated stat")
+	}
+}
+
+// TestListProcessesLinux tests listing against the real procfs, filtered to the test binary
+func TestListProcessesLinux(t *testing.T) {
+	prev := processCPUSample
+	processCPUSample = 10 * time.Millisecond
+	t.Cleanup(func() { processCPUSample = prev })
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Skipf("os.Executable: %v", err)
+	}
+	executor := NewExecutor(zap.NewNop(), 0)
+
+	list, err := executor.ListProcesses(ProcessListOptions{Name: filepath.Base(self), SortBy: ProcessSortPID})
+	if err != nil {
+		t.Fatalf("ListProcesses() error = %v", err)
+	}
+	var found *ProcessInfo
+	for i := range list.Processes {
+		if int(list.Processes[i].PID) == os.Getpid() {
+			found = &list.Processes[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("own process %d not in %+v", os.Getpid(), list.Processes)
+	}
+	if found.RSSBytes == 0 || found.StartTime == "" || found.User == "" || !strings.Contains(found.CommandLine, filepath.Base(self)) {
+		t.Errorf("own process = %+v", found)
+	}
+	if list.Total < list.Matched || list.Matched < 1 {
+		t.Errorf("total = %d, matched = %d", list.Total, list.Matched)
+	}
+
+	// Top trims after sorting
+	list, err = executor.ListProcesses(ProcessListOptions{Top: 1})
+	if err != nil || len(list.Processes) != 1 {
+		t.Errorf("ListProcesses(top 1) = %+v, %v", list, err)
+	}
+}
+
+// TestKillProcessesLinux tests killing a child process by PID through the allow list
+func TestKillProcessesLinux(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not available")
+	}
+	cmd := exec.Command(sleep, "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start sleep: %v", err)
+	}
+	defer cmd.Process.Kill()
+	pid := uint32(cmd.Process.Pid)
+	executor := NewExecutor(zap.NewNop(), 0)
+
+	if _, err := executor.KillProcesses(pid, "", []string{"other"}); err == nil || !strings.Contains(err.Error(), "not in allowed list") {
+		t.Fatalf("KillProcesses() error = %v, want not allowed", err)
+	}
+
+	// The executable may be a multi-call binary (e.g. busybox or coreutils)
+	name := processName(t, pid)
+	killed, err := executor.KillProcesses(pid, "", []string{name})
+	if err != nil || len(killed) != 1 || killed[0] != pid {
+		t.Fatalf("KillProcesses() = %v, %v", killed, err)
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Error("sleep exited cleanly, want killed")
+	}
+
+	if _, err := executor.KillProcesses(uint32(os.Getpid()), "", []string{processName(t, uint32(os.Getpid()))}); err == nil || !strings.Contains(err.Error(), "agent itself") {
+		t.Errorf("KillProcesses(self) error = %v", err)
+	}
+}
+
+// TestKillProcessReusedPID tests that a PID whose start time changed since
+// the listing is not killed
+func TestKillProcessReusedPID(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not available")
+	}
+	cmd := exec.Command(sleep, "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start sleep: %v", err)
+	}
+	defer cmd.Process.Kill()
+	pid := uint32(cmd.Process.Pid)
+
+	var listed processSample
+	processes, err := listProcesses()
+	if err != nil {
+		t.Fatalf("listProcesses() error = %v", err)
+	}
+	for _, p := range processes {
+		if p.PID == pid {
+			listed = p
+		}
+	}
+
+	// As if the listed process had exited and the PID been reused
+	stale := listed
+	stale.Start = listed.Start.Add(-time.Minute)
+	if err := killProcess(stale); err == nil || !strings.Contains(err.Error(), "another process") {
+		t.Fatalf("killProcess(stale) error = %v, want reused PID", err)
+	}
+	// A killed child stays in procfs as a zombie until it is waited for
+	for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(cmd.Process.Pid), "stat"))
+		if err != nil {
+			t.Fatalf("read stat: %v", err)
+		}
+		if fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:])); len(fields) > 0 && fields[0] == "Z" {
+			t.Fatal("process with a reused PID was killed")
+		}
+	}
+
+	if err := killProcess(listed); err != nil {
+		t.Fatalf("killProcess() error = %v", err)
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Error("sleep exited cleanly, want killed")
+	}
+}
+
+// processName returns the executable name procfs reports for pid
+func processName(t *testing.T, pid uint32) string {
+	t.Helper()
+	processes, err := listProcesses()
+	if err != nil {
+		t.Fatalf("listProcesses() error = %v", err)
+	}
+	for _, p := range processes {
+		if p.PID == pid {
+			return p.Name
+		}
+	}
+	t.Fatalf("process %d not found", pid)
+	return ""
+}
@@ -0,0 +1,23 @@
+//go:build !windows && !linux
+
+package tasks
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// listProcesses reports that processes are not supported
+func listProcesses() ([]processSample, error) {
+	return nil, fmt.Errorf("process list not supported on %s", runtime.GOOS)
+}
+
+// processDetails reports that processes are not supported
+func processDetails(pid uint32) (string, string, error) {
+	return "", "", fmt.Errorf("process list not supported on %s", runtime.GOOS)
+}
+
+// killProcess reports that processes are not supported
+func killProcess(p processSample) error {
+	return fmt.Errorf("process control not supported on %s", runtime.GOOS)
+}
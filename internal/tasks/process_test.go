@@ -0,0 +1,84 @@
+package tasks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestSortProcesses tests every sort order and the PID tie-break
+func TestSortProcesses(t *testing.T) {
+	processes := []ProcessInfo{
+		{PID: 30, Name: "b.exe", CPUPercent: 5, RSSBytes: 100, StartTime: "2025-01-01T00:00:02Z"},
+		{PID: 10, Name: "C.exe", CPUPercent: 50, RSSBytes: 10, StartTime: "2025-01-01T00:00:01Z"},
+		{PID: 20, Name: "a.exe", CPUPercent: 5, RSSBytes: 1000, StartTime: "2025-01-01T00:00:03Z"},
+	}
+	tests := map[string][]uint32{
+		ProcessSortCPU:       {10, 20, 30},
+		ProcessSortMemory:    {20, 30, 10},
+		ProcessSortPID:       {10, 20, 30},
+		ProcessSortName:      {20, 30, 10},
+		ProcessSortStartTime: {20, 30, 10},
+	}
+	for sortBy, want := range tests {
+		sorted := append([]ProcessInfo(nil), processes...)
+		sortProcesses(sorted, sortBy)
+		var got []uint32
+		for _, p := range sorted {
+			got = append(got, p.PID)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sort %s = %v, want %v", sortBy, got, want)
+		}
+	}
+}
+
+// TestProcessNames tests name filters and the kill allow list
+func TestProcessNames(t *testing.T) {
+	if !matchProcessName("sql*.exe", "SQLServr.exe") || matchProcessName("sql*.exe", "mysql.exe") {
+		t.Error("matchProcessName() glob mismatch")
+	}
+	if !matchProcessName("notepad.exe", "Notepad.exe") {
+		t.Error("matchProcessName() should match exact names case-insensitively")
+	}
+	if !isProcessAllowed("Notepad.EXE", []string{"notepad.exe"}) || isProcessAllowed("notepad", []string{"notepad.exe"}) {
+		t.Error("isProcessAllowed() mismatch")
+	}
+	if got := cpuPercent(0, time.Second); got != 0 {
+		t.Errorf("cpuPercent(0) = %v", got)
+	}
+}
+
+// TestProcessRequestValidation tests requests rejected before touching processes
+func TestProcessRequestValidation(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), 0)
+	allowed := []string{"notepad.exe"}
+
+	tests := []struct {
+		name    string
+		pid     uint32
+		process string
+		errText string
+	}{
+		{name: "neither", errText: "exactly one of pid or name"},
+		{name: "both", pid: 42, process: "notepad.exe", errText: "exactly one of pid or name"},
+		{name: "not allowed", process: "lsass.exe", errText: "not in allowed list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executor.KillProcesses(tt.pid, tt.process, allowed)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("KillProcesses() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+
+	for _, opts := range []ProcessListOptions{{SortBy: "threads"}, {Top: -1}, {Name: "[bad"}} {
+		if _, err := executor.ListProcesses(opts); err == nil {
+			t.Errorf("ListProcesses(%+v) accepted invalid options", opts)
+		}
+	}
+}
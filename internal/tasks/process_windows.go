@@ -0,0 +1,173 @@
+//go:build windows
+
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procK32GetProcessMemoryInfo = modKernel32.NewProc("K32GetProcessMemoryInfo")
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS (psapi.h)
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// listProcesses takes a Toolhelp process snapshot and reads the CPU times,
+// start time and working set of each process
+// Protected processes that cannot be opened are listed with the name only
+func listProcesses() ([]processSample, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("CreateToolhelp32Snapshot failed: %w", err)
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	err = windows.Process32First(snapshot, &entry)
+
+	var processes []processSample
+	for err == nil {
+		p := processSample{PID: entry.ProcessID, Name: windows.UTF16ToString(entry.ExeFile[:])}
+		readProcessTimes(&p)
+		processes = append(processes, p)
+		err = windows.Process32Next(snapshot, &entry)
+	}
+	if !errors.Is(err, windows.ERROR_NO_MORE_FILES) {
+		return nil, fmt.Errorf("Process32Next failed: %w", err)
+	}
+	return processes, nil
+}
+
+// readProcessTimes fills the executable path, CPU time, start time and
+// working set where the process can be opened
+func readProcessTimes(p *processSample) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, p.PID)
+	if err != nil {
+		return
+	}
+	defer windows.CloseHandle(h)
+
+	if path, err := processImagePath(h); err == nil {
+		p.Path = path
+	}
+
+	var creation, exit, kernel, user windows.Filetime
+	if windows.GetProcessTimes(h, &creation, &exit, &kernel, &user) == nil {
+		p.CPUTime = filetimeDuration(kernel) + filetimeDuration(user)
+		p.Start = time.Unix(0, creation.Nanoseconds())
+	}
+
+	counters := processMemoryCounters{cb: uint32(unsafe.Sizeof(processMemoryCounters{}))}
+	if ret, _, _ := procK32GetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb)); ret != 0 {
+		p.RSS = uint64(counters.WorkingSetSize)
+	}
+}
+
+// filetimeDuration converts a FILETIME interval (100ns units) to a duration
+func filetimeDuration(ft windows.Filetime) time.Duration {
+	return time.Duration(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) * 100
+}
+
+// processDetails returns the owner (DOMAIN\user) and command line of a process
+func processDetails(pid uint32) (string, string, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return "", "", err
+	}
+	defer windows.CloseHandle(h)
+
+	var owner string
+	var token windows.Token
+	if err := windows.OpenProcessToken(h, windows.TOKEN_QUERY, &token); err == nil {
+		if tokenUser, err := token.GetTokenUser(); err == nil {
+			if account, domain, _, err := tokenUser.User.Sid.LookupAccount(""); err == nil {
+				owner = domain + `\` + account
+			}
+		}
+		token.Close()
+	}
+
+	commandLine, err := processCommandLine(h)
+	return owner, commandLine, err
+}
+
+// processCommandLine reads the command line (Windows 8.1 and later)
+func processCommandLine(h windows.Handle) (string, error) {
+	buf := make([]byte, 1024)
+	for {
+		var size uint32
+		err := windows.NtQueryInformationProcess(h, windows.ProcessCommandLineInformation,
+			unsafe.Pointer(&buf[0]), uint32(len(buf)), &size)
+		if err == nil {
+			return (*windows.NTUnicodeString)(unsafe.Pointer(&buf[0])).String(), nil
+		}
+		if err != windows.STATUS_INFO_LENGTH_MISMATCH || int(size) <= len(buf) {
+			return "", err
+		}
+		buf = make([]byte, size)
+	}
+}
+
+// killProcess terminates a process immediately
+// The image name and creation time are checked on the same handle that is
+// terminated, so a PID reused since the listing is never killed
+func killProcess(p processSample) error {
+	h, err := windows.OpenProcess(windows.PROCESS_TERMINATE|windows.PROCESS_QUERY_LIMITED_INFORMATION, false, p.PID)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+
+	path, err := processImagePath(h)
+	if err != nil {
+		return fmt.Errorf("failed to read process image: %w", err)
+	}
+	if !strings.EqualFold(filepath.Base(path), p.Name) {
+		return fmt.Errorf("pid %d now belongs to %s", p.PID, filepath.Base(path))
+	}
+	if !p.Start.IsZero() {
+		var creation, exit, kernel, user windows.Filetime
+		if err := windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+			return fmt.Errorf("failed to read process times: %w", err)
+		}
+		if !time.Unix(0, creation.Nanoseconds()).Equal(p.Start) {
+			return fmt.Errorf("pid %d now belongs to another process", p.PID)
+		}
+	}
+	return windows.TerminateProcess(h, 1)
+}
+
+// processImagePath returns the full executable path of an open process
+// The buffer starts at MAX_PATH and grows only for longer paths
+func processImagePath(h windows.Handle) (string, error) {
+	buf := make([]uint16, windows.MAX_PATH)
+	for {
+		size := uint32(len(buf))
+		err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size)
+		if err == nil {
+			return windows.UTF16ToString(buf[:size]), nil
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER || len(buf) >= windows.MAX_LONG_PATH {
+			return "", err
+		}
+		buf = make([]uint16, min(len(buf)*4, windows.MAX_LONG_PATH))
+	}
+}
@@ -0,0 +1,274 @@
+package tasks
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// TargetMetrics is one scrape of an additional exporter (scrape_targets)
+type TargetMetrics struct {
+	Target           string         `json:"target"`
+	Metrics          []CustomMetric `json:"metrics"` // Selected families (as-is) followed by mapped metrics
+	ScrapeDurationMs int64          `json:"scrape_duration_ms"`
+	Timestamp        string         `json:"timestamp"`
+}
+
+// ScrapeTargetHealth reports the scrape history of one target in health
+type ScrapeTargetHealth struct {
+	LastSuccess   string `json:"last_success,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	LastErrorTime string `json:"last_error_time,omitempty"`
+	Successes     int64  `json:"successes"`
+	Failures      int64  `json:"failures"`
+}
+
+// scrapeStats tracks one scrape target for health
+type scrapeStats struct {
+	lastSuccess   time.Time
+	lastError     string
+	lastErrorTime time.Time
+	successes     int64
+	failures      int64
+}
+
+// Scraper scrapes one additional exporter with its own HTTP client,
+// credentials and counter cache (rates are per target)
+type Scraper struct {
+	logger  *zap.Logger
+	target  config.ScrapeTarget
+	timeout time.Duration
+	client  *http.Client
+	cache   *metricsCache
+}
+
+// NewScraper creates a scraper for a configured target
+// Fails if the target's TLS files cannot be loaded
+func NewScraper(logger *zap.Logger, target config.ScrapeTarget) (*Scraper, error) {
+	timeout := target.Timeout
+	if timeout == 0 {
+		timeout = config.DefaultScrapeTimeout
+	}
+
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:       5 * time.Second,
+			KeepAlive:     30 * time.Second,
+			FallbackDelay: 300 * time.Millisecond,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	tlsConfig, err := scrapeTLSConfig(&target.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("scrape target %s: %w", target.Name, err)
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &Scraper{
+		logger:  logger.With(zap.String("target", target.Name)),
+		target:  target,
+		timeout: timeout,
+		client:  &http.Client{Timeout: timeout, Transport: transport},
+		cache:   &metricsCache{lastCustom: make(map[string]customCounter)},
+	}, nil
+}
+
+// Name returns the target name
+func (s *Scraper) Name() string {
+	return s.target.Name
+}
+
+// Scrape fetches the target and returns the selected and mapped metrics
+func (s *Scraper) Scrape() (*TargetMetrics, error) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.target.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "win-agent/1.0")
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	switch s.target.Auth.Type {
+	case "basic":
+		req.SetBasicAuth(s.target.Auth.Username, s.target.Auth.Password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+s.target.Auth.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("scrape timeout after %v: %w", s.timeout, err)
+		}
+		return nil, fmt.Errorf("failed to fetch metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	families, err := decodeMetricFamilies(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+
+	now := time.Now()
+	metrics := selectFamilies(families, s.target.Families)
+	metrics = append(metrics, s.cache.mapCustomMetrics(s.logger, families, s.target.Metrics, now)...)
+	if metrics == nil {
+		metrics = []CustomMetric{}
+	}
+
+	return &TargetMetrics{
+		Target:           s.target.Name,
+		Metrics:          metrics,
+		ScrapeDurationMs: time.Since(start).Milliseconds(),
+		Timestamp:        now.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// selectFamilies forwards every series of the families matching patterns as-is
+// Families are sorted by name; summaries and histograms are skipped
+func selectFamilies(families map[string]*dto.MetricFamily, patterns []string) []CustomMetric {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var result []CustomMetric
+	for _, name := range names {
+		for _, m := range families[name].Metric {
+			value, ok := seriesValue(m)
+			if !ok {
+				continue
+			}
+			var labels map[string]string
+			if len(m.Label) > 0 {
+				labels = make(map[string]string, len(m.Label))
+				for _, label := range m.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+			}
+			result = append(result, CustomMetric{Name: name, Labels: labels, Value: value})
+		}
+	}
+	return result
+}
+
+// scrapeTLSConfig builds the client TLS settings for an https target
+func scrapeTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// RecordScrapeSuccess records a successful scrape of a target
+func (e *Executor) RecordScrapeSuccess(target string) {
+	e.taskStats.mu.Lock()
+	defer e.taskStats.mu.Unlock()
+	stats := e.taskStats.scrapeTarget(target)
+	stats.lastSuccess = time.Now()
+	stats.successes++
+}
+
+// RecordScrapeFailure records a failed scrape of a target
+func (e *Executor) RecordScrapeFailure(target string, err error) {
+	e.taskStats.mu.Lock()
+	defer e.taskStats.mu.Unlock()
+	stats := e.taskStats.scrapeTarget(target)
+	stats.lastError = err.Error()
+	stats.lastErrorTime = time.Now()
+	stats.failures++
+}
+
+// scrapeTarget returns the stats of a target, creating them on first use
+// Callers must hold the lock
+func (t *TaskStats) scrapeTarget(target string) *scrapeStats {
+	if t.scrapes == nil {
+		t.scrapes = make(map[string]*scrapeStats)
+	}
+	stats, ok := t.scrapes[target]
+	if !ok {
+		stats = &scrapeStats{}
+		t.scrapes[target] = stats
+	}
+	return stats
+}
+
+// scrapeHealth converts the per-target stats for health
+// Callers must hold the read lock
+func (t *TaskStats) scrapeHealth() map[string]ScrapeTargetHealth {
+	if len(t.scrapes) == 0 {
+		return nil
+	}
+
+	health := make(map[string]ScrapeTargetHealth, len(t.scrapes))
+	for target, stats := range t.scrapes {
+		h := ScrapeTargetHealth{
+			LastError: stats.lastError,
+			Successes: stats.successes,
+			Failures:  stats.failures,
+		}
+		if !stats.lastSuccess.IsZero() {
+			h.LastSuccess = stats.lastSuccess.Format(time.RFC3339)
+		}
+		if !stats.lastErrorTime.IsZero() {
+			h.LastErrorTime = stats.lastErrorTime.Format(time.RFC3339)
+		}
+		health[target] = h
+	}
+	return health
+}
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+const targetExposition = `# TYPE mssql_up gauge
+mssql_up{instance="SQLEXPRESS"} 1
+# TYPE mssql_connections gauge
+mssql_connections{database="app"} 12
+mssql_connections{database="master"} 3
+# TYPE go_goroutines gauge
+go_goroutines 40
+`
+
+// TestScraperScrape tests auth, family selection and mapping for a scrape target
+func TestScraperScrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(targetExposition))
+	}))
+	defer server.Close()
+
+	target := config.ScrapeTarget{
+		Name:     "mssql",
+		URL:      server.URL,
+		Interval: time.Minute,
+		Auth:     config.ScrapeAuthConfig{Type: "bearer", Token: "s3cret"},
+		Families: []string{"mssql_up"},
+		Metrics:  []config.CustomMetric{{Name: "connections", Family: "mssql_connections"}},
+	}
+	scraper, err := NewScraper(zap.NewNop(), target)
+	if err != nil {
+		t.Fatalf("NewScraper() error = %v", err)
+	}
+
+	got, err := scraper.Scrape()
+	if err != nil {
+		t.Fatalf("Scrape() error = %v", err)
+	}
+	want := []CustomMetric{
+		{Name: "mssql_up", Labels: map[string]string{"instance": "SQLEXPRESS"}, Value: 1},
+		{Name: "connections", Value: 15},
+	}
+	if got.Target != "mssql" || !reflect.DeepEqual(got.Metrics, want) {
+		t.Errorf("Scrape() = %+v, want metrics %+v", got, want)
+	}
+
+	// Wrong credentials surface as a scrape error
+	target.Auth.Token = "wrong"
+	scraper, _ = NewScraper(zap.NewNop(), target)
+	if _, err := scraper.Scrape(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Scrape() with bad token error = %v, want status 401", err)
+	}
+}
+
+// TestSelectFamilies tests glob selection across families
+func TestSelectFamilies(t *testing.T) {
+	got := selectFamilies(parseFamilies(t, targetExposition), []string{"mssql_*"})
+	if len(got) != 3 || got[0].Name != "mssql_connections" || got[2].Name != "mssql_up" {
+		t.Errorf("selectFamilies(mssql_*) = %+v", got)
+	}
+	if got := selectFamilies(parseFamilies(t, targetExposition), nil); got != nil {
+		t.Errorf("selectFamilies(nil) = %+v, want nil", got)
+	}
+}
+
+// TestRecordScrapeStats tests per-target health stats
+func TestRecordScrapeStats(t *testing.T) {
+	e := NewExecutor(zap.NewNop(), 30*time.Second)
+	if got := e.GetTaskMetrics().ScrapeTargets; got != nil {
+		t.Errorf("ScrapeTargets = %+v, want nil before any scrape", got)
+	}
+
+	e.RecordScrapeSuccess("iis")
+	e.RecordScrapeSuccess("iis")
+	e.RecordScrapeFailure("mssql", errors.New("connection refused"))
+
+	targets := e.GetTaskMetrics().ScrapeTargets
+	if iis := targets["iis"]; iis.Successes != 2 || iis.Failures != 0 || iis.LastSuccess == "" {
+		t.Errorf("iis = %+v", iis)
+	}
+	if mssql := targets["mssql"]; mssql.Failures != 1 || mssql.LastError != "connection refused" || mssql.LastErrorTime == "" {
+		t.Errorf("mssql = %+v", mssql)
+	}
+}
@@ -0,0 +1,527 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/config"
+)
+
+// Service states, using the Windows SCM names on every platform
+const (
+	StateStopped         = "Stopped"
+	StateStartPending    = "StartPending"
+	StateStopPending     = "StopPending"
+	StateRunning         = "Running"
+	StateContinuePending = "ContinuePending"
+	StatePausePending    = "PausePending"
+	StatePaused          = "Paused"
+	StateUnknown         = "Unknown"
+)
+
+// Service startup types, using the PowerShell StartType names on every platform
+const (
+	StartTypeAutomatic = "Automatic"
+	StartTypeDelayed   = "AutomaticDelayedStart"
+	StartTypeManual    = "Manual"
+	StartTypeDisabled  = "Disabled"
+	StartTypeBoot      = "Boot"    // Drivers only; reported, cannot be set
+	StartTypeSystem    = "System"  // Drivers only; reported, cannot be set
+	StartTypeUnknown   = "Unknown" // Not a startup type the agent recognizes
+)
+
+// Service control actions
+const (
+	ServiceActionStart      = "start"
+	ServiceActionStop       = "stop"
+	ServiceActionRestart    = "restart"
+	ServiceActionPause      = "pause"
+	ServiceActionContinue   = "continue"
+	ServiceActionSetStartup = "set_startup"
+)
+
+// ServiceManager is the OS service backend used by the Executor
+// Start, Stop, Pause and Continue request the change and return; the
+// Executor polls Query until the service gets there
+type ServiceManager interface {
+	// Query returns the current state of a service (State* constants)
+	// An error means the service does not exist or cannot be opened
+	Query(name string) (string, error)
+	Start(name string) error
+	Stop(name string) error
+	Pause(name string) error
+	Continue(name string) error
+
+	// StartType returns the startup type (StartType* constants)
+	StartType(name string) (string, error)
+	// SetStartType changes the startup type to Automatic, AutomaticDelayedStart,
+	// Manual or Disabled
+	SetStartType(name, startType string) error
+	// Dependents returns the services that depend directly on name
+	Dependents(name string) ([]string, error)
+
+	// Details returns the configuration and runtime details of a service
+	Details(name string) (*ServiceDetails, error)
+	// List returns the names of all installed services
+	List() ([]string, error)
+}
+
+// Recovery action types reported in ServiceDetails
+const (
+	RecoveryActionNone    = "none"
+	RecoveryActionRestart = "restart"
+	RecoveryActionReboot  = "reboot"
+	RecoveryActionCommand = "run_command"
+)
+
+// ServiceDetails is the cmd.service.query result for one service
+type ServiceDetails struct {
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name"`
+	State        string   `json:"state"`
+	StartType    string   `json:"start_type"`
+	BinaryPath   string   `json:"binary_path"`
+	Account      string   `json:"account"`              // Account the service runs as
+	PID          uint32   `json:"pid"`                  // 0 when not running
+	Dependencies []string `json:"dependencies"`         // Services this one needs
+	Dependents   []string `json:"dependents,omitempty"` // Services that need this one
+
+	// Failure actions, in order: the Nth failure uses action N (the last repeats)
+	RecoveryActions []ServiceRecoveryAction `json:"recovery_actions"`
+	// Seconds without failures after which the failure count resets
+	RecoveryResetSeconds uint32 `json:"recovery_reset_seconds,omitempty"`
+	// Command run by run_command actions
+	RecoveryCommand string `json:"recovery_command,omitempty"`
+}
+
+// ServiceRecoveryAction is one configured failure action
+type ServiceRecoveryAction struct {
+	Type    string `json:"type"` // RecoveryAction* constants
+	DelayMs int64  `json:"delay_ms"`
+}
+
+// ServiceControl is a service control request
+type ServiceControl struct {
+	Name   string
+	Action string // ServiceAction* constants
+
+	// StartupType is the new startup type for set_startup
+	StartupType string
+	// IncludeDependents stops running dependent services first on stop and
+	// restart, and starts them again after a restart
+	IncludeDependents bool
+}
+
+// ServiceControlResult is the outcome of a successful service control
+type ServiceControlResult struct {
+	Message     string
+	State       string   // State after the action ("" if it could not be read)
+	StartupType string   // Startup type after the action ("" if it could not be read)
+	Dependents  []string // Dependents stopped (and restarted), in stop order
+
+	// StoppedDependents is set, with an error, when a failed stop or restart
+	// leaves dependents stopped that could not be started again
+	StoppedDependents []string
+}
+
+// ServiceStatus represents the status of a Windows service
+type ServiceStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Poll settings for waitForServiceState; variables so tests can shorten them
+var (
+	serviceStateTimeout  = 30 * time.Second
+	serviceStateInterval = 500 * time.Millisecond
+)
+
+// ControlService starts, stops, or restarts a service
+// Only services in the allowedServices list can be controlled
+func (e *Executor) ControlService(name, action string, allowedServices []string) (string, error) {
+	result, err := e.ControlServiceWith(ServiceControl{Name: name, Action: action}, allowedServices)
+	if err != nil {
+		return "", err
+	}
+	return result.Message, nil
+}
+
+// ControlServiceWith runs a service control request and reports the
+// resulting state and startup type
+// The service, and any dependents it stops, must be in allowedServices
+func (e *Executor) ControlServiceWith(req ServiceControl, allowedServices []string) (*ServiceControlResult, error) {
+	name, action := req.Name, req.Action
+
+	// Validate service is in whitelist
+	if !isServiceAllowed(name, allowedServices) {
+		return nil, fmt.Errorf("service not in allowed list: %s", name)
+	}
+
+	// Validate the request before touching the service
+	switch action {
+	case ServiceActionStart, ServiceActionStop, ServiceActionRestart, ServiceActionPause, ServiceActionContinue:
+	case ServiceActionSetStartup:
+		if !isSettableStartType(req.StartupType) {
+			return nil, fmt.Errorf("invalid startup_type: %q (must be Automatic, AutomaticDelayedStart, Manual, or Disabled)", req.StartupType)
+		}
+	default:
+		return nil, fmt.Errorf("invalid action: %s (must be start, stop, restart, pause, continue, or set_startup)", action)
+	}
+	if req.IncludeDependents && action != ServiceActionStop && action != ServiceActionRestart {
+		return nil, fmt.Errorf("include_dependents only applies to stop and restart")
+	}
+
+	// Make sure the service exists before changing it
+	if _, err := e.services.Query(name); err != nil {
+		return nil, fmt.Errorf("failed to open service %s: %w", name, err)
+	}
+
+	// Dependents are stopped too, so they must be allowed as well
+	var dependents []string
+	if req.IncludeDependents {
+		var err error
+		dependents, err = e.runningDependents(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dependents of %s: %w", name, err)
+		}
+		for _, dependent := range dependents {
+			if !isServiceAllowed(dependent, allowedServices) {
+				return nil, fmt.Errorf("dependent service not in allowed list: %s", dependent)
+			}
+		}
+	}
+
+	// Perform the requested action
+	var message string
+	switch action {
+	case ServiceActionStart:
+		if err := e.services.Start(name); err != nil {
+			return nil, fmt.Errorf("failed to start service: %w", err)
+		}
+		message = fmt.Sprintf("Service %s started successfully", name)
+
+	case ServiceActionStop:
+		stopped, err := e.stopDependents(dependents)
+		if err != nil {
+			return e.restoreDependents(stopped, err)
+		}
+		if err := e.services.Stop(name); err != nil {
+			return e.restoreDependents(stopped, fmt.Errorf("failed to stop service: %w", err))
+		}
+		// Wait for service to stop (with timeout)
+		if err := e.waitForServiceState(name, StateStopped, serviceStateTimeout); err != nil {
+			return e.restoreDependents(stopped, fmt.Errorf("service did not stop in time: %w", err))
+		}
+		message = fmt.Sprintf("Service %s stopped successfully (status: %s)", name, StateStopped)
+
+	case ServiceActionRestart:
+		stopped, err := e.stopDependents(dependents)
+		if err != nil {
+			return e.restoreDependents(stopped, err)
+		}
+
+		// Stop the service first
+		if err := e.services.Stop(name); err != nil {
+			return e.restoreDependents(stopped, fmt.Errorf("failed to stop service for restart: %w", err))
+		}
+
+		// Wait for service to stop
+		if err := e.waitForServiceState(name, StateStopped, serviceStateTimeout); err != nil {
+			return e.restoreDependents(stopped, fmt.Errorf("service did not stop for restart: %w", err))
+		}
+
+		// Start the service
+		if err := e.services.Start(name); err != nil {
+			return e.restoreDependents(stopped, fmt.Errorf("failed to start service after restart: %w", err))
+		}
+
+		// Wait for service to start
+		if err := e.waitForServiceState(name, StateRunning, serviceStateTimeout); err != nil {
+			return e.restoreDependents(stopped, fmt.Errorf("service did not start after restart: %w", err))
+		}
+
+		// Bring the dependents back in reverse stop order
+		if down := e.startDependents(stopped); len(down) > 0 {
+			return &ServiceControlResult{StoppedDependents: down},
+				fmt.Errorf("service %s restarted, but dependent services did not start: %s", name, strings.Join(down, ", "))
+		}
+
+		message = fmt.Sprintf("Service %s restarted successfully", name)
+
+	case ServiceActionPause:
+		if err := e.services.Pause(name); err != nil {
+			return nil, fmt.Errorf("failed to pause service: %w", err)
+		}
+		if err := e.waitForServiceState(name, StatePaused, serviceStateTimeout); err != nil {
+			return nil, fmt.Errorf("service did not pause in time: %w", err)
+		}
+		message = fmt.Sprintf("Service %s paused successfully", name)
+
+	case ServiceActionContinue:
+		if err := e.services.Continue(name); err != nil {
+			return nil, fmt.Errorf("failed to continue service: %w", err)
+		}
+		if err := e.waitForServiceState(name, StateRunning, serviceStateTimeout); err != nil {
+			return nil, fmt.Errorf("service did not continue in time: %w", err)
+		}
+		message = fmt.Sprintf("Service %s continued successfully", name)
+
+	case ServiceActionSetStartup:
+		if err := e.services.SetStartType(name, req.StartupType); err != nil {
+			return nil, fmt.Errorf("failed to set startup type: %w", err)
+		}
+		message = fmt.Sprintf("Service %s startup type set to %s", name, req.StartupType)
+	}
+
+	result := &ServiceControlResult{Message: message, Dependents: dependents}
+	if state, err := e.services.Query(name); err == nil {
+		result.State = state
+	} else {
+		e.logger.Warn("Failed to query service after control", zap.String("service", name), zap.Error(err))
+	}
+	if startType, err := e.services.StartType(name); err == nil {
+		result.StartupType = startType
+	} else {
+		e.logger.Warn("Failed to query service startup type", zap.String("service", name), zap.Error(err))
+	}
+	return result, nil
+}
+
+// runningDependents returns the services that depend on name, directly or
+// indirectly, and are not stopped, in the order they must be stopped
+// (dependents of a dependent come before it)
+func (e *Executor) runningDependents(name string) ([]string, error) {
+	var order []string
+	seen := map[string]bool{name: true}
+
+	var visit func(service string) error
+	visit = func(service string) error {
+		dependents, err := e.services.Dependents(service)
+		if err != nil {
+			return err
+		}
+		for _, dependent := range dependents {
+			if seen[dependent] {
+				continue
+			}
+			seen[dependent] = true
+			if err := visit(dependent); err != nil {
+				return err
+			}
+			state, err := e.services.Query(dependent)
+			if err != nil {
+				return fmt.Errorf("failed to query %s: %w", dependent, err)
+			}
+			if state != StateStopped {
+				order = append(order, dependent)
+			}
+		}
+		return nil
+	}
+
+	if err := visit(name); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// stopDependents stops dependent services in order, waiting for each
+// It returns the dependents stopped so far, including on an error, since one
+// that failed to stop may still be on its way down
+func (e *Executor) stopDependents(dependents []string) ([]string, error) {
+	var stopped []string
+	for _, dependent := range dependents {
+		stopped = append(stopped, dependent)
+		if err := e.services.Stop(dependent); err != nil {
+			return stopped, fmt.Errorf("failed to stop dependent service %s: %w", dependent, err)
+		}
+		if err := e.waitForServiceState(dependent, StateStopped, serviceStateTimeout); err != nil {
+			return stopped, fmt.Errorf("dependent service %s did not stop: %w", dependent, err)
+		}
+	}
+	return stopped, nil
+}
+
+// startDependents starts stopped dependents in reverse stop order, waiting
+// for each, and returns the ones that did not reach Running
+// It carries on past failures so one bad dependent does not keep the rest down
+func (e *Executor) startDependents(stopped []string) []string {
+	var down []string
+	for i := len(stopped) - 1; i >= 0; i-- {
+		dependent := stopped[i]
+		if state, err := e.services.Query(dependent); err == nil && state == StateRunning {
+			continue
+		}
+		err := e.services.Start(dependent)
+		if err == nil {
+			err = e.waitForServiceState(dependent, StateRunning, serviceStateTimeout)
+		}
+		if err != nil {
+			e.logger.Error("Failed to start dependent service", zap.String("service", dependent), zap.Error(err))
+			down = append(down, dependent)
+		}
+	}
+	return down
+}
+
+// restoreDependents makes a best-effort attempt to start the dependents a
+// failed stop or restart took down, and reports any still stopped with err
+func (e *Executor) restoreDependents(stopped []string, err error) (*ServiceControlResult, error) {
+	down := e.startDependents(stopped)
+	if len(down) == 0 {
+		return nil, err
+	}
+	return &ServiceControlResult{StoppedDependents: down},
+		fmt.Errorf("%w (dependent services left stopped: %s)", err, strings.Join(down, ", "))
+}
+
+// RecoverService brings a service back to Running for the watchdog
+// A stopped service is started; one in any other state is stopped first
+// Unlike ControlService it waits for Running and needs no allow list
+func (e *Executor) RecoverService(name string) error {
+	state, err := e.services.Query(name)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", name, err)
+	}
+
+	if state != StateStopped {
+		if err := e.services.Stop(name); err != nil {
+			return fmt.Errorf("failed to stop %s service: %w", state, err)
+		}
+		if err := e.waitForServiceState(name, StateStopped, serviceStateTimeout); err != nil {
+			return fmt.Errorf("service did not stop: %w", err)
+		}
+	}
+
+	if err := e.services.Start(name); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+	if err := e.waitForServiceState(name, StateRunning, serviceStateTimeout); err != nil {
+		return fmt.Errorf("service did not start: %w", err)
+	}
+	return nil
+}
+
+// QueryService returns the details of one service
+func (e *Executor) QueryService(name string) (*ServiceDetails, error) {
+	if name == "" {
+		return nil, fmt.Errorf("service_name is required")
+	}
+	details, err := e.services.Details(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service %s: %w", name, err)
+	}
+	if details.Dependencies == nil {
+		details.Dependencies = []string{}
+	}
+	if details.RecoveryActions == nil {
+		details.RecoveryActions = []ServiceRecoveryAction{}
+	}
+	return details, nil
+}
+
+// ExpandServices resolves service_check entries to service names
+// Exact names are kept as they are, so a missing service is still reported;
+// patterns are replaced by the installed services they match, sorted
+// Services are only listed when there is a pattern
+func (e *Executor) ExpandServices(entries []string) ([]string, error) {
+	var installed []string
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, entry := range entries {
+		if !config.IsServicePattern(entry) {
+			if !seen[config.ServiceKey(entry)] {
+				seen[config.ServiceKey(entry)] = true
+				names = append(names, entry)
+			}
+			continue
+		}
+
+		if installed == nil {
+			list, err := e.services.List()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list services: %w", err)
+			}
+			installed = list
+			sort.Strings(installed)
+		}
+		for _, name := range installed {
+			if config.MatchService(entry, name) && !seen[config.ServiceKey(name)] {
+				seen[config.ServiceKey(name)] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// GetServiceStatuses retrieves the status of all configured services
+func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error) {
+	var statuses []ServiceStatus
+
+	for _, name := range services {
+		state, err := e.services.Query(name)
+		if err != nil {
+			e.logger.Warn("Failed to query service",
+				zap.String("service", name),
+				zap.Error(err))
+			statuses = append(statuses, ServiceStatus{
+				Name:   name,
+				Status: "Error",
+			})
+			continue
+		}
+
+		statuses = append(statuses, ServiceStatus{
+			Name:   name,
+			Status: state,
+		})
+	}
+
+	return statuses, nil
+}
+
+// isSettableStartType checks that a startup type can be applied to a service
+func isSettableStartType(startType string) bool {
+	switch startType {
+	case StartTypeAutomatic, StartTypeDelayed, StartTypeManual, StartTypeDisabled:
+		return true
+	}
+	return false
+}
+
+// isServiceAllowed checks if a service is in the allowed list
+func isServiceAllowed(name string, allowedServices []string) bool {
+	for _, allowed := range allowedServices {
+		if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForServiceState waits for a service to reach a specific state
+func (e *Executor) waitForServiceState(name, targetState string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	var state string
+	for time.Now().Before(deadline) {
+		var err error
+		state, err = e.services.Query(name)
+		if err != nil {
+			return err
+		}
+
+		if state == targetState {
+			return nil
+		}
+
+		time.Sleep(serviceStateInterval)
+	}
+
+	return fmt.Errorf("timeout waiting for service state %s (last: %s)", targetState, state)
+}
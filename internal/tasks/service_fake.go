@@ -0,0 +1,256 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FakeServiceManager is an in-memory ServiceManager for tests
+// Start, Stop, Pause and Continue move a service into its pending state; it
+// reaches the target state after PendingQueries further Query calls, or never
+// if it hangs. Every control call is recorded in Calls
+type FakeServiceManager struct {
+	mu       sync.Mutex
+	services map[string]*fakeService
+	calls    []string
+
+	// PendingQueries is how many Query calls a service stays pending for
+	PendingQueries int
+}
+
+// fakeService is the simulated state of one service
+type fakeService struct {
+	state      string
+	target     string // State reached when pending runs out ("" = none queued)
+	pending    int
+	hangOn     string // Action ("start", "stop", ...) whose change never completes
+	hanging    bool
+	startType  string
+	dependents []string
+	details    ServiceDetails // Static details returned by Details
+	startErr   error
+	stopErr    error
+	queryErr   error
+}
+
+// NewFakeServiceManager creates a fake with no services and one pending Query
+func NewFakeServiceManager() *FakeServiceManager {
+	return &FakeServiceManager{
+		services:       make(map[string]*fakeService),
+		PendingQueries: 1,
+	}
+}
+
+// Add creates or resets a service in the given state, with a Manual startup type
+func (f *FakeServiceManager) Add(name, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services[name] = &fakeService{state: state, startType: StartTypeManual}
+}
+
+// SetDependents sets the services that depend directly on name
+func (f *FakeServiceManager) SetDependents(name string, dependents ...string) {
+	f.update(name, func(s *fakeService) { s.dependents = dependents })
+}
+
+// SetDetails sets the static details returned by Details; state, startup
+// type and dependents always come from the fake's own state
+func (f *FakeServiceManager) SetDetails(name string, details ServiceDetails) {
+	f.update(name, func(s *fakeService) { s.details = details })
+}
+
+// Remove uninstalls a service
+func (f *FakeServiceManager) Remove(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.services, name)
+}
+
+// Hang makes the service stay pending after action ("start", "stop", "pause" or "continue")
+func (f *FakeServiceManager) Hang(name, action string) {
+	f.update(name, func(s *fakeService) { s.hangOn = action })
+}
+
+// FailStart makes Start return err
+func (f *FakeServiceManager) FailStart(name string, err error) {
+	f.update(name, func(s *fakeService) { s.startErr = err })
+}
+
+// FailStop makes Stop return err
+func (f *FakeServiceManager) FailStop(name string, err error) {
+	f.update(name, func(s *fakeService) { s.stopErr = err })
+}
+
+// FailQuery makes Query return err
+func (f *FakeServiceManager) FailQuery(name string, err error) {
+	f.update(name, func(s *fakeService) { s.queryErr = err })
+}
+
+// State returns the current state without advancing pending changes
+func (f *FakeServiceManager) State(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.services[name]; ok {
+		return s.state
+	}
+	return ""
+}
+
+// Calls returns the recorded control calls, e.g. "stop Spooler" or
+// "set_startup Spooler Disabled"
+func (f *FakeServiceManager) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Query returns the service state, advancing a pending change
+func (f *FakeServiceManager) Query(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.services[name]
+	if !ok {
+		return "", fmt.Errorf("service %s does not exist", name)
+	}
+	if s.queryErr != nil {
+		return "", s.queryErr
+	}
+
+	state := s.state
+	if s.target != "" && !s.hanging {
+		if s.pending > 0 {
+			s.pending--
+		} else {
+			s.state, s.target = s.target, ""
+			state = s.state
+		}
+	}
+	return state, nil
+}
+
+// Start moves a stopped service to StartPending
+func (f *FakeServiceManager) Start(name string) error {
+	return f.change("start", name, StateStartPending, StateRunning)
+}
+
+// Stop moves a running service to StopPending
+func (f *FakeServiceManager) Stop(name string) error {
+	return f.change("stop", name, StateStopPending, StateStopped)
+}
+
+// Pause moves a running service to PausePending
+func (f *FakeServiceManager) Pause(name string) error {
+	return f.change("pause", name, StatePausePending, StatePaused)
+}
+
+// Continue moves a paused service to ContinuePending
+func (f *FakeServiceManager) Continue(name string) error {
+	return f.change("continue", name, StateContinuePending, StateRunning)
+}
+
+// StartType returns the startup type
+func (f *FakeServiceManager) StartType(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.services[name]
+	if !ok {
+		return "", fmt.Errorf("service %s does not exist", name)
+	}
+	return s.startType, nil
+}
+
+// SetStartType records the call and changes the startup type
+func (f *FakeServiceManager) SetStartType(name, startType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "set_startup "+name+" "+startType)
+	s, ok := f.services[name]
+	if !ok {
+		return fmt.Errorf("service %s does not exist", name)
+	}
+	s.startType = startType
+	return nil
+}
+
+// Dependents returns the services set with SetDependents
+func (f *FakeServiceManager) Dependents(name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.services[name]
+	if !ok {
+		return nil, fmt.Errorf("service %s does not exist", name)
+	}
+	return append([]string(nil), s.dependents...), nil
+}
+
+// Details returns the static details with the current state
+func (f *FakeServiceManager) Details(name string) (*ServiceDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.services[name]
+	if !ok {
+		return nil, fmt.Errorf("service %s does not exist", name)
+	}
+	details := s.details
+	details.Name = name
+	details.State = s.state
+	details.StartType = s.startType
+	details.Dependents = append([]string(nil), s.dependents...)
+	return &details, nil
+}
+
+// List returns the names of all services, sorted
+func (f *FakeServiceManager) List() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.services))
+	for name := range f.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// change records a call and queues the transition through pending to target
+func (f *FakeServiceManager) change(action, name, pending, target string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, action+" "+name)
+	s, ok := f.services[name]
+	if !ok {
+		return fmt.Errorf("service %s does not exist", name)
+	}
+
+	switch {
+	case action == "start" && s.startErr != nil:
+		return s.startErr
+	case action == "stop" && s.stopErr != nil:
+		return s.stopErr
+	case action == "start" && s.startType == StartTypeDisabled:
+		return fmt.Errorf("service %s is disabled", name)
+	case action == "start" && s.state != StateStopped:
+		return fmt.Errorf("service %s is already %s", name, s.state)
+	case action == "stop" && s.state == StateStopped:
+		return fmt.Errorf("service %s is not running", name)
+	case action == "pause" && s.state != StateRunning:
+		return fmt.Errorf("service %s is not running", name)
+	case action == "continue" && s.state != StatePaused:
+		return fmt.Errorf("service %s is not paused", name)
+	}
+
+	s.state, s.target, s.pending = pending, target, f.PendingQueries
+	s.hanging = s.hangOn == action
+	return nil
+}
+
+// update applies fn to an existing service
+func (f *FakeServiceManager) update(name string, fn func(s *fakeService)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.services[name]; ok {
+		fn(s)
+	}
+}
@@ -0,0 +1,293 @@
+//go:build linux
+
+package tasks
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemctl controls systemd units through the systemctl command
+// Service names are unit names; ".service" is implied when omitted
+type systemctl struct{}
+
+// newServiceManager returns the platform service backend
+func newServiceManager() ServiceManager {
+	return systemctl{}
+}
+
+// Query returns the unit state under the Windows state names
+func (systemctl) Query(unit string) (string, error) {
+	props, err := showUnit(unit, "LoadState", "ActiveState", "FreezerState")
+	if err != nil {
+		return "", err
+	}
+	return unitState(unit, props)
+}
+
+// Start queues a start job without waiting for it
+func (systemctl) Start(unit string) error {
+	return runSystemctl("start", unit)
+}
+
+// Stop queues a stop job without waiting for it
+func (systemctl) Stop(unit string) error {
+	return runSystemctl("stop", unit)
+}
+
+// Pause freezes the unit's processes (systemd 246 and later)
+func (systemctl) Pause(unit string) error {
+	return systemctlCommand("freeze", "--", unit)
+}
+
+// Continue thaws a frozen unit
+func (systemctl) Continue(unit string) error {
+	return systemctlCommand("thaw", "--", unit)
+}
+
+// StartType maps the unit file state: enabled units start at boot
+// (Automatic), masked units cannot start (Disabled), the rest are Manual
+func (systemctl) StartType(unit string) (string, error) {
+	props, err := showUnit(unit, "UnitFileState")
+	if err != nil {
+		return "", err
+	}
+	return unitFileStateToStartType(props["UnitFileState"]), nil
+}
+
+// SetStartType enables, disables or masks the unit
+// systemd has no delayed start, so AutomaticDelayedStart is rejected
+func (systemctl) SetStartType(unit, startType string) error {
+	switch startType {
+	case StartTypeAutomatic:
+		if err := systemctlCommand("unmask", "--", unit); err != nil {
+			return err
+		}
+		return systemctlCommand("enable", "--", unit)
+	case StartTypeManual:
+		if err := systemctlCommand("unmask", "--", unit); err != nil {
+			return err
+		}
+		return systemctlCommand("disable", "--", unit)
+	case StartTypeDisabled:
+		return systemctlCommand("mask", "--", unit)
+	default:
+		return fmt.Errorf("startup type %s is not supported for systemd units", startType)
+	}
+}
+
+// Dependents returns the service units that require or are bound to unit
+func (systemctl) Dependents(unit string) ([]string, error) {
+	props, err := showUnit(unit, "RequiredBy", "BoundBy")
+	if err != nil {
+		return nil, err
+	}
+	return serviceUnits(props["RequiredBy"], props["BoundBy"]), nil
+}
+
+// Details reads the unit's properties
+// The description stands in for the display name, and Restart= for the
+// failure actions (plus a reboot when FailureAction= reboots)
+func (systemctl) Details(unit string) (*ServiceDetails, error) {
+	props, err := showUnit(unit, "Id", "Description", "LoadState", "ActiveState", "FreezerState",
+		"UnitFileState", "ExecStart", "User", "MainPID", "Requires", "BindsTo", "RequiredBy", "BoundBy",
+		"Restart", "RestartUSec", "FailureAction")
+	if err != nil {
+		return nil, err
+	}
+	state, err := unitState(unit, props)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &ServiceDetails{
+		Name:         props["Id"],
+		DisplayName:  props["Description"],
+		State:        state,
+		StartType:    unitFileStateToStartType(props["UnitFileState"]),
+		BinaryPath:   execStartCommand(props["ExecStart"]),
+		Account:      props["User"],
+		Dependencies: serviceUnits(props["Requires"], props["BindsTo"]),
+		Dependents:   serviceUnits(props["RequiredBy"], props["BoundBy"]),
+	}
+	if details.Account == "" {
+		details.Account = "root"
+	}
+	if pid, err := strconv.ParseUint(props["MainPID"], 10, 32); err == nil {
+		details.PID = uint32(pid)
+	}
+	if restart := props["Restart"]; restart != "" && restart != "no" {
+		details.RecoveryActions = append(details.RecoveryActions, ServiceRecoveryAction{
+			Type:    RecoveryActionRestart,
+			DelayMs: systemdDuration(props["RestartUSec"]).Milliseconds(),
+		})
+	}
+	if strings.HasPrefix(props["FailureAction"], "reboot") {
+		details.RecoveryActions = append(details.RecoveryActions, ServiceRecoveryAction{Type: RecoveryActionReboot})
+	}
+	return details, nil
+}
+
+// List returns the loaded and installed service units
+// Template units (name@.service) are skipped; their instances are listed
+func (systemctl) List() ([]string, error) {
+	var units []string
+	for _, args := range [][]string{
+		{"list-units", "--type=service", "--all", "--plain", "--no-legend", "--no-pager"},
+		{"list-unit-files", "--type=service", "--no-legend", "--no-pager"},
+	} {
+		out, err := exec.Command("systemctl", args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("systemctl %s failed: %w", args[0], err)
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			for _, field := range strings.Fields(line) {
+				// Failed units may be marked with a bullet before the name
+				if !strings.HasSuffix(field, ".service") {
+					continue
+				}
+				if !strings.HasSuffix(field, "@.service") && !slices.Contains(units, field) {
+					units = append(units, field)
+				}
+				break
+			}
+		}
+	}
+	return units, nil
+}
+
+// showUnit reads unit properties with systemctl show
+func showUnit(unit string, properties ...string) (map[string]string, error) {
+	out, err := exec.Command("systemctl", "show", "--property="+strings.Join(properties, ","), "--", unit).Output()
+	if err != nil {
+		return nil, fmt.Errorf("systemctl show failed: %w", err)
+	}
+
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[key] = value
+		}
+	}
+	return props, nil
+}
+
+// unitState maps loaded unit properties to a service state; frozen units
+// are reported as Paused
+// Units that are not found are an error; masked units are Stopped, so their
+// startup type can still be changed
+func unitState(unit string, props map[string]string) (string, error) {
+	if props["LoadState"] != "loaded" && props["LoadState"] != "masked" {
+		return "", fmt.Errorf("unit %s is %s", unit, props["LoadState"])
+	}
+	switch props["FreezerState"] {
+	case "frozen":
+		return StatePaused, nil
+	case "freezing":
+		return StatePausePending, nil
+	case "thawing":
+		return StateContinuePending, nil
+	}
+	return unitStateToString(props["ActiveState"]), nil
+}
+
+// unitFileStateToStartType maps a UnitFileState to a startup type
+func unitFileStateToStartType(state string) string {
+	switch state {
+	case "enabled", "enabled-runtime":
+		return StartTypeAutomatic
+	case "masked", "masked-runtime":
+		return StartTypeDisabled
+	default:
+		return StartTypeManual
+	}
+}
+
+// serviceUnits returns the .service units from space separated unit lists
+func serviceUnits(lists ...string) []string {
+	var units []string
+	for _, unit := range strings.Fields(strings.Join(lists, " ")) {
+		if strings.HasSuffix(unit, ".service") && !slices.Contains(units, unit) {
+			units = append(units, unit)
+		}
+	}
+	return units
+}
+
+// execStartCommand extracts the command line from an ExecStart property
+// ("{ path=/usr/sbin/sshd ; argv[]=/usr/sbin/sshd -D ; ... }")
+func execStartCommand(execStart string) string {
+	_, argv, ok := strings.Cut(execStart, "argv[]=")
+	if !ok {
+		return ""
+	}
+	command, _, _ := strings.Cut(argv, " ;")
+	return strings.TrimSpace(command)
+}
+
+// systemdTimeUnits are the time span units systemctl show prints
+var systemdTimeUnits = map[string]time.Duration{
+	"us":  time.Microsecond,
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"min": time.Minute,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+}
+
+// systemdDuration parses a systemd time span such as "100ms" or "1min 30s"
+// Unparsable spans (e.g. "infinity") are zero
+func systemdDuration(span string) time.Duration {
+	var total time.Duration
+	for _, field := range strings.Fields(span) {
+		i := strings.IndexFunc(field, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if i <= 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(field[:i], 64)
+		unit, ok := systemdTimeUnits[field[i:]]
+		if err != nil || !ok {
+			return 0
+		}
+		total += time.Duration(value * float64(unit))
+	}
+	return total
+}
+
+// unitStateToString maps a systemd ActiveState to the Windows state names,
+// so service reports and alert rules look the same on both platforms
+func unitStateToString(state string) string {
+	switch state {
+	case "active", "reloading":
+		return StateRunning
+	case "inactive", "failed":
+		return StateStopped
+	case "activating":
+		return StateStartPending
+	case "deactivating":
+		return StateStopPending
+	default:
+		return StateUnknown
+	}
+}
+
+// runSystemctl runs a non-blocking systemctl verb, keeping its output in the error
+func runSystemctl(verb, unit string) error {
+	return systemctlCommand(verb, "--no-block", "--", unit)
+}
+
+// systemctlCommand runs systemctl, keeping its output in the error
+func systemctlCommand(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("systemctl %s: %s", args[0], msg)
+		}
+		return fmt.Errorf("systemctl %s: %w", args[0], err)
+	}
+	return nil
+}
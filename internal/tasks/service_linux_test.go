@@ -0,0 +1,62 @@
+//go:build linux
+
+package tasks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestUnitStateToString tests the systemd to Windows state mapping
+func TestUnitStateToString(t *testing.T) {
+	tests := map[string]string{
+		"active":       StateRunning,
+		"reloading":    StateRunning,
+		"inactive":     StateStopped,
+		"failed":       StateStopped,
+		"activating":   StateStartPending,
+		"deactivating": StateStopPending,
+		"maintenance":  StateUnknown,
+	}
+	for state, want := range tests {
+		if got := unitStateToString(state); got != want {
+			t.Errorf("unitStateToString(%q) = %q, want %q", state, got, want)
+		}
+	}
+}
+
+// TestSystemdDuration tests parsing of systemctl show time spans
+func TestSystemdDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"100ms":      100 * time.Millisecond,
+		"5s":         5 * time.Second,
+		"1min 30s":   90 * time.Second,
+		"1.5s":       1500 * time.Millisecond,
+		"0":          0,
+		"infinity":   0,
+		"":           0,
+		"2h 1min 1s": 2*time.Hour + time.Minute + time.Second,
+	}
+	for span, want := range tests {
+		if got := systemdDuration(span); got != want {
+			t.Errorf("systemdDuration(%q) = %v, want %v", span, got, want)
+		}
+	}
+}
+
+// TestUnitProperties tests ExecStart and dependency list parsing
+func TestUnitProperties(t *testing.T) {
+	execStart := "{ path=/usr/sbin/sshd ; argv[]=/usr/sbin/sshd -D $SSHD_OPTS ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }"
+	if got := execStartCommand(execStart); got != "/usr/sbin/sshd -D $SSHD_OPTS" {
+		t.Errorf("execStartCommand() = %q", got)
+	}
+	if got := execStartCommand(""); got != "" {
+		t.Errorf("execStartCommand(\"\") = %q, want empty", got)
+	}
+
+	got := serviceUnits("sysinit.target nginx.service", "", "php-fpm.service nginx.service")
+	if want := []string{"nginx.service", "php-fpm.service"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceUnits() = %v, want %v", got, want)
+	}
+}
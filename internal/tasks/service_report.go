@@ -0,0 +1,35 @@
+package tasks
+
+import (
+	"time"
+)
+
+// ServiceReport is the service_check telemetry payload
+// On failure Services is empty and Status/Error describe what went wrong
+type ServiceReport struct {
+	Services  []ServiceStatus `json:"services"`
+	Status    string          `json:"status,omitempty"` // "error" when statuses could not be read
+	Error     string          `json:"error,omitempty"`
+	Timestamp string          `json:"timestamp"`
+}
+
+// CreateServiceReport wraps collected service statuses for publishing
+func CreateServiceReport(statuses []ServiceStatus) *ServiceReport {
+	if statuses == nil {
+		statuses = []ServiceStatus{}
+	}
+	return &ServiceReport{
+		Services:  statuses,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// CreateServiceError creates a report for a failed service check
+func CreateServiceError(err error) *ServiceReport {
+	return &ServiceReport{
+		Services:  []ServiceStatus{},
+		Status:    "error",
+		Error:     err.Error(),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
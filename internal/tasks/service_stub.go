@@ -1,4 +1,4 @@
-//go:build !windows
+//go:build !windows && !linux
 
 package tasks
 
@@ -7,73 +7,60 @@ import (
 	"runtime"
 )
 
-// ServiceStatus represents the status of a Windows service
-type ServiceStatus struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
+// unsupportedManager is the service backend on platforms without one
+type unsupportedManager struct{}
+
+// newServiceManager returns the platform service backend
+func newServiceManager() ServiceManager {
+	return unsupportedManager{}
 }
 
-// ControlService is a stub for non-Windows platforms
-func (e *Executor) ControlService(name, action string, allowedServices []string) (string, error) {
-	// Validate service is in whitelist (for testing)
-	if !isServiceAllowed(name, allowedServices) {
-		return "", fmt.Errorf("service not in allowed list: %s", name)
-	}
+// Query reports that services are not supported
+func (unsupportedManager) Query(name string) (string, error) {
+	return "", fmt.Errorf("service status not supported on %s", runtime.GOOS)
+}
 
-	// Validate action (for testing)
-	if action != "start" && action != "stop" && action != "restart" {
-		return "", fmt.Errorf("invalid action: %s (must be start, stop, or restart)", action)
-	}
+// Start reports that services are not supported
+func (unsupportedManager) Start(name string) error {
+	return fmt.Errorf("service control not supported on %s", runtime.GOOS)
+}
 
-	return "", fmt.Errorf("service control not supported on %s", runtime.GOOS)
+// Stop reports that services are not supported
+func (unsupportedManager) Stop(name string) error {
+	return fmt.Errorf("service control not supported on %s", runtime.GOOS)
 }
 
-// GetServiceStatuses is a stub for non-Windows platforms
-func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error) {
-	return nil, fmt.Errorf("service status not supported on %s", runtime.GOOS)
+// Pause reports that services are not supported
+func (unsupportedManager) Pause(name string) error {
+	return fmt.Errorf("service control not supported on %s", runtime.GOOS)
 }
 
-// isServiceAllowed checks if a service is in the allowed list
-func isServiceAllowed(name string, allowedServices []string) bool {
-	for _, allowed := range allowedServices {
-		if name == allowed {
-			return true
-		}
-	}
-	return false
+// Continue reports that services are not supported
+func (unsupportedManager) Continue(name string) error {
+	return fmt.Errorf("service control not supported on %s", runtime.GOOS)
 }
 
-// Mock state type for testing on non-Windows platforms
-type State uint32
+// StartType reports that services are not supported
+func (unsupportedManager) StartType(name string) (string, error) {
+	return "", fmt.Errorf("service status not supported on %s", runtime.GOOS)
+}
 
-const (
-	Stopped State = 1
-	StartPending State = 2
-	StopPending State = 3
-	Running State = 4
-	ContinuePending State = 5
-	PausePending State = 6
-	Paused State = 7
-)
+// SetStartType reports that services are not supported
+func (unsupportedManager) SetStartType(name, startType string) error {
+	return fmt.Errorf("service control not supported on %s", runtime.GOOS)
+}
 
-// stateToString converts a service state to a human-readable string
-func stateToString(state State) string {
-	switch state {
-	case Stopped:
-		return "Stopped"
-	case StartPending:
-		return "StartPending"
-	case StopPending:
-		return "StopPending"
-	case Running:
-		return "Running"
-	case ContinuePending:
-		return "ContinuePending"
-	case PausePending:
-		return "PausePending"
-	case Paused:
-		return "Paused"
-	default:
-		return "Unknown"
-	}
+// Dependents reports that services are not supported
+func (unsupportedManager) Dependents(name string) ([]string, error) {
+	return nil, fmt.Errorf("service status not supported on %s", runtime.GOOS)
+}
+
+// Details reports that services are not supported
+func (unsupportedManager) Details(name string) (*ServiceDetails, error) {
+	return nil, fmt.Errorf("service status not supported on %s", runtime.GOOS)
+}
+
+// List reports that services are not supported
+func (unsupportedManager) List() ([]string, error) {
+	return nil, fmt.Errorf("service status not supported on %s", runtime.GOOS)
 }
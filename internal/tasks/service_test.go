@@ -1,7 +1,14 @@
 package tasks
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 // TestIsServiceAllowed tests service whitelist validation
@@ -187,3 +194,440 @@ func TestControlService(t *testing.T) {
 		})
 	}
 }
+
+// useFastServicePolling shortens service state polling for the duration of the test
+func useFastServicePolling(t *testing.T) {
+	t.Helper()
+	prevTimeout, prevInterval := serviceStateTimeout, serviceStateInterval
+	serviceStateTimeout, serviceStateInterval = 50*time.Millisecond, time.Millisecond
+	t.Cleanup(func() {
+		serviceStateTimeout, serviceStateInterval = prevTimeout, prevInterval
+	})
+}
+
+// TestControlServiceSequencing tests the state machine against the fake backend
+func TestControlServiceSequencing(t *testing.T) {
+	useFastServicePolling(t)
+	allowed := []string{"Spooler"}
+
+	tests := []struct {
+		name      string
+		action    string
+		state     string
+		setup     func(f *FakeServiceManager)
+		wantCalls []string
+		wantState string
+		errText   string
+	}{
+		{
+			name:      "restart",
+			action:    "restart",
+			state:     StateRunning,
+			wantCalls: []string{"stop Spooler", "start Spooler"},
+			wantState: StateRunning,
+		},
+		{
+			name:      "stop",
+			action:    "stop",
+			state:     StateRunning,
+			wantCalls: []string{"stop Spooler"},
+			wantState: StateStopped,
+		},
+		{
+			name:      "start returns without waiting",
+			action:    "start",
+			state:     StateStopped,
+			wantCalls: []string{"start Spooler"},
+			wantState: StateStartPending,
+		},
+		{
+			name:      "stop hangs",
+			action:    "stop",
+			state:     StateRunning,
+			setup:     func(f *FakeServiceManager) { f.Hang("Spooler", "stop") },
+			wantCalls: []string{"stop Spooler"},
+			wantState: StateStopPending,
+			errText:   "did not stop in time",
+		},
+		{
+			name:      "restart hangs starting",
+			action:    "restart",
+			state:     StateRunning,
+			setup:     func(f *FakeServiceManager) { f.Hang("Spooler", "start") },
+			wantCalls: []string{"stop Spooler", "start Spooler"},
+			wantState: StateStartPending,
+			errText:   "service did not start after restart",
+		},
+		{
+			name:      "restart of a stopped service",
+			action:    "restart",
+			state:     StateStopped,
+			wantCalls: []string{"stop Spooler"},
+			wantState: StateStopped,
+			errText:   "failed to stop service for restart: service Spooler is not running",
+		},
+		{
+			name:      "restart start failure",
+			action:    "restart",
+			state:     StateRunning,
+			setup:     func(f *FakeServiceManager) { f.FailStart("Spooler", errors.New("access denied")) },
+			wantCalls: []string{"stop Spooler", "start Spooler"},
+			wantState: StateStopped,
+			errText:   "failed to start service after restart: access denied",
+		},
+		{
+			name:    "query failure",
+			action:  "start",
+			state:   StateStopped,
+			setup:   func(f *FakeServiceManager) { f.FailQuery("Spooler", errors.New("access denied")) },
+			errText: "failed to open service Spooler: access denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeServiceManager()
+			fake.Add("Spooler", tt.state)
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+			executor := NewExecutorWithServices(zap.NewNop(), 30*time.Second, fake)
+
+			_, err := executor.ControlService("Spooler", tt.action, allowed)
+			if tt.errText == "" && err != nil {
+				t.Fatalf("ControlService() error = %v", err)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Fatalf("ControlService() error = %v, want %q", err, tt.errText)
+			}
+			if calls := fake.Calls(); len(calls)+len(tt.wantCalls) > 0 && !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if tt.wantState != "" && fake.State("Spooler") != tt.wantState {
+				t.Errorf("state = %s, want %s", fake.State("Spooler"), tt.wantState)
+			}
+		})
+	}
+}
+
+// TestGetServiceStatusesFake tests status reporting including lookup failures
+func TestGetServiceStatusesFake(t *testing.T) {
+	fake := NewFakeServiceManager()
+	fake.Add("Spooler", StateRunning)
+	fake.Add("W32Time", StateStopped)
+	fake.Add("Locked", StateRunning)
+	fake.FailQuery("Locked", errors.New("access denied"))
+	executor := NewExecutorWithServices(zap.NewNop(), 30*time.Second, fake)
+
+	got, err := executor.GetServiceStatuses([]string{"Spooler", "W32Time", "Locked", "Missing"})
+	if err != nil {
+		t.Fatalf("GetServiceStatuses() error = %v", err)
+	}
+	want := []ServiceStatus{
+		{Name: "Spooler", Status: StateRunning},
+		{Name: "W32Time", Status: StateStopped},
+		{Name: "Locked", Status: "Error"},
+		{Name: "Missing", Status: "Error"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetServiceStatuses() = %+v, want %+v", got, want)
+	}
+}
+
+// TestRecoverService tests that recovery starts stopped services and cycles the rest
+func TestRecoverService(t *testing.T) {
+	useFastServicePolling(t)
+
+	tests := []struct {
+		name      string
+		state     string
+		setup     func(f *FakeServiceManager)
+		wantCalls []string
+		errText   string
+	}{
+		{name: "stopped", state: StateStopped, wantCalls: []string{"start Spooler"}},
+		{name: "paused", state: StatePaused, wantCalls: []string{"stop Spooler", "start Spooler"}},
+		{
+			name:      "start hangs",
+			state:     StateStopped,
+			setup:     func(f *FakeServiceManager) { f.Hang("Spooler", "start") },
+			wantCalls: []string{"start Spooler"},
+			errText:   "service did not start",
+		},
+		{
+			name:      "stop fails",
+			state:     StateStopPending,
+			setup:     func(f *FakeServiceManager) { f.FailStop("Spooler", errors.New("not accepting controls")) },
+			wantCalls: []string{"stop Spooler"},
+			errText:   "failed to stop StopPending service: not accepting controls",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeServiceManager()
+			fake.Add("Spooler", tt.state)
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+			executor := NewExecutorWithServices(zap.NewNop(), 30*time.Second, fake)
+
+			err := executor.RecoverService("Spooler")
+			if tt.errText == "" && err != nil {
+				t.Fatalf("RecoverService() error = %v", err)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Fatalf("RecoverService() error = %v, want %q", err, tt.errText)
+			}
+			if calls := fake.Calls(); !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if tt.errText == "" && fake.State("Spooler") != StateRunning {
+				t.Errorf("state = %s, want Running", fake.State("Spooler"))
+			}
+		})
+	}
+}
+
+// TestControlServiceWith tests pause/continue, startup types and dependency-aware control
+func TestControlServiceWith(t *testing.T) {
+	useFastServicePolling(t)
+
+	tests := []struct {
+		name        string
+		req         ServiceControl
+		allowed     []string
+		setup       func(f *FakeServiceManager)
+		wantCalls   []string
+		wantState   string
+		wantStartup string
+		wantDeps    []string
+		wantStopped []string // StoppedDependents with an error
+		errText     string
+	}{
+		{
+			name:        "pause",
+			req:         ServiceControl{Name: "W3SVC", Action: ServiceActionPause},
+			wantCalls:   []string{"pause W3SVC"},
+			wantState:   StatePaused,
+			wantStartup: StartTypeManual,
+		},
+		{
+			name:      "continue",
+			req:       ServiceControl{Name: "W3SVC", Action: ServiceActionContinue},
+			setup:     func(f *FakeServiceManager) { f.Add("W3SVC", StatePaused) },
+			wantCalls: []string{"continue W3SVC"},
+			wantState: StateRunning,
+		},
+		{
+			name:      "continue a running service",
+			req:       ServiceControl{Name: "W3SVC", Action: ServiceActionContinue},
+			wantCalls: []string{"continue W3SVC"},
+			errText:   "failed to continue service: service W3SVC is not paused",
+		},
+		{
+			name:        "set startup type",
+			req:         ServiceControl{Name: "W3SVC", Action: ServiceActionSetStartup, StartupType: StartTypeDelayed},
+			wantCalls:   []string{"set_startup W3SVC AutomaticDelayedStart"},
+			wantState:   StateRunning,
+			wantStartup: StartTypeDelayed,
+		},
+		{
+			name:    "invalid startup type",
+			req:     ServiceControl{Name: "W3SVC", Action: ServiceActionSetStartup, StartupType: "Boot"},
+			errText: "invalid startup_type",
+		},
+		{
+			name: "start a disabled service",
+			req:  ServiceControl{Name: "W3SVC", Action: ServiceActionStart},
+			setup: func(f *FakeServiceManager) {
+				f.Add("W3SVC", StateStopped)
+				f.SetStartType("W3SVC", StartTypeDisabled)
+			},
+			wantCalls: []string{"set_startup W3SVC Disabled", "start W3SVC"},
+			errText:   "service W3SVC is disabled",
+		},
+		{
+			name:      "restart with dependents",
+			req:       ServiceControl{Name: "HTTP", Action: ServiceActionRestart, IncludeDependents: true},
+			wantCalls: []string{"stop WAS", "stop W3SVC", "stop HTTP", "start HTTP", "start W3SVC", "start WAS"},
+			wantState: StateRunning,
+			wantDeps:  []string{"WAS", "W3SVC"},
+		},
+		{
+			name: "stopped dependents are left alone",
+			req:  ServiceControl{Name: "HTTP", Action: ServiceActionStop, IncludeDependents: true},
+			setup: func(f *FakeServiceManager) {
+				f.Add("WAS", StateStopped)
+			},
+			wantCalls: []string{"stop W3SVC", "stop HTTP"},
+			wantState: StateStopped,
+			wantDeps:  []string{"W3SVC"},
+		},
+		{
+			name:    "dependent not allowed",
+			req:     ServiceControl{Name: "HTTP", Action: ServiceActionRestart, IncludeDependents: true},
+			allowed: []string{"HTTP", "W3SVC"},
+			errText: "dependent service not in allowed list: WAS",
+		},
+		{
+			name:      "failed restart starts the dependents again",
+			req:       ServiceControl{Name: "HTTP", Action: ServiceActionRestart, IncludeDependents: true},
+			setup:     func(f *FakeServiceManager) { f.FailStart("HTTP", errors.New("access denied")) },
+			wantCalls: []string{"stop WAS", "stop W3SVC", "stop HTTP", "start HTTP", "start W3SVC", "start WAS"},
+			errText:   "failed to start service after restart: access denied",
+		},
+		{
+			name:      "failed stop starts the dependents again",
+			req:       ServiceControl{Name: "HTTP", Action: ServiceActionStop, IncludeDependents: true},
+			setup:     func(f *FakeServiceManager) { f.FailStop("HTTP", errors.New("access denied")) },
+			wantCalls: []string{"stop WAS", "stop W3SVC", "stop HTTP", "start W3SVC", "start WAS"},
+			errText:   "failed to stop service: access denied",
+		},
+		{
+			name: "dependents left stopped are reported",
+			req:  ServiceControl{Name: "HTTP", Action: ServiceActionRestart, IncludeDependents: true},
+			setup: func(f *FakeServiceManager) {
+				f.FailStart("HTTP", errors.New("access denied"))
+				f.FailStart("W3SVC", errors.New("access denied"))
+			},
+			wantCalls:   []string{"stop WAS", "stop W3SVC", "stop HTTP", "start HTTP", "start W3SVC", "start WAS"},
+			wantStopped: []string{"W3SVC"},
+			errText:     "dependent services left stopped: W3SVC",
+		},
+		{
+			name:        "dependent that does not start after a restart",
+			req:         ServiceControl{Name: "HTTP", Action: ServiceActionRestart, IncludeDependents: true},
+			setup:       func(f *FakeServiceManager) { f.FailStart("WAS", errors.New("access denied")) },
+			wantCalls:   []string{"stop WAS", "stop W3SVC", "stop HTTP", "start HTTP", "start W3SVC", "start WAS"},
+			wantStopped: []string{"WAS"},
+			errText:     "service HTTP restarted, but dependent services did not start: WAS",
+		},
+		{
+			name:    "dependents with pause",
+			req:     ServiceControl{Name: "HTTP", Action: ServiceActionPause, IncludeDependents: true},
+			errText: "include_dependents only applies to stop and restart",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// HTTP <- W3SVC <- WAS, all running
+			fake := NewFakeServiceManager()
+			for _, name := range []string{"HTTP", "W3SVC", "WAS"} {
+				fake.Add(name, StateRunning)
+			}
+			fake.SetDependents("HTTP", "W3SVC")
+			fake.SetDependents("W3SVC", "WAS")
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+			allowed := tt.allowed
+			if allowed == nil {
+				allowed = []string{"HTTP", "W3SVC", "WAS"}
+			}
+			executor := NewExecutorWithServices(zap.NewNop(), 30*time.Second, fake)
+
+			result, err := executor.ControlServiceWith(tt.req, allowed)
+			if tt.errText == "" && err != nil {
+				t.Fatalf("ControlServiceWith() error = %v", err)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Fatalf("ControlServiceWith() error = %v, want %q", err, tt.errText)
+			}
+			if calls := fake.Calls(); len(calls)+len(tt.wantCalls) > 0 && !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if err != nil {
+				var stopped []string
+				if result != nil {
+					stopped = result.StoppedDependents
+				}
+				if !reflect.DeepEqual(stopped, tt.wantStopped) {
+					t.Errorf("StoppedDependents = %v, want %v", stopped, tt.wantStopped)
+				}
+				return
+			}
+			if result.State != tt.wantState {
+				t.Errorf("State = %s, want %s", result.State, tt.wantState)
+			}
+			if tt.wantStartup != "" && result.StartupType != tt.wantStartup {
+				t.Errorf("StartupType = %s, want %s", result.StartupType, tt.wantStartup)
+			}
+			if !reflect.DeepEqual(result.Dependents, tt.wantDeps) {
+				t.Errorf("Dependents = %v, want %v", result.Dependents, tt.wantDeps)
+			}
+		})
+	}
+}
+
+// TestExpandServices tests that patterns are expanded against the installed services
+func TestExpandServices(t *testing.T) {
+	fake := NewFakeServiceManager()
+	for _, name := range []string{"MSSQL$PROD", "MSSQL$DEV", "MSSQLSERVER", "Spooler"} {
+		fake.Add(name, StateRunning)
+	}
+	executor := NewExecutorWithServices(zap.NewNop(), 30*time.Second, fake)
+
+	got, err := executor.ExpandServices([]string{"Spooler", "MSSQL$*", "Missing", "MSSQL$PROD"})
+	if err != nil {
+		t.Fatalf("ExpandServices() error = %v", err)
+	}
+	if want := []string{"Spooler", "MSSQL$DEV", "MSSQL$PROD", "Missing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandServices() = %v, want %v", got, want)
+	}
+
+	// Re-expanded each call, so uninstalled services drop out
+	fake.Remove("MSSQL$DEV")
+	got, _ = executor.ExpandServices([]string{"MSSQL$*"})
+	if want := []string{"MSSQL$PROD"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandServices() after removal = %v, want %v", got, want)
+	}
+}
+
+// TestQueryService tests service details through the fake backend
+func TestQueryService(t *testing.T) {
+	fake := NewFakeServiceManager()
+	fake.Add("W3SVC", StateRunning)
+	fake.SetDependents("W3SVC", "WAS")
+	fake.SetDetails("W3SVC", ServiceDetails{
+		DisplayName:  "World Wide Web Publishing Service",
+		BinaryPath:   `C:\Windows\system32\svchost.exe -k iissvcs`,
+		Account:      "LocalSystem",
+		PID:          4242,
+		Dependencies: []string{"HTTP"},
+	})
+	executor := NewExecutorWithServices(zap.NewNop(), 30*time.Second, fake)
+
+	details, err := executor.QueryService("W3SVC")
+	if err != nil {
+		t.Fatalf("QueryService() error = %v", err)
+	}
+	if details.Name != "W3SVC" || details.State != StateRunning || details.StartType != StartTypeManual || details.PID != 4242 {
+		t.Errorf("details = %+v", details)
+	}
+	if !reflect.DeepEqual(details.Dependents, []string{"WAS"}) || details.RecoveryActions == nil {
+		t.Errorf("dependents = %v, recovery actions = %v", details.Dependents, details.RecoveryActions)
+	}
+
+	if _, err := executor.QueryService("Missing"); err == nil || !strings.Contains(err.Error(), "failed to query service Missing") {
+		t.Errorf("QueryService(Missing) error = %v", err)
+	}
+}
+
+// TestServiceReportServices tests services is always an array, as before the
+// envelope, including in error reports
+func TestServiceReportServices(t *testing.T) {
+	for name, report := range map[string]*ServiceReport{
+		"no services": CreateServiceReport(nil),
+		"error":       CreateServiceError(errors.New("access denied")),
+	} {
+		data, err := json.Marshal(report)
+		if err != nil {
+			t.Fatalf("%s: Marshal() error = %v", name, err)
+		}
+		if !strings.Contains(string(data), `"services":[]`) {
+			t.Errorf("%s: report = %s, want an empty services array", name, data)
+		}
+	}
+}
@@ -4,183 +4,259 @@ package tasks
 
 import (
 	"fmt"
-	"time"
+	"unsafe"
 
-	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
 )
 
-// ServiceStatus represents the status of a Windows service
-type ServiceStatus struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
+// scmManager controls Windows services through the Service Control Manager
+// Each call opens its own SCM connection, so it is safe for concurrent use
+type scmManager struct{}
+
+// newServiceManager returns the platform service backend
+func newServiceManager() ServiceManager {
+	return scmManager{}
 }
 
-// ControlService starts, stops, or restarts a Windows service
-// Only services in the allowedServices list can be controlled
-func (e *Executor) ControlService(name, action string, allowedServices []string) (string, error) {
-	// Validate service is in whitelist
-	if !isServiceAllowed(name, allowedServices) {
-		return "", fmt.Errorf("service not in allowed list: %s", name)
-	}
+// Query returns the current state of a service
+func (scmManager) Query(name string) (string, error) {
+	var state string
+	err := withService(name, func(s *mgr.Service) error {
+		status, err := s.Query()
+		if err != nil {
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+		state = stateToString(status.State)
+		return nil
+	})
+	return state, err
+}
 
-	// Connect to service manager
-	m, err := mgr.Connect()
-	if err != nil {
-		return "", fmt.Errorf("failed to connect to service manager: %w", err)
-	}
-	defer m.Disconnect()
+// Start requests a service start without waiting for it
+func (scmManager) Start(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		return s.Start()
+	})
+}
 
-	// Open the service
-	s, err := m.OpenService(name)
-	if err != nil {
-		return "", fmt.Errorf("failed to open service %s: %w", name, err)
-	}
-	defer s.Close()
+// Stop sends the stop control without waiting for the service to stop
+func (scmManager) Stop(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		_, err := s.Control(svc.Stop)
+		return err
+	})
+}
 
-	// Perform the requested action
-	switch action {
-	case "start":
-		if err := s.Start(); err != nil {
-			return "", fmt.Errorf("failed to start service: %w", err)
-		}
-		return fmt.Sprintf("Service %s started successfully", name), nil
+// Pause sends the pause control without waiting for the service to pause
+func (scmManager) Pause(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		_, err := s.Control(svc.Pause)
+		return err
+	})
+}
+
+// Continue sends the continue control without waiting for the service to resume
+func (scmManager) Continue(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		_, err := s.Control(svc.Continue)
+		return err
+	})
+}
 
-	case "stop":
-		status, err := s.Control(svc.Stop)
+// StartType returns the configured startup type
+func (scmManager) StartType(name string) (string, error) {
+	var startType string
+	err := withService(name, func(s *mgr.Service) error {
+		cfg, err := s.Config()
 		if err != nil {
-			return "", fmt.Errorf("failed to stop service: %w", err)
+			return fmt.Errorf("failed to query service config: %w", err)
 		}
-		// Wait for service to stop (with timeout)
-		if err := waitForServiceState(s, svc.Stopped, 30*time.Second); err != nil {
-			return "", fmt.Errorf("service did not stop in time: %w", err)
-		}
-		return fmt.Sprintf("Service %s stopped successfully (status: %v)", name, status.State), nil
+		startType = startTypeToString(cfg.StartType, cfg.DelayedAutoStart)
+		return nil
+	})
+	return startType, err
+}
 
-	case "restart":
-		// Stop the service first
-		if _, err := s.Control(svc.Stop); err != nil {
-			return "", fmt.Errorf("failed to stop service for restart: %w", err)
-		}
-		
-		// Wait for service to stop
-		if err := waitForServiceState(s, svc.Stopped, 30*time.Second); err != nil {
-			return "", fmt.Errorf("service did not stop for restart: %w", err)
-		}
+// SetStartType changes only the startup type, leaving the rest of the
+// service configuration untouched
+func (scmManager) SetStartType(name, startType string) error {
+	var scmStart uint32
+	switch startType {
+	case StartTypeAutomatic, StartTypeDelayed:
+		scmStart = mgr.StartAutomatic
+	case StartTypeManual:
+		scmStart = mgr.StartManual
+	case StartTypeDisabled:
+		scmStart = mgr.StartDisabled
+	default:
+		return fmt.Errorf("unsupported startup type: %s", startType)
+	}
 
-		// Start the service
-		if err := s.Start(); err != nil {
-			return "", fmt.Errorf("failed to start service after restart: %w", err)
+	return withService(name, func(s *mgr.Service) error {
+		err := windows.ChangeServiceConfig(s.Handle, windows.SERVICE_NO_CHANGE, scmStart, windows.SERVICE_NO_CHANGE,
+			nil, nil, nil, nil, nil, nil, nil)
+		if err != nil {
+			return err
 		}
-
-		// Wait for service to start
-		if err := waitForServiceState(s, svc.Running, 30*time.Second); err != nil {
-			return "", fmt.Errorf("service did not start after restart: %w", err)
+		if scmStart != mgr.StartAutomatic {
+			return nil
 		}
-
-		return fmt.Sprintf("Service %s restarted successfully", name), nil
-
-	default:
-		return "", fmt.Errorf("invalid action: %s (must be start, stop, or restart)", action)
-	}
+		var delayed windows.SERVICE_DELAYED_AUTO_START_INFO
+		if startType == StartTypeDelayed {
+			delayed.IsDelayedAutoStartUp = 1
+		}
+		return windows.ChangeServiceConfig2(s.Handle, windows.SERVICE_CONFIG_DELAYED_AUTO_START_INFO, (*byte)(unsafe.Pointer(&delayed)))
+	})
 }
 
-// GetServiceStatuses retrieves the status of all configured services
-func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error) {
-	// Connect to service manager
-	m, err := mgr.Connect()
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to service manager: %w", err)
-	}
-	defer m.Disconnect()
-
-	var statuses []ServiceStatus
+// Dependents returns the services that depend directly on name, in any state
+func (scmManager) Dependents(name string) ([]string, error) {
+	var dependents []string
+	err := withService(name, func(s *mgr.Service) error {
+		var err error
+		dependents, err = s.ListDependentServices(svc.AnyActivity)
+		return err
+	})
+	return dependents, err
+}
 
-	for _, name := range services {
-		s, err := m.OpenService(name)
+// Details reads the service configuration, status and failure actions
+func (scmManager) Details(name string) (*ServiceDetails, error) {
+	var details *ServiceDetails
+	err := withService(name, func(s *mgr.Service) error {
+		status, err := s.Query()
 		if err != nil {
-			e.logger.Warn("Failed to open service",
-				zap.String("service", name),
-				zap.Error(err))
-			statuses = append(statuses, ServiceStatus{
-				Name:   name,
-				Status: "Error",
-			})
-			continue
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+		cfg, err := s.Config()
+		if err != nil {
+			return fmt.Errorf("failed to query service config: %w", err)
+		}
+		dependents, err := s.ListDependentServices(svc.AnyActivity)
+		if err != nil {
+			return fmt.Errorf("failed to list dependent services: %w", err)
 		}
 
-		status, err := s.Query()
-		s.Close()
+		details = &ServiceDetails{
+			Name:         name,
+			DisplayName:  cfg.DisplayName,
+			State:        stateToString(status.State),
+			StartType:    startTypeToString(cfg.StartType, cfg.DelayedAutoStart),
+			BinaryPath:   cfg.BinaryPathName,
+			Account:      cfg.ServiceStartName,
+			PID:          status.ProcessId,
+			Dependencies: cfg.Dependencies,
+			Dependents:   dependents,
+		}
 
+		// Failure actions are optional; a service without them has none
+		actions, err := s.RecoveryActions()
 		if err != nil {
-			e.logger.Warn("Failed to query service",
-				zap.String("service", name),
-				zap.Error(err))
-			statuses = append(statuses, ServiceStatus{
-				Name:   name,
-				Status: "Error",
+			return fmt.Errorf("failed to query recovery actions: %w", err)
+		}
+		for _, action := range actions {
+			details.RecoveryActions = append(details.RecoveryActions, ServiceRecoveryAction{
+				Type:    recoveryActionToString(action.Type),
+				DelayMs: action.Delay.Milliseconds(),
 			})
-			continue
 		}
+		if len(actions) > 0 {
+			if details.RecoveryResetSeconds, err = s.ResetPeriod(); err != nil {
+				return fmt.Errorf("failed to query recovery reset period: %w", err)
+			}
+			if details.RecoveryCommand, err = s.RecoveryCommand(); err != nil {
+				return fmt.Errorf("failed to query recovery command: %w", err)
+			}
+		}
+		return nil
+	})
+	return details, err
+}
 
-		statuses = append(statuses, ServiceStatus{
-			Name:   name,
-			Status: stateToString(status.State),
-		})
+// List returns the names of all installed services
+func (scmManager) List() ([]string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to service manager: %w", err)
 	}
-
-	return statuses, nil
+	defer m.Disconnect()
+	return m.ListServices()
 }
 
-// isServiceAllowed checks if a service is in the allowed list
-func isServiceAllowed(name string, allowedServices []string) bool {
-	for _, allowed := range allowedServices {
-		if name == allowed {
-			return true
-		}
+// withService connects to the SCM and opens a service for fn
+func withService(name string, fn func(s *mgr.Service) error) error {
+	// Connect to service manager
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
 	}
-	return false
-}
+	defer m.Disconnect()
 
-// waitForServiceState waits for a service to reach a specific state
-func waitForServiceState(s *mgr.Service, targetState svc.State, timeout time.Duration) error {
-	deadline := time.Now().Add(timeout)
-	
-	for time.Now().Before(deadline) {
-		status, err := s.Query()
-		if err != nil {
-			return err
-		}
-		
-		if status.State == targetState {
-			return nil
-		}
-		
-		time.Sleep(500 * time.Millisecond)
+	// Open the service; callers add the service name to the error
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
 	}
-	
-	return fmt.Errorf("timeout waiting for service state")
+	defer s.Close()
+
+	return fn(s)
 }
 
 // stateToString converts a service state to a human-readable string
 func stateToString(state svc.State) string {
 	switch state {
 	case svc.Stopped:
-		return "Stopped"
+		return StateStopped
 	case svc.StartPending:
-		return "StartPending"
+		return StateStartPending
 	case svc.StopPending:
-		return "StopPending"
+		return StateStopPending
 	case svc.Running:
-		return "Running"
+		return StateRunning
 	case svc.ContinuePending:
-		return "ContinuePending"
+		return StateContinuePending
 	case svc.PausePending:
-		return "PausePending"
+		return StatePausePending
 	case svc.Paused:
-		return "Paused"
+		return StatePaused
+	default:
+		return StateUnknown
+	}
+}
+
+// startTypeToString converts an SCM start type to its PowerShell name
+func startTypeToString(startType uint32, delayed bool) string {
+	switch startType {
+	case mgr.StartAutomatic:
+		if delayed {
+			return StartTypeDelayed
+		}
+		return StartTypeAutomatic
+	case mgr.StartManual:
+		return StartTypeManual
+	case mgr.StartDisabled:
+		return StartTypeDisabled
+	case windows.SERVICE_BOOT_START:
+		return StartTypeBoot
+	case windows.SERVICE_SYSTEM_START:
+		return StartTypeSystem
+	default:
+		return StartTypeUnknown
+	}
+}
+
+// recoveryActionToString converts an SCM failure action type
+func recoveryActionToString(action int) string {
+	switch action {
+	case mgr.ServiceRestart:
+		return RecoveryActionRestart
+	case mgr.ComputerReboot:
+		return RecoveryActionReboot
+	case mgr.RunCommand:
+		return RecoveryActionCommand
 	default:
-		return "Unknown"
+		return RecoveryActionNone
 	}
 }
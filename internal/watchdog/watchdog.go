@@ -0,0 +1,328 @@
+package watchdog
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/alerts"
+	"win-agent/internal/config"
+	"win-agent/internal/tasks"
+)
+
+// Recovery event types
+const (
+	EventAttempt   = "recovery_attempt"   // A recovery is starting
+	EventSucceeded = "recovery_succeeded" // The service is Running again
+	EventFailed    = "recovery_failed"    // The attempt failed; another follows after the backoff
+	EventExhausted = "recovery_exhausted" // max_restarts reached within the window; no more attempts
+)
+
+// AlertRule is the rule name of the alert raised when a recovery budget is exhausted
+const AlertRule = "service_recovery"
+
+// ScriptResult is the outcome of a pre or post recovery script
+type ScriptResult struct {
+	Script   string `json:"script"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Event is published to {prefix}.{device_id}.events.recovery
+type Event struct {
+	Event       string        `json:"event"`
+	Service     string        `json:"service"`
+	Status      string        `json:"status"`                 // Service status that triggered the recovery
+	Attempt     int           `json:"attempt"`                // Attempt number within the window
+	MaxRestarts int           `json:"max_restarts"`           // Attempts allowed per window
+	Error       string        `json:"error,omitempty"`        // Why the attempt failed
+	PreScript   *ScriptResult `json:"pre_script,omitempty"`   // Outcome events only
+	PostScript  *ScriptResult `json:"post_script,omitempty"`  // Outcome events only
+	DurationMs  int64         `json:"duration_ms,omitempty"`  // Outcome events only
+	NextAttempt string        `json:"next_attempt,omitempty"` // Earliest next attempt after a failure
+	Timestamp   string        `json:"timestamp"`
+}
+
+// Recoverer restarts services and runs recovery scripts (*tasks.Executor)
+type Recoverer interface {
+	RecoverService(name string) error
+	ExecuteCommand(command string, allowedCommands []string, scriptsDir string, timeout time.Duration) (string, int, error)
+}
+
+// serviceState tracks one service's failures and recovery budget
+type serviceState struct {
+	policy      config.RecoveryPolicy // With defaults applied
+	failures    int                   // Consecutive checks not Running
+	attempts    []time.Time           // Attempts within the window
+	backoff     time.Duration         // Wait after the next attempt
+	nextAttempt time.Time
+	inFlight    bool
+	exhausted   time.Time // When the budget ran out (zero while attempts remain)
+	status      string    // Status that exhausted the budget
+	name        string    // Service name as reported by that check
+}
+
+// Watchdog recovers services with a recovery policy when service checks
+// find them not Running. Recoveries run in the background; their events
+// are handed to publish, and exhausted budgets are raised through alert
+type Watchdog struct {
+	mu            sync.Mutex
+	wg            sync.WaitGroup
+	logger        *zap.Logger
+	recoverer     Recoverer
+	services      map[string]*serviceState // By config.ServiceKey
+	scriptsDir    string
+	scriptTimeout time.Duration
+	publish       func(Event)
+	alert         func(alerts.Event)
+}
+
+// New creates a watchdog for the service_check recovery policies
+func New(logger *zap.Logger, recoverer Recoverer, cfg *config.Config, publish func(Event), alert func(alerts.Event)) *Watchdog {
+	w := &Watchdog{
+		logger:        logger,
+		recoverer:     recoverer,
+		services:      make(map[string]*serviceState),
+		scriptsDir:    cfg.Commands.ScriptsDirectory,
+		scriptTimeout: cfg.Commands.Timeout,
+		publish:       publish,
+		alert:         alert,
+	}
+	for _, policy := range cfg.Tasks.ServiceCheck.Recovery {
+		policy = withDefaults(policy)
+		w.services[config.ServiceKey(policy.Service)] = &serviceState{policy: policy, backoff: policy.Backoff}
+	}
+	return w
+}
+
+// recovery is an attempt started by Observe
+type recovery struct {
+	policy config.RecoveryPolicy
+	event  Event
+	next   time.Time
+}
+
+// Observe updates failure counts from a service check and starts any
+// recovery that is due
+// Events and alerts are collected under the lock and emitted after it is
+// released, so publish and alert may block or call back into the watchdog
+// A nil watchdog (no recovery policies) does nothing
+func (w *Watchdog) Observe(statuses []tasks.ServiceStatus, now time.Time) {
+	if w == nil {
+		return
+	}
+	events, alertEvents, recoveries := w.observe(statuses, now)
+
+	for _, event := range events {
+		w.publish(event)
+	}
+	for _, event := range alertEvents {
+		w.alert(event)
+	}
+	for _, r := range recoveries {
+		go w.recover(r.policy, r.event, r.next)
+	}
+}
+
+// observe updates the state under the lock and returns what Observe emits
+func (w *Watchdog) observe(statuses []tasks.ServiceStatus, now time.Time) (events []Event, alertEvents []alerts.Event, recoveries []recovery) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, status := range statuses {
+		state, ok := w.services[config.ServiceKey(status.Name)]
+		if !ok {
+			continue
+		}
+		policy := &state.policy
+
+		if status.Status == tasks.StateRunning {
+			state.failures = 0
+			if !state.exhausted.IsZero() {
+				alertEvents = append(alertEvents, w.exhaustedAlert(alerts.EventResolved, state, status.Name, status.Status, now))
+				state.exhausted = time.Time{}
+			}
+			continue
+		}
+
+		state.failures++
+		if state.inFlight || !state.exhausted.IsZero() || state.failures < policy.FailedChecks || now.Before(state.nextAttempt) {
+			continue
+		}
+
+		// Budget: attempts within the window; a quiet window resets the backoff
+		cutoff := now.Add(-policy.Window)
+		recent := state.attempts[:0]
+		for _, at := range state.attempts {
+			if at.After(cutoff) {
+				recent = append(recent, at)
+			}
+		}
+		state.attempts = recent
+		if len(state.attempts) == 0 {
+			state.backoff = policy.Backoff
+		}
+
+		if len(state.attempts) >= policy.MaxRestarts {
+			state.exhausted = now
+			state.status = status.Status
+			state.name = status.Name
+			w.logger.Error("Service recovery budget exhausted, giving up",
+				zap.String("service", status.Name),
+				zap.Int("max_restarts", policy.MaxRestarts),
+				zap.Duration("window", policy.Window))
+			events = append(events, Event{
+				Event:       EventExhausted,
+				Service:     status.Name,
+				Status:      status.Status,
+				Attempt:     len(state.attempts),
+				MaxRestarts: policy.MaxRestarts,
+				Timestamp:   now.UTC().Format(time.RFC3339),
+			})
+			alertEvents = append(alertEvents, w.exhaustedAlert(alerts.EventFiring, state, status.Name, status.Status, now))
+			continue
+		}
+
+		state.attempts = append(state.attempts, now)
+		state.nextAttempt = now.Add(state.backoff)
+		state.backoff = min(state.backoff*2, policy.MaxBackoff)
+		state.inFlight = true
+
+		attempt := Event{
+			Event:       EventAttempt,
+			Service:     status.Name,
+			Status:      status.Status,
+			Attempt:     len(state.attempts),
+			MaxRestarts: policy.MaxRestarts,
+			Timestamp:   now.UTC().Format(time.RFC3339),
+		}
+		// Counted here so Wait covers recoveries not started yet
+		w.wg.Add(1)
+		recoveries = append(recoveries, recovery{policy: *policy, event: attempt, next: state.nextAttempt})
+	}
+	return events, alertEvents, recoveries
+}
+
+// Wait blocks until running recoveries have finished
+func (w *Watchdog) Wait() {
+	if w == nil {
+		return
+	}
+	w.wg.Wait()
+}
+
+// Active returns the alerts of services whose recovery budget is exhausted,
+// for the health response
+// A nil watchdog (no recovery policies) has none
+func (w *Watchdog) Active() []alerts.Alert {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var active []alerts.Alert
+	for _, state := range w.services {
+		if !state.exhausted.IsZero() {
+			active = append(active, w.exhaustedAlert(alerts.EventFiring, state, state.name, state.status, state.exhausted).Alert)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Target < active[j].Target })
+	return active
+}
+
+// recover runs one attempt: pre script, restart, post script
+func (w *Watchdog) recover(policy config.RecoveryPolicy, event Event, next time.Time) {
+	defer w.wg.Done()
+
+	w.logger.Warn("Recovering service",
+		zap.String("service", event.Service),
+		zap.String("status", event.Status),
+		zap.Int("attempt", event.Attempt),
+		zap.Int("max_restarts", event.MaxRestarts))
+	w.publish(event)
+
+	start := time.Now()
+	if policy.PreScript != "" {
+		event.PreScript = w.runScript(policy.PreScript)
+	}
+	err := w.recoverer.RecoverService(event.Service)
+	if policy.PostScript != "" {
+		event.PostScript = w.runScript(policy.PostScript)
+	}
+	end := time.Now()
+
+	event.Event = EventSucceeded
+	event.DurationMs = end.Sub(start).Milliseconds()
+	event.Timestamp = end.UTC().Format(time.RFC3339)
+	if err != nil {
+		event.Event = EventFailed
+		event.Error = err.Error()
+		event.NextAttempt = next.UTC().Format(time.RFC3339)
+		w.logger.Error("Service recovery failed",
+			zap.String("service", event.Service),
+			zap.Int("attempt", event.Attempt),
+			zap.Error(err))
+	} else {
+		w.logger.Info("Service recovered",
+			zap.String("service", event.Service),
+			zap.Int("attempt", event.Attempt),
+			zap.Int64("duration_ms", event.DurationMs))
+	}
+
+	w.mu.Lock()
+	w.services[event.Service].inFlight = false
+	w.mu.Unlock()
+
+	w.publish(event)
+}
+
+// runScript runs a recovery script from scripts_directory
+// Failures are reported in the result and do not stop the recovery
+func (w *Watchdog) runScript(script string) *ScriptResult {
+	_, exitCode, err := w.recoverer.ExecuteCommand(script, nil, w.scriptsDir, w.scriptTimeout)
+	result := &ScriptResult{Script: script, ExitCode: exitCode}
+	if err != nil {
+		result.Error = err.Error()
+		w.logger.Warn("Recovery script failed", zap.String("script", script), zap.Error(err))
+	}
+	return result
+}
+
+// exhaustedAlert builds the alert for a service whose budget ran out
+func (w *Watchdog) exhaustedAlert(kind string, state *serviceState, service, status string, now time.Time) alerts.Event {
+	return alerts.Event{
+		Event: kind,
+		Alert: alerts.Alert{
+			Rule:      AlertRule,
+			Severity:  config.AlertSeverityCritical,
+			Target:    service,
+			Condition: fmt.Sprintf("%d recovery attempts within %v did not keep %s running", state.policy.MaxRestarts, state.policy.Window, service),
+			Status:    status,
+			Since:     state.exhausted.UTC().Format(time.RFC3339),
+		},
+		Timestamp: now.UTC().Format(time.RFC3339),
+	}
+}
+
+// withDefaults fills unset policy fields
+func withDefaults(policy config.RecoveryPolicy) config.RecoveryPolicy {
+	if policy.FailedChecks == 0 {
+		policy.FailedChecks = config.DefaultRecoveryFailedChecks
+	}
+	if policy.Backoff == 0 {
+		policy.Backoff = config.DefaultRecoveryBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = max(config.DefaultRecoveryMaxBackoff, policy.Backoff)
+	}
+	if policy.MaxRestarts == 0 {
+		policy.MaxRestarts = config.DefaultRecoveryMaxRestarts
+	}
+	if policy.Window == 0 {
+		policy.Window = config.DefaultRecoveryWindow
+	}
+	return policy
+}
@@ -0,0 +1,283 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"win-agent/internal/alerts"
+	"win-agent/internal/config"
+	"win-agent/internal/tasks"
+)
+
+// fakeRecoverer records recoveries and scripts
+type fakeRecoverer struct {
+	mu        sync.Mutex
+	calls     []string
+	recoverOK bool
+}
+
+// RecoverService records the call and fails unless recoverOK
+func (f *fakeRecoverer) RecoverService(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "recover "+name)
+	if !f.recoverOK {
+		return errors.New("service did not start")
+	}
+	return nil
+}
+
+// ExecuteCommand records the script and succeeds
+func (f *fakeRecoverer) ExecuteCommand(command string, allowedCommands []string, scriptsDir string, timeout time.Duration) (string, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "script "+command)
+	return "", 0, nil
+}
+
+// recorder collects published events
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+	alerts []alerts.Event
+}
+
+// publish records a recovery event
+func (r *recorder) publish(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// alert records an alert event
+func (r *recorder) alert(e alerts.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, e)
+}
+
+// take returns the published events and resets the list
+func (r *recorder) take() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// kinds returns the published event types and resets the list
+func (r *recorder) kinds() []string {
+	var kinds []string
+	for _, e := range r.take() {
+		kinds = append(kinds, e.Event)
+	}
+	return kinds
+}
+
+// newTestWatchdog creates a watchdog with one policy for "Spooler"
+func newTestWatchdog(policy config.RecoveryPolicy, recoverer Recoverer) (*Watchdog, *recorder) {
+	policy.Service = "Spooler"
+	cfg := &config.Config{}
+	cfg.Commands.ScriptsDirectory = "C:\\Scripts"
+	cfg.Tasks.ServiceCheck.Recovery = []config.RecoveryPolicy{policy}
+	rec := &recorder{}
+	return New(zap.NewNop(), recoverer, cfg, rec.publish, rec.alert), rec
+}
+
+// status builds a single service check result
+func status(state string) []tasks.ServiceStatus {
+	return []tasks.ServiceStatus{{Name: "Spooler", Status: state}, {Name: "Other", Status: "Stopped"}}
+}
+
+// TestWatchdogBackoffAndBudget tests failed_checks, exponential backoff and exhaustion
+func TestWatchdogBackoffAndBudget(t *testing.T) {
+	recoverer := &fakeRecoverer{}
+	w, rec := newTestWatchdog(config.RecoveryPolicy{
+		FailedChecks: 2,
+		Backoff:      time.Minute,
+		MaxBackoff:   3 * time.Minute,
+		MaxRestarts:  3,
+		Window:       time.Hour,
+	}, recoverer)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// want lists event:attempt, with the next attempt for failures
+	steps := []struct {
+		offset time.Duration
+		want   []string
+	}{
+		{0, nil}, // first failed check
+		{30 * time.Second, []string{"recovery_attempt:1", "recovery_failed:1 next 2025-01-01T00:01:30Z"}}, // backoff 1m
+		{time.Minute, nil}, // backoff
+		{90 * time.Second, []string{"recovery_attempt:2", "recovery_failed:2 next 2025-01-01T00:03:30Z"}}, // backoff 2m
+		{3 * time.Minute, nil}, // backoff
+		{4 * time.Minute, []string{"recovery_attempt:3", "recovery_failed:3 next 2025-01-01T00:07:00Z"}}, // backoff 3m (capped)
+		{5 * time.Minute, nil},
+		{7 * time.Minute, []string{"recovery_exhausted:3"}}, // budget used up
+		{8 * time.Minute, nil},                              // no more attempts
+	}
+
+	for i, step := range steps {
+		w.Observe(status("Stopped"), start.Add(step.offset))
+		w.Wait()
+		var got []string
+		for _, e := range rec.take() {
+			desc := fmt.Sprintf("%s:%d", e.Event, e.Attempt)
+			if e.NextAttempt != "" {
+				desc += " next " + e.NextAttempt
+			}
+			got = append(got, desc)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("step %d (%v): events = %v, want %v", i, step.offset, got, step.want)
+		}
+	}
+
+	if len(rec.alerts) != 1 || rec.alerts[0].Event != alerts.EventFiring || rec.alerts[0].Target != "Spooler" || rec.alerts[0].Rule != AlertRule {
+		t.Fatalf("alerts = %+v, want one firing service_recovery alert", rec.alerts)
+	}
+	if active := w.Active(); len(active) != 1 || !reflect.DeepEqual(active[0], rec.alerts[0].Alert) {
+		t.Fatalf("Active() = %+v, want the firing alert %+v", active, rec.alerts[0].Alert)
+	}
+
+	// Running again (fixed by hand) resolves the alert and re-arms recovery
+	w.Observe(status("Running"), start.Add(10*time.Minute))
+	if len(rec.alerts) != 2 || rec.alerts[1].Event != alerts.EventResolved {
+		t.Fatalf("alerts = %+v, want resolved", rec.alerts)
+	}
+	if active := w.Active(); len(active) != 0 {
+		t.Errorf("Active() = %+v after recovery, want none", active)
+	}
+	if calls := len(recoverer.calls); calls != 3 {
+		t.Errorf("recover calls = %d, want 3", calls)
+	}
+}
+
+// TestWatchdogOutcome tests the published outcome, scripts and window reset
+func TestWatchdogOutcome(t *testing.T) {
+	recoverer := &fakeRecoverer{recoverOK: true}
+	w, rec := newTestWatchdog(config.RecoveryPolicy{
+		FailedChecks: 1,
+		MaxRestarts:  1,
+		Window:       10 * time.Minute,
+		PreScript:    "before.ps1",
+		PostScript:   "after.ps1",
+	}, recoverer)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	w.Observe(status("StopPending"), start)
+	w.Wait()
+
+	rec.mu.Lock()
+	events := rec.events
+	rec.mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("events = %+v, want attempt and outcome", events)
+	}
+	outcome := events[1]
+	if outcome.Event != EventSucceeded || outcome.Status != "StopPending" || outcome.Attempt != 1 || outcome.MaxRestarts != 1 {
+		t.Errorf("outcome = %+v", outcome)
+	}
+	if outcome.PreScript == nil || outcome.PreScript.Script != "before.ps1" || outcome.PostScript == nil || outcome.NextAttempt != "" {
+		t.Errorf("outcome scripts = %+v / %+v", outcome.PreScript, outcome.PostScript)
+	}
+	want := []string{"script before.ps1", "recover Spooler", "script after.ps1"}
+	if len(recoverer.calls) != 3 || recoverer.calls[0] != want[0] || recoverer.calls[1] != want[1] || recoverer.calls[2] != want[2] {
+		t.Errorf("calls = %v, want %v", recoverer.calls, want)
+	}
+	rec.kinds()
+
+	// Running resets the failure count; the single restart is still in the window
+	w.Observe(status("Running"), start.Add(time.Minute))
+	w.Observe(status("Stopped"), start.Add(2*time.Minute))
+	if got := rec.kinds(); len(got) != 1 || got[0] != EventExhausted {
+		t.Fatalf("events = %v, want exhausted within the window", got)
+	}
+
+	// After a quiet window recovery is allowed again
+	w.Observe(status("Running"), start.Add(15*time.Minute))
+	w.Observe(status("Stopped"), start.Add(16*time.Minute))
+	w.Wait()
+	if got := rec.kinds(); len(got) != 2 || got[1] != EventSucceeded {
+		t.Fatalf("events = %v, want a new attempt after the window", got)
+	}
+}
+
+// TestWatchdogWithExecutor tests recovery through the Executor and fake service backend
+func TestWatchdogWithExecutor(t *testing.T) {
+	services := tasks.NewFakeServiceManager()
+	services.PendingQueries = 0
+	services.Add("Spooler", tasks.StateStopped)
+	executor := tasks.NewExecutorWithServices(zap.NewNop(), 30*time.Second, services)
+
+	w, rec := newTestWatchdog(config.RecoveryPolicy{FailedChecks: 1}, executor)
+	w.Observe(status(tasks.StateStopped), time.Now())
+	w.Wait()
+
+	if services.State("Spooler") != tasks.StateRunning {
+		t.Errorf("state = %s, want Running", services.State("Spooler"))
+	}
+	if got := rec.kinds(); len(got) != 2 || got[1] != EventSucceeded {
+		t.Errorf("events = %v, want attempt and success", got)
+	}
+}
+
+// TestWatchdogEmitsUnlocked tests that publish and alert run without the watchdog lock held
+func TestWatchdogEmitsUnlocked(t *testing.T) {
+	w, rec := newTestWatchdog(config.RecoveryPolicy{FailedChecks: 1, MaxRestarts: 1}, &fakeRecoverer{})
+	locked := false
+	check := func() {
+		if w.mu.TryLock() {
+			w.mu.Unlock()
+		} else {
+			locked = true
+		}
+	}
+	w.publish = func(e Event) { check(); rec.publish(e) }
+	w.alert = func(e alerts.Event) { check(); rec.alert(e) }
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.Observe(status("Stopped"), start)
+	w.Wait()
+	w.Observe(status("Stopped"), start.Add(10*time.Minute))
+	w.Observe(status("Running"), start.Add(20*time.Minute))
+
+	if got := rec.kinds(); len(got) != 3 || got[2] != EventExhausted {
+		t.Fatalf("events = %v, want attempt, failure and exhaustion", got)
+	}
+	if len(rec.alerts) != 2 {
+		t.Fatalf("alerts = %+v, want firing and resolved", rec.alerts)
+	}
+	if locked {
+		t.Error("publish or alert called with the watchdog lock held")
+	}
+}
+
+// TestWatchdogServiceCase tests policies match services like service_check:
+// case-insensitively on Windows, exactly elsewhere
+func TestWatchdogServiceCase(t *testing.T) {
+	w, rec := newTestWatchdog(config.RecoveryPolicy{FailedChecks: 1}, &fakeRecoverer{recoverOK: true})
+
+	w.Observe([]tasks.ServiceStatus{{Name: "SPOOLER", Status: "Stopped"}}, time.Now())
+	w.Wait()
+	got := rec.kinds()
+	if recovered := len(got) > 0; recovered != (runtime.GOOS == "windows") {
+		t.Errorf("events = %v, want a recovery only on Windows", got)
+	}
+}
+
+// TestNilWatchdog tests that a nil watchdog is a no-op
+func TestNilWatchdog(t *testing.T) {
+	var w *Watchdog
+	w.Observe(status("Stopped"), time.Now())
+	w.Wait()
+	if active := w.Active(); active != nil {
+		t.Errorf("Active() = %+v, want nil", active)
+	}
+}